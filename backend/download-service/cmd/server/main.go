@@ -12,9 +12,13 @@ import (
 
     "download-service/internal/cache"
     libclient "download-service/internal/clients/library"
+    tierclient "download-service/internal/clients/tier"
+    "download-service/internal/clients/cdn"
     s3client "download-service/internal/clients/s3"
     "download-service/internal/handlers"
+    intramw "download-service/internal/middleware"
     "download-service/internal/database"
+    "download-service/internal/models"
     "download-service/internal/repository"
     "download-service/internal/router"
     "download-service/internal/services"
@@ -50,30 +54,206 @@ func main() {
         CBCooldown:          time.Duration(cfg.LibraryCBCooldownMs) * time.Millisecond,
     })
     // Wrap with instrumentation for logging and monitoring
-    lib := libclient.NewInstrumentedClient(baseLibClient, logg)
-
-    // Initialize S3 client
-    s3, err := s3client.NewClient(context.Background(), s3client.Options{
-        Endpoint:        cfg.S3Endpoint,
-        Region:          cfg.S3Region,
-        AccessKeyID:     cfg.S3AccessKeyID,
-        SecretAccessKey: cfg.S3SecretAccessKey,
-        Bucket:          cfg.S3Bucket,
-    })
-    if err != nil {
-        logg.Fatalf("s3 client failed: %v", err)
+    var lib libclient.Interface = libclient.NewInstrumentedClient(baseLibClient, logg)
+    // Cache ownership answers in Redis, outside the instrumentation so only real
+    // requests are measured
+    if cfg.LibraryCacheEnabled {
+        lib = libclient.NewCachedClient(lib, libclient.CachedOptions{
+            Store:       libclient.NewRedisCacheStore(rdb),
+            OwnedTTL:    time.Duration(cfg.LibraryCacheOwnedSec) * time.Second,
+            NotOwnedTTL: time.Duration(cfg.LibraryCacheDeniedSec) * time.Second,
+            StaleGrace:  time.Duration(cfg.LibraryCacheStaleSec) * time.Second,
+        }, logg)
+    }
+
+    // Initialize storage: S3, or a local directory for installs without S3
+    var storage s3client.Interface
+    var fsStorage *s3client.FSClient
+    if cfg.StorageBackend == "fs" {
+        fsStorage, err = s3client.NewFSClient(s3client.FSOptions{
+            Root:       cfg.StorageFSRoot,
+            SigningKey: []byte(cfg.StorageFSSigningKey),
+            BaseURL:    cfg.StoragePublicBaseURL,
+        })
+        if err != nil {
+            logg.Fatalf("filesystem storage failed: %v", err)
+        }
+        storage = fsStorage
+    } else if cfg.StorageOrigins == "" {
+        storage, err = s3client.NewClient(context.Background(), s3client.Options{
+            Endpoint:        cfg.S3Endpoint,
+            Region:          cfg.S3Region,
+            AccessKeyID:     cfg.S3AccessKeyID,
+            SecretAccessKey: cfg.S3SecretAccessKey,
+            Bucket:          cfg.S3Bucket,
+        })
+        if err != nil {
+            logg.Fatalf("s3 client failed: %v", err)
+        }
+    } else {
+        // Validate has already checked the origin spec.
+        specs, _ := config.ParseOrigins(cfg.StorageOrigins)
+        origins := make([]s3client.Origin, 0, len(specs))
+        for _, o := range specs {
+            endpoint := o.Endpoint
+            if endpoint == "" {
+                endpoint = cfg.S3Endpoint
+            }
+            client, err := s3client.NewClient(context.Background(), s3client.Options{
+                Endpoint:        endpoint,
+                Region:          o.Region,
+                AccessKeyID:     cfg.S3AccessKeyID,
+                SecretAccessKey: cfg.S3SecretAccessKey,
+                Bucket:          o.Bucket,
+            })
+            if err != nil {
+                logg.Fatalf("s3 client for origin %s failed: %v", o.Name, err)
+            }
+            origins = append(origins, s3client.Origin{Name: o.Name, Region: o.Region, Weight: o.Weight, Storage: client})
+        }
+        storage, err = s3client.NewMultiClient(s3client.MultiOptions{
+            Origins:     origins,
+            LocalRegion: cfg.S3Region,
+            CBThreshold: cfg.StorageOriginCBThreshold,
+            CBCooldown:  time.Duration(cfg.StorageOriginCBCooldownMs) * time.Millisecond,
+        })
+        if err != nil {
+            logg.Fatalf("storage origins failed: %v", err)
+        }
     }
 
     // Wire repositories and services
     dlRepo := repository.NewDownloadRepository(db)
-    stream := services.NewStreamService()
-    fileSvc := services.NewFileService(s3)
-    dlSvc := services.NewDownloadService(db, rdb, dlRepo, stream, lib, logg)
+    dlFileRepo := repository.NewDownloadFileRepository(db)
+    dlEventRepo := repository.NewDownloadEventRepository(db)
+    auditRepo := repository.NewAuditRepository(db)
+    var sink services.Sink = services.DiscardSink{}
+    if cfg.DownloadStagingDir != "" {
+        sink = services.DirSink{Root: cfg.DownloadStagingDir}
+    }
+    stream := services.NewStreamService(storage, sink)
+    stream.ConfigureBandwidth(services.BandwidthOptions{
+        NodeBytesPerSecond: cfg.NodeBandwidthBps,
+        UserBytesPerSecond: cfg.UserBandwidthBps,
+    })
+    fileSvc := services.NewFileService(storage)
+    // Validate has already checked the TTL spec.
+    urlTTLs, _ := config.ParseURLTTLs(cfg.DownloadURLTTLs)
+    urlOpts := services.URLOptions{TTL: time.Duration(cfg.DownloadURLTTLSec) * time.Second}
+    for _, t := range urlTTLs {
+        urlOpts.SizeTTLs = append(urlOpts.SizeTTLs, services.SizeTTL{MaxSize: t.MaxSize, TTL: time.Duration(t.Seconds) * time.Second})
+    }
+    if cfg.DownloadURLSigner == "cdn" {
+        signer, err := cdn.NewSigner(cdn.Options{
+            BaseURL:       cfg.CDNBaseURL,
+            Secret:        []byte(cfg.CDNSigningKey),
+            PathPrefix:    cfg.CDNPathPrefix,
+            SignDirectory: cfg.CDNSignDirectory,
+        })
+        if err != nil {
+            logg.Fatalf("cdn signer failed: %v", err)
+        }
+        urlOpts.Signer = signer
+    }
+    fileSvc.ConfigureURLs(urlOpts)
+    dlSvc := services.NewDownloadService(db, rdb, dlRepo, dlFileRepo, dlEventRepo, stream, fileSvc, lib, logg)
+    dlSvc.ConfigureCluster(services.ClusterOptions{
+        InstanceID: cfg.InstanceID,
+        LeaseTTL:   time.Duration(cfg.DownloadLeaseTTLSec) * time.Second,
+        Leases:     cache.NewRedisLeases(rdb),
+        Commands:   cache.NewRedisCommandBus(rdb),
+        Events:     cache.NewRedisEventLog(rdb),
+    })
+    dlSvc.ConfigureQueue(cfg.MaxActiveDownloads)
+    dlSvc.ConfigureEntitlements(services.EntitlementOptions{
+        CacheTTL:    time.Duration(cfg.EntitlementCacheTTLSec) * time.Second,
+        Revocations: cache.NewRedisRevocations(rdb),
+    })
+    // Validate has already checked the tier spec.
+    tiers, _ := config.ParseTiers(cfg.DownloadTiers)
+    tierOpts := services.TierOptions{Default: cfg.DefaultTier, Limits: make(map[string]services.TierLimits, len(tiers))}
+    for _, t := range tiers {
+        tierOpts.Limits[t.Name] = services.TierLimits{MaxBytesPerSecond: t.MaxBytesPerSecond, MaxActive: t.MaxActive, Priority: t.Priority}
+    }
+    if cfg.TierServiceURL != "" {
+        tierOpts.Provider = tierclient.NewClient(tierclient.Options{
+            BaseURL:             cfg.TierServiceURL,
+            InternalHeaderName:  cfg.LibraryInternalHeader,
+            InternalHeaderValue: cfg.TierInternalToken,
+        })
+    }
+    dlSvc.ConfigureTiers(tierOpts)
+    if cfg.OffPeakHours != "" {
+        from, to, _ := config.ParseHours(cfg.OffPeakHours)
+        dlSvc.ConfigureSchedule(models.HourWindow{From: from, To: to})
+    }
+    tokenKey, _ := config.ParseEd25519Key(cfg.DownloadTokenEd25519Key)
+    dlSvc.ConfigureTokens(services.TokenOptions{
+        Secret:     []byte(cfg.DownloadTokenSecret),
+        PrivateKey: tokenKey,
+        TTL:        time.Duration(cfg.DownloadTokenTTLSec) * time.Second,
+        BaseURL:    cfg.DownloadEdgeBaseURL,
+    })
+
+    adminSvc := services.NewAdminService(dlSvc, auditRepo, logg)
+    publishSvc := services.NewPublishService(storage, fileSvc, logg)
+    publishSvc.ConfigurePublishing(services.PublishOptions{
+        Uploads:    cache.NewRedisUploads(rdb),
+        StaleAfter: time.Duration(cfg.PublishUploadStaleSec) * time.Second,
+    })
+
+    // Reconcile downloads left behind by a previous run before serving traffic,
+    // then serve commands routed from other replicas, heartbeat leases and adopt
+    // downloads of dead replicas.
+    if res, err := dlSvc.RecoverDownloads(context.Background()); err != nil {
+        logg.Printf("download recovery failed: %v", err)
+    } else {
+        logg.Printf("download recovery: resumed=%d paused=%d failed=%d skipped=%d", res.Resumed, res.Paused, res.Failed, res.Skipped)
+    }
+    leaseCtx, stopLeases := context.WithCancel(context.Background())
+    go func() {
+        if err := dlSvc.RunCoordinator(leaseCtx); err != nil {
+            logg.Fatalf("download coordinator failed: %v", err)
+        }
+    }()
+    go publishSvc.RunUploadReaper(leaseCtx, time.Hour)
 
     // Create handlers
     h := handlers.NewDownloadHandler(dlSvc, rdb)
     fh := handlers.NewFileHandler(fileSvc, dlSvc)
     hh := handlers.NewHealthHandler(db, rdb, logg)
+    ah := handlers.NewAdminHandler(adminSvc)
+    eh := handlers.NewEdgeHandler(fileSvc, dlSvc)
+    enth := handlers.NewEntitlementHandler(dlSvc)
+    ph := handlers.NewPublishHandler(publishSvc)
+    var sh *handlers.StorageHandler
+    if fsStorage != nil {
+        sh = handlers.NewStorageHandler(fsStorage)
+    }
+
+    // Public keys for RS256/ES256 tokens. A failed first load is retried when the
+    // first token arrives, so an auth-service outage does not block startup.
+    var authKeys intramw.KeySource
+    if cfg.AuthJwksURL != "" || cfg.AuthJwksFile != "" {
+        jwks := intramw.NewJWKS(intramw.JWKSOptions{
+            URL:     cfg.AuthJwksURL,
+            File:    cfg.AuthJwksFile,
+            Refresh: time.Duration(cfg.AuthJwksRefreshSec) * time.Second,
+            OnKeyError: func(kid string, err error) {
+                logg.Printf("JWKS key %q skipped: %v", kid, err)
+            },
+        })
+        if err := jwks.Refresh(context.Background()); err != nil {
+            logg.Printf("initial JWKS load failed: %v", err)
+        }
+        go jwks.Run(leaseCtx, func(err error) { logg.Printf("JWKS refresh failed: %v", err) })
+        authKeys = jwks
+    }
+
+    var rateLimiter intramw.Limiter
+    if cfg.RateLimitBackend == "redis" {
+        rateLimiter = cache.NewRedisRateLimiter(rdb)
+    }
 
     // Setup router with all middleware and routes
     r := router.SetupRouter(router.RouterOptions{
@@ -82,14 +262,21 @@ func main() {
         DownloadHandler:     h,
         FileHandler:         fh,
         HealthHandler:       hh,
+        AdminHandler:        ah,
+        EdgeHandler:         eh,
+        EntitlementHandler:  enth,
+        StorageHandler:      sh,
+        PublishHandler:      ph,
         EnableProfiling:     cfg.Env != "production", // Enable profiling in dev/test
         EnableMetrics:       true,
         CORSAllowedOrigins:  []string{}, // Will use production defaults
         CORSAllowedMethods:  []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-        CORSAllowedHeaders:  []string{"Origin", "Content-Type", "Authorization", "X-Request-ID", "X-User-Id"},
-        CORSExposeHeaders:   []string{"X-Request-ID"},
+        CORSAllowedHeaders:  []string{"Origin", "Content-Type", "Authorization", "X-Request-ID", "X-User-Id", "X-Checksum-SHA256"},
+        CORSExposeHeaders:   []string{"X-Request-ID", "Retry-After", "X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset"},
         CORSAllowCredentials: false,
         CORSMaxAge:          12 * time.Hour,
+        AuthKeys:            authKeys,
+        RateLimiter:         rateLimiter,
     })
 
     srv := &http.Server{
@@ -119,6 +306,9 @@ func main() {
     if err := srv.Shutdown(ctx); err != nil {
         logg.Fatalf("server forced to shutdown: %v", err)
     }
+    // Hand running transfers over to the remaining replicas.
+    stopLeases()
+    dlSvc.ReleaseLeases(ctx)
 
     logg.Println("Server exiting")
 }
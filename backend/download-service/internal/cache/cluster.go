@@ -0,0 +1,141 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	redis "github.com/redis/go-redis/v9"
+)
+
+// Command operations relayed to the replica that owns a download.
+const (
+	CommandPause  = "pause"
+	CommandResume = "resume"
+	CommandCancel = "cancel"
+	CommandSpeed  = "speed"
+)
+
+// Command asks the owning replica to act on one of its transfer sessions.
+type Command struct {
+	Op             string `json:"op"`
+	DownloadID     string `json:"downloadId"`
+	BytesPerSecond int64  `json:"bytesPerSecond,omitempty"`
+}
+
+func downloadOwnerKey(id string) string { return fmt.Sprintf("dl:%s:owner", id) }
+
+func commandChannel(owner string) string { return fmt.Sprintf("dl:commands:%s", owner) }
+
+// claimLease sets the owner if the lease is free or already held by the same owner.
+// A missing key is claimed as well, so leases survive a Redis restart.
+var claimLease = redis.NewScript(`
+local cur = redis.call('GET', KEYS[1])
+if (not cur) or cur == ARGV[1] then
+  redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+  return 1
+end
+return 0`)
+
+var releaseLease = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+  return redis.call('DEL', KEYS[1])
+end
+return 0`)
+
+// RedisLeases stores download ownership leases as expiring Redis keys.
+type RedisLeases struct {
+	rdb *redis.Client
+}
+
+func NewRedisLeases(rdb *redis.Client) *RedisLeases { return &RedisLeases{rdb: rdb} }
+
+// Acquire takes the lease for owner unless another replica holds a live one.
+func (l *RedisLeases) Acquire(ctx context.Context, downloadID, owner string, ttl time.Duration) (bool, error) {
+	n, err := claimLease.Run(ctx, l.rdb, []string{downloadOwnerKey(downloadID)}, owner, ttl.Milliseconds()).Int()
+	return n == 1, err
+}
+
+// Renew extends owner's lease; false means another replica has taken it over.
+func (l *RedisLeases) Renew(ctx context.Context, downloadID, owner string, ttl time.Duration) (bool, error) {
+	return l.Acquire(ctx, downloadID, owner, ttl)
+}
+
+// Release drops the lease if owner still holds it.
+func (l *RedisLeases) Release(ctx context.Context, downloadID, owner string) error {
+	return releaseLease.Run(ctx, l.rdb, []string{downloadOwnerKey(downloadID)}, owner).Err()
+}
+
+// Owners returns the live lease owner of each download that has one.
+func (l *RedisLeases) Owners(ctx context.Context, downloadIDs []string) (map[string]string, error) {
+	out := make(map[string]string, len(downloadIDs))
+	if len(downloadIDs) == 0 {
+		return out, nil
+	}
+	keys := make([]string, len(downloadIDs))
+	for i, id := range downloadIDs {
+		keys[i] = downloadOwnerKey(id)
+	}
+	vals, err := l.rdb.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for i, v := range vals {
+		if owner, ok := v.(string); ok && owner != "" {
+			out[downloadIDs[i]] = owner
+		}
+	}
+	return out, nil
+}
+
+// RedisCommandBus delivers commands over a pub/sub channel per replica.
+type RedisCommandBus struct {
+	rdb *redis.Client
+}
+
+func NewRedisCommandBus(rdb *redis.Client) *RedisCommandBus { return &RedisCommandBus{rdb: rdb} }
+
+// Publish sends cmd to the replica named owner.
+func (b *RedisCommandBus) Publish(ctx context.Context, owner string, cmd Command) error {
+	payload, err := json.Marshal(cmd)
+	if err != nil {
+		return err
+	}
+	return b.rdb.Publish(ctx, commandChannel(owner), payload).Err()
+}
+
+// Subscribe delivers commands addressed to owner until ctx is cancelled.
+func (b *RedisCommandBus) Subscribe(ctx context.Context, owner string) (<-chan Command, error) {
+	sub := b.rdb.Subscribe(ctx, commandChannel(owner))
+	if _, err := sub.Receive(ctx); err != nil {
+		_ = sub.Close()
+		return nil, err
+	}
+	out := make(chan Command)
+	go func() {
+		defer close(out)
+		defer sub.Close()
+		msgs := sub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-msgs:
+				if !ok {
+					return
+				}
+				var cmd Command
+				if err := json.Unmarshal([]byte(msg.Payload), &cmd); err != nil {
+					continue
+				}
+				select {
+				case out <- cmd:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out, nil
+}
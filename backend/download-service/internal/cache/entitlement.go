@@ -0,0 +1,39 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	redis "github.com/redis/go-redis/v9"
+)
+
+func revocationKey(userID, gameID string) string {
+	return fmt.Sprintf("dl:revoked:%s:%s", userID, gameID)
+}
+
+// RedisRevocations records entitlement revocations as expiring Redis keys, so
+// every replica sees them.
+type RedisRevocations struct {
+	rdb *redis.Client
+}
+
+func NewRedisRevocations(rdb *redis.Client) *RedisRevocations { return &RedisRevocations{rdb: rdb} }
+
+// Revoke records that the user lost the game at the given time, for ttl.
+func (r *RedisRevocations) Revoke(ctx context.Context, userID, gameID string, at time.Time, ttl time.Duration) error {
+	return r.rdb.Set(ctx, revocationKey(userID, gameID), at.UnixMilli(), ttl).Err()
+}
+
+// RevokedAt returns when the user lost the game, if that is still recorded.
+func (r *RedisRevocations) RevokedAt(ctx context.Context, userID, gameID string) (time.Time, bool, error) {
+	ms, err := r.rdb.Get(ctx, revocationKey(userID, gameID)).Int64()
+	if errors.Is(err, redis.Nil) {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return time.UnixMilli(ms), true, nil
+}
@@ -0,0 +1,115 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	redis "github.com/redis/go-redis/v9"
+)
+
+// Download event types pushed to progress subscribers.
+const (
+	EventProgress = "progress"
+	EventStatus   = "status"
+	EventError    = "error"
+)
+
+// DownloadEvent is one entry of a download's event history. ID is assigned by the
+// log on append and is what subscribers resume from.
+type DownloadEvent struct {
+	ID             string `json:"-"`
+	Type           string `json:"type"`
+	DownloadID     string `json:"downloadId"`
+	UserID         string `json:"userId"`
+	Status         string `json:"status"`
+	Progress       int    `json:"progress"`
+	DownloadedSize int64  `json:"downloadedSize"`
+	TotalSize      int64  `json:"totalSize"`
+	Speed          int64  `json:"speed"`
+	FileID         string `json:"fileId,omitempty"`
+	Error          string `json:"error,omitempty"`
+	AtUnixMilli    int64  `json:"at"`
+}
+
+// DownloadEventsKey is the event stream of a single download.
+func DownloadEventsKey(downloadID string) string { return fmt.Sprintf("dl:%s:events", downloadID) }
+
+// UserDownloadEventsKey is the event stream of every download of a user.
+func UserDownloadEventsKey(userID string) string { return fmt.Sprintf("user:%s:dl:events", userID) }
+
+const (
+	eventStreamMaxLen = 1000
+	eventStreamTTL    = 24 * time.Hour
+	eventReadCount    = 100
+)
+
+// RedisEventLog keeps download events in capped Redis streams so any replica can
+// serve a subscriber and a reconnecting client can replay what it missed.
+type RedisEventLog struct {
+	rdb *redis.Client
+}
+
+func NewRedisEventLog(rdb *redis.Client) *RedisEventLog { return &RedisEventLog{rdb: rdb} }
+
+// Append adds ev to each of the given streams.
+func (l *RedisEventLog) Append(ctx context.Context, streams []string, ev DownloadEvent) error {
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	pipe := l.rdb.Pipeline()
+	for _, stream := range streams {
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: stream,
+			MaxLen: eventStreamMaxLen,
+			Approx: true,
+			Values: map[string]interface{}{"event": payload},
+		})
+		pipe.Expire(ctx, stream, eventStreamTTL)
+	}
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// Last returns the ID of the newest event in stream, or "0-0" when it is empty.
+func (l *RedisEventLog) Last(ctx context.Context, stream string) (string, error) {
+	msgs, err := l.rdb.XRevRangeN(ctx, stream, "+", "-", 1).Result()
+	if err != nil {
+		return "", err
+	}
+	if len(msgs) == 0 {
+		return "0-0", nil
+	}
+	return msgs[0].ID, nil
+}
+
+// Read returns events of stream newer than after, waiting up to block for one to arrive.
+func (l *RedisEventLog) Read(ctx context.Context, stream, after string, block time.Duration) ([]DownloadEvent, error) {
+	res, err := l.rdb.XRead(ctx, &redis.XReadArgs{
+		Streams: []string{stream, after},
+		Count:   eventReadCount,
+		Block:   block,
+	}).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var out []DownloadEvent
+	for _, s := range res {
+		for _, msg := range s.Messages {
+			raw, _ := msg.Values["event"].(string)
+			var ev DownloadEvent
+			if err := json.Unmarshal([]byte(raw), &ev); err != nil {
+				continue
+			}
+			ev.ID = msg.ID
+			out = append(out, ev)
+		}
+	}
+	return out, nil
+}
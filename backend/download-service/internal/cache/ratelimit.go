@@ -0,0 +1,75 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RateQuota allows Rate requests per second on average and bursts of up to Burst.
+type RateQuota struct {
+	Rate  float64
+	Burst int
+}
+
+// RateDecision is the outcome of spending requests against a quota.
+type RateDecision struct {
+	Allowed    bool
+	Remaining  int           // requests that could still be made right now
+	RetryAfter time.Duration // until the request would be allowed; 0 when it was
+	ResetAfter time.Duration // until the full burst is available again
+}
+
+func rateLimitKey(key string) string { return fmt.Sprintf("ratelimit:%s", key) }
+
+// gcra spends ARGV[3] requests of a quota with an emission interval of ARGV[1]
+// microseconds and a burst of ARGV[2]. The key holds the theoretical arrival time
+// of the next request and expires once the burst is refilled. Redis' own clock is
+// used so replicas with skewed clocks agree.
+var gcra = redis.NewScript(`
+local interval = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local cost = tonumber(ARGV[3])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+local tat = tonumber(redis.call('GET', KEYS[1])) or now
+if tat < now then
+  tat = now
+end
+local window = burst * interval
+local new_tat = tat + cost * interval
+local diff = now - (new_tat - window)
+if diff < 0 then
+  return {0, math.floor((now - (tat - window)) / interval), math.ceil(-diff), math.ceil(tat - now)}
+end
+-- Redis rejects PX 0, which a sub-millisecond interval or a zero cost would give.
+redis.call('SET', KEYS[1], string.format('%.0f', new_tat), 'PX', math.max(1, math.ceil((new_tat - now) / 1000)))
+return {1, math.floor(diff / interval), 0, math.ceil(new_tat - now)}`)
+
+// RedisRateLimiter enforces rate quotas shared by every replica using the generic
+// cell rate algorithm, which needs a single counter per key.
+type RedisRateLimiter struct {
+	rdb *redis.Client
+}
+
+func NewRedisRateLimiter(rdb *redis.Client) *RedisRateLimiter { return &RedisRateLimiter{rdb: rdb} }
+
+// Allow spends cost requests of key's quota if they are available.
+func (l *RedisRateLimiter) Allow(ctx context.Context, key string, q RateQuota, cost int) (RateDecision, error) {
+	interval := float64(time.Second/time.Microsecond) / q.Rate
+	res, err := gcra.Run(ctx, l.rdb, []string{rateLimitKey(key)}, interval, q.Burst, cost).Int64Slice()
+	if err != nil {
+		return RateDecision{}, err
+	}
+	if len(res) != 4 {
+		return RateDecision{}, fmt.Errorf("rate limit script returned %d values", len(res))
+	}
+	return RateDecision{
+		Allowed:    res[0] == 1,
+		Remaining:  int(res[1]),
+		RetryAfter: time.Duration(res[2]) * time.Microsecond,
+		ResetAfter: time.Duration(res[3]) * time.Microsecond,
+	}, nil
+}
@@ -205,4 +205,133 @@ func TestDownloadStatusValueSerialization(t *testing.T) {
 	assert.Equal(t, status.DownloadedSize, retrieved.DownloadedSize)
 	assert.Equal(t, status.TotalSize, retrieved.TotalSize)
 	assert.Equal(t, status.Speed, retrieved.Speed)
-}
\ No newline at end of file
+}
+func TestRedisRateLimiter(t *testing.T) {
+	client := setupTestRedis(t)
+	ctx := context.Background()
+
+	// Skip if Redis is not available
+	if err := Ping(ctx, client); err != nil {
+		t.Skip("Redis not available, skipping test")
+	}
+
+	limiter := NewRedisRateLimiter(client)
+	q := RateQuota{Rate: 1, Burst: 3}
+
+	d, err := limiter.Allow(ctx, "user-1", q, 2)
+	require.NoError(t, err)
+	assert.True(t, d.Allowed)
+	assert.Equal(t, 1, d.Remaining)
+	assert.InDelta(t, 2*time.Second, d.ResetAfter, float64(100*time.Millisecond))
+
+	d, err = limiter.Allow(ctx, "user-1", q, 2)
+	require.NoError(t, err)
+	assert.False(t, d.Allowed, "only one request is left")
+	assert.Equal(t, 1, d.Remaining)
+	assert.InDelta(t, time.Second, d.RetryAfter, float64(100*time.Millisecond))
+
+	// Keys are limited independently.
+	d, err = limiter.Allow(ctx, "user-2", q, 3)
+	require.NoError(t, err)
+	assert.True(t, d.Allowed)
+	assert.Equal(t, 0, d.Remaining)
+
+	// Quotas whose key would expire in under a millisecond are still stored.
+	fast := RateQuota{Rate: 1e6, Burst: 1}
+	for _, cost := range []int{0, 1} {
+		d, err = limiter.Allow(ctx, "user-3", fast, cost)
+		require.NoError(t, err)
+		assert.True(t, d.Allowed)
+	}
+}
+
+func TestRedisRevocations(t *testing.T) {
+	client := setupTestRedis(t)
+	ctx := context.Background()
+
+	// Skip if Redis is not available
+	if err := Ping(ctx, client); err != nil {
+		t.Skip("Redis not available, skipping test")
+	}
+
+	revocations := NewRedisRevocations(client)
+	_, ok, err := revocations.RevokedAt(ctx, "user-1", "game-1")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	at := time.Now()
+	require.NoError(t, revocations.Revoke(ctx, "user-1", "game-1", at, time.Minute))
+	got, ok, err := revocations.RevokedAt(ctx, "user-1", "game-1")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, at.UnixMilli(), got.UnixMilli())
+
+	ttl, err := client.TTL(ctx, revocationKey("user-1", "game-1")).Result()
+	require.NoError(t, err)
+	assert.InDelta(t, time.Minute, ttl, float64(2*time.Second))
+}
+
+func TestRedisUploads(t *testing.T) {
+	client := setupTestRedis(t)
+	ctx := context.Background()
+
+	// Skip if Redis is not available
+	if err := Ping(ctx, client); err != nil {
+		t.Skip("Redis not available, skipping test")
+	}
+
+	uploads := NewRedisUploads(client)
+	old := &BuildUpload{
+		ID: "u1", GameID: "g1", Version: "1.0", CreatedBy: "user-1", PartSize: 5 << 20,
+		Files:     []UploadFile{{Path: "bin/game", Size: 10, ObjectKey: "games/g1/versions/1.0/files/bin/game", UploadID: "mp-1"}},
+		CreatedAt: time.Now().Add(-2 * time.Hour),
+	}
+	fresh := &BuildUpload{ID: "u2", GameID: "g1", Version: "1.1", CreatedAt: time.Now()}
+	require.NoError(t, uploads.Create(ctx, old, time.Minute))
+	require.NoError(t, uploads.Create(ctx, fresh, time.Minute))
+
+	got, ok, err := uploads.Get(ctx, "u1")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, old.Files, got.Files)
+
+	require.NoError(t, uploads.PutPart(ctx, "u1", UploadedPart{File: 0, Number: 1, Size: 10, ETag: "a"}, time.Minute))
+	require.NoError(t, uploads.PutPart(ctx, "u1", UploadedPart{File: 0, Number: 1, Size: 10, ETag: "b"}, time.Minute))
+	parts, err := uploads.Parts(ctx, "u1")
+	require.NoError(t, err)
+	require.Len(t, parts, 1)
+	assert.Equal(t, "b", parts[0].ETag, "a part sent again replaces the first")
+
+	stale, err := uploads.CreatedBefore(ctx, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"u1"}, stale)
+
+	require.NoError(t, uploads.Delete(ctx, "u1"))
+	_, ok, err = uploads.Get(ctx, "u1")
+	require.NoError(t, err)
+	assert.False(t, ok)
+	parts, err = uploads.Parts(ctx, "u1")
+	require.NoError(t, err)
+	assert.Empty(t, parts)
+	stale, err = uploads.CreatedBefore(ctx, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"u2"}, stale)
+
+	// One upload at a time completes a version.
+	client.Del(ctx, versionLockKey("g1", "1.1"))
+	ok, err = uploads.LockVersion(ctx, "g1", "1.1", "u2", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = uploads.LockVersion(ctx, "g1", "1.1", "u3", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	require.NoError(t, uploads.UnlockVersion(ctx, "g1", "1.1", "u3"), "only the holder unlocks")
+	ok, err = uploads.LockVersion(ctx, "g1", "1.1", "u3", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	require.NoError(t, uploads.UnlockVersion(ctx, "g1", "1.1", "u2"))
+	ok, err = uploads.LockVersion(ctx, "g1", "1.1", "u3", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	require.NoError(t, uploads.UnlockVersion(ctx, "g1", "1.1", "u3"))
+}
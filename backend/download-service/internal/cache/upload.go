@@ -0,0 +1,141 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	redis "github.com/redis/go-redis/v9"
+)
+
+// BuildUpload is a publisher's build upload in progress: one multipart upload
+// per non-empty file of the build.
+type BuildUpload struct {
+	ID        string       `json:"id"`
+	GameID    string       `json:"gameId"`
+	Version   string       `json:"version"`
+	CreatedBy string       `json:"createdBy"`
+	PartSize  int64        `json:"partSize"`
+	Files     []UploadFile `json:"files"`
+	CreatedAt time.Time    `json:"createdAt"`
+}
+
+// UploadFile is one file of a build upload.
+type UploadFile struct {
+	Path      string `json:"path"`
+	Size      int64  `json:"size"`
+	SHA256    string `json:"sha256"`
+	ObjectKey string `json:"objectKey"`
+	UploadID  string `json:"uploadId,omitempty"` // empty for empty files, which need no object
+}
+
+// UploadedPart is a stored part of one file of a build upload.
+type UploadedPart struct {
+	File   int    `json:"file"`
+	Number int32  `json:"number"`
+	Size   int64  `json:"size"`
+	ETag   string `json:"etag"`
+	SHA256 string `json:"sha256"` // hex digest
+}
+
+const uploadIndexKey = "publish:uploads"
+
+func uploadKey(id string) string      { return fmt.Sprintf("publish:upload:%s", id) }
+func uploadPartsKey(id string) string { return fmt.Sprintf("publish:upload:%s:parts", id) }
+func versionLockKey(gameID, version string) string {
+	return fmt.Sprintf("publish:version:%s:%s:lock", gameID, version)
+}
+
+// RedisUploads keeps build uploads in Redis so parts can arrive at any replica.
+// Uploads are indexed by creation time for the stale upload reaper.
+type RedisUploads struct {
+	rdb *redis.Client
+}
+
+func NewRedisUploads(rdb *redis.Client) *RedisUploads { return &RedisUploads{rdb: rdb} }
+
+func (s *RedisUploads) Create(ctx context.Context, u *BuildUpload, ttl time.Duration) error {
+	payload, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+	pipe := s.rdb.TxPipeline()
+	pipe.Set(ctx, uploadKey(u.ID), payload, ttl)
+	pipe.ZAdd(ctx, uploadIndexKey, redis.Z{Score: float64(u.CreatedAt.UnixMilli()), Member: u.ID})
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func (s *RedisUploads) Get(ctx context.Context, id string) (*BuildUpload, bool, error) {
+	raw, err := s.rdb.Get(ctx, uploadKey(id)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	var u BuildUpload
+	if err := json.Unmarshal(raw, &u); err != nil {
+		return nil, false, err
+	}
+	return &u, true, nil
+}
+
+// PutPart records a part, replacing an earlier upload of the same part.
+func (s *RedisUploads) PutPart(ctx context.Context, id string, p UploadedPart, ttl time.Duration) error {
+	payload, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	pipe := s.rdb.TxPipeline()
+	pipe.HSet(ctx, uploadPartsKey(id), fmt.Sprintf("%d/%d", p.File, p.Number), payload)
+	pipe.Expire(ctx, uploadPartsKey(id), ttl)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func (s *RedisUploads) Parts(ctx context.Context, id string) ([]UploadedPart, error) {
+	raw, err := s.rdb.HVals(ctx, uploadPartsKey(id)).Result()
+	if err != nil {
+		return nil, err
+	}
+	parts := make([]UploadedPart, 0, len(raw))
+	for _, r := range raw {
+		var p UploadedPart
+		if err := json.Unmarshal([]byte(r), &p); err != nil {
+			return nil, err
+		}
+		parts = append(parts, p)
+	}
+	return parts, nil
+}
+
+func (s *RedisUploads) Delete(ctx context.Context, id string) error {
+	pipe := s.rdb.TxPipeline()
+	pipe.Del(ctx, uploadKey(id), uploadPartsKey(id))
+	pipe.ZRem(ctx, uploadIndexKey, id)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// CreatedBefore returns the uploads started before t.
+func (s *RedisUploads) CreatedBefore(ctx context.Context, t time.Time) ([]string, error) {
+	return s.rdb.ZRangeByScore(ctx, uploadIndexKey, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: "(" + strconv.FormatInt(t.UnixMilli(), 10),
+	}).Result()
+}
+
+// LockVersion reserves completing gameID's version for owner until ttl passes
+// or UnlockVersion; false means another upload holds it.
+func (s *RedisUploads) LockVersion(ctx context.Context, gameID, version, owner string, ttl time.Duration) (bool, error) {
+	return s.rdb.SetNX(ctx, versionLockKey(gameID, version), owner, ttl).Result()
+}
+
+// UnlockVersion drops the reservation if owner still holds it.
+func (s *RedisUploads) UnlockVersion(ctx context.Context, gameID, version, owner string) error {
+	return releaseLease.Run(ctx, s.rdb, []string{versionLockKey(gameID, version)}, owner).Err()
+}
@@ -0,0 +1,73 @@
+package cdn
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var testSecret = []byte("0123456789abcdef0123456789abcdef")
+
+func TestSigner_SignsObjectPath(t *testing.T) {
+	s, err := NewSigner(Options{BaseURL: "https://cdn.example.com/", Secret: testSecret, PathPrefix: "/content/"})
+	require.NoError(t, err)
+
+	raw, err := s.SignURL(context.Background(), "games/g 1/game.zip", time.Minute, "eu-central-1")
+	require.NoError(t, err)
+	u, err := url.Parse(raw)
+	require.NoError(t, err)
+	require.Equal(t, "cdn.example.com", u.Host)
+	require.Equal(t, "/content/games/g%201/game.zip", u.EscapedPath())
+	require.Empty(t, u.Query().Get("token_path"))
+	require.NoError(t, s.Verify(u.EscapedPath(), u.Query()))
+
+	// The token is bound to the path, the expiry and the secret.
+	require.ErrorIs(t, s.Verify("/content/games/g%201/other.zip", u.Query()), ErrInvalidToken)
+	q := u.Query()
+	q.Set("expires", "9999999999")
+	require.ErrorIs(t, s.Verify(u.EscapedPath(), q), ErrInvalidToken)
+	other, err := NewSigner(Options{BaseURL: "https://cdn.example.com", Secret: []byte("fedcba9876543210fedcba9876543210")})
+	require.NoError(t, err)
+	require.ErrorIs(t, other.Verify(u.EscapedPath(), u.Query()), ErrInvalidToken)
+
+	expired, err := s.SignURL(context.Background(), "games/g1/game.zip", -time.Minute, "")
+	require.NoError(t, err)
+	u, _ = url.Parse(expired)
+	require.ErrorIs(t, s.Verify(u.EscapedPath(), u.Query()), ErrInvalidToken)
+}
+
+func TestSigner_TokenSeparatesPathAndExpiry(t *testing.T) {
+	s, err := NewSigner(Options{BaseURL: "https://cdn.example.com", Secret: testSecret})
+	require.NoError(t, err)
+
+	q := url.Values{"expires": {"7000000000"}, "token": {s.token("/games/g1/part1", "7000000000")}}
+	require.NoError(t, s.Verify("/games/g1/part1", q))
+
+	// Moving the path's last digit into the expiry must not carry the token over.
+	q.Set("expires", "17000000000")
+	require.ErrorIs(t, s.Verify("/games/g1/part", q), ErrInvalidToken)
+}
+
+func TestSigner_SignsDirectory(t *testing.T) {
+	s, err := NewSigner(Options{BaseURL: "https://cdn.example.com", Secret: testSecret, SignDirectory: true})
+	require.NoError(t, err)
+
+	raw, err := s.SignURL(context.Background(), "games/g1/game.zip", time.Minute, "")
+	require.NoError(t, err)
+	u, err := url.Parse(raw)
+	require.NoError(t, err)
+	require.Equal(t, "/games/g1/", u.Query().Get("token_path"))
+	require.NoError(t, s.Verify("/games/g1/game.zip", u.Query()))
+	require.NoError(t, s.Verify("/games/g1/chunks/abc", u.Query()), "other files of the build")
+	require.ErrorIs(t, s.Verify("/games/g2/game.zip", u.Query()), ErrInvalidToken)
+}
+
+func TestNewSigner_Validates(t *testing.T) {
+	_, err := NewSigner(Options{BaseURL: "cdn.example.com", Secret: testSecret})
+	require.Error(t, err)
+	_, err = NewSigner(Options{BaseURL: "https://cdn.example.com", Secret: []byte("short")})
+	require.Error(t, err)
+}
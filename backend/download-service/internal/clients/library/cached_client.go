@@ -0,0 +1,227 @@
+package library
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"download-service/internal/observability"
+	"download-service/pkg/logger"
+
+	redis "github.com/redis/go-redis/v9"
+)
+
+// Defaults of CachedOptions.
+const (
+	DefaultOwnedTTL    = 5 * time.Minute
+	DefaultNotOwnedTTL = 30 * time.Second
+	DefaultStaleGrace  = 30 * time.Minute
+)
+
+// CacheEntry is a cached ownership answer.
+type CacheEntry struct {
+	Owned     bool      `json:"owned"`
+	CheckedAt time.Time `json:"checkedAt"`
+}
+
+// CacheStore holds cached ownership answers, shared by every replica.
+type CacheStore interface {
+	Get(ctx context.Context, key string) (CacheEntry, bool, error)
+	Set(ctx context.Context, key string, e CacheEntry, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+}
+
+// Invalidator is implemented by clients that cache ownership.
+type Invalidator interface {
+	Invalidate(ctx context.Context, userID, gameID string) error
+}
+
+// CachedOptions configures CachedClient.
+type CachedOptions struct {
+	Store       CacheStore
+	OwnedTTL    time.Duration // how long "owned" is trusted; DefaultOwnedTTL when zero
+	NotOwnedTTL time.Duration // how long "not owned" is trusted, kept short so a purchase shows up quickly; DefaultNotOwnedTTL when zero
+	StaleGrace  time.Duration // how long past OwnedTTL "owned" is served while the circuit is open; DefaultStaleGrace when zero, negative disables it
+}
+
+// CachedClient wraps a Library Service client with an ownership cache. While the
+// client's circuit is open it keeps answering "owned" from entries up to
+// StaleGrace past their lifetime, so an outage does not lock out users who owned
+// the game moments ago. "Not owned" is never served stale.
+type CachedClient struct {
+	client Interface
+	opts   CachedOptions
+	logger logger.Logger
+}
+
+// NewCachedClient creates a caching library client.
+func NewCachedClient(client Interface, opts CachedOptions, logger logger.Logger) *CachedClient {
+	if opts.OwnedTTL <= 0 {
+		opts.OwnedTTL = DefaultOwnedTTL
+	}
+	if opts.NotOwnedTTL <= 0 {
+		opts.NotOwnedTTL = DefaultNotOwnedTTL
+	}
+	if opts.StaleGrace == 0 {
+		opts.StaleGrace = DefaultStaleGrace
+	} else if opts.StaleGrace < 0 {
+		opts.StaleGrace = 0
+	}
+	return &CachedClient{client: client, opts: opts, logger: logger}
+}
+
+func ownershipCacheKey(userID, gameID string) string {
+	return fmt.Sprintf("library:owns:%s:%s", userID, gameID)
+}
+
+// CheckOwnership answers from the cache when it can and asks the client otherwise.
+func (cc *CachedClient) CheckOwnership(ctx context.Context, userID, gameID string) (bool, error) {
+	key := ownershipCacheKey(userID, gameID)
+	entry, cached, err := cc.opts.Store.Get(ctx, key)
+	if err != nil {
+		// The cache is an optimisation; fall through to the library.
+		logger.Error(cc.logger, "ownership cache read failed", "error", err, "userID", userID, "gameID", gameID)
+		cached = false
+	}
+	age := time.Since(entry.CheckedAt)
+	if cached && entry.Owned && age < cc.opts.OwnedTTL {
+		observability.RecordLibraryCache("hit")
+		return true, nil
+	}
+	if cached && !entry.Owned && age < cc.opts.NotOwnedTTL {
+		observability.RecordLibraryCache("negative_hit")
+		return false, nil
+	}
+
+	owned, err := cc.client.CheckOwnership(ctx, userID, gameID)
+	if err != nil {
+		if isCircuitOpenError(err) && cached && entry.Owned && age < cc.opts.OwnedTTL+cc.opts.StaleGrace {
+			observability.RecordLibraryCache("stale")
+			logger.Info(cc.logger, "serving stale ownership while library circuit is open",
+				"userID", userID,
+				"gameID", gameID,
+				"age_ms", age.Milliseconds())
+			return true, nil
+		}
+		return false, err
+	}
+	observability.RecordLibraryCache("miss")
+
+	ttl := cc.opts.NotOwnedTTL
+	if owned {
+		// Kept past its lifetime so it can be served stale during an outage.
+		ttl = cc.opts.OwnedTTL + cc.opts.StaleGrace
+	}
+	if err := cc.opts.Store.Set(ctx, key, CacheEntry{Owned: owned, CheckedAt: time.Now()}, ttl); err != nil {
+		logger.Error(cc.logger, "ownership cache write failed", "error", err, "userID", userID, "gameID", gameID)
+	}
+	return owned, nil
+}
+
+// CheckOwnershipBatch answers what it can from the cache and asks the client
+// about the rest in one request, caching the answers.
+func (cc *CachedClient) CheckOwnershipBatch(ctx context.Context, userID string, gameIDs []string) (map[string]bool, error) {
+	out := make(map[string]bool, len(gameIDs))
+	stale := make(map[string]bool)
+	var missing []string
+	for _, gameID := range gameIDs {
+		entry, cached, err := cc.opts.Store.Get(ctx, ownershipCacheKey(userID, gameID))
+		if err != nil {
+			logger.Error(cc.logger, "ownership cache read failed", "error", err, "userID", userID, "gameID", gameID)
+			cached = false
+		}
+		age := time.Since(entry.CheckedAt)
+		switch {
+		case cached && entry.Owned && age < cc.opts.OwnedTTL:
+			observability.RecordLibraryCache("hit")
+			out[gameID] = true
+		case cached && !entry.Owned && age < cc.opts.NotOwnedTTL:
+			observability.RecordLibraryCache("negative_hit")
+			out[gameID] = false
+		default:
+			stale[gameID] = cached && entry.Owned && age < cc.opts.OwnedTTL+cc.opts.StaleGrace
+			missing = append(missing, gameID)
+		}
+	}
+	if len(missing) == 0 {
+		return out, nil
+	}
+
+	owned, err := cc.client.CheckOwnershipBatch(ctx, userID, missing)
+	if err != nil {
+		if !isCircuitOpenError(err) {
+			return nil, err
+		}
+		for _, gameID := range missing {
+			if !stale[gameID] {
+				return nil, err
+			}
+		}
+		for _, gameID := range missing {
+			observability.RecordLibraryCache("stale")
+			out[gameID] = true
+		}
+		logger.Info(cc.logger, "serving stale ownership while library circuit is open",
+			"userID", userID,
+			"gameCount", len(missing))
+		return out, nil
+	}
+	for _, gameID := range missing {
+		observability.RecordLibraryCache("miss")
+		out[gameID] = owned[gameID]
+		ttl := cc.opts.NotOwnedTTL
+		if owned[gameID] {
+			ttl = cc.opts.OwnedTTL + cc.opts.StaleGrace
+		}
+		if err := cc.opts.Store.Set(ctx, ownershipCacheKey(userID, gameID), CacheEntry{Owned: owned[gameID], CheckedAt: time.Now()}, ttl); err != nil {
+			logger.Error(cc.logger, "ownership cache write failed", "error", err, "userID", userID, "gameID", gameID)
+		}
+	}
+	return out, nil
+}
+
+// ListUserGames is not cached.
+func (cc *CachedClient) ListUserGames(ctx context.Context, userID string) ([]string, error) {
+	return cc.client.ListUserGames(ctx, userID)
+}
+
+// Invalidate drops the cached answer, e.g. when the entitlement is revoked.
+func (cc *CachedClient) Invalidate(ctx context.Context, userID, gameID string) error {
+	return cc.opts.Store.Delete(ctx, ownershipCacheKey(userID, gameID))
+}
+
+// RedisCacheStore keeps cached ownership answers in Redis.
+type RedisCacheStore struct {
+	rdb *redis.Client
+}
+
+func NewRedisCacheStore(rdb *redis.Client) *RedisCacheStore { return &RedisCacheStore{rdb: rdb} }
+
+func (s *RedisCacheStore) Get(ctx context.Context, key string) (CacheEntry, bool, error) {
+	raw, err := s.rdb.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return CacheEntry{}, false, nil
+	}
+	if err != nil {
+		return CacheEntry{}, false, err
+	}
+	var e CacheEntry
+	if err := json.Unmarshal(raw, &e); err != nil {
+		return CacheEntry{}, false, err
+	}
+	return e, true, nil
+}
+
+func (s *RedisCacheStore) Set(ctx context.Context, key string, e CacheEntry, ttl time.Duration) error {
+	raw, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return s.rdb.Set(ctx, key, raw, ttl).Err()
+}
+
+func (s *RedisCacheStore) Delete(ctx context.Context, key string) error {
+	return s.rdb.Del(ctx, key).Err()
+}
@@ -0,0 +1,158 @@
+package library
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"download-service/pkg/logger"
+	"github.com/stretchr/testify/require"
+)
+
+type memCacheStore struct {
+	mu sync.Mutex
+	m  map[string]CacheEntry
+}
+
+func newMemCacheStore() *memCacheStore { return &memCacheStore{m: make(map[string]CacheEntry)} }
+
+func (s *memCacheStore) Get(ctx context.Context, key string) (CacheEntry, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.m[key]
+	return e, ok, nil
+}
+
+func (s *memCacheStore) Set(ctx context.Context, key string, e CacheEntry, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.m[key] = e
+	return nil
+}
+
+func (s *memCacheStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.m, key)
+	return nil
+}
+
+// age backdates a cached answer.
+func (s *memCacheStore) age(userID, gameID string, by time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := ownershipCacheKey(userID, gameID)
+	e := s.m[key]
+	e.CheckedAt = e.CheckedAt.Add(-by)
+	s.m[key] = e
+}
+
+// countingClient wraps MockClient and counts ownership checks.
+type countingClient struct {
+	*MockClient
+	calls int
+}
+
+func (c *countingClient) CheckOwnership(ctx context.Context, userID, gameID string) (bool, error) {
+	c.calls++
+	return c.MockClient.CheckOwnership(ctx, userID, gameID)
+}
+
+func newCachedTestClient() (*CachedClient, *countingClient, *memCacheStore) {
+	inner := &countingClient{MockClient: NewMockClient()}
+	inner.SetUserGames("user1", []string{"game1"})
+	store := newMemCacheStore()
+	cc := NewCachedClient(inner, CachedOptions{
+		Store:       store,
+		OwnedTTL:    time.Minute,
+		NotOwnedTTL: 10 * time.Second,
+		StaleGrace:  time.Hour,
+	}, logger.New())
+	return cc, inner, store
+}
+
+func TestCachedClient_CachesAnswers(t *testing.T) {
+	cc, inner, store := newCachedTestClient()
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		owned, err := cc.CheckOwnership(ctx, "user1", "game1")
+		require.NoError(t, err)
+		require.True(t, owned)
+		owned, err = cc.CheckOwnership(ctx, "user1", "game2")
+		require.NoError(t, err)
+		require.False(t, owned)
+	}
+	require.Equal(t, 2, inner.calls)
+
+	// "Not owned" expires sooner, so a purchase shows up quickly.
+	inner.AddUserGame("user1", "game2")
+	store.age("user1", "game2", 15*time.Second)
+	store.age("user1", "game1", 15*time.Second)
+	owned, err := cc.CheckOwnership(ctx, "user1", "game2")
+	require.NoError(t, err)
+	require.True(t, owned)
+	_, err = cc.CheckOwnership(ctx, "user1", "game1")
+	require.NoError(t, err)
+	require.Equal(t, 3, inner.calls)
+
+	require.NoError(t, cc.Invalidate(ctx, "user1", "game1"))
+	_, err = cc.CheckOwnership(ctx, "user1", "game1")
+	require.NoError(t, err)
+	require.Equal(t, 4, inner.calls)
+}
+
+func TestCachedClient_ServesStaleWhileCircuitOpen(t *testing.T) {
+	cc, inner, store := newCachedTestClient()
+	ctx := context.Background()
+
+	_, err := cc.CheckOwnership(ctx, "user1", "game1")
+	require.NoError(t, err)
+	_, err = cc.CheckOwnership(ctx, "user1", "game2")
+	require.NoError(t, err)
+	store.age("user1", "game1", 2*time.Minute)
+	store.age("user1", "game2", 2*time.Minute)
+	inner.SetError("CheckOwnership", errors.New("library client: circuit open"))
+
+	owned, err := cc.CheckOwnership(ctx, "user1", "game1")
+	require.NoError(t, err)
+	require.True(t, owned, "expired but within the grace period")
+
+	_, err = cc.CheckOwnership(ctx, "user1", "game2")
+	require.Error(t, err, "not owned is never served stale")
+
+	store.age("user1", "game1", time.Hour)
+	_, err = cc.CheckOwnership(ctx, "user1", "game1")
+	require.Error(t, err, "past the grace period")
+
+	// Only an open circuit is answered from stale entries.
+	store.age("user1", "game1", -time.Hour)
+	inner.SetError("CheckOwnership", errors.New("library returned 500"))
+	_, err = cc.CheckOwnership(ctx, "user1", "game1")
+	require.Error(t, err)
+}
+
+func TestCachedClient_Batch(t *testing.T) {
+	cc, inner, store := newCachedTestClient()
+	ctx := context.Background()
+
+	_, err := cc.CheckOwnership(ctx, "user1", "game1")
+	require.NoError(t, err)
+	owned, err := cc.CheckOwnershipBatch(ctx, "user1", []string{"game1", "game2"})
+	require.NoError(t, err)
+	require.Equal(t, map[string]bool{"game1": true, "game2": false}, owned)
+	require.Equal(t, 1, inner.calls, "game1 is answered from the cache, game2 by the batch call")
+
+	// Both are cached now; during an outage only the owned game can be served stale.
+	store.age("user1", "game1", 2*time.Minute)
+	inner.SetError("CheckOwnershipBatch", errors.New("library client: circuit open"))
+	owned, err = cc.CheckOwnershipBatch(ctx, "user1", []string{"game1", "game2"})
+	require.NoError(t, err)
+	require.Equal(t, map[string]bool{"game1": true, "game2": false}, owned)
+
+	store.age("user1", "game2", time.Minute)
+	_, err = cc.CheckOwnershipBatch(ctx, "user1", []string{"game1", "game2"})
+	require.Error(t, err)
+}
@@ -1,6 +1,7 @@
 package library
 
 import (
+    "bytes"
     "context"
     "encoding/json"
     "errors"
@@ -45,6 +46,8 @@ type Client struct {
 type Interface interface {
     CheckOwnership(ctx context.Context, userID, gameID string) (bool, error)
     ListUserGames(ctx context.Context, userID string) ([]string, error)
+    // CheckOwnershipBatch reports which of the games the user owns, in one request.
+    CheckOwnershipBatch(ctx context.Context, userID string, gameIDs []string) (map[string]bool, error)
 }
 
 func NewClient(opts Options) *Client {
@@ -109,17 +112,29 @@ func (c *Client) markFailure() {
     c.mu.Unlock()
 }
 
-// doJSON performs an HTTP request with retries and decodes JSON into out if non-nil.
-func (c *Client) doJSON(ctx context.Context, method, path string, out any) (int, error) {
+// doJSON performs an HTTP request with retries, sending in as a JSON body if
+// non-nil and decoding JSON into out if non-nil.
+func (c *Client) doJSON(ctx context.Context, method, path string, in, out any) (int, error) {
     if !c.circuitAllows() {
         return 0, errors.New("library client: circuit open")
     }
 
+    var payload []byte
+    if in != nil {
+        var err error
+        if payload, err = json.Marshal(in); err != nil {
+            return 0, err
+        }
+    }
     url := c.baseURL + path
     var lastErr error
     attempts := c.maxRetries + 1
     for i := 0; i < attempts; i++ {
-        req, err := http.NewRequestWithContext(ctx, method, url, nil)
+        var reqBody io.Reader
+        if payload != nil {
+            reqBody = bytes.NewReader(payload)
+        }
+        req, err := http.NewRequestWithContext(ctx, method, url, reqBody)
         if err != nil {
             return 0, err
         }
@@ -127,6 +142,9 @@ func (c *Client) doJSON(ctx context.Context, method, path string, out any) (int,
             req.Header.Set(c.hdrName, c.hdrValue)
         }
         req.Header.Set("Accept", "application/json")
+        if payload != nil {
+            req.Header.Set("Content-Type", "application/json")
+        }
 
         resp, err := c.hc.Do(req)
         if err != nil {
@@ -214,7 +232,7 @@ type ownershipResponse struct {
 // CheckOwnership checks whether user owns the game using the dedicated endpoint, falling back to the games list if needed.
 func (c *Client) CheckOwnership(ctx context.Context, userID, gameID string) (bool, error) {
     var resp ownershipResponse
-    code, err := c.doJSON(ctx, http.MethodGet, fmt.Sprintf("/api/library/user/%s/owns/%s", userID, gameID), &resp)
+    code, err := c.doJSON(ctx, http.MethodGet, fmt.Sprintf("/api/library/user/%s/owns/%s", userID, gameID), nil, &resp)
     if err == nil && code >= 200 && code < 300 {
         return resp.Owns, nil
     }
@@ -223,7 +241,7 @@ func (c *Client) CheckOwnership(ctx context.Context, userID, gameID string) (boo
     }
     // Fallback to internal list endpoint (expected to be lightweight and reuse circuit breaker).
     var list userGamesResponse
-    _, fallbackErr := c.doJSON(ctx, http.MethodGet, fmt.Sprintf("/api/library/user/%s/games", userID), &list)
+    _, fallbackErr := c.doJSON(ctx, http.MethodGet, fmt.Sprintf("/api/library/user/%s/games", userID), nil, &list)
     if fallbackErr != nil {
         if err != nil {
             return false, err
@@ -244,7 +262,7 @@ func (c *Client) CheckOwnership(ctx context.Context, userID, gameID string) (boo
 // ListUserGames returns list of game IDs owned by the user via internal endpoint.
 func (c *Client) ListUserGames(ctx context.Context, userID string) ([]string, error) {
     var resp userGamesResponse
-    _, err := c.doJSON(ctx, http.MethodGet, fmt.Sprintf("/api/library/user/%s/games", userID), &resp)
+    _, err := c.doJSON(ctx, http.MethodGet, fmt.Sprintf("/api/library/user/%s/games", userID), nil, &resp)
     if err != nil {
         return nil, err
     }
@@ -254,3 +272,40 @@ func (c *Client) ListUserGames(ctx context.Context, userID string) ([]string, er
     }
     return ids, nil
 }
+
+type ownershipBatchRequest struct {
+    GameIDs []string `json:"gameIds"`
+}
+
+type ownershipBatchResponse struct {
+    Owns map[string]bool `json:"owns"`
+}
+
+// CheckOwnershipBatch asks the bulk endpoint which of the games the user owns,
+// falling back to the games list where the endpoint is not deployed. Games the
+// response leaves out are not owned.
+func (c *Client) CheckOwnershipBatch(ctx context.Context, userID string, gameIDs []string) (map[string]bool, error) {
+    out := make(map[string]bool, len(gameIDs))
+    if len(gameIDs) == 0 {
+        return out, nil
+    }
+    var resp ownershipBatchResponse
+    code, err := c.doJSON(ctx, http.MethodPost, fmt.Sprintf("/api/library/user/%s/owns", userID), ownershipBatchRequest{GameIDs: gameIDs}, &resp)
+    if err != nil {
+        return nil, err
+    }
+    if code == http.StatusNotFound {
+        owned, err := c.ListUserGames(ctx, userID)
+        if err != nil {
+            return nil, err
+        }
+        resp.Owns = make(map[string]bool, len(owned))
+        for _, id := range owned {
+            resp.Owns[id] = true
+        }
+    }
+    for _, id := range gameIDs {
+        out[id] = resp.Owns[id]
+    }
+    return out, nil
+}
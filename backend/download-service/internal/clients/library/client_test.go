@@ -35,6 +35,46 @@ func TestClient_CheckOwnership_Owned(t *testing.T) {
     require.Equal(t, int32(1), atomic.LoadInt32(&ownsCalls))
 }
 
+func TestClient_CheckOwnershipBatch(t *testing.T) {
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        require.Equal(t, http.MethodPost, r.Method)
+        require.Equal(t, "/api/library/user/u1/owns", r.URL.Path)
+        require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+        var req struct {
+            GameIDs []string `json:"gameIds"`
+        }
+        require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+        require.Equal(t, []string{"g1", "g2", "g3"}, req.GameIDs)
+        _ = json.NewEncoder(w).Encode(map[string]any{"owns": map[string]bool{"g1": true, "g2": false}})
+    }))
+    defer srv.Close()
+
+    c := NewClient(Options{BaseURL: srv.URL, Timeout: time.Second, CBThreshold: 3, CBCooldown: time.Second})
+    owned, err := c.CheckOwnershipBatch(context.Background(), "u1", []string{"g1", "g2", "g3"})
+    require.NoError(t, err)
+    require.Equal(t, map[string]bool{"g1": true, "g2": false, "g3": false}, owned)
+}
+
+func TestClient_CheckOwnershipBatch_FallbackToList(t *testing.T) {
+    gamesCalls := int32(0)
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        switch r.URL.Path {
+        case "/api/library/user/u1/games":
+            atomic.AddInt32(&gamesCalls, 1)
+            _ = json.NewEncoder(w).Encode(map[string]any{"games": []map[string]any{{"gameId": "g2"}}})
+        default:
+            http.NotFound(w, r)
+        }
+    }))
+    defer srv.Close()
+
+    c := NewClient(Options{BaseURL: srv.URL, Timeout: time.Second, CBThreshold: 3, CBCooldown: time.Second})
+    owned, err := c.CheckOwnershipBatch(context.Background(), "u1", []string{"g1", "g2"})
+    require.NoError(t, err)
+    require.Equal(t, map[string]bool{"g1": false, "g2": true}, owned)
+    require.Equal(t, int32(1), atomic.LoadInt32(&gamesCalls))
+}
+
 func TestClient_CheckOwnership_NotOwned(t *testing.T) {
     srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
         switch r.URL.Path {
@@ -105,6 +105,43 @@ func (ic *InstrumentedClient) ListUserGames(ctx context.Context, userID string)
 	return games, nil
 }
 
+// CheckOwnershipBatch checks ownership of several games with logging and monitoring
+func (ic *InstrumentedClient) CheckOwnershipBatch(ctx context.Context, userID string, gameIDs []string) (map[string]bool, error) {
+	start := time.Now()
+	method := "CheckOwnershipBatch"
+
+	owned, err := ic.client.CheckOwnershipBatch(ctx, userID, gameIDs)
+	duration := time.Since(start)
+
+	if err != nil {
+		status := "error"
+		if isCircuitOpenError(err) {
+			status = "circuit_open"
+			observability.SetLibraryCircuitBreakerState(true)
+		}
+
+		observability.RecordLibraryRequest(method, status, duration)
+		logger.Error(ic.logger, "library service batch ownership check failed",
+			"method", method,
+			"userID", userID,
+			"gameCount", len(gameIDs),
+			"error", err,
+			"duration_ms", duration.Milliseconds())
+		return nil, err
+	}
+
+	observability.RecordLibraryRequest(method, "success", duration)
+	observability.SetLibraryCircuitBreakerState(false)
+
+	logger.Info(ic.logger, "library service batch ownership check completed",
+		"method", method,
+		"userID", userID,
+		"gameCount", len(gameIDs),
+		"duration_ms", duration.Milliseconds())
+
+	return owned, nil
+}
+
 // isCircuitOpenError checks if the error indicates circuit breaker is open
 func isCircuitOpenError(err error) bool {
 	return err != nil && err.Error() == "library client: circuit open"
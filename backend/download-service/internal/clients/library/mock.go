@@ -66,6 +66,21 @@ func (m *MockClient) ListUserGames(ctx context.Context, userID string) ([]string
 	return result, nil
 }
 
+func (m *MockClient) CheckOwnershipBatch(ctx context.Context, userID string, gameIDs []string) (map[string]bool, error) {
+	if err, exists := m.Errors["CheckOwnershipBatch"]; exists {
+		return nil, err
+	}
+	out := make(map[string]bool, len(gameIDs))
+	for _, gameID := range gameIDs {
+		owned, err := m.CheckOwnership(ctx, userID, gameID)
+		if err != nil {
+			return nil, err
+		}
+		out[gameID] = owned
+	}
+	return out, nil
+}
+
 // Helper methods for testing
 
 func (m *MockClient) SetUserGames(userID string, gameIDs []string) {
@@ -1,9 +1,15 @@
 package s3
 
 import (
+    "bytes"
     "context"
+    "crypto/md5"
+    "encoding/hex"
     "errors"
     "fmt"
+    "io"
+    "sort"
+    "strings"
     "sync"
     "time"
 
@@ -28,11 +34,15 @@ type ObjectInfo struct {
     Key          string
     Size         int64
     LastModified time.Time
+    ETag         string // entity tag as returned by storage, without quotes
 }
 
 // ErrNotFound is returned when the object or prefix does not exist.
 var ErrNotFound = errors.New("s3 object not found")
 
+// ErrInvalidRange is returned when a requested byte range lies outside the object.
+var ErrInvalidRange = errors.New("s3 invalid range")
+
 // Client is a wrapper around the AWS S3 client.
 type Client struct {
     presignClient *awss3.PresignClient
@@ -40,10 +50,13 @@ type Client struct {
     bucket        string
 }
 
-// Interface describes the methods implemented by the S3 client.
+// Interface describes a storage backend. It is implemented by the S3 client, the
+// local filesystem driver FSClient and the in-memory MockClient.
 type Interface interface {
     GetPresignedURL(ctx context.Context, objectKey string, lifetime time.Duration) (string, error)
     StatObject(ctx context.Context, objectKey string) (ObjectInfo, error)
+    GetObjectRange(ctx context.Context, objectKey string, offset, length int64) (io.ReadCloser, error)
+    ListObjects(ctx context.Context, prefix string) ([]ObjectInfo, error)
     CleanupPrefix(ctx context.Context, prefix string) error
 }
 
@@ -109,13 +122,65 @@ func (c *Client) StatObject(ctx context.Context, objectKey string) (ObjectInfo,
         }
         return ObjectInfo{}, err
     }
-    info := ObjectInfo{Key: objectKey, Size: aws.ToInt64(out.ContentLength)}
+    info := ObjectInfo{Key: objectKey, Size: aws.ToInt64(out.ContentLength), ETag: strings.Trim(aws.ToString(out.ETag), `"`)}
     if out.LastModified != nil {
         info.LastModified = *out.LastModified
     }
     return info, nil
 }
 
+// GetObjectRange streams length bytes of the object starting at offset.
+// The caller is responsible for closing the returned reader.
+func (c *Client) GetObjectRange(ctx context.Context, objectKey string, offset, length int64) (io.ReadCloser, error) {
+    if offset < 0 || length <= 0 {
+        return nil, ErrInvalidRange
+    }
+    out, err := c.s3Client.GetObject(ctx, &awss3.GetObjectInput{
+        Bucket: aws.String(c.bucket),
+        Key:    aws.String(objectKey),
+        Range:  aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)),
+    })
+    if err != nil {
+        var nsk *types.NoSuchKey
+        if errors.As(err, &nsk) {
+            return nil, ErrNotFound
+        }
+        var nfe *types.NotFound
+        if errors.As(err, &nfe) {
+            return nil, ErrNotFound
+        }
+        var apiErr interface{ ErrorCode() string }
+        if errors.As(err, &apiErr) && apiErr.ErrorCode() == "InvalidRange" {
+            return nil, ErrInvalidRange
+        }
+        return nil, err
+    }
+    return out.Body, nil
+}
+
+// ListObjects returns the objects whose keys start with prefix, in key order.
+func (c *Client) ListObjects(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+    pager := awss3.NewListObjectsV2Paginator(c.s3Client, &awss3.ListObjectsV2Input{
+        Bucket: aws.String(c.bucket),
+        Prefix: aws.String(prefix),
+    })
+    var out []ObjectInfo
+    for pager.HasMorePages() {
+        page, err := pager.NextPage(ctx)
+        if err != nil {
+            return nil, err
+        }
+        for _, obj := range page.Contents {
+            info := ObjectInfo{Key: aws.ToString(obj.Key), Size: aws.ToInt64(obj.Size), ETag: strings.Trim(aws.ToString(obj.ETag), `"`)}
+            if obj.LastModified != nil {
+                info.LastModified = *obj.LastModified
+            }
+            out = append(out, info)
+        }
+    }
+    return out, nil
+}
+
 // CleanupPrefix removes any temporary objects with the provided prefix.
 func (c *Client) CleanupPrefix(ctx context.Context, prefix string) error {
     const pageSize = int32(1000)
@@ -183,11 +248,13 @@ type mockObject struct {
     size         int64
     lastModified time.Time
     content      []byte
+    etag         string
 }
 
 type MockClient struct {
     mu      sync.RWMutex
     objects map[string]mockObject
+    uploads map[string]*mockUpload
     bucket  string
 }
 
@@ -203,7 +270,49 @@ func (m *MockClient) StatObject(ctx context.Context, objectKey string) (ObjectIn
     if !ok {
         return ObjectInfo{}, ErrNotFound
     }
-    return ObjectInfo{Key: objectKey, Size: obj.size, LastModified: obj.lastModified}, nil
+    return ObjectInfo{Key: objectKey, Size: obj.size, LastModified: obj.lastModified, ETag: obj.etag}, nil
+}
+
+func (m *MockClient) GetObjectRange(ctx context.Context, objectKey string, offset, length int64) (io.ReadCloser, error) {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    obj, ok := m.objects[objectKey]
+    if !ok {
+        return nil, ErrNotFound
+    }
+    if offset < 0 || length <= 0 || offset >= obj.size {
+        return nil, ErrInvalidRange
+    }
+    end := offset + length
+    if end > obj.size {
+        end = obj.size
+    }
+    // Objects stored without content are treated as zero-filled.
+    data := make([]byte, end-offset)
+    if offset < int64(len(obj.content)) {
+        copy(data, obj.content[offset:minInt64(end, int64(len(obj.content)))])
+    }
+    return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func minInt64(a, b int64) int64 {
+    if a < b {
+        return a
+    }
+    return b
+}
+
+func (m *MockClient) ListObjects(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    var out []ObjectInfo
+    for key, obj := range m.objects {
+        if strings.HasPrefix(key, prefix) {
+            out = append(out, ObjectInfo{Key: key, Size: obj.size, LastModified: obj.lastModified, ETag: obj.etag})
+        }
+    }
+    sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+    return out, nil
 }
 
 func (m *MockClient) CleanupPrefix(ctx context.Context, prefix string) error {
@@ -226,6 +335,11 @@ func (m *MockClient) CleanupPrefix(ctx context.Context, prefix string) error {
 func (m *MockClient) PutObject(key string, size int64, content []byte) {
     m.mu.Lock()
     defer m.mu.Unlock()
-    m.objects[key] = mockObject{size: size, lastModified: time.Now(), content: content}
+    sum := md5.Sum(content)
+    etag := hex.EncodeToString(sum[:])
+    if content == nil {
+        etag = fmt.Sprintf("%x-%x", size, time.Now().UnixNano())
+    }
+    m.objects[key] = mockObject{size: size, lastModified: time.Now(), content: content, etag: etag}
 }
 
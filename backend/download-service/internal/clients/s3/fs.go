@@ -0,0 +1,446 @@
+package s3
+
+import (
+    "context"
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "io"
+    "io/fs"
+    "net/url"
+    "os"
+    "path"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// FSObjectPath is the route prefix FSClient's signed URLs point at; the service
+// serves them itself.
+const FSObjectPath = "/storage/objects/"
+
+// fsTempPrefix marks files being written; they are not objects until renamed.
+const fsTempPrefix = ".upload-"
+
+// ErrInvalidSignature is returned for object URLs with a bad or expired signature.
+var ErrInvalidSignature = errors.New("s3 invalid signature")
+
+// FSOptions holds configuration for the local filesystem storage driver.
+type FSOptions struct {
+    Root       string // directory holding the objects, created if missing
+    SigningKey []byte // signs object URLs; at least 32 bytes
+    BaseURL    string // public URL of the service; empty yields relative URLs
+}
+
+// FSClient stores objects as files below a root directory, for on-prem installs
+// and tests that run without S3. Keys map to slash-separated paths below the
+// root. Its presigned URLs are HMAC-signed links to FSObjectPath.
+type FSClient struct {
+    root    string
+    key     []byte
+    baseURL string
+}
+
+// NewFSClient creates a filesystem storage driver.
+func NewFSClient(opts FSOptions) (*FSClient, error) {
+    if opts.Root == "" {
+        return nil, errors.New("filesystem storage root is required")
+    }
+    if len(opts.SigningKey) < 32 {
+        return nil, errors.New("filesystem storage signing key must be at least 32 bytes")
+    }
+    root, err := filepath.Abs(opts.Root)
+    if err != nil {
+        return nil, err
+    }
+    if err := os.MkdirAll(root, 0o755); err != nil {
+        return nil, fmt.Errorf("create storage root: %w", err)
+    }
+    return &FSClient{root: root, key: opts.SigningKey, baseURL: strings.TrimSuffix(opts.BaseURL, "/")}, nil
+}
+
+// validKey reports whether key is a clean relative path that stays below the root.
+func validKey(key string) bool {
+    if key == "" || strings.HasPrefix(key, "/") || strings.ContainsAny(key, "\\\x00") || path.Clean(key) != key {
+        return false
+    }
+    for _, part := range strings.Split(key, "/") {
+        if part == ".." || strings.HasPrefix(part, fsTempPrefix) {
+            return false
+        }
+    }
+    return true
+}
+
+// filePath maps an object key to its file. Invalid keys are reported as missing.
+func (c *FSClient) filePath(key string) (string, error) {
+    if !validKey(key) {
+        return "", ErrNotFound
+    }
+    return filepath.Join(c.root, filepath.FromSlash(key)), nil
+}
+
+func fsObjectInfo(key string, fi fs.FileInfo) ObjectInfo {
+    // Cheap to compute and changes whenever the file is replaced.
+    etag := fmt.Sprintf("%x-%x", fi.Size(), fi.ModTime().UnixNano())
+    return ObjectInfo{Key: key, Size: fi.Size(), LastModified: fi.ModTime(), ETag: etag}
+}
+
+// GetPresignedURL returns a signed URL of the object served by the service itself.
+func (c *FSClient) GetPresignedURL(ctx context.Context, objectKey string, lifetime time.Duration) (string, error) {
+    if !validKey(objectKey) {
+        return "", ErrNotFound
+    }
+    expires := strconv.FormatInt(time.Now().Add(lifetime).Unix(), 10)
+    segments := strings.Split(objectKey, "/")
+    for i, s := range segments {
+        segments[i] = url.PathEscape(s)
+    }
+    q := url.Values{"expires": {expires}, "signature": {c.sign(objectKey, expires)}}
+    return c.baseURL + FSObjectPath + strings.Join(segments, "/") + "?" + q.Encode(), nil
+}
+
+func (c *FSClient) sign(objectKey, expires string) string {
+    mac := hmac.New(sha256.New, c.key)
+    mac.Write([]byte(objectKey + "\n" + expires))
+    return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature checks the expires and signature parameters of a URL returned
+// by GetPresignedURL.
+func (c *FSClient) VerifySignature(objectKey, expires, signature string) error {
+    sig, err := base64.RawURLEncoding.DecodeString(signature)
+    if err != nil {
+        return ErrInvalidSignature
+    }
+    want, _ := base64.RawURLEncoding.DecodeString(c.sign(objectKey, expires))
+    if !hmac.Equal(sig, want) {
+        return ErrInvalidSignature
+    }
+    exp, err := strconv.ParseInt(expires, 10, 64)
+    if err != nil || time.Now().Unix() > exp {
+        return ErrInvalidSignature
+    }
+    return nil
+}
+
+// StatObject returns the size and modification time of the object's file.
+func (c *FSClient) StatObject(ctx context.Context, objectKey string) (ObjectInfo, error) {
+    p, err := c.filePath(objectKey)
+    if err != nil {
+        return ObjectInfo{}, err
+    }
+    fi, err := os.Stat(p)
+    if err != nil {
+        if errors.Is(err, fs.ErrNotExist) {
+            return ObjectInfo{}, ErrNotFound
+        }
+        return ObjectInfo{}, err
+    }
+    if !fi.Mode().IsRegular() {
+        return ObjectInfo{}, ErrNotFound
+    }
+    return fsObjectInfo(objectKey, fi), nil
+}
+
+// GetObjectRange streams length bytes of the object starting at offset, or up to
+// its end. The caller is responsible for closing the returned reader.
+func (c *FSClient) GetObjectRange(ctx context.Context, objectKey string, offset, length int64) (io.ReadCloser, error) {
+    if offset < 0 || length <= 0 {
+        return nil, ErrInvalidRange
+    }
+    p, err := c.filePath(objectKey)
+    if err != nil {
+        return nil, err
+    }
+    f, err := os.Open(p)
+    if err != nil {
+        if errors.Is(err, fs.ErrNotExist) {
+            return nil, ErrNotFound
+        }
+        return nil, err
+    }
+    fi, err := f.Stat()
+    if err != nil {
+        f.Close()
+        return nil, err
+    }
+    if !fi.Mode().IsRegular() {
+        f.Close()
+        return nil, ErrNotFound
+    }
+    if offset >= fi.Size() {
+        f.Close()
+        return nil, ErrInvalidRange
+    }
+    return &sectionReadCloser{Reader: io.NewSectionReader(f, offset, length), f: f}, nil
+}
+
+type sectionReadCloser struct {
+    io.Reader
+    f *os.File
+}
+
+func (r *sectionReadCloser) Close() error { return r.f.Close() }
+
+// ListObjects returns the objects whose keys start with prefix, in key order.
+func (c *FSClient) ListObjects(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+    // Walk only the deepest directory the prefix names.
+    dir := c.root
+    if i := strings.LastIndex(prefix, "/"); i > 0 {
+        if !validKey(prefix[:i]) {
+            return nil, nil
+        }
+        dir = filepath.Join(c.root, filepath.FromSlash(prefix[:i]))
+    }
+    var out []ObjectInfo
+    err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+        if err != nil {
+            if errors.Is(err, fs.ErrNotExist) {
+                return nil
+            }
+            return err
+        }
+        if err := ctx.Err(); err != nil {
+            return err
+        }
+        if strings.HasPrefix(d.Name(), fsTempPrefix) {
+            if d.IsDir() {
+                // Multipart uploads in progress.
+                return fs.SkipDir
+            }
+            return nil
+        }
+        if !d.Type().IsRegular() {
+            return nil
+        }
+        rel, err := filepath.Rel(c.root, p)
+        if err != nil {
+            return err
+        }
+        key := filepath.ToSlash(rel)
+        if !strings.HasPrefix(key, prefix) {
+            return nil
+        }
+        fi, err := d.Info()
+        if err != nil {
+            if errors.Is(err, fs.ErrNotExist) {
+                return nil
+            }
+            return err
+        }
+        out = append(out, fsObjectInfo(key, fi))
+        return nil
+    })
+    if err != nil {
+        return nil, err
+    }
+    return out, nil
+}
+
+// CleanupPrefix removes the objects whose keys start with prefix and the
+// directories left empty.
+func (c *FSClient) CleanupPrefix(ctx context.Context, prefix string) error {
+    objects, err := c.ListObjects(ctx, prefix)
+    if err != nil {
+        return err
+    }
+    for _, obj := range objects {
+        p := filepath.Join(c.root, filepath.FromSlash(obj.Key))
+        if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+            return err
+        }
+        // Fails harmlessly at the first directory that still has entries.
+        for dir := filepath.Dir(p); dir != c.root; dir = filepath.Dir(dir) {
+            if os.Remove(dir) != nil {
+                break
+            }
+        }
+    }
+    return nil
+}
+
+// PutObject stores the content of r under key, replacing any existing object.
+// Readers never see a partly written object.
+func (c *FSClient) PutObject(ctx context.Context, objectKey string, r io.Reader) (ObjectInfo, error) {
+    if !validKey(objectKey) {
+        return ObjectInfo{}, fmt.Errorf("invalid object key %q", objectKey)
+    }
+    p := filepath.Join(c.root, filepath.FromSlash(objectKey))
+    if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+        return ObjectInfo{}, err
+    }
+    tmp, err := os.CreateTemp(filepath.Dir(p), fsTempPrefix+"*")
+    if err != nil {
+        return ObjectInfo{}, err
+    }
+    defer os.Remove(tmp.Name())
+    if err := tmp.Chmod(0o644); err != nil {
+        tmp.Close()
+        return ObjectInfo{}, err
+    }
+    if _, err := io.Copy(tmp, r); err != nil {
+        tmp.Close()
+        return ObjectInfo{}, err
+    }
+    if err := tmp.Sync(); err != nil {
+        tmp.Close()
+        return ObjectInfo{}, err
+    }
+    if err := tmp.Close(); err != nil {
+        return ObjectInfo{}, err
+    }
+    if err := os.Rename(tmp.Name(), p); err != nil {
+        return ObjectInfo{}, err
+    }
+    return c.StatObject(ctx, objectKey)
+}
+
+// uploadDir returns the directory holding the parts of a multipart upload.
+func (c *FSClient) uploadDir(uploadID string) (string, error) {
+    if len(uploadID) != 32 {
+        return "", ErrNotFound
+    }
+    if _, err := hex.DecodeString(uploadID); err != nil {
+        return "", ErrNotFound
+    }
+    return filepath.Join(c.root, fsTempPrefix+uploadID), nil
+}
+
+// openUpload returns the directory of an upload of objectKey.
+func (c *FSClient) openUpload(objectKey, uploadID string) (string, error) {
+    dir, err := c.uploadDir(uploadID)
+    if err != nil {
+        return "", err
+    }
+    key, err := os.ReadFile(filepath.Join(dir, "key"))
+    if err != nil || string(key) != objectKey {
+        return "", ErrNotFound
+    }
+    return dir, nil
+}
+
+// CreateMultipartUpload starts an upload whose parts are kept in a directory
+// below the root until it is completed.
+func (c *FSClient) CreateMultipartUpload(ctx context.Context, objectKey string) (string, error) {
+    if !validKey(objectKey) {
+        return "", fmt.Errorf("invalid object key %q", objectKey)
+    }
+    id := newUploadID()
+    dir, _ := c.uploadDir(id)
+    if err := os.Mkdir(dir, 0o755); err != nil {
+        return "", err
+    }
+    if err := os.WriteFile(filepath.Join(dir, "key"), []byte(objectKey), 0o644); err != nil {
+        os.RemoveAll(dir)
+        return "", err
+    }
+    return id, nil
+}
+
+// UploadPart writes a part, checking its size and checksum as it is written.
+func (c *FSClient) UploadPart(ctx context.Context, objectKey, uploadID string, number int32, body io.Reader, size int64, sum []byte) (CompletedPart, error) {
+    if number < 1 {
+        return CompletedPart{}, fmt.Errorf("invalid part number %d", number)
+    }
+    dir, err := c.openUpload(objectKey, uploadID)
+    if err != nil {
+        return CompletedPart{}, err
+    }
+    tmp, err := os.CreateTemp(dir, "tmp-*")
+    if err != nil {
+        return CompletedPart{}, err
+    }
+    defer os.Remove(tmp.Name())
+    h := sha256.New()
+    n, err := io.Copy(io.MultiWriter(tmp, h), io.LimitReader(body, size+1))
+    if cerr := tmp.Close(); err == nil {
+        err = cerr
+    }
+    if err != nil {
+        return CompletedPart{}, err
+    }
+    if n != size || !hmac.Equal(h.Sum(nil), sum) {
+        return CompletedPart{}, ErrChecksumMismatch
+    }
+    if err := os.Rename(tmp.Name(), filepath.Join(dir, fmt.Sprintf("part-%05d", number))); err != nil {
+        return CompletedPart{}, err
+    }
+    return CompletedPart{Number: number, ETag: hex.EncodeToString(sum), SHA256: sum}, nil
+}
+
+// CompleteMultipartUpload concatenates the parts into the object.
+func (c *FSClient) CompleteMultipartUpload(ctx context.Context, objectKey, uploadID string, parts []CompletedPart) (ObjectInfo, error) {
+    dir, err := c.openUpload(objectKey, uploadID)
+    if err != nil {
+        return ObjectInfo{}, err
+    }
+    chain := &partChain{}
+    for _, p := range sortedParts(parts) {
+        path := filepath.Join(dir, fmt.Sprintf("part-%05d", p.Number))
+        if _, err := os.Stat(path); err != nil {
+            if errors.Is(err, fs.ErrNotExist) {
+                err = fmt.Errorf("%w: part %d was not uploaded", ErrChecksumMismatch, p.Number)
+            }
+            return ObjectInfo{}, err
+        }
+        chain.paths = append(chain.paths, path)
+    }
+    defer chain.Close()
+    info, err := c.PutObject(ctx, objectKey, chain)
+    if err != nil {
+        return ObjectInfo{}, err
+    }
+    return info, os.RemoveAll(dir)
+}
+
+// partChain reads part files one after another, holding one open at a time.
+type partChain struct {
+    paths []string
+    cur   *os.File
+}
+
+func (r *partChain) Read(p []byte) (int, error) {
+    for {
+        if r.cur == nil {
+            if len(r.paths) == 0 {
+                return 0, io.EOF
+            }
+            f, err := os.Open(r.paths[0])
+            if err != nil {
+                return 0, err
+            }
+            r.cur, r.paths = f, r.paths[1:]
+        }
+        n, err := r.cur.Read(p)
+        if err == io.EOF {
+            r.cur.Close()
+            r.cur = nil
+            if n > 0 {
+                return n, nil
+            }
+            continue
+        }
+        return n, err
+    }
+}
+
+func (r *partChain) Close() error {
+    if r.cur == nil {
+        return nil
+    }
+    return r.cur.Close()
+}
+
+// AbortMultipartUpload discards an upload and its parts.
+func (c *FSClient) AbortMultipartUpload(ctx context.Context, objectKey, uploadID string) error {
+    dir, err := c.openUpload(objectKey, uploadID)
+    if err != nil {
+        return err
+    }
+    return os.RemoveAll(dir)
+}
@@ -0,0 +1,120 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestFSClient(t *testing.T) *FSClient {
+	t.Helper()
+	c, err := NewFSClient(FSOptions{
+		Root:       t.TempDir(),
+		SigningKey: []byte("0123456789abcdef0123456789abcdef"),
+		BaseURL:    "https://dl.example.com/",
+	})
+	require.NoError(t, err)
+	return c
+}
+
+func TestFSClient_ObjectsAndRanges(t *testing.T) {
+	c := newTestFSClient(t)
+	ctx := context.Background()
+
+	info, err := c.PutObject(ctx, "games/g1/game.zip", strings.NewReader("0123456789"))
+	require.NoError(t, err)
+	require.Equal(t, int64(10), info.Size)
+	require.NotEmpty(t, info.ETag)
+
+	stat, err := c.StatObject(ctx, "games/g1/game.zip")
+	require.NoError(t, err)
+	require.Equal(t, info, stat)
+
+	rc, err := c.GetObjectRange(ctx, "games/g1/game.zip", 3, 4)
+	require.NoError(t, err)
+	data, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	require.NoError(t, rc.Close())
+	require.Equal(t, "3456", string(data))
+
+	// A range running past the end is cut short, one starting past it is refused.
+	rc, err = c.GetObjectRange(ctx, "games/g1/game.zip", 8, 100)
+	require.NoError(t, err)
+	data, _ = io.ReadAll(rc)
+	rc.Close()
+	require.Equal(t, "89", string(data))
+	_, err = c.GetObjectRange(ctx, "games/g1/game.zip", 10, 1)
+	require.ErrorIs(t, err, ErrInvalidRange)
+
+	_, err = c.StatObject(ctx, "games/g1/missing.zip")
+	require.ErrorIs(t, err, ErrNotFound)
+	_, err = c.StatObject(ctx, "games/g1")
+	require.ErrorIs(t, err, ErrNotFound, "directories are not objects")
+
+	// Keys cannot leave the root.
+	require.NoError(t, os.WriteFile(filepath.Join(filepath.Dir(c.root), "secret"), []byte("x"), 0o600))
+	for _, key := range []string{"../secret", "games/../../secret", "/etc/passwd", "games//g1/game.zip"} {
+		_, err = c.StatObject(ctx, key)
+		require.ErrorIs(t, err, ErrNotFound, key)
+	}
+	_, err = c.PutObject(ctx, "../escape", strings.NewReader("x"))
+	require.Error(t, err)
+}
+
+func TestFSClient_ListAndCleanupPrefix(t *testing.T) {
+	c := newTestFSClient(t)
+	ctx := context.Background()
+	for _, key := range []string{"temp/d1/a", "temp/d1/sub/b", "temp/d10/c", "games/g1/game.zip"} {
+		_, err := c.PutObject(ctx, key, strings.NewReader(key))
+		require.NoError(t, err)
+	}
+
+	keys := func(prefix string) []string {
+		objects, err := c.ListObjects(ctx, prefix)
+		require.NoError(t, err)
+		var out []string
+		for _, o := range objects {
+			out = append(out, o.Key)
+		}
+		return out
+	}
+	require.Equal(t, []string{"temp/d1/a", "temp/d1/sub/b"}, keys("temp/d1/"))
+	require.Equal(t, []string{"temp/d1/a", "temp/d1/sub/b", "temp/d10/c"}, keys("temp/d1"))
+	require.Empty(t, keys("nothing/here/"))
+
+	require.NoError(t, c.CleanupPrefix(ctx, "temp/d1/"))
+	require.Equal(t, []string{"games/g1/game.zip", "temp/d10/c"}, keys(""))
+	_, err := os.Stat(filepath.Join(c.root, "temp", "d1"))
+	require.True(t, errors.Is(err, os.ErrNotExist), "emptied directories are removed")
+	require.NoError(t, c.CleanupPrefix(ctx, "temp/d1/"), "nothing left to remove")
+}
+
+func TestFSClient_SignedURLs(t *testing.T) {
+	c := newTestFSClient(t)
+	ctx := context.Background()
+
+	raw, err := c.GetPresignedURL(ctx, "games/g 1/game.zip", time.Minute)
+	require.NoError(t, err)
+	u, err := url.Parse(raw)
+	require.NoError(t, err)
+	require.Equal(t, "dl.example.com", u.Host)
+	require.Equal(t, FSObjectPath+"games/g 1/game.zip", u.Path)
+	q := u.Query()
+	require.NoError(t, c.VerifySignature("games/g 1/game.zip", q.Get("expires"), q.Get("signature")))
+
+	require.ErrorIs(t, c.VerifySignature("games/g 2/game.zip", q.Get("expires"), q.Get("signature")), ErrInvalidSignature)
+	require.ErrorIs(t, c.VerifySignature("games/g 1/game.zip", "9999999999", q.Get("signature")), ErrInvalidSignature)
+
+	expired, err := c.GetPresignedURL(ctx, "games/g1/game.zip", -time.Minute)
+	require.NoError(t, err)
+	u, _ = url.Parse(expired)
+	require.ErrorIs(t, c.VerifySignature("games/g1/game.zip", u.Query().Get("expires"), u.Query().Get("signature")), ErrInvalidSignature)
+}
@@ -0,0 +1,255 @@
+package s3
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "math"
+    "math/rand/v2"
+    "sort"
+    "sync"
+    "time"
+
+    "download-service/internal/observability"
+)
+
+// ErrNoOrigin is returned when every origin's circuit is open.
+var ErrNoOrigin = errors.New("s3 no storage origin available")
+
+// Origin is one bucket the same objects are replicated to.
+type Origin struct {
+    Name    string
+    Region  string
+    Weight  int // share of traffic among origins of equal preference; at least 1
+    Storage Interface
+}
+
+// MultiOptions configures MultiClient.
+type MultiOptions struct {
+    Origins     []Origin
+    LocalRegion string        // preferred when a request carries no region hint
+    CBThreshold int           // consecutive failures to open an origin's circuit
+    CBCooldown  time.Duration // open state duration
+}
+
+// RegionalPresigner is implemented by storage that can pick the origin of a
+// presigned URL by the client's region.
+type RegionalPresigner interface {
+    GetPresignedURLIn(ctx context.Context, objectKey string, lifetime time.Duration, region string) (string, error)
+}
+
+type origin struct {
+    Origin
+
+    mu          sync.Mutex
+    failCount   int
+    circuitOpen bool
+    reopenAt    time.Time
+}
+
+// MultiClient spreads requests over several origins by region and weight. Reads
+// fail over to the next origin when one errors or lacks the object, and an
+// origin that keeps failing is skipped until its circuit cools down, the way
+// the library client guards the Library Service.
+type MultiClient struct {
+    origins     []*origin
+    localRegion string
+    cbThresh    int
+    cbCooldown  time.Duration
+    rnd         func() float64
+}
+
+// NewMultiClient creates storage backed by the given origins.
+func NewMultiClient(opts MultiOptions) (*MultiClient, error) {
+    if len(opts.Origins) == 0 {
+        return nil, errors.New("at least one storage origin is required")
+    }
+    m := &MultiClient{
+        localRegion: opts.LocalRegion,
+        cbThresh:    opts.CBThreshold,
+        cbCooldown:  opts.CBCooldown,
+        rnd:         rand.Float64,
+    }
+    if m.cbThresh <= 0 {
+        m.cbThresh = 5
+    }
+    if m.cbCooldown <= 0 {
+        m.cbCooldown = 10 * time.Second
+    }
+    for _, o := range opts.Origins {
+        if o.Storage == nil {
+            return nil, fmt.Errorf("storage origin %q has no client", o.Name)
+        }
+        if o.Weight < 1 {
+            o.Weight = 1
+        }
+        m.origins = append(m.origins, &origin{Origin: o})
+        observability.SetStorageOriginCircuitState(o.Name, false)
+    }
+    return m, nil
+}
+
+// circuitAllows returns whether a request may proceed and updates state for half-open.
+func (o *origin) circuitAllows() bool {
+    o.mu.Lock()
+    defer o.mu.Unlock()
+    if !o.circuitOpen {
+        return true
+    }
+    if time.Now().After(o.reopenAt) {
+        o.circuitOpen = false
+        o.failCount = 0
+        observability.SetStorageOriginCircuitState(o.Name, false)
+        return true
+    }
+    return false
+}
+
+func (o *origin) markSuccess() {
+    o.mu.Lock()
+    o.failCount = 0
+    o.circuitOpen = false
+    o.mu.Unlock()
+}
+
+func (o *origin) markFailure(threshold int, cooldown time.Duration) {
+    o.mu.Lock()
+    o.failCount++
+    if o.failCount >= threshold && !o.circuitOpen {
+        o.circuitOpen = true
+        o.reopenAt = time.Now().Add(cooldown)
+        observability.SetStorageOriginCircuitState(o.Name, true)
+    }
+    o.mu.Unlock()
+}
+
+// order returns the origins to try: those in region first, then the rest, each
+// group in a random order weighted by Weight.
+func (m *MultiClient) order(region string) []*origin {
+    if region == "" {
+        region = m.localRegion
+    }
+    type ranked struct {
+        o     *origin
+        local bool
+        key   float64
+    }
+    rs := make([]ranked, len(m.origins))
+    for i, o := range m.origins {
+        // Weighted random order: sorting by -ln(u)/w puts heavier origins first
+        // proportionally more often.
+        rs[i] = ranked{o: o, local: region != "" && o.Region == region, key: -math.Log(1-m.rnd()) / float64(o.Weight)}
+    }
+    sort.SliceStable(rs, func(i, j int) bool {
+        if rs[i].local != rs[j].local {
+            return rs[i].local
+        }
+        return rs[i].key < rs[j].key
+    })
+    out := make([]*origin, len(rs))
+    for i, r := range rs {
+        out[i] = r.o
+    }
+    return out
+}
+
+// failover calls fn on each origin in order until one succeeds. ErrNotFound moves
+// on without counting against the origin; ErrInvalidRange is final.
+func (m *MultiClient) failover(ctx context.Context, region, op string, fn func(Interface) error) error {
+    var lastErr error
+    for _, o := range m.order(region) {
+        if !o.circuitAllows() {
+            observability.RecordStorageOriginRequest(o.Name, op, "circuit_open")
+            continue
+        }
+        err := fn(o.Storage)
+        switch {
+        case err == nil:
+            o.markSuccess()
+            observability.RecordStorageOriginRequest(o.Name, op, "success")
+            return nil
+        case errors.Is(err, ErrNotFound):
+            o.markSuccess()
+            observability.RecordStorageOriginRequest(o.Name, op, "not_found")
+        case errors.Is(err, ErrInvalidRange):
+            o.markSuccess()
+            observability.RecordStorageOriginRequest(o.Name, op, "success")
+            return err
+        case ctx.Err() != nil:
+            // The caller gave up; the origin is not to blame.
+            return err
+        default:
+            o.markFailure(m.cbThresh, m.cbCooldown)
+            observability.RecordStorageOriginRequest(o.Name, op, "error")
+        }
+        if lastErr == nil || !errors.Is(err, ErrNotFound) {
+            lastErr = err
+        }
+    }
+    if lastErr == nil {
+        return ErrNoOrigin
+    }
+    return lastErr
+}
+
+// GetPresignedURL presigns the object at the first available origin.
+func (m *MultiClient) GetPresignedURL(ctx context.Context, objectKey string, lifetime time.Duration) (string, error) {
+    return m.GetPresignedURLIn(ctx, objectKey, lifetime, "")
+}
+
+// GetPresignedURLIn presigns the object at the first available origin, preferring
+// origins in region. Presigning is local, so the origin's health comes from reads.
+func (m *MultiClient) GetPresignedURLIn(ctx context.Context, objectKey string, lifetime time.Duration, region string) (string, error) {
+    var url string
+    err := m.failover(ctx, region, "GetPresignedURL", func(s Interface) error {
+        var err error
+        url, err = s.GetPresignedURL(ctx, objectKey, lifetime)
+        return err
+    })
+    return url, err
+}
+
+// StatObject returns the object's metadata from the first origin that has it.
+func (m *MultiClient) StatObject(ctx context.Context, objectKey string) (ObjectInfo, error) {
+    var info ObjectInfo
+    err := m.failover(ctx, "", "StatObject", func(s Interface) error {
+        var err error
+        info, err = s.StatObject(ctx, objectKey)
+        return err
+    })
+    return info, err
+}
+
+// GetObjectRange streams the range from the first origin that has the object.
+func (m *MultiClient) GetObjectRange(ctx context.Context, objectKey string, offset, length int64) (io.ReadCloser, error) {
+    var body io.ReadCloser
+    err := m.failover(ctx, "", "GetObjectRange", func(s Interface) error {
+        var err error
+        body, err = s.GetObjectRange(ctx, objectKey, offset, length)
+        return err
+    })
+    return body, err
+}
+
+// ListObjects lists the objects of the first available origin.
+func (m *MultiClient) ListObjects(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+    var out []ObjectInfo
+    err := m.failover(ctx, "", "ListObjects", func(s Interface) error {
+        var err error
+        out, err = s.ListObjects(ctx, prefix)
+        return err
+    })
+    return out, err
+}
+
+// CleanupPrefix removes the objects with the prefix from every origin.
+func (m *MultiClient) CleanupPrefix(ctx context.Context, prefix string) error {
+    var errs []error
+    for _, o := range m.origins {
+        if err := o.Storage.CleanupPrefix(ctx, prefix); err != nil && !errors.Is(err, ErrNotFound) {
+            errs = append(errs, fmt.Errorf("origin %s: %w", o.Name, err))
+        }
+    }
+    return errors.Join(errs...)
+}
@@ -0,0 +1,139 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// flakyClient fails every call while down is set.
+type flakyClient struct {
+	*MockClient
+	down  atomic.Bool
+	calls atomic.Int32
+}
+
+var errOriginDown = errors.New("origin unreachable")
+
+func (c *flakyClient) StatObject(ctx context.Context, key string) (ObjectInfo, error) {
+	c.calls.Add(1)
+	if c.down.Load() {
+		return ObjectInfo{}, errOriginDown
+	}
+	return c.MockClient.StatObject(ctx, key)
+}
+
+func (c *flakyClient) GetObjectRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	c.calls.Add(1)
+	if c.down.Load() {
+		return nil, errOriginDown
+	}
+	return c.MockClient.GetObjectRange(ctx, key, offset, length)
+}
+
+func newOriginTestClient(t *testing.T) (*MultiClient, *flakyClient, *flakyClient) {
+	t.Helper()
+	eu := &flakyClient{MockClient: NewMockClient()}
+	us := &flakyClient{MockClient: NewMockClient()}
+	eu.bucket, us.bucket = "eu", "us"
+	m, err := NewMultiClient(MultiOptions{
+		Origins: []Origin{
+			{Name: "eu", Region: "eu-central-1", Weight: 3, Storage: eu},
+			{Name: "us", Region: "us-east-1", Weight: 1, Storage: us},
+		},
+		LocalRegion: "eu-central-1",
+		CBThreshold: 2,
+		CBCooldown:  time.Minute,
+	})
+	require.NoError(t, err)
+	return m, eu, us
+}
+
+func TestMultiClient_PrefersRegion(t *testing.T) {
+	m, _, _ := newOriginTestClient(t)
+	ctx := context.Background()
+
+	url, err := m.GetPresignedURLIn(ctx, "games/g1/game.zip", time.Minute, "us-east-1")
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(url, "mock://us/"), url)
+	url, err = m.GetPresignedURL(ctx, "games/g1/game.zip", time.Minute)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(url, "mock://eu/"), "the local region without a hint: %s", url)
+
+	// Without a region match the weights decide.
+	m.localRegion = ""
+	m.rnd = rand.New(rand.NewPCG(1, 2)).Float64
+	counts := map[string]int{}
+	for i := 0; i < 400; i++ {
+		url, err := m.GetPresignedURLIn(ctx, "games/g1/game.zip", time.Minute, "ap-south-1")
+		require.NoError(t, err)
+		counts[url[len("mock://"):len("mock://")+2]]++
+	}
+	require.Greater(t, counts["eu"], 2*counts["us"], "%v", counts)
+	require.Positive(t, counts["us"])
+}
+
+func TestMultiClient_FailsOver(t *testing.T) {
+	m, eu, us := newOriginTestClient(t)
+	ctx := context.Background()
+	us.PutObject("games/g1/game.zip", 4, []byte("data"))
+
+	// Missing at the primary: served by the secondary.
+	info, err := m.StatObject(ctx, "games/g1/game.zip")
+	require.NoError(t, err)
+	require.Equal(t, int64(4), info.Size)
+	_, err = m.StatObject(ctx, "games/g1/missing.zip")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	// Primary down: reads move on, and after CBThreshold failures the primary is
+	// not asked at all until its circuit cools down.
+	eu.PutObject("games/g1/game.zip", 4, []byte("data"))
+	eu.down.Store(true)
+	before := eu.calls.Load()
+	for i := 0; i < 3; i++ {
+		rc, err := m.GetObjectRange(ctx, "games/g1/game.zip", 1, 2)
+		require.NoError(t, err)
+		data, _ := io.ReadAll(rc)
+		require.Equal(t, "at", string(data))
+	}
+	require.Equal(t, before+2, eu.calls.Load())
+
+	m.origins[0].mu.Lock()
+	m.origins[0].reopenAt = time.Now()
+	m.origins[0].mu.Unlock()
+	eu.down.Store(false)
+	_, err = m.StatObject(ctx, "games/g1/game.zip")
+	require.NoError(t, err)
+	require.Equal(t, before+3, eu.calls.Load(), "asked again after the cooldown")
+
+	// Every origin down.
+	eu.down.Store(true)
+	us.down.Store(true)
+	_, err = m.StatObject(ctx, "games/g1/game.zip")
+	require.ErrorIs(t, err, errOriginDown)
+	_, err = m.StatObject(ctx, "games/g1/game.zip")
+	require.ErrorIs(t, err, errOriginDown)
+	_, err = m.StatObject(ctx, "games/g1/game.zip")
+	require.ErrorIs(t, err, ErrNoOrigin)
+}
+
+func TestMultiClient_CleanupPrefixEverywhere(t *testing.T) {
+	m, eu, us := newOriginTestClient(t)
+	ctx := context.Background()
+	eu.PutObject("temp/d1/a", 1, []byte("a"))
+	us.PutObject("temp/d1/b", 1, []byte("b"))
+
+	require.NoError(t, m.CleanupPrefix(ctx, "temp/d1/"))
+	for _, c := range []*flakyClient{eu, us} {
+		left, err := c.ListObjects(ctx, "temp/")
+		require.NoError(t, err)
+		require.Empty(t, left)
+	}
+}
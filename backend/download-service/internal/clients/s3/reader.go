@@ -0,0 +1,78 @@
+package s3
+
+import (
+    "context"
+    "errors"
+    "io"
+)
+
+// ObjectReader exposes a stored object as an io.ReadSeekCloser backed by ranged reads,
+// so it can be handed to http.ServeContent. A ranged read is opened lazily on the
+// first Read after each Seek.
+type ObjectReader struct {
+    ctx     context.Context
+    storage Interface
+    key     string
+    size    int64
+    offset  int64
+    body    io.ReadCloser
+}
+
+// NewObjectReader returns a reader over an object of the given size.
+func NewObjectReader(ctx context.Context, storage Interface, key string, size int64) *ObjectReader {
+    return &ObjectReader{ctx: ctx, storage: storage, key: key, size: size}
+}
+
+func (r *ObjectReader) Read(p []byte) (int, error) {
+    if r.offset >= r.size {
+        return 0, io.EOF
+    }
+    if r.body == nil {
+        body, err := r.storage.GetObjectRange(r.ctx, r.key, r.offset, r.size-r.offset)
+        if err != nil {
+            return 0, err
+        }
+        r.body = body
+    }
+    n, err := r.body.Read(p)
+    r.offset += int64(n)
+    if errors.Is(err, io.EOF) && r.offset < r.size {
+        return n, io.ErrUnexpectedEOF
+    }
+    return n, err
+}
+
+func (r *ObjectReader) Seek(offset int64, whence int) (int64, error) {
+    var abs int64
+    switch whence {
+    case io.SeekStart:
+        abs = offset
+    case io.SeekCurrent:
+        abs = r.offset + offset
+    case io.SeekEnd:
+        abs = r.size + offset
+    default:
+        return 0, errors.New("s3: invalid whence")
+    }
+    if abs < 0 {
+        return 0, errors.New("s3: negative position")
+    }
+    if abs != r.offset {
+        r.closeBody()
+    }
+    r.offset = abs
+    return abs, nil
+}
+
+func (r *ObjectReader) Close() error {
+    return r.closeBody()
+}
+
+func (r *ObjectReader) closeBody() error {
+    if r.body == nil {
+        return nil
+    }
+    err := r.body.Close()
+    r.body = nil
+    return err
+}
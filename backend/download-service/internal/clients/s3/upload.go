@@ -0,0 +1,282 @@
+package s3
+
+import (
+    "bytes"
+    "context"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "io"
+    "sort"
+
+    "github.com/aws/aws-sdk-go-v2/aws"
+    v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+    awss3 "github.com/aws/aws-sdk-go-v2/service/s3"
+    "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// ErrChecksumMismatch is returned when an uploaded part does not match its
+// size or SHA-256 checksum.
+var ErrChecksumMismatch = errors.New("s3 checksum mismatch")
+
+// CompletedPart is an uploaded part of a multipart upload.
+type CompletedPart struct {
+    Number int32
+    ETag   string
+    SHA256 []byte
+}
+
+// Uploader is implemented by storage that accepts multipart uploads. Parts are
+// numbered from 1; the upload's object appears only once it is completed.
+type Uploader interface {
+    CreateMultipartUpload(ctx context.Context, objectKey string) (string, error)
+    // UploadPart stores exactly size bytes of body, which must hash to sha256.
+    UploadPart(ctx context.Context, objectKey, uploadID string, number int32, body io.Reader, size int64, sha256 []byte) (CompletedPart, error)
+    CompleteMultipartUpload(ctx context.Context, objectKey, uploadID string, parts []CompletedPart) (ObjectInfo, error)
+    AbortMultipartUpload(ctx context.Context, objectKey, uploadID string) error
+}
+
+// PutSmallObject stores content as a single-part upload, e.g. a manifest.
+func PutSmallObject(ctx context.Context, u Uploader, objectKey string, content []byte) (ObjectInfo, error) {
+    id, err := u.CreateMultipartUpload(ctx, objectKey)
+    if err != nil {
+        return ObjectInfo{}, err
+    }
+    sum := sha256.Sum256(content)
+    part, err := u.UploadPart(ctx, objectKey, id, 1, bytes.NewReader(content), int64(len(content)), sum[:])
+    if err != nil {
+        _ = u.AbortMultipartUpload(ctx, objectKey, id)
+        return ObjectInfo{}, err
+    }
+    return u.CompleteMultipartUpload(ctx, objectKey, id, []CompletedPart{part})
+}
+
+func apiErrorCode(err error) string {
+    var apiErr interface{ ErrorCode() string }
+    if errors.As(err, &apiErr) {
+        return apiErr.ErrorCode()
+    }
+    return ""
+}
+
+// CreateMultipartUpload starts a multipart upload with SHA-256 part checksums.
+func (c *Client) CreateMultipartUpload(ctx context.Context, objectKey string) (string, error) {
+    out, err := c.s3Client.CreateMultipartUpload(ctx, &awss3.CreateMultipartUploadInput{
+        Bucket:            aws.String(c.bucket),
+        Key:               aws.String(objectKey),
+        ChecksumAlgorithm: types.ChecksumAlgorithmSha256,
+    })
+    if err != nil {
+        return "", err
+    }
+    return aws.ToString(out.UploadId), nil
+}
+
+// UploadPart streams a part to S3, which rejects it if it does not match the checksum.
+func (c *Client) UploadPart(ctx context.Context, objectKey, uploadID string, number int32, body io.Reader, size int64, sum []byte) (CompletedPart, error) {
+    checksum := base64.StdEncoding.EncodeToString(sum)
+    out, err := c.s3Client.UploadPart(ctx, &awss3.UploadPartInput{
+        Bucket:         aws.String(c.bucket),
+        Key:            aws.String(objectKey),
+        UploadId:       aws.String(uploadID),
+        PartNumber:     aws.Int32(number),
+        Body:           body,
+        ContentLength:  aws.Int64(size),
+        ChecksumSHA256: aws.String(checksum),
+    }, awss3.WithAPIOptions(
+        // The body is streamed, so it cannot be hashed up front for the signature;
+        // the part checksum protects it instead.
+        v4.SwapComputePayloadSHA256ForUnsignedPayloadMiddleware,
+    ))
+    if err != nil {
+        switch apiErrorCode(err) {
+        case "BadDigest", "InvalidDigest", "IncompleteBody":
+            return CompletedPart{}, ErrChecksumMismatch
+        case "NoSuchUpload":
+            return CompletedPart{}, ErrNotFound
+        }
+        return CompletedPart{}, err
+    }
+    return CompletedPart{Number: number, ETag: aws.ToString(out.ETag), SHA256: sum}, nil
+}
+
+// CompleteMultipartUpload assembles the parts into the object.
+func (c *Client) CompleteMultipartUpload(ctx context.Context, objectKey, uploadID string, parts []CompletedPart) (ObjectInfo, error) {
+    completed := make([]types.CompletedPart, len(parts))
+    for i, p := range parts {
+        completed[i] = types.CompletedPart{
+            PartNumber:     aws.Int32(p.Number),
+            ETag:           aws.String(p.ETag),
+            ChecksumSHA256: aws.String(base64.StdEncoding.EncodeToString(p.SHA256)),
+        }
+    }
+    _, err := c.s3Client.CompleteMultipartUpload(ctx, &awss3.CompleteMultipartUploadInput{
+        Bucket:          aws.String(c.bucket),
+        Key:             aws.String(objectKey),
+        UploadId:        aws.String(uploadID),
+        MultipartUpload: &types.CompletedMultipartUpload{Parts: completed},
+    })
+    if err != nil {
+        switch apiErrorCode(err) {
+        case "NoSuchUpload":
+            return ObjectInfo{}, ErrNotFound
+        case "InvalidPart", "InvalidPartOrder", "EntityTooSmall":
+            return ObjectInfo{}, fmt.Errorf("%w: %v", ErrChecksumMismatch, err)
+        }
+        return ObjectInfo{}, err
+    }
+    return c.StatObject(ctx, objectKey)
+}
+
+// AbortMultipartUpload discards an upload and its parts.
+func (c *Client) AbortMultipartUpload(ctx context.Context, objectKey, uploadID string) error {
+    _, err := c.s3Client.AbortMultipartUpload(ctx, &awss3.AbortMultipartUploadInput{
+        Bucket:   aws.String(c.bucket),
+        Key:      aws.String(objectKey),
+        UploadId: aws.String(uploadID),
+    })
+    if err != nil && apiErrorCode(err) == "NoSuchUpload" {
+        return ErrNotFound
+    }
+    return err
+}
+
+// readPart reads exactly size bytes of body and checks them against sum.
+func readPart(body io.Reader, size int64, sum []byte) ([]byte, error) {
+    data, err := io.ReadAll(io.LimitReader(body, size+1))
+    if err != nil {
+        return nil, err
+    }
+    got := sha256.Sum256(data)
+    if int64(len(data)) != size || !bytes.Equal(got[:], sum) {
+        return nil, ErrChecksumMismatch
+    }
+    return data, nil
+}
+
+func newUploadID() string {
+    b := make([]byte, 16)
+    _, _ = rand.Read(b)
+    return hex.EncodeToString(b)
+}
+
+type mockUpload struct {
+    key   string
+    parts map[int32][]byte
+}
+
+func (m *MockClient) CreateMultipartUpload(ctx context.Context, objectKey string) (string, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    if m.uploads == nil {
+        m.uploads = make(map[string]*mockUpload)
+    }
+    id := newUploadID()
+    m.uploads[id] = &mockUpload{key: objectKey, parts: make(map[int32][]byte)}
+    return id, nil
+}
+
+func (m *MockClient) UploadPart(ctx context.Context, objectKey, uploadID string, number int32, body io.Reader, size int64, sum []byte) (CompletedPart, error) {
+    data, err := readPart(body, size, sum)
+    if err != nil {
+        return CompletedPart{}, err
+    }
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    up, ok := m.uploads[uploadID]
+    if !ok || up.key != objectKey {
+        return CompletedPart{}, ErrNotFound
+    }
+    up.parts[number] = data
+    return CompletedPart{Number: number, ETag: hex.EncodeToString(sum), SHA256: sum}, nil
+}
+
+func (m *MockClient) CompleteMultipartUpload(ctx context.Context, objectKey, uploadID string, parts []CompletedPart) (ObjectInfo, error) {
+    m.mu.Lock()
+    up, ok := m.uploads[uploadID]
+    if !ok || up.key != objectKey {
+        m.mu.Unlock()
+        return ObjectInfo{}, ErrNotFound
+    }
+    var content []byte
+    for _, p := range sortedParts(parts) {
+        data, ok := up.parts[p.Number]
+        if !ok {
+            m.mu.Unlock()
+            return ObjectInfo{}, fmt.Errorf("%w: part %d was not uploaded", ErrChecksumMismatch, p.Number)
+        }
+        content = append(content, data...)
+    }
+    delete(m.uploads, uploadID)
+    m.mu.Unlock()
+    m.PutObject(objectKey, int64(len(content)), content)
+    return m.StatObject(ctx, objectKey)
+}
+
+func (m *MockClient) AbortMultipartUpload(ctx context.Context, objectKey, uploadID string) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    if _, ok := m.uploads[uploadID]; !ok {
+        return ErrNotFound
+    }
+    delete(m.uploads, uploadID)
+    return nil
+}
+
+// PendingUploads returns the number of multipart uploads neither completed nor aborted.
+func (m *MockClient) PendingUploads() int {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    return len(m.uploads)
+}
+
+func sortedParts(parts []CompletedPart) []CompletedPart {
+    out := append([]CompletedPart(nil), parts...)
+    sort.Slice(out, func(i, j int) bool { return out[i].Number < out[j].Number })
+    return out
+}
+
+// Uploads go to the first configured origin; bucket replication copies them to
+// the others.
+func (m *MultiClient) uploader() (Uploader, error) {
+    u, ok := m.origins[0].Storage.(Uploader)
+    if !ok {
+        return nil, fmt.Errorf("storage origin %s does not accept uploads", m.origins[0].Name)
+    }
+    return u, nil
+}
+
+func (m *MultiClient) CreateMultipartUpload(ctx context.Context, objectKey string) (string, error) {
+    u, err := m.uploader()
+    if err != nil {
+        return "", err
+    }
+    return u.CreateMultipartUpload(ctx, objectKey)
+}
+
+func (m *MultiClient) UploadPart(ctx context.Context, objectKey, uploadID string, number int32, body io.Reader, size int64, sum []byte) (CompletedPart, error) {
+    u, err := m.uploader()
+    if err != nil {
+        return CompletedPart{}, err
+    }
+    return u.UploadPart(ctx, objectKey, uploadID, number, body, size, sum)
+}
+
+func (m *MultiClient) CompleteMultipartUpload(ctx context.Context, objectKey, uploadID string, parts []CompletedPart) (ObjectInfo, error) {
+    u, err := m.uploader()
+    if err != nil {
+        return ObjectInfo{}, err
+    }
+    return u.CompleteMultipartUpload(ctx, objectKey, uploadID, parts)
+}
+
+func (m *MultiClient) AbortMultipartUpload(ctx context.Context, objectKey, uploadID string) error {
+    u, err := m.uploader()
+    if err != nil {
+        return err
+    }
+    return u.AbortMultipartUpload(ctx, objectKey, uploadID)
+}
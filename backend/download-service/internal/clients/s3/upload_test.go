@@ -0,0 +1,94 @@
+package s3
+
+import (
+	"context"
+	"crypto/sha256"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// uploadStorage is storage that also accepts multipart uploads.
+type uploadStorage interface {
+	Interface
+	Uploader
+}
+
+func TestUploaders_MultipartUpload(t *testing.T) {
+	for name, newStorage := range map[string]func(t *testing.T) uploadStorage{
+		"mock": func(t *testing.T) uploadStorage { return NewMockClient() },
+		"fs":   func(t *testing.T) uploadStorage { return newTestFSClient(t) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			c := newStorage(t)
+			ctx := context.Background()
+			key := "games/g1/versions/2.0/files/bin/game"
+
+			id, err := c.CreateMultipartUpload(ctx, key)
+			require.NoError(t, err)
+			put := func(n int32, data string) (CompletedPart, error) {
+				sum := sha256.Sum256([]byte(data))
+				return c.UploadPart(ctx, key, id, n, strings.NewReader(data), int64(len(data)), sum[:])
+			}
+
+			// Parts may arrive out of order and be sent again.
+			p2, err := put(2, "world")
+			require.NoError(t, err)
+			_, err = put(1, "HELLO ")
+			require.NoError(t, err)
+			p1, err := put(1, "hello ")
+			require.NoError(t, err)
+
+			// A body that does not match its checksum or size is refused.
+			sum := sha256.Sum256([]byte("other"))
+			_, err = c.UploadPart(ctx, key, id, 3, strings.NewReader("wrong"), 5, sum[:])
+			require.ErrorIs(t, err, ErrChecksumMismatch)
+			sum = sha256.Sum256([]byte("short"))
+			_, err = c.UploadPart(ctx, key, id, 3, strings.NewReader("short"), 6, sum[:])
+			require.ErrorIs(t, err, ErrChecksumMismatch)
+
+			_, err = c.StatObject(ctx, key)
+			require.ErrorIs(t, err, ErrNotFound, "the object appears only once completed")
+
+			info, err := c.CompleteMultipartUpload(ctx, key, id, []CompletedPart{p2, p1})
+			require.NoError(t, err)
+			require.Equal(t, int64(11), info.Size)
+			rc, err := c.GetObjectRange(ctx, key, 0, info.Size)
+			require.NoError(t, err)
+			data, _ := io.ReadAll(rc)
+			rc.Close()
+			require.Equal(t, "hello world", string(data))
+
+			_, err = put(1, "again")
+			require.ErrorIs(t, err, ErrNotFound, "a completed upload takes no more parts")
+		})
+	}
+}
+
+func TestUploaders_AbortAndSmallObjects(t *testing.T) {
+	ctx := context.Background()
+	m := NewMockClient()
+	fs := newTestFSClient(t)
+	for _, c := range []Uploader{m, fs} {
+		id, err := c.CreateMultipartUpload(ctx, "games/g1/tmp")
+		require.NoError(t, err)
+		sum := sha256.Sum256([]byte("x"))
+		_, err = c.UploadPart(ctx, "games/g1/tmp", id, 1, strings.NewReader("x"), 1, sum[:])
+		require.NoError(t, err)
+		require.NoError(t, c.AbortMultipartUpload(ctx, "games/g1/tmp", id))
+		require.ErrorIs(t, c.AbortMultipartUpload(ctx, "games/g1/tmp", id), ErrNotFound)
+
+		info, err := PutSmallObject(ctx, c, "games/g1/manifest.json", []byte(`{"files":[]}`))
+		require.NoError(t, err)
+		require.Equal(t, int64(12), info.Size)
+	}
+	require.Zero(t, m.PendingUploads())
+
+	// Upload directories are neither objects nor left behind.
+	objects, err := fs.ListObjects(ctx, "")
+	require.NoError(t, err)
+	require.Len(t, objects, 1)
+	require.Equal(t, "games/g1/manifest.json", objects[0].Key)
+}
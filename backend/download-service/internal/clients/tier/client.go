@@ -0,0 +1,101 @@
+// Package tier resolves the subscription tier of a user, which decides how fast
+// and how many downloads they may run.
+package tier
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "io"
+    "net/http"
+    "net/url"
+    "strings"
+    "time"
+)
+
+// Interface is implemented by tier providers.
+type Interface interface {
+    // UserTier returns the user's tier name, or "" when the user has no subscription.
+    UserTier(ctx context.Context, userID string) (string, error)
+}
+
+type ctxKey struct{}
+
+// NewContext returns a context carrying a tier already known for the request,
+// e.g. from a token claim, so providers need not be asked.
+func NewContext(ctx context.Context, tier string) context.Context {
+    return context.WithValue(ctx, ctxKey{}, tier)
+}
+
+// FromContext returns the tier stored by NewContext.
+func FromContext(ctx context.Context) (string, bool) {
+    t, _ := ctx.Value(ctxKey{}).(string)
+    return t, t != ""
+}
+
+// Options configures the subscription service client.
+type Options struct {
+    BaseURL             string
+    Timeout             time.Duration
+    InternalHeaderName  string // e.g., X-Internal-Token
+    InternalHeaderValue string
+    HTTPClient          *http.Client // optional custom client
+}
+
+// Client asks the subscription service for a user's tier.
+type Client struct {
+    baseURL  string
+    hc       *http.Client
+    hdrName  string
+    hdrValue string
+}
+
+func NewClient(opts Options) *Client {
+    hc := opts.HTTPClient
+    if hc == nil {
+        timeout := opts.Timeout
+        if timeout <= 0 {
+            timeout = 2 * time.Second
+        }
+        hc = &http.Client{Timeout: timeout}
+    }
+    return &Client{
+        baseURL:  strings.TrimRight(opts.BaseURL, "/"),
+        hc:       hc,
+        hdrName:  opts.InternalHeaderName,
+        hdrValue: opts.InternalHeaderValue,
+    }
+}
+
+type tierResponse struct {
+    Tier string `json:"tier"`
+}
+
+// UserTier fetches the tier of the user's active subscription.
+func (c *Client) UserTier(ctx context.Context, userID string) (string, error) {
+    req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/api/subscriptions/user/"+url.PathEscape(userID)+"/tier", nil)
+    if err != nil {
+        return "", err
+    }
+    if c.hdrName != "" && c.hdrValue != "" {
+        req.Header.Set(c.hdrName, c.hdrValue)
+    }
+    req.Header.Set("Accept", "application/json")
+
+    resp, err := c.hc.Do(req)
+    if err != nil {
+        return "", err
+    }
+    defer resp.Body.Close()
+    switch {
+    case resp.StatusCode == http.StatusNotFound:
+        return "", nil
+    case resp.StatusCode < 200 || resp.StatusCode >= 300:
+        return "", fmt.Errorf("tier client: http %d", resp.StatusCode)
+    }
+    var out tierResponse
+    if err := json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&out); err != nil {
+        return "", fmt.Errorf("decode response: %w", err)
+    }
+    return out.Tier, nil
+}
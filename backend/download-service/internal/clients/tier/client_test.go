@@ -0,0 +1,47 @@
+package tier
+
+import (
+    "context"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "time"
+
+    "github.com/stretchr/testify/require"
+)
+
+func TestClient_UserTier(t *testing.T) {
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        require.Equal(t, "secret", r.Header.Get("X-Internal-Token"))
+        switch r.URL.Path {
+        case "/api/subscriptions/user/u1/tier":
+            _ = json.NewEncoder(w).Encode(map[string]any{"tier": "premium"})
+        case "/api/subscriptions/user/u2/tier":
+            http.NotFound(w, r)
+        default:
+            w.WriteHeader(http.StatusInternalServerError)
+        }
+    }))
+    defer srv.Close()
+
+    c := NewClient(Options{BaseURL: srv.URL + "/", Timeout: time.Second, InternalHeaderName: "X-Internal-Token", InternalHeaderValue: "secret"})
+    got, err := c.UserTier(context.Background(), "u1")
+    require.NoError(t, err)
+    require.Equal(t, "premium", got)
+
+    got, err = c.UserTier(context.Background(), "u2")
+    require.NoError(t, err)
+    require.Empty(t, got)
+
+    _, err = c.UserTier(context.Background(), "u3")
+    require.Error(t, err)
+}
+
+func TestContext(t *testing.T) {
+    _, ok := FromContext(context.Background())
+    require.False(t, ok)
+    got, ok := FromContext(NewContext(context.Background(), "plus"))
+    require.True(t, ok)
+    require.Equal(t, "plus", got)
+}
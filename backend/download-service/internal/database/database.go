@@ -38,7 +38,7 @@ func migrate(db *gorm.DB) error {
 	}
 
 	// AutoMigrate models
-	if err := db.AutoMigrate(&models.Download{}, &models.DownloadFile{}); err != nil {
+	if err := db.AutoMigrate(&models.Download{}, &models.DownloadFile{}, &models.DownloadEvent{}, &models.AuditEntry{}); err != nil {
 		return err
 	}
 
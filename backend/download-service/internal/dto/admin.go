@@ -0,0 +1,42 @@
+package dto
+
+import "download-service/internal/models"
+
+// AdminActionRequest explains why an operator cancels or retries a download.
+type AdminActionRequest struct {
+	Reason string `json:"reason" binding:"max=500"`
+}
+
+// ForceFailRequest gives the failure reason the user will see.
+type ForceFailRequest struct {
+	Reason string `json:"reason" binding:"required,max=500"`
+}
+
+// AuditEntryResponse is one recorded admin action.
+type AuditEntryResponse struct {
+	ID           string            `json:"id"`
+	Actor        string            `json:"actor"`
+	Action       string            `json:"action"`
+	DownloadID   string            `json:"downloadId,omitempty"`
+	TargetUserID string            `json:"targetUserId,omitempty"`
+	Reason       string            `json:"reason,omitempty"`
+	Details      map[string]string `json:"details,omitempty"`
+	Outcome      string            `json:"outcome"`
+	RequestID    string            `json:"requestId,omitempty"`
+	CreatedAt    int64             `json:"createdAt"`
+}
+
+func FromAuditEntry(e models.AuditEntry) AuditEntryResponse {
+	return AuditEntryResponse{
+		ID:           e.ID,
+		Actor:        e.Actor,
+		Action:       e.Action,
+		DownloadID:   e.DownloadID,
+		TargetUserID: e.TargetUserID,
+		Reason:       e.Reason,
+		Details:      e.Details,
+		Outcome:      e.Outcome,
+		RequestID:    e.RequestID,
+		CreatedAt:    e.CreatedAt.Unix(),
+	}
+}
@@ -0,0 +1,39 @@
+package dto
+
+// Operations a client can send over the download control channel.
+const (
+	ControlPause       = "pause"
+	ControlResume      = "resume"
+	ControlCancel      = "cancel"
+	ControlSetSpeed    = "set_speed"
+	ControlSetPriority = "set_priority"
+)
+
+// Types of messages the server sends over the control channel.
+const (
+	ControlReply     = "reply"
+	ControlEvent     = "event"
+	ControlKeepAlive = "keepalive"
+)
+
+// ControlCommand is a message the client sends over the control channel.
+type ControlCommand struct {
+	RequestID      string `json:"requestId"` // echoed in the reply
+	Op             string `json:"op"`
+	DownloadID     string `json:"downloadId"`
+	BytesPerSecond int64  `json:"bytesPerSecond,omitempty"` // set_speed
+	Priority       *int   `json:"priority,omitempty"`       // set_priority
+}
+
+// ControlMessage is a message the server sends over the control channel: the
+// reply to a command, a download event or a keepalive.
+type ControlMessage struct {
+	Type      string                 `json:"type"`
+	RequestID string                 `json:"requestId,omitempty"`
+	Status    int                    `json:"status,omitempty"` // HTTP status the command would have had
+	Error     string                 `json:"error,omitempty"`
+	Download  *DownloadResponse      `json:"download,omitempty"` // state after a successful command
+	Event     string                 `json:"event,omitempty"`    // event type, for Type "event"
+	EventID   string                 `json:"eventId,omitempty"`  // resume position, as with Last-Event-ID
+	Data      *DownloadEventResponse `json:"data,omitempty"`
+}
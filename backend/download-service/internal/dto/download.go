@@ -1,11 +1,28 @@
 package dto
 
-import "download-service/internal/models"
+import (
+    "time"
+
+    "download-service/internal/cache"
+    "download-service/internal/models"
+)
 
 // Requests
 type StartDownloadRequest struct {
-    UserID string `json:"userId" binding:"omitempty,uuid4"`
-    GameID string `json:"gameId" binding:"required,uuid4"`
+    UserID      string           `json:"userId" binding:"omitempty,uuid4"`
+    GameID      string           `json:"gameId" binding:"required,uuid4"`
+    Type        string           `json:"type" binding:"omitempty,oneof=full update"`
+    FromVersion string           `json:"fromVersion" binding:"required_if=Type update"` // installed version, for updates
+    Version     string           `json:"version"`                                       // update target; the current build when empty
+    Schedule    *ScheduleRequest `json:"schedule"`                                      // start later or only within set hours
+}
+
+// StartBatchRequest asks for full downloads of the listed games, or of every
+// game the user owns.
+type StartBatchRequest struct {
+    GameIDs  []string         `json:"gameIds" binding:"omitempty,max=200,dive,uuid4"`
+    AllOwned bool             `json:"allOwned"`
+    Schedule *ScheduleRequest `json:"schedule"` // applied to every download
 }
 
 type PauseDownloadRequest struct {
@@ -16,18 +33,66 @@ type ResumeDownloadRequest struct {
     DownloadID string `json:"downloadId" binding:"required,uuid4"`
 }
 
+type SetPriorityRequest struct {
+    Priority *int `json:"priority" binding:"required,min=0,max=100"`
+}
+
+// ReorderQueueRequest lists pending downloads in the order they should start.
+type ReorderQueueRequest struct {
+    DownloadIDs []string `json:"downloadIds" binding:"required,min=1,max=200,dive,required"`
+}
+
+// ScheduleRequest restricts when a download may transfer. Windows are daily hour
+// spans [from, to) read in timezone and wrap past midnight when from > to; offPeak
+// limits the download to the service's off-peak hours. An empty schedule removes it.
+type ScheduleRequest struct {
+    StartAt  *time.Time          `json:"startAt"`
+    Windows  []models.HourWindow `json:"windows" binding:"max=24"`
+    OffPeak  bool                `json:"offPeak"`
+    Timezone string              `json:"timezone"`
+}
+
+func (r *ScheduleRequest) ToModel() *models.DownloadSchedule {
+    if r == nil {
+        return nil
+    }
+    return &models.DownloadSchedule{StartAt: r.StartAt, Windows: r.Windows, OffPeak: r.OffPeak, Timezone: r.Timezone}
+}
+
 // Responses
+// BatchItemResponse is the outcome for one game of a batch; Status is the HTTP
+// status the game would have had as a single request.
+type BatchItemResponse struct {
+    GameID   string            `json:"gameId"`
+    Status   int               `json:"status"`
+    Download *DownloadResponse `json:"download,omitempty"`
+    Error    string            `json:"error,omitempty"`
+}
+
+type StartBatchResponse struct {
+    Items   []BatchItemResponse `json:"items"`
+    Created int                 `json:"created"`
+    Failed  int                 `json:"failed"`
+}
+
 type DownloadResponse struct {
-    ID             string `json:"id"`
-    UserID         string `json:"userId"`
-    GameID         string `json:"gameId"`
-    Status         string `json:"status"`
-    Progress       int    `json:"progress"`
-    TotalSize      int64  `json:"totalSize"`
-    DownloadedSize int64  `json:"downloadedSize"`
-    Speed          int64  `json:"speed"`
-    CreatedAt      int64  `json:"createdAt"`
-    UpdatedAt      int64  `json:"updatedAt"`
+    ID             string                   `json:"id"`
+    UserID         string                   `json:"userId"`
+    GameID         string                   `json:"gameId"`
+    Status         string                   `json:"status"`
+    Type           string                   `json:"type"`
+    Version        string                   `json:"version,omitempty"`
+    FromVersion    string                   `json:"fromVersion,omitempty"`
+    Progress       int                      `json:"progress"`
+    TotalSize      int64                    `json:"totalSize"`
+    DownloadedSize int64                    `json:"downloadedSize"`
+    Speed          int64                    `json:"speed"`
+    Priority       int                      `json:"priority"`
+    Tier           string                   `json:"tier,omitempty"`
+    Schedule       *models.DownloadSchedule `json:"schedule,omitempty"`
+    FailureReason  string                   `json:"failureReason,omitempty"`
+    CreatedAt      int64                    `json:"createdAt"`
+    UpdatedAt      int64                    `json:"updatedAt"`
 }
 
 func FromModel(d models.Download) DownloadResponse {
@@ -36,11 +101,118 @@ func FromModel(d models.Download) DownloadResponse {
         UserID:         d.UserID,
         GameID:         d.GameID,
         Status:         string(d.Status),
+        Type:           string(d.Type),
+        Version:        d.Version,
+        FromVersion:    d.FromVersion,
         Progress:       d.Progress,
         TotalSize:      d.TotalSize,
         DownloadedSize: d.DownloadedSize,
         Speed:          d.Speed,
+        Priority:       d.Priority,
+        Tier:           d.Tier,
+        Schedule:       d.Schedule,
+        FailureReason:  d.FailureReason,
         CreatedAt:      d.CreatedAt.Unix(),
         UpdatedAt:      d.UpdatedAt.Unix(),
     }
 }
+
+type ChunkFailureResponse struct {
+    Index  int    `json:"index"`
+    Offset int64  `json:"offset"`
+    Size   int64  `json:"size"`
+    Reason string `json:"reason"`
+}
+
+// DownloadURLResponse lists signed URLs of the files a download transfers. URL
+// repeats the only file's URL for single-file builds.
+type DownloadURLResponse struct {
+    URL   string            `json:"url,omitempty"`
+    Files []FileURLResponse `json:"files"`
+}
+
+type FileURLResponse struct {
+    Path string `json:"path"`
+    Size int64  `json:"size"`
+    URL  string `json:"url"`
+}
+
+type FileVerificationResponse struct {
+    FileID         string                 `json:"fileId"`
+    Path           string                 `json:"path"`
+    Status         string                 `json:"status"`
+    ExpectedSHA256 string                 `json:"expectedSha256,omitempty"`
+    ActualSHA256   string                 `json:"actualSha256,omitempty"`
+    FailedChunks   []ChunkFailureResponse `json:"failedChunks,omitempty"`
+    Repairing      bool                   `json:"repairing,omitempty"` // the failed chunks are being fetched again
+}
+
+type VerificationResponse struct {
+    DownloadID string                     `json:"downloadId"`
+    Status     string                     `json:"status"`
+    Files      []FileVerificationResponse `json:"files"`
+}
+
+// TransitionResponse is one entry of a download's status history.
+type TransitionResponse struct {
+    From      string `json:"from,omitempty"`
+    To        string `json:"to"`
+    Actor     string `json:"actor"`
+    Reason    string `json:"reason,omitempty"`
+    CreatedAt int64  `json:"createdAt"`
+}
+
+func FromTransition(e models.DownloadEvent) TransitionResponse {
+    return TransitionResponse{
+        From:      string(e.FromStatus),
+        To:        string(e.ToStatus),
+        Actor:     e.Actor,
+        Reason:    e.Reason,
+        CreatedAt: e.CreatedAt.Unix(),
+    }
+}
+
+// DownloadEventResponse is the data of a server-sent download event.
+type DownloadEventResponse struct {
+    DownloadID     string `json:"downloadId"`
+    Status         string `json:"status"`
+    Progress       int    `json:"progress"`
+    DownloadedSize int64  `json:"downloadedSize"`
+    TotalSize      int64  `json:"totalSize"`
+    Speed          int64  `json:"speed"`
+    FileID         string `json:"fileId,omitempty"`
+    Error          string `json:"error,omitempty"`
+    At             int64  `json:"at"` // unix milliseconds
+}
+
+func FromEvent(ev cache.DownloadEvent) DownloadEventResponse {
+    return DownloadEventResponse{
+        DownloadID:     ev.DownloadID,
+        Status:         ev.Status,
+        Progress:       ev.Progress,
+        DownloadedSize: ev.DownloadedSize,
+        TotalSize:      ev.TotalSize,
+        Speed:          ev.Speed,
+        FileID:         ev.FileID,
+        Error:          ev.Error,
+        At:             ev.AtUnixMilli,
+    }
+}
+
+// IssueTokenRequest scopes a download token. The token is bound to the caller's
+// address unless clientCidr names other clients.
+type IssueTokenRequest struct {
+    FileID     string `json:"fileId"`
+    ClientCIDR string `json:"clientCidr"`
+    Range      *struct {
+        Start int64 `json:"start" binding:"min=0"`
+        End   int64 `json:"end" binding:"gtefield=Start"`
+    } `json:"range"` // inclusive byte offsets of the file; requires fileId
+    TTLSeconds int `json:"ttlSeconds" binding:"min=0"`
+}
+
+type DownloadTokenResponse struct {
+    Token     string `json:"token"`
+    URL       string `json:"url,omitempty"` // edge URL of the file, when the token is bound to one
+    ExpiresAt int64  `json:"expiresAt"`
+}
@@ -0,0 +1,15 @@
+package dto
+
+// EntitlementRevokedRequest is the library's notice that a user lost a game.
+type EntitlementRevokedRequest struct {
+	EventID string `json:"eventId" binding:"max=200"`
+	UserID  string `json:"userId" binding:"required,uuid4"`
+	GameID  string `json:"gameId" binding:"required,uuid4"`
+	Reason  string `json:"reason" binding:"max=500"` // e.g. "refund" or "chargeback"
+}
+
+// EntitlementRevokedResponse lists the downloads the revocation cancelled.
+type EntitlementRevokedResponse struct {
+	EventID   string   `json:"eventId,omitempty"`
+	Cancelled []string `json:"cancelled"`
+}
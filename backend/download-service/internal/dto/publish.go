@@ -0,0 +1,55 @@
+package dto
+
+import "download-service/internal/cache"
+
+// CreateBuildUploadRequest announces a new build version and its files.
+type CreateBuildUploadRequest struct {
+	Version  string                   `json:"version" binding:"required,max=64"`
+	PartSize int64                    `json:"partSize" binding:"min=0"` // the service default when zero
+	Files    []BuildUploadFileRequest `json:"files" binding:"required,min=1,max=1000,dive"`
+}
+
+type BuildUploadFileRequest struct {
+	Path   string `json:"path" binding:"required,max=1024"`
+	Size   int64  `json:"size" binding:"min=0"`
+	SHA256 string `json:"sha256" binding:"required,len=64,hexadecimal"`
+}
+
+// BuildUploadResponse describes an upload in progress: which parts each file is
+// sent in and which of them have been stored.
+type BuildUploadResponse struct {
+	ID        string                    `json:"id"`
+	GameID    string                    `json:"gameId"`
+	Version   string                    `json:"version"`
+	PartSize  int64                     `json:"partSize"`
+	Files     []BuildUploadFileResponse `json:"files"`
+	Uploaded  []UploadedPartResponse    `json:"uploaded"`
+	CreatedAt int64                     `json:"createdAt"`
+}
+
+type BuildUploadFileResponse struct {
+	Index int    `json:"index"`
+	Path  string `json:"path"`
+	Size  int64  `json:"size"`
+	Parts int    `json:"parts"` // 0 for empty files, which need no parts
+}
+
+type UploadedPartResponse struct {
+	File   int    `json:"file"`
+	Part   int32  `json:"part"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+func FromUploadedPart(p cache.UploadedPart) UploadedPartResponse {
+	return UploadedPartResponse{File: p.File, Part: p.Number, Size: p.Size, SHA256: p.SHA256}
+}
+
+// PublishedBuildResponse is the build version a completed upload registered.
+type PublishedBuildResponse struct {
+	GameID    string `json:"gameId"`
+	Version   string `json:"version"`
+	BuildID   string `json:"buildId"`
+	Files     int    `json:"files"`
+	TotalSize int64  `json:"totalSize"`
+}
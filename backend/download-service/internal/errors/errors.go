@@ -17,3 +17,28 @@ func (e FileCorruptedError) Error() string { return fmt.Sprintf("file corrupted:
 type StorageError struct{ Msg string }
 func (e StorageError) Error() string { return fmt.Sprintf("storage error: %s", e.Msg) }
 
+type GameBuildNotFoundError struct{ GameID string }
+func (e GameBuildNotFoundError) Error() string { return fmt.Sprintf("game build not found: %s", e.GameID) }
+
+type ManifestInvalidError struct{ GameID, Reason string }
+func (e ManifestInvalidError) Error() string { return fmt.Sprintf("invalid manifest for game %s: %s", e.GameID, e.Reason) }
+type ChunkCorruptedError struct{ ObjectKey string; Offset, Size int64 }
+func (e ChunkCorruptedError) Error() string { return fmt.Sprintf("chunk corrupted: %s (offset %d, %d bytes)", e.ObjectKey, e.Offset, e.Size) }
+
+type LeaseConflictError struct{ ID string }
+func (e LeaseConflictError) Error() string { return fmt.Sprintf("download %s is running on another replica", e.ID) }
+
+type InvalidTransitionError struct{ ID, From, To string }
+func (e InvalidTransitionError) Error() string { return fmt.Sprintf("download %s cannot move from %s to %s", e.ID, e.From, e.To) }
+
+type DuplicateDownloadError struct{ GameID, DownloadID string }
+func (e DuplicateDownloadError) Error() string { return fmt.Sprintf("game %s already has an unfinished download %s", e.GameID, e.DownloadID) }
+
+type InvalidTokenError struct{ Reason string }
+func (e InvalidTokenError) Error() string { return fmt.Sprintf("invalid download token: %s", e.Reason) }
+
+type UploadNotFoundError struct{ ID string }
+func (e UploadNotFoundError) Error() string { return fmt.Sprintf("upload not found: %s", e.ID) }
+
+type BuildVersionExistsError struct{ GameID, Version string }
+func (e BuildVersionExistsError) Error() string { return fmt.Sprintf("game %s already has a build version %s", e.GameID, e.Version) }
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+    "context"
+    "net/http"
+    "strconv"
+
+    "github.com/gin-gonic/gin"
+
+    "download-service/internal/dto"
+    derr "download-service/internal/errors"
+    intramw "download-service/internal/middleware"
+    "download-service/internal/models"
+    "download-service/internal/repository"
+    "download-service/internal/services"
+)
+
+// AdminHandler serves the operator API. Access is checked by the router; the
+// handlers only identify the operator for the audit log.
+type AdminHandler struct {
+    svc *services.AdminService
+}
+
+func NewAdminHandler(svc *services.AdminService) *AdminHandler {
+    return &AdminHandler{svc: svc}
+}
+
+// RegisterRoutes wires the admin routes under the given (already guarded) group.
+func (h *AdminHandler) RegisterRoutes(r *gin.RouterGroup) {
+    downloads := r.Group("/downloads")
+    downloads.GET("", h.listDownloads)
+    downloads.GET("/:id", h.getDownload)
+    downloads.GET("/:id/history", h.downloadHistory)
+    downloads.POST("/:id/cancel", h.forceCancel)
+    downloads.POST("/:id/fail", h.forceFail)
+    downloads.POST("/:id/retry", h.retry)
+
+    r.GET("/audit", h.auditLog)
+}
+
+// listDownloads lists downloads of all users, filtered by ?userId=, ?gameId= and ?status=.
+func (h *AdminHandler) listDownloads(c *gin.Context) {
+    op, ok := operator(c)
+    if !ok {
+        return
+    }
+    f := repository.DownloadFilter{
+        UserID: c.Query("userId"),
+        GameID: c.Query("gameId"),
+        Status: models.DownloadStatus(c.Query("status")),
+    }
+    switch f.Status {
+    case "", models.StatusPending, models.StatusDownloading, models.StatusPaused,
+        models.StatusCompleted, models.StatusFailed, models.StatusCancelled:
+    default:
+        httpError(c, derr.ValidationError{Msg: "unknown status " + string(f.Status)})
+        return
+    }
+    f.Limit, f.Offset = page(c)
+    list, err := h.svc.ListDownloads(c.Request.Context(), op, f)
+    if err != nil {
+        httpError(c, err)
+        return
+    }
+    resp := make([]dto.DownloadResponse, 0, len(list))
+    for _, d := range list {
+        resp = append(resp, dto.FromModel(d))
+    }
+    c.JSON(http.StatusOK, gin.H{"items": resp, "limit": f.Limit, "offset": f.Offset, "count": len(resp)})
+}
+
+func (h *AdminHandler) getDownload(c *gin.Context) {
+    op, ok := operator(c)
+    if !ok {
+        return
+    }
+    d, err := h.svc.GetDownload(c.Request.Context(), op, c.Param("id"))
+    if err != nil {
+        httpError(c, err)
+        return
+    }
+    c.JSON(http.StatusOK, dto.FromModel(*d))
+}
+
+func (h *AdminHandler) downloadHistory(c *gin.Context) {
+    op, ok := operator(c)
+    if !ok {
+        return
+    }
+    events, err := h.svc.DownloadHistory(c.Request.Context(), op, c.Param("id"))
+    if err != nil {
+        httpError(c, err)
+        return
+    }
+    resp := make([]dto.TransitionResponse, 0, len(events))
+    for _, e := range events {
+        resp = append(resp, dto.FromTransition(e))
+    }
+    c.JSON(http.StatusOK, gin.H{"items": resp, "count": len(resp)})
+}
+
+func (h *AdminHandler) forceCancel(c *gin.Context) {
+    var req dto.AdminActionRequest
+    if !bindOptionalJSON(c, &req) {
+        return
+    }
+    h.act(c, req.Reason, h.svc.ForceCancel)
+}
+
+func (h *AdminHandler) forceFail(c *gin.Context) {
+    var req dto.ForceFailRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        httpError(c, derr.ValidationError{Msg: err.Error()})
+        return
+    }
+    h.act(c, req.Reason, h.svc.ForceFail)
+}
+
+func (h *AdminHandler) retry(c *gin.Context) {
+    var req dto.AdminActionRequest
+    if !bindOptionalJSON(c, &req) {
+        return
+    }
+    h.act(c, req.Reason, h.svc.Retry)
+}
+
+type adminAction func(ctx context.Context, op services.Operator, downloadID, reason string) (*models.Download, error)
+
+func (h *AdminHandler) act(c *gin.Context, reason string, action adminAction) {
+    op, ok := operator(c)
+    if !ok {
+        return
+    }
+    d, err := action(c.Request.Context(), op, c.Param("id"), reason)
+    if err != nil {
+        httpError(c, err)
+        return
+    }
+    c.JSON(http.StatusOK, dto.FromModel(*d))
+}
+
+// auditLog lists recorded admin actions, filtered by ?actor=, ?downloadId= and ?action=.
+func (h *AdminHandler) auditLog(c *gin.Context) {
+    f := repository.AuditFilter{
+        Actor:      c.Query("actor"),
+        DownloadID: c.Query("downloadId"),
+        Action:     c.Query("action"),
+    }
+    f.Limit, f.Offset = page(c)
+    list, err := h.svc.AuditLog(c.Request.Context(), f)
+    if err != nil {
+        httpError(c, err)
+        return
+    }
+    resp := make([]dto.AuditEntryResponse, 0, len(list))
+    for _, e := range list {
+        resp = append(resp, dto.FromAuditEntry(e))
+    }
+    c.JSON(http.StatusOK, gin.H{"items": resp, "limit": f.Limit, "offset": f.Offset, "count": len(resp)})
+}
+
+// operator identifies the caller for the audit log.
+func operator(c *gin.Context) (services.Operator, bool) {
+    uid, ok := intramw.UserIDFromContext(c)
+    if !ok {
+        httpError(c, derr.AccessDeniedError{Reason: "missing user identity"})
+        return services.Operator{}, false
+    }
+    return services.Operator{UserID: uid, RequestID: c.GetString(intramw.RequestIDKey)}, true
+}
+
+// bindOptionalJSON binds the body if there is one.
+func bindOptionalJSON(c *gin.Context, req any) bool {
+    if c.Request.ContentLength == 0 {
+        return true
+    }
+    if err := c.ShouldBindJSON(req); err != nil {
+        httpError(c, derr.ValidationError{Msg: err.Error()})
+        return false
+    }
+    return true
+}
+
+// page reads ?limit= (default 50, at most 200) and ?offset=.
+func page(c *gin.Context) (limit, offset int) {
+    limit = 50
+    if v := c.Query("limit"); v != "" {
+        if n, err := strconv.Atoi(v); err == nil && n >= 0 && n <= 200 {
+            limit = n
+        }
+    }
+    if v := c.Query("offset"); v != "" {
+        if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+            offset = n
+        }
+    }
+    return limit, offset
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+
+	"download-service/internal/cache"
+	"download-service/internal/dto"
+	derr "download-service/internal/errors"
+	intramw "download-service/internal/middleware"
+	"download-service/internal/models"
+)
+
+// controlChannel upgrades to a WebSocket over which the authenticated user sends
+// commands for their downloads and receives the events of all of them. Events
+// resume after Last-Event-ID (or ?lastEventId=) like the SSE streams.
+func (h *DownloadHandler) controlChannel(c *gin.Context) {
+	uid, ok := intramw.UserIDFromContext(c)
+	if !ok {
+		httpError(c, derr.AccessDeniedError{Reason: "missing user identity"})
+		return
+	}
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+	events, err := h.svc.UserDownloadEvents(ctx, uid, lastEventID(c))
+	if err != nil {
+		httpError(c, err)
+		return
+	}
+
+	srv := websocket.Server{
+		// Origins are already enforced by the CORS middleware; desktop clients send none.
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler: func(ws *websocket.Conn) {
+			// The hijacked connection keeps the server's read and write timeouts otherwise.
+			_ = ws.SetDeadline(time.Time{})
+			h.serveControl(ctx, ws, uid, events)
+		},
+	}
+	srv.ServeHTTP(c.Writer, c.Request)
+}
+
+func (h *DownloadHandler) serveControl(ctx context.Context, ws *websocket.Conn, uid string, events <-chan cache.DownloadEvent) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	replies := make(chan dto.ControlMessage)
+	go func() {
+		defer cancel()
+		for {
+			var raw []byte
+			if err := websocket.Message.Receive(ws, &raw); err != nil {
+				return
+			}
+			var cmd dto.ControlCommand
+			reply := dto.ControlMessage{Type: dto.ControlReply}
+			if err := json.Unmarshal(raw, &cmd); err != nil {
+				reply.Status, reply.Error = http.StatusBadRequest, "malformed command: "+err.Error()
+			} else {
+				reply = h.runControl(ctx, uid, cmd)
+			}
+			select {
+			case replies <- reply:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		var msg dto.ControlMessage
+		select {
+		case <-ctx.Done():
+			return
+		case msg = <-replies:
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			data := dto.FromEvent(ev)
+			msg = dto.ControlMessage{Type: dto.ControlEvent, Event: ev.Type, EventID: ev.ID, Data: &data}
+		case <-keepAlive.C:
+			msg = dto.ControlMessage{Type: dto.ControlKeepAlive}
+		}
+		if err := websocket.JSON.Send(ws, msg); err != nil {
+			return
+		}
+	}
+}
+
+// runControl executes one command through the same service calls, and therefore
+// the same ownership checks, as the REST endpoints.
+func (h *DownloadHandler) runControl(ctx context.Context, uid string, cmd dto.ControlCommand) dto.ControlMessage {
+	reply := dto.ControlMessage{Type: dto.ControlReply, RequestID: cmd.RequestID}
+	var err error
+	switch {
+	case cmd.DownloadID == "":
+		err = derr.ValidationError{Msg: "missing downloadId"}
+	case cmd.Op == dto.ControlPause:
+		err = h.svc.PauseDownload(ctx, uid, cmd.DownloadID)
+	case cmd.Op == dto.ControlResume:
+		err = h.svc.ResumeDownload(ctx, uid, cmd.DownloadID)
+	case cmd.Op == dto.ControlCancel:
+		err = h.svc.CancelDownload(ctx, uid, cmd.DownloadID)
+	case cmd.Op == dto.ControlSetSpeed:
+		err = h.svc.SetDownloadSpeed(ctx, uid, cmd.DownloadID, cmd.BytesPerSecond)
+	case cmd.Op == dto.ControlSetPriority:
+		if cmd.Priority == nil {
+			err = derr.ValidationError{Msg: "missing priority"}
+		} else {
+			err = h.svc.SetDownloadPriority(ctx, uid, cmd.DownloadID, *cmd.Priority)
+		}
+	default:
+		err = derr.ValidationError{Msg: "unknown op " + cmd.Op}
+	}
+	if err == nil {
+		var d *models.Download
+		if d, err = h.svc.GetDownload(ctx, uid, cmd.DownloadID); err == nil {
+			resp := dto.FromModel(*d)
+			reply.Status, reply.Download = http.StatusOK, &resp
+			return reply
+		}
+	}
+	reply.Status, reply.Error = errorStatus(err), err.Error()
+	return reply
+}
@@ -32,14 +32,24 @@ func NewDownloadHandler(svc *services.DownloadService, rdb *redis.Client) *Downl
 func (h *DownloadHandler) RegisterRoutes(r *gin.RouterGroup) {
     downloads := r.Group("/downloads")
     downloads.POST("", h.startDownload)
+    downloads.POST("/batch", h.startBatch)
+    downloads.GET("/ws", h.controlChannel)
     downloads.GET("/:id", h.getDownload)
+    downloads.GET("/:id/events", h.downloadEvents)
+    downloads.GET("/:id/history", h.downloadHistory)
     downloads.PUT("/:id/pause", h.pauseDownload)
     downloads.PUT("/:id/resume", h.resumeDownload)
     downloads.DELETE("/:id", h.cancelDownload)
     downloads.PUT("/:id/speed", h.setDownloadSpeed)
+    downloads.PUT("/:id/priority", h.setDownloadPriority)
+    downloads.PUT("/:id/schedule", h.setDownloadSchedule)
+    downloads.DELETE("/:id/schedule", h.clearDownloadSchedule)
 
     users := r.Group("/users")
     users.GET("/:userId/downloads", h.listUserDownloads)
+    users.GET("/:userId/downloads/events", h.userDownloadEvents)
+    users.GET("/:userId/downloads/queue", h.downloadQueue)
+    users.PUT("/:userId/downloads/queue", h.reorderQueue)
     users.GET("/:userId/library/games", h.listUserLibraryGames)
 }
 
@@ -73,6 +83,67 @@ func (h *DownloadHandler) setDownloadSpeed(c *gin.Context) {
     c.Status(http.StatusOK)
 }
 
+func (h *DownloadHandler) setDownloadPriority(c *gin.Context) {
+    id := c.Param("id")
+    if id == "" {
+        httpError(c, derr.ValidationError{Msg: "missing id"})
+        return
+    }
+    uid, ok := intramw.UserIDFromContext(c)
+    if !ok {
+        httpError(c, derr.AccessDeniedError{Reason: "missing user identity"})
+        return
+    }
+    var req dto.SetPriorityRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        httpError(c, derr.ValidationError{Msg: err.Error()})
+        return
+    }
+
+    if err := h.svc.SetDownloadPriority(c.Request.Context(), uid, id, *req.Priority); err != nil {
+        httpError(c, err)
+        return
+    }
+    d, err := h.svc.GetDownload(c.Request.Context(), uid, id)
+    if err != nil {
+        httpError(c, err)
+        return
+    }
+    c.JSON(http.StatusOK, dto.FromModel(*d))
+}
+
+func (h *DownloadHandler) setDownloadSchedule(c *gin.Context) {
+    var req dto.ScheduleRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        httpError(c, derr.ValidationError{Msg: err.Error()})
+        return
+    }
+    h.applySchedule(c, req.ToModel())
+}
+
+func (h *DownloadHandler) clearDownloadSchedule(c *gin.Context) {
+    h.applySchedule(c, nil)
+}
+
+func (h *DownloadHandler) applySchedule(c *gin.Context, schedule *models.DownloadSchedule) {
+    id := c.Param("id")
+    if id == "" {
+        httpError(c, derr.ValidationError{Msg: "missing id"})
+        return
+    }
+    uid, ok := intramw.UserIDFromContext(c)
+    if !ok {
+        httpError(c, derr.AccessDeniedError{Reason: "missing user identity"})
+        return
+    }
+    d, err := h.svc.SetDownloadSchedule(c.Request.Context(), uid, id, schedule)
+    if err != nil {
+        httpError(c, err)
+        return
+    }
+    c.JSON(http.StatusOK, dto.FromModel(*d))
+}
+
 func (h *DownloadHandler) cancelDownload(c *gin.Context) {
     id := c.Param("id")
     if id == "" {
@@ -92,20 +163,35 @@ func (h *DownloadHandler) cancelDownload(c *gin.Context) {
 }
 
 func httpError(c *gin.Context, err error) {
+    c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+}
+
+// errorStatus maps a service error to the HTTP status reported for it.
+func errorStatus(err error) int {
     switch err.(type) {
     case derr.ValidationError:
-        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return http.StatusBadRequest
+    case derr.InvalidTokenError:
+        return http.StatusUnauthorized
     case derr.AccessDeniedError:
-        c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
-    case derr.DownloadNotFoundError:
-        c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+        return http.StatusForbidden
+    case derr.DownloadNotFoundError, derr.GameBuildNotFoundError, derr.UploadNotFoundError:
+        return http.StatusNotFound
+    case derr.FileCorruptedError, derr.ChunkCorruptedError:
+        // Storage served bytes that do not match the build.
+        return http.StatusBadGateway
+    case derr.ManifestInvalidError:
+        // The build is published but unusable; retrying will not help.
+        return http.StatusUnprocessableEntity
+    case derr.LeaseConflictError, derr.InvalidTransitionError, derr.DuplicateDownloadError,
+        derr.BuildVersionExistsError:
+        return http.StatusConflict
     default:
         // Check for circuit breaker errors
         if err != nil && err.Error() == "library client: circuit open" {
-            c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
-            return
+            return http.StatusServiceUnavailable
         }
-        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return http.StatusInternalServerError
     }
 }
 
@@ -128,7 +214,13 @@ func (h *DownloadHandler) startDownload(c *gin.Context) {
         return
     }
 
-    d, err := h.svc.StartDownload(c.Request.Context(), req.UserID, req.GameID)
+    d, err := h.svc.Start(c.Request.Context(), req.UserID, services.DownloadRequest{
+        GameID:      req.GameID,
+        Type:        models.DownloadType(req.Type),
+        FromVersion: req.FromVersion,
+        Version:     req.Version,
+        Schedule:    req.Schedule.ToModel(),
+    })
     if err != nil {
         httpError(c, err)
         return
@@ -145,6 +237,45 @@ func (h *DownloadHandler) startDownload(c *gin.Context) {
     c.JSON(http.StatusCreated, dto.FromModel(*d))
 }
 
+// startBatch creates downloads of several games, e.g. the user's whole library.
+// Games are reported individually; the request only fails as a whole when it is
+// invalid or the library cannot be asked.
+func (h *DownloadHandler) startBatch(c *gin.Context) {
+    var req dto.StartBatchRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        httpError(c, derr.ValidationError{Msg: err.Error()})
+        return
+    }
+    uid, ok := intramw.UserIDFromContext(c)
+    if !ok {
+        httpError(c, derr.AccessDeniedError{Reason: "missing user identity"})
+        return
+    }
+    items, err := h.svc.StartBatch(c.Request.Context(), uid, services.BatchRequest{
+        GameIDs:  req.GameIDs,
+        AllOwned: req.AllOwned,
+        Schedule: req.Schedule.ToModel(),
+    })
+    if err != nil {
+        httpError(c, err)
+        return
+    }
+    resp := dto.StartBatchResponse{Items: make([]dto.BatchItemResponse, 0, len(items))}
+    for _, it := range items {
+        item := dto.BatchItemResponse{GameID: it.GameID, Status: http.StatusCreated}
+        if it.Err != nil {
+            item.Status, item.Error = errorStatus(it.Err), it.Err.Error()
+            resp.Failed++
+        } else {
+            d := dto.FromModel(*it.Download)
+            item.Download = &d
+            resp.Created++
+        }
+        resp.Items = append(resp.Items, item)
+    }
+    c.JSON(http.StatusOK, resp)
+}
+
 func (h *DownloadHandler) getDownload(c *gin.Context) {
     id := c.Param("id")
     if id == "" {
@@ -173,6 +304,29 @@ func (h *DownloadHandler) getDownload(c *gin.Context) {
     c.JSON(http.StatusOK, dto.FromModel(*d))
 }
 
+func (h *DownloadHandler) downloadHistory(c *gin.Context) {
+    id := c.Param("id")
+    if id == "" {
+        httpError(c, derr.ValidationError{Msg: "missing id"})
+        return
+    }
+    uid, ok := intramw.UserIDFromContext(c)
+    if !ok {
+        httpError(c, derr.AccessDeniedError{Reason: "missing user identity"})
+        return
+    }
+    events, err := h.svc.DownloadHistory(c.Request.Context(), uid, id)
+    if err != nil {
+        httpError(c, err)
+        return
+    }
+    resp := make([]dto.TransitionResponse, 0, len(events))
+    for _, e := range events {
+        resp = append(resp, dto.FromTransition(e))
+    }
+    c.JSON(http.StatusOK, gin.H{"items": resp, "count": len(resp)})
+}
+
 func (h *DownloadHandler) pauseDownload(c *gin.Context) {
     id := c.Param("id")
     if id == "" {
@@ -269,6 +423,66 @@ func (h *DownloadHandler) listUserDownloads(c *gin.Context) {
     c.JSON(http.StatusOK, gin.H{"items": resp, "limit": limit, "offset": offset, "count": len(resp)})
 }
 
+// downloadQueue lists the user's pending downloads in the order they will start.
+func (h *DownloadHandler) downloadQueue(c *gin.Context) {
+    uid, ok := h.pathUser(c)
+    if !ok {
+        return
+    }
+    list, err := h.svc.DownloadQueue(c.Request.Context(), uid)
+    if err != nil {
+        httpError(c, err)
+        return
+    }
+    c.JSON(http.StatusOK, queueResponse(list))
+}
+
+// reorderQueue moves the listed pending downloads to the front of the queue.
+func (h *DownloadHandler) reorderQueue(c *gin.Context) {
+    uid, ok := h.pathUser(c)
+    if !ok {
+        return
+    }
+    var req dto.ReorderQueueRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        httpError(c, derr.ValidationError{Msg: err.Error()})
+        return
+    }
+    list, err := h.svc.ReorderQueue(c.Request.Context(), uid, req.DownloadIDs)
+    if err != nil {
+        httpError(c, err)
+        return
+    }
+    c.JSON(http.StatusOK, queueResponse(list))
+}
+
+// pathUser returns the :userId of the route after checking it is the caller.
+func (h *DownloadHandler) pathUser(c *gin.Context) (string, bool) {
+    pathUserID := c.Param("userId")
+    if pathUserID == "" {
+        httpError(c, derr.ValidationError{Msg: "missing userId"})
+        return "", false
+    }
+    authUserID, ok := intramw.UserIDFromContext(c)
+    if !ok {
+        httpError(c, derr.AccessDeniedError{Reason: "missing user identity"})
+        return "", false
+    }
+    if pathUserID != authUserID {
+        httpError(c, derr.AccessDeniedError{Reason: "cannot access downloads of another user"})
+        return "", false
+    }
+    return pathUserID, true
+}
+
+func queueResponse(list []models.Download) gin.H {
+    resp := make([]dto.DownloadResponse, 0, len(list))
+    for _, d := range list {
+        resp = append(resp, dto.FromModel(d))
+    }
+    return gin.H{"items": resp, "count": len(resp)}
+}
+
 func (h *DownloadHandler) listUserLibraryGames(c *gin.Context) {
     pathUserID := c.Param("userId")
     if pathUserID == "" {
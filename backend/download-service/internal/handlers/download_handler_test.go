@@ -4,8 +4,10 @@ import (
     "bytes"
     "context"
     "encoding/json"
+    "fmt"
     "net/http"
     "net/http/httptest"
+    "sort"
     "sync"
     "testing"
     "time"
@@ -13,7 +15,9 @@ import (
     "github.com/gin-gonic/gin"
     "github.com/stretchr/testify/suite"
 
+    "download-service/internal/clients/s3"
     "download-service/internal/models"
+    "download-service/internal/repository"
     "download-service/internal/services"
     plog "download-service/pkg/logger"
     "gorm.io/gorm"
@@ -22,6 +26,8 @@ import (
 type downloadHandlerSuite struct {
     suite.Suite
     repo        *memDownloadRepo
+    fileRepo    *memDownloadFileRepo
+    storage     *s3.MockClient
     stream      *services.StreamService
     svc         *services.DownloadService
     router      *gin.Engine
@@ -42,7 +48,7 @@ func (r *memDownloadRepo) Create(ctx context.Context, d *models.Download) error
     defer r.mu.Unlock()
     r.seq++
     if d.ID == "" {
-        d.ID = time.Now().Format("150405.000000")
+        d.ID = fmt.Sprintf("dl-%d", r.seq)
     }
     now := time.Now()
     d.CreatedAt = now
@@ -54,12 +60,11 @@ func (r *memDownloadRepo) Create(ctx context.Context, d *models.Download) error
 func (r *memDownloadRepo) GetByID(ctx context.Context, id string) (*models.Download, error) {
     r.mu.Lock()
     defer r.mu.Unlock()
-    v, ok := r.m[id]
-    if !ok {
-        return nil, gorm.ErrRecordNotFound
+    if v, ok := r.m[id]; ok {
+        vv := v
+        return &vv, nil
     }
-    vv := v
-    return &vv, nil
+    return nil, gorm.ErrRecordNotFound
 }
 
 func (r *memDownloadRepo) Update(ctx context.Context, d *models.Download) error {
@@ -115,6 +120,36 @@ func (r *memDownloadRepo) UpdateProgress(ctx context.Context, id string, progres
     return gorm.ErrRecordNotFound
 }
 
+func (r *memDownloadRepo) Transition(ctx context.Context, id string, from, to models.DownloadStatus, reason string) (bool, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    d, ok := r.m[id]
+    if !ok || d.Status != from {
+        return false, nil
+    }
+    d.Status = to
+    if to == models.StatusFailed {
+        d.FailureReason = reason
+    } else if from == models.StatusFailed {
+        d.FailureReason = ""
+    }
+    d.UpdatedAt = time.Now()
+    r.m[id] = d
+    return true, nil
+}
+
+func (r *memDownloadRepo) UpdatePriority(ctx context.Context, id string, priority int) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    if d, ok := r.m[id]; ok {
+        d.Priority = priority
+        d.UpdatedAt = time.Now()
+        r.m[id] = d
+        return nil
+    }
+    return gorm.ErrRecordNotFound
+}
+
 func (r *memDownloadRepo) ListByUserAndStatus(ctx context.Context, userID string, status models.DownloadStatus, limit, offset int) ([]models.Download, error) {
     r.mu.Lock()
     defer r.mu.Unlock()
@@ -130,11 +165,11 @@ func (r *memDownloadRepo) ListByUserAndStatus(ctx context.Context, userID string
 func (r *memDownloadRepo) Delete(ctx context.Context, id string) error {
     r.mu.Lock()
     defer r.mu.Unlock()
-    if _, ok := r.m[id]; !ok {
-        return gorm.ErrRecordNotFound
+    if _, ok := r.m[id]; ok {
+        delete(r.m, id)
+        return nil
     }
-    delete(r.m, id)
-    return nil
+    return gorm.ErrRecordNotFound
 }
 
 func (r *memDownloadRepo) CountByUser(ctx context.Context, userID string) (int64, error) {
@@ -149,10 +184,338 @@ func (r *memDownloadRepo) CountByUser(ctx context.Context, userID string) (int64
     return count, nil
 }
 
+func (r *memDownloadRepo) ListByStatus(ctx context.Context, status models.DownloadStatus, limit, offset int) ([]models.Download, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    out := make([]models.Download, 0)
+    for _, v := range r.m {
+        if v.Status == status {
+            out = append(out, v)
+        }
+    }
+    sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+    if offset >= len(out) {
+        return []models.Download{}, nil
+    }
+    out = out[offset:]
+    if limit > 0 && len(out) > limit {
+        out = out[:limit]
+    }
+    return out, nil
+}
+
+func (r *memDownloadRepo) ListUnfinished(ctx context.Context, userID string, gameIDs []string) ([]models.Download, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    games := make(map[string]bool, len(gameIDs))
+    for _, id := range gameIDs {
+        games[id] = true
+    }
+    out := make([]models.Download, 0)
+    for _, v := range r.m {
+        if v.UserID == userID && games[v.GameID] && models.CanTransition(v.Status, models.StatusCancelled) {
+            out = append(out, v)
+        }
+    }
+    return out, nil
+}
+
+func (r *memDownloadRepo) AcquireLease(ctx context.Context, id, owner string, ttl time.Duration) (bool, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    d, ok := r.m[id]
+    if !ok {
+        return false, nil
+    }
+    now := time.Now()
+    if d.LeaseOwner != "" && d.LeaseOwner != owner && d.LeaseExpiresAt != nil && d.LeaseExpiresAt.After(now) {
+        return false, nil
+    }
+    exp := now.Add(ttl)
+    d.LeaseOwner, d.LeaseExpiresAt = owner, &exp
+    r.m[id] = d
+    return true, nil
+}
+
+func (r *memDownloadRepo) RenewLease(ctx context.Context, id, owner string, ttl time.Duration) (bool, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    d, ok := r.m[id]
+    if !ok || d.LeaseOwner != owner {
+        return false, nil
+    }
+    exp := time.Now().Add(ttl)
+    d.LeaseExpiresAt = &exp
+    r.m[id] = d
+    return true, nil
+}
+
+func (r *memDownloadRepo) ReleaseLease(ctx context.Context, id, owner string) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    if d, ok := r.m[id]; ok && d.LeaseOwner == owner {
+        d.LeaseOwner, d.LeaseExpiresAt = "", nil
+        r.m[id] = d
+    }
+    return nil
+}
+
+func (r *memDownloadRepo) ListOrphaned(ctx context.Context, now time.Time, afterID string, limit int) ([]models.Download, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    out := make([]models.Download, 0)
+    for _, v := range r.m {
+        expired := v.LeaseOwner != "" && v.LeaseExpiresAt != nil && v.LeaseExpiresAt.Before(now)
+        if v.ID > afterID && ((v.Status == models.StatusDownloading && (v.LeaseOwner == "" || expired)) || (v.Status == models.StatusPaused && expired)) {
+            out = append(out, v)
+        }
+    }
+    sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+    if limit > 0 && len(out) > limit {
+        out = out[:limit]
+    }
+    return out, nil
+}
+
+func (r *memDownloadRepo) CountByUserAndStatus(ctx context.Context, userID string, status models.DownloadStatus) (int64, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    count := int64(0)
+    for _, v := range r.m {
+        if v.UserID == userID && v.Status == status {
+            count++
+        }
+    }
+    return count, nil
+}
+
+func (r *memDownloadRepo) ListQueue(ctx context.Context, userID string, limit int) ([]models.Download, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    out := make([]models.Download, 0)
+    for _, v := range r.m {
+        if v.UserID == userID && v.Status == models.StatusPending {
+            out = append(out, v)
+        }
+    }
+    sort.Slice(out, func(i, j int) bool {
+        a, b := out[i], out[j]
+        if a.Priority != b.Priority {
+            return a.Priority > b.Priority
+        }
+        if a.QueuePosition != b.QueuePosition {
+            return a.QueuePosition < b.QueuePosition
+        }
+        return a.CreatedAt.Before(b.CreatedAt)
+    })
+    if limit > 0 && len(out) > limit {
+        out = out[:limit]
+    }
+    return out, nil
+}
+
+func (r *memDownloadRepo) SetQueueOrder(ctx context.Context, userID string, ids []string) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    for i, id := range ids {
+        if d, ok := r.m[id]; ok && d.UserID == userID && d.Status == models.StatusPending {
+            d.QueuePosition = int64(i - len(ids))
+            r.m[id] = d
+        }
+    }
+    return nil
+}
+
+func (r *memDownloadRepo) UpdateSchedule(ctx context.Context, id string, schedule *models.DownloadSchedule) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    if d, ok := r.m[id]; ok {
+        d.Schedule = schedule
+        d.UpdatedAt = time.Now()
+        r.m[id] = d
+        return nil
+    }
+    return gorm.ErrRecordNotFound
+}
+
+func (r *memDownloadRepo) ListScheduled(ctx context.Context, limit, offset int) ([]models.Download, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    out := make([]models.Download, 0)
+    for _, v := range r.m {
+        if v.Schedule != nil && (v.Status == models.StatusPending || v.Status == models.StatusDownloading) {
+            out = append(out, v)
+        }
+    }
+    sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+    if offset >= len(out) {
+        return []models.Download{}, nil
+    }
+    out = out[offset:]
+    if limit > 0 && len(out) > limit {
+        out = out[:limit]
+    }
+    return out, nil
+}
+
+func (r *memDownloadRepo) List(ctx context.Context, f repository.DownloadFilter) ([]models.Download, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    out := make([]models.Download, 0)
+    for _, v := range r.m {
+        if (f.UserID == "" || v.UserID == f.UserID) && (f.GameID == "" || v.GameID == f.GameID) && (f.Status == "" || v.Status == f.Status) {
+            out = append(out, v)
+        }
+    }
+    sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+    if f.Offset >= len(out) {
+        return []models.Download{}, nil
+    }
+    out = out[f.Offset:]
+    if f.Limit > 0 && len(out) > f.Limit {
+        out = out[:f.Limit]
+    }
+    return out, nil
+}
+
+type memDownloadEventRepo struct {
+    mu     sync.Mutex
+    events []models.DownloadEvent
+}
+
+func newMemDownloadEventRepo() *memDownloadEventRepo { return &memDownloadEventRepo{} }
+
+func (r *memDownloadEventRepo) Create(ctx context.Context, e *models.DownloadEvent) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    e.ID = fmt.Sprintf("ev-%d", len(r.events)+1)
+    e.CreatedAt = time.Now()
+    r.events = append(r.events, *e)
+    return nil
+}
+
+func (r *memDownloadEventRepo) ListByDownload(ctx context.Context, downloadID string) ([]models.DownloadEvent, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    var out []models.DownloadEvent
+    for _, e := range r.events {
+        if e.DownloadID == downloadID {
+            out = append(out, e)
+        }
+    }
+    return out, nil
+}
+
+type memDownloadFileRepo struct {
+    mu  sync.Mutex
+    m   map[string]models.DownloadFile
+    seq int
+}
+
+func newMemDownloadFileRepo() *memDownloadFileRepo {
+    return &memDownloadFileRepo{m: make(map[string]models.DownloadFile)}
+}
+
+func (r *memDownloadFileRepo) Create(ctx context.Context, f *models.DownloadFile) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    r.seq++
+    if f.ID == "" {
+        f.ID = fmt.Sprintf("file-%d", r.seq)
+    }
+    now := time.Now()
+    f.CreatedAt = now
+    f.UpdatedAt = now
+    r.m[f.ID] = *f
+    return nil
+}
+
+func (r *memDownloadFileRepo) GetByID(ctx context.Context, id string) (*models.DownloadFile, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    if v, ok := r.m[id]; ok {
+        return &v, nil
+    }
+    return nil, gorm.ErrRecordNotFound
+}
+
+func (r *memDownloadFileRepo) ListByDownload(ctx context.Context, downloadID string) ([]models.DownloadFile, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    out := make([]models.DownloadFile, 0)
+    for _, v := range r.m {
+        if v.DownloadID == downloadID {
+            out = append(out, v)
+        }
+    }
+    sort.Slice(out, func(i, j int) bool { return out[i].FileName < out[j].FileName })
+    return out, nil
+}
+
+func (r *memDownloadFileRepo) Update(ctx context.Context, f *models.DownloadFile) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    if _, ok := r.m[f.ID]; !ok {
+        return gorm.ErrRecordNotFound
+    }
+    f.UpdatedAt = time.Now()
+    r.m[f.ID] = *f
+    return nil
+}
+
+func (r *memDownloadFileRepo) UpdateStatus(ctx context.Context, id string, status models.DownloadStatus) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    if f, ok := r.m[id]; ok {
+        f.Status = status
+        r.m[id] = f
+        return nil
+    }
+    return gorm.ErrRecordNotFound
+}
+
+func (r *memDownloadFileRepo) UpdateProgress(ctx context.Context, id string, downloadedSize int64) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    if f, ok := r.m[id]; ok {
+        f.DownloadedSize = downloadedSize
+        r.m[id] = f
+        return nil
+    }
+    return gorm.ErrRecordNotFound
+}
+
+func (r *memDownloadFileRepo) Delete(ctx context.Context, id string) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    delete(r.m, id)
+    return nil
+}
+
+func (r *memDownloadFileRepo) DeleteByDownload(ctx context.Context, downloadID string) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    for id, f := range r.m {
+        if f.DownloadID == downloadID {
+            delete(r.m, id)
+        }
+    }
+    return nil
+}
+
 type mockLibrary struct{ owned bool }
 
 func (m mockLibrary) CheckOwnership(ctx context.Context, userID, gameID string) (bool, error) { return m.owned, nil }
 func (m mockLibrary) ListUserGames(ctx context.Context, userID string) ([]string, error)  { return nil, nil }
+func (m mockLibrary) CheckOwnershipBatch(ctx context.Context, userID string, gameIDs []string) (map[string]bool, error) {
+    out := make(map[string]bool, len(gameIDs))
+    for _, id := range gameIDs {
+        out[id] = m.owned
+    }
+    return out, nil
+}
+
+const testGameID = "11111111-1111-4111-8111-111111111111"
 
 func TestDownloadHandlerSuite(t *testing.T) {
     gin.SetMode(gin.TestMode)
@@ -161,9 +524,13 @@ func TestDownloadHandlerSuite(t *testing.T) {
 
 func (s *downloadHandlerSuite) SetupTest() {
     s.repo = newMemDownloadRepo()
-    s.stream = services.NewStreamService()
+    s.storage = s3.NewMockClient()
+    s.storage.PutObject("games/"+testGameID+"/game.zip", 512*1024, nil)
+    s.stream = services.NewStreamService(s.storage, nil)
     s.libraryMock = mockLibrary{owned: true}
-    s.svc = services.NewDownloadService(nil, nil, s.repo, s.stream, s.libraryMock, plog.New())
+    s.fileRepo = newMemDownloadFileRepo()
+    fileSvc := services.NewFileService(s.storage)
+    s.svc = services.NewDownloadService(nil, nil, s.repo, s.fileRepo, newMemDownloadEventRepo(), s.stream, fileSvc, s.libraryMock, plog.New())
 
     s.router = gin.New()
     middlewareSuite := s
@@ -175,11 +542,12 @@ func (s *downloadHandlerSuite) SetupTest() {
     })
     handler := NewDownloadHandler(s.svc, nil)
     handler.RegisterRoutes(s.router.Group("/api"))
+    NewFileHandler(fileSvc, s.svc).RegisterRoutes(s.router.Group("/api"))
 }
 
 func (s *downloadHandlerSuite) TestStartDownload() {
     s.authUserID = "00000000-0000-0000-0000-000000000001"
-    body := map[string]string{"gameId": "11111111-1111-4111-8111-111111111111"}
+    body := map[string]string{"gameId": testGameID}
     b, _ := json.Marshal(body)
     req := httptest.NewRequest(http.MethodPost, "/api/downloads", bytes.NewReader(b))
     req.Header.Set("Content-Type", "application/json")
@@ -239,3 +607,23 @@ func (s *downloadHandlerSuite) TestListUserDownloads() {
     s.Contains(resp.Body.String(), "dl-list")
 }
 
+func (s *downloadHandlerSuite) TestStreamFileRequiresEntitlement() {
+    s.authUserID = "00000000-0000-0000-0000-000000000004"
+    ctx := context.Background()
+    s.Require().NoError(s.repo.Create(ctx, &models.Download{ID: "dl-content", UserID: s.authUserID, GameID: testGameID, Status: models.StatusCompleted}))
+    s.Require().NoError(s.fileRepo.Create(ctx, &models.DownloadFile{ID: "file-content", DownloadID: "dl-content", FileName: "game.bin", FilePath: "game.bin", FileSize: 4, ObjectKey: "games/" + testGameID + "/files/game.bin"}))
+    s.storage.PutObject("games/"+testGameID+"/files/game.bin", 4, []byte("data"))
+
+    get := func() *httptest.ResponseRecorder {
+        resp := httptest.NewRecorder()
+        s.router.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/api/downloads/dl-content/files/file-content/content", nil))
+        return resp
+    }
+    resp := get()
+    s.Equal(http.StatusOK, resp.Code)
+    s.Equal("data", resp.Body.String())
+
+    _, err := s.svc.RevokeEntitlement(ctx, s.authUserID, testGameID, "refund")
+    s.Require().NoError(err)
+    s.Equal(http.StatusForbidden, get().Code)
+}
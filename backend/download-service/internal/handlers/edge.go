@@ -0,0 +1,97 @@
+package handlers
+
+import (
+    "fmt"
+    "net/http"
+    "strconv"
+    "strings"
+
+    "github.com/gin-gonic/gin"
+
+    derr "download-service/internal/errors"
+    "download-service/internal/services"
+)
+
+// EdgeHandler serves file content to holders of a download token instead of an
+// API session, so download managers and CDNs can fetch files with a plain URL.
+type EdgeHandler struct {
+    fileSvc *services.FileService
+    dlSvc   *services.DownloadService
+}
+
+func NewEdgeHandler(fileSvc *services.FileService, dlSvc *services.DownloadService) *EdgeHandler {
+    return &EdgeHandler{fileSvc: fileSvc, dlSvc: dlSvc}
+}
+
+// RegisterRoutes wires the edge routes; they must not sit behind the API auth.
+func (h *EdgeHandler) RegisterRoutes(r *gin.RouterGroup) {
+    r.GET("/downloads/:id/files/:fileId/content", h.streamFile)
+    r.HEAD("/downloads/:id/files/:fileId/content", h.streamFile)
+}
+
+// streamFile serves a file to the holder of a token for it. A token scoped to a
+// byte range only serves ranges inside it; without a Range header the scope is served.
+func (h *EdgeHandler) streamFile(c *gin.Context) {
+    token := c.Query("token")
+    if token == "" {
+        httpError(c, derr.InvalidTokenError{Reason: "missing token"})
+        return
+    }
+    grant, err := h.dlSvc.VerifyDownloadToken(c.Request.Context(), token, c.Param("id"), c.Param("fileId"), c.ClientIP())
+    if err != nil {
+        httpError(c, err)
+        return
+    }
+    if scope := grant.Range; scope != nil {
+        hdr := c.Request.Header
+        // A failed If-Range would fall back to the whole file.
+        hdr.Del("If-Range")
+        if hdr.Get("Range") == "" {
+            hdr.Set("Range", fmt.Sprintf("bytes=%d-%d", scope.Start, scope.End))
+        } else if !rangesWithin(hdr.Get("Range"), grant.File.FileSize, *scope) {
+            c.JSON(http.StatusForbidden, gin.H{"error": "requested range is outside the token's scope"})
+            return
+        }
+    }
+    serveFile(c, h.fileSvc, grant.File)
+}
+
+// rangesWithin reports whether every range of a Range header over a file of size
+// bytes lies inside scope. Headers it cannot parse are refused.
+func rangesWithin(header string, size int64, scope services.ByteRange) bool {
+    spec, ok := strings.CutPrefix(header, "bytes=")
+    if !ok {
+        return false
+    }
+    for _, r := range strings.Split(spec, ",") {
+        from, to, ok := strings.Cut(strings.TrimSpace(r), "-")
+        if !ok {
+            return false
+        }
+        var first, last int64
+        if from == "" {
+            // Suffix range: the last n bytes.
+            n, err := strconv.ParseInt(to, 10, 64)
+            if err != nil || n <= 0 {
+                return false
+            }
+            first, last = max(size-n, 0), size-1
+        } else {
+            var err error
+            if first, err = strconv.ParseInt(from, 10, 64); err != nil {
+                return false
+            }
+            last = size - 1
+            if to != "" {
+                if last, err = strconv.ParseInt(to, 10, 64); err != nil {
+                    return false
+                }
+                last = min(last, size-1)
+            }
+        }
+        if first < scope.Start || last > scope.End {
+            return false
+        }
+    }
+    return true
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+    "net/http"
+
+    "github.com/gin-gonic/gin"
+
+    "download-service/internal/dto"
+    derr "download-service/internal/errors"
+    "download-service/internal/services"
+)
+
+// EntitlementHandler receives entitlement events from the library service.
+// The router guards it with the internal service token.
+type EntitlementHandler struct {
+    svc *services.DownloadService
+}
+
+func NewEntitlementHandler(svc *services.DownloadService) *EntitlementHandler {
+    return &EntitlementHandler{svc: svc}
+}
+
+func (h *EntitlementHandler) RegisterRoutes(r *gin.RouterGroup) {
+    r.POST("/entitlements/revoked", h.revoked)
+}
+
+// revoked cancels the user's downloads of a refunded or charged-back game and
+// invalidates their tokens. Deliveries may be retried; repeats cancel nothing.
+func (h *EntitlementHandler) revoked(c *gin.Context) {
+    var req dto.EntitlementRevokedRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        httpError(c, derr.ValidationError{Msg: err.Error()})
+        return
+    }
+    res, err := h.svc.RevokeEntitlement(c.Request.Context(), req.UserID, req.GameID, req.Reason)
+    if err != nil {
+        httpError(c, err)
+        return
+    }
+    c.JSON(http.StatusOK, dto.EntitlementRevokedResponse{EventID: req.EventID, Cancelled: res.Cancelled})
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+
+	"download-service/internal/cache"
+	"download-service/internal/dto"
+	derr "download-service/internal/errors"
+	intramw "download-service/internal/middleware"
+)
+
+// sseKeepAlive is how often an idle event stream gets a comment line, so proxies
+// do not close it.
+const sseKeepAlive = 15 * time.Second
+
+func (h *DownloadHandler) downloadEvents(c *gin.Context) {
+	id := c.Param("id")
+	if id == "" {
+		httpError(c, derr.ValidationError{Msg: "missing id"})
+		return
+	}
+	uid, ok := intramw.UserIDFromContext(c)
+	if !ok {
+		httpError(c, derr.AccessDeniedError{Reason: "missing user identity"})
+		return
+	}
+	events, err := h.svc.DownloadEvents(c.Request.Context(), uid, id, lastEventID(c))
+	if err != nil {
+		httpError(c, err)
+		return
+	}
+	serveEvents(c, events)
+}
+
+func (h *DownloadHandler) userDownloadEvents(c *gin.Context) {
+	pathUserID := c.Param("userId")
+	if pathUserID == "" {
+		httpError(c, derr.ValidationError{Msg: "missing userId"})
+		return
+	}
+	authUserID, ok := intramw.UserIDFromContext(c)
+	if !ok {
+		httpError(c, derr.AccessDeniedError{Reason: "missing user identity"})
+		return
+	}
+	if pathUserID != authUserID {
+		httpError(c, derr.AccessDeniedError{Reason: "cannot view downloads for another user"})
+		return
+	}
+	events, err := h.svc.UserDownloadEvents(c.Request.Context(), pathUserID, lastEventID(c))
+	if err != nil {
+		httpError(c, err)
+		return
+	}
+	serveEvents(c, events)
+}
+
+// lastEventID reads the resume position. Browsers send the header on reconnect;
+// the query parameter lets a client resume a fresh EventSource.
+func lastEventID(c *gin.Context) string {
+	if v := c.GetHeader("Last-Event-ID"); v != "" {
+		return v
+	}
+	return c.Query("lastEventId")
+}
+
+// serveEvents writes events as server-sent events until the client goes away.
+func serveEvents(c *gin.Context, events <-chan cache.DownloadEvent) {
+	hdr := c.Writer.Header()
+	hdr.Set("Content-Type", "text/event-stream")
+	hdr.Set("Cache-Control", "no-cache")
+	hdr.Set("Connection", "keep-alive")
+	hdr.Set("X-Accel-Buffering", "no")
+
+	// Event streams stay open far longer than the server's write timeout.
+	_ = http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			c.Render(-1, sse.Event{Id: ev.ID, Event: ev.Type, Data: dto.FromEvent(ev)})
+		case <-keepAlive.C:
+			if _, err := io.WriteString(c.Writer, ": keepalive\n\n"); err != nil {
+				return
+			}
+		}
+		c.Writer.Flush()
+	}
+}
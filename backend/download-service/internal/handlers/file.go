@@ -1,14 +1,22 @@
 package handlers
 
 import (
+    "errors"
+    "fmt"
+    "mime"
     "net/http"
+    "path"
+    "time"
 
     "github.com/gin-gonic/gin"
 
+    "download-service/internal/clients/s3"
+    "download-service/internal/dto"
     derr "download-service/internal/errors"
     intramw "download-service/internal/middleware"
+    "download-service/internal/models"
+    "download-service/internal/observability"
     "download-service/internal/services"
-    "download-service/pkg/validate"
 )
 
 type FileHandler struct {
@@ -20,17 +28,19 @@ func NewFileHandler(fileSvc *services.FileService, dlSvc *services.DownloadServi
     return &FileHandler{fileSvc: fileSvc, dlSvc: dlSvc}
 }
 
-type verifyBody struct {
-    FilePath     string `json:"filePath" binding:"required"`
-    ExpectedSize int64  `json:"expectedSize" binding:"required,gt=0"`
-}
-
 func (h *FileHandler) RegisterRoutes(r *gin.RouterGroup) {
     r.GET("/downloads/:id/url", h.getDownloadURL)
+    r.POST("/downloads/:id/tokens", h.issueToken)
+    r.GET("/downloads/:id/files/:fileId/content", h.streamFile)
+    r.HEAD("/downloads/:id/files/:fileId/content", h.streamFile)
     r.POST("/downloads/:id/verify", h.verify)
     r.DELETE("/downloads/:id/files/temp", h.cleanup)
 }
 
+// regionHintHeader carries the client's storage region, e.g. set by the CDN from
+// its geo lookup, so presigned URLs point at a nearby origin.
+const regionHintHeader = "X-Client-Region"
+
 func (h *FileHandler) getDownloadURL(c *gin.Context) {
     downloadID := c.Param("id")
     userID, ok := intramw.UserIDFromContext(c)
@@ -39,36 +49,187 @@ func (h *FileHandler) getDownloadURL(c *gin.Context) {
         return
     }
 
+    if h.dlSvc.TokensEnabled() {
+        // Presigned URLs can be shared with anyone until they expire.
+        c.JSON(http.StatusGone, gin.H{"error": "presigned URLs are disabled; request a download token"})
+        return
+    }
+
     download, err := h.dlSvc.GetDownload(c.Request.Context(), userID, downloadID)
     if err != nil {
         httpError(c, err)
         return
     }
+    if err := h.dlSvc.CheckEntitlement(c.Request.Context(), download); err != nil {
+        httpError(c, err)
+        return
+    }
 
-    url, err := h.fileSvc.GetDownloadURL(c.Request.Context(), download)
+    urls, err := h.fileSvc.GetDownloadURLs(c.Request.Context(), download, c.GetHeader(regionHintHeader))
     if err != nil {
         httpError(c, err)
         return
     }
 
-    c.JSON(http.StatusOK, gin.H{"url": url})
+    c.JSON(http.StatusOK, downloadURLResponse(urls))
 }
 
-func (h *FileHandler) verify(c *gin.Context) {
-    var body verifyBody
-    if err := c.ShouldBindJSON(&body); err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+func downloadURLResponse(urls []services.FileURL) dto.DownloadURLResponse {
+    out := dto.DownloadURLResponse{Files: make([]dto.FileURLResponse, 0, len(urls))}
+    for _, u := range urls {
+        out.Files = append(out.Files, dto.FileURLResponse{Path: u.Path, Size: u.Size, URL: u.URL})
+    }
+    if len(urls) == 1 {
+        out.URL = urls[0].URL
+    }
+    return out
+}
+
+// issueToken signs a short-lived token for the edge routes, bound to the caller's
+// address unless the request names other clients.
+func (h *FileHandler) issueToken(c *gin.Context) {
+    userID, ok := intramw.UserIDFromContext(c)
+    if !ok {
+        httpError(c, derr.AccessDeniedError{Reason: "missing user identity"})
         return
     }
-    if err := validate.Struct(body); err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+    var req dto.IssueTokenRequest
+    if c.Request.ContentLength != 0 {
+        if err := c.ShouldBindJSON(&req); err != nil {
+            httpError(c, derr.ValidationError{Msg: err.Error()})
+            return
+        }
+    }
+    tok, err := h.dlSvc.IssueDownloadToken(c.Request.Context(), userID, c.Param("id"), c.ClientIP(), tokenScope(req))
+    if err != nil {
+        httpError(c, err)
         return
     }
-    if err := h.fileSvc.VerifyFile(c.Request.Context(), body.FilePath, body.ExpectedSize); err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+    c.JSON(http.StatusCreated, dto.DownloadTokenResponse{Token: tok.Token, URL: tok.URL, ExpiresAt: tok.ExpiresAt.Unix()})
+}
+
+func tokenScope(r dto.IssueTokenRequest) services.TokenScope {
+    scope := services.TokenScope{FileID: r.FileID, ClientCIDR: r.ClientCIDR, TTL: time.Duration(r.TTLSeconds) * time.Second}
+    if r.Range != nil {
+        scope.Range = &services.ByteRange{Start: r.Range.Start, End: r.Range.End}
+    }
+    return scope
+}
+
+// streamFile serves a file of the caller's download with RFC 7233 range support
+// (Range, If-Range, multipart/byteranges, ETag and Last-Modified validators).
+func (h *FileHandler) streamFile(c *gin.Context) {
+    userID, ok := intramw.UserIDFromContext(c)
+    if !ok {
+        httpError(c, derr.AccessDeniedError{Reason: "missing user identity"})
         return
     }
-    c.JSON(http.StatusOK, gin.H{"status": "ok"})
+    download, file, err := h.dlSvc.GetDownloadFile(c.Request.Context(), userID, c.Param("id"), c.Param("fileId"))
+    if err != nil {
+        httpError(c, err)
+        return
+    }
+    if err := h.dlSvc.CheckEntitlement(c.Request.Context(), download); err != nil {
+        httpError(c, err)
+        return
+    }
+    serveFile(c, h.fileSvc, file)
+}
+
+// serveFile writes the content of a download file, honouring the request's range
+// and validator headers.
+func serveFile(c *gin.Context, fileSvc *services.FileService, file *models.DownloadFile) {
+    if file.ObjectKey == "" {
+        // Chunked builds have no whole-file object to serve.
+        c.JSON(http.StatusNotFound, gin.H{"error": "file is assembled from chunks and has no single object"})
+        return
+    }
+    content, err := fileSvc.OpenObject(c.Request.Context(), file.ObjectKey)
+    if err != nil {
+        if errors.Is(err, s3.ErrNotFound) {
+            c.JSON(http.StatusNotFound, gin.H{"error": "file content not found"})
+            return
+        }
+        httpError(c, err)
+        return
+    }
+    defer content.Reader.Close()
+
+    hdr := c.Writer.Header()
+    if content.Info.ETag != "" {
+        hdr.Set("ETag", fmt.Sprintf("%q", content.Info.ETag))
+    }
+    ctype := mime.TypeByExtension(path.Ext(file.FileName))
+    if ctype == "" {
+        ctype = "application/octet-stream"
+    }
+    hdr.Set("Content-Type", ctype)
+    hdr.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": file.FileName}))
+
+    // Game artifacts outlive the server's write timeout; the request context still bounds the transfer.
+    _ = http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+
+    w := &countingWriter{ResponseWriter: c.Writer}
+    http.ServeContent(w, c.Request, file.FileName, content.Info.LastModified, content.Reader)
+    if w.n > 0 {
+        observability.AddServedBytes(c.Writer.Status(), w.n)
+    }
+}
+
+// countingWriter meters the body bytes written through it.
+type countingWriter struct {
+    http.ResponseWriter
+    n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+    n, err := w.ResponseWriter.Write(p)
+    w.n += int64(n)
+    return n, err
+}
+
+func (w *countingWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// verify checks the download's files against their build manifest digests and
+// reports per-file and per-chunk failures.
+func (h *FileHandler) verify(c *gin.Context) {
+    userID, ok := intramw.UserIDFromContext(c)
+    if !ok {
+        httpError(c, derr.AccessDeniedError{Reason: "missing user identity"})
+        return
+    }
+    report, err := h.dlSvc.VerifyDownload(c.Request.Context(), userID, c.Param("id"))
+    if err != nil {
+        httpError(c, err)
+        return
+    }
+    c.JSON(http.StatusOK, verificationResponse(*report))
+}
+
+func verificationResponse(r services.VerificationReport) dto.VerificationResponse {
+    out := dto.VerificationResponse{
+        DownloadID: r.DownloadID,
+        Status:     string(models.StatusVerified),
+        Files:      make([]dto.FileVerificationResponse, 0, len(r.Files)),
+    }
+    if !r.Verified {
+        out.Status = string(models.StatusCorrupted)
+    }
+    for _, f := range r.Files {
+        fr := dto.FileVerificationResponse{
+            FileID:         f.FileID,
+            Path:           f.Path,
+            Status:         string(f.Status),
+            ExpectedSHA256: f.ExpectedSHA256,
+            ActualSHA256:   f.ActualSHA256,
+            Repairing:      f.Repairing,
+        }
+        for _, c := range f.FailedChunks {
+            fr.FailedChunks = append(fr.FailedChunks, dto.ChunkFailureResponse{Index: c.Index, Offset: c.Offset, Size: c.Size, Reason: c.Reason})
+        }
+        out.Files = append(out.Files, fr)
+    }
+    return out
 }
 
 func (h *FileHandler) cleanup(c *gin.Context) {
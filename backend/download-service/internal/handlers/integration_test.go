@@ -97,15 +97,19 @@ func (s *IntegrationTestSuite) SetupSuite() {
 	// Repositories
 	downloadRepo := repository.NewDownloadRepository(db)
 	downloadFileRepo := repository.NewDownloadFileRepository(db)
+	downloadEventRepo := repository.NewDownloadEventRepository(db)
 
 	// Services
-	streamService := services.NewStreamService()
+	streamService := services.NewStreamService(s3Client, nil)
 	fileService := services.NewFileService(s3Client)
 	downloadService := services.NewDownloadService(
 		db,
 		nil, // Redis client - using nil for tests
 		downloadRepo,
+		downloadFileRepo,
+		downloadEventRepo,
 		streamService,
+		fileService,
 		libraryClient,
 		log,
 	)
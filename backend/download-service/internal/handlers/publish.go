@@ -0,0 +1,186 @@
+package handlers
+
+import (
+    "context"
+    "net/http"
+    "strconv"
+    "time"
+
+    "github.com/gin-gonic/gin"
+
+    "download-service/internal/cache"
+    "download-service/internal/dto"
+    derr "download-service/internal/errors"
+    intramw "download-service/internal/middleware"
+    "download-service/internal/services"
+)
+
+// partChecksumHeader carries the base64 SHA-256 digest of an uploaded part.
+const partChecksumHeader = "X-Checksum-SHA256"
+
+// PublishHandler serves the build publishing API. Publisher access is checked by
+// the router and access to the game by the service; an upload can only be
+// continued by the user who started it.
+type PublishHandler struct {
+    svc *services.PublishService
+}
+
+func NewPublishHandler(svc *services.PublishService) *PublishHandler {
+    return &PublishHandler{svc: svc}
+}
+
+// RegisterRoutes wires the publishing routes under the given (already guarded) group.
+func (h *PublishHandler) RegisterRoutes(r *gin.RouterGroup) {
+    r.POST("/games/:gameId/builds", h.createUpload)
+
+    uploads := r.Group("/uploads")
+    uploads.GET("/:id", h.getUpload)
+    uploads.PUT("/:id/files/:index/parts/:part", h.uploadPart)
+    uploads.POST("/:id/complete", h.complete)
+    uploads.DELETE("/:id", h.abort)
+}
+
+func publisherID(c *gin.Context) (string, bool) {
+    uid, ok := intramw.UserIDFromContext(c)
+    if !ok {
+        httpError(c, derr.AccessDeniedError{Reason: "missing user identity"})
+    }
+    return uid, ok
+}
+
+// publishContext carries the games the caller's token lets them publish to the service.
+func publishContext(c *gin.Context) context.Context {
+    return services.WithPublisherGames(c.Request.Context(), intramw.GamesFromContext(c))
+}
+
+// createUpload starts uploading a new build version; the response tells the
+// publisher how many parts to send for each file.
+func (h *PublishHandler) createUpload(c *gin.Context) {
+    uid, ok := publisherID(c)
+    if !ok {
+        return
+    }
+    var req dto.CreateBuildUploadRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        httpError(c, derr.ValidationError{Msg: err.Error()})
+        return
+    }
+    breq := services.BuildUploadRequest{GameID: c.Param("gameId"), Version: req.Version, PartSize: req.PartSize}
+    for _, f := range req.Files {
+        breq.Files = append(breq.Files, services.BuildUploadFile{Path: f.Path, Size: f.Size, SHA256: f.SHA256})
+    }
+    up, err := h.svc.CreateBuildUpload(publishContext(c), uid, breq)
+    if err != nil {
+        httpError(c, err)
+        return
+    }
+    c.JSON(http.StatusCreated, buildUploadResponse(up, nil))
+}
+
+// getUpload reports the parts stored so far, so an interrupted upload can resume.
+func (h *PublishHandler) getUpload(c *gin.Context) {
+    uid, ok := publisherID(c)
+    if !ok {
+        return
+    }
+    st, err := h.svc.GetBuildUpload(c.Request.Context(), uid, c.Param("id"))
+    if err != nil {
+        httpError(c, err)
+        return
+    }
+    c.JSON(http.StatusOK, buildUploadResponse(st.Upload, st.Parts))
+}
+
+// uploadPart stores one part sent as the raw request body. Content-Length must
+// be the part's size and the checksum header its SHA-256 digest.
+func (h *PublishHandler) uploadPart(c *gin.Context) {
+    uid, ok := publisherID(c)
+    if !ok {
+        return
+    }
+    index, err := strconv.Atoi(c.Param("index"))
+    if err != nil {
+        httpError(c, derr.ValidationError{Msg: "invalid file index"})
+        return
+    }
+    part, err := strconv.ParseInt(c.Param("part"), 10, 32)
+    if err != nil {
+        httpError(c, derr.ValidationError{Msg: "invalid part number"})
+        return
+    }
+    size := c.Request.ContentLength
+    if size < 0 {
+        httpError(c, derr.ValidationError{Msg: "Content-Length is required"})
+        return
+    }
+    checksum := c.GetHeader(partChecksumHeader)
+    if checksum == "" {
+        httpError(c, derr.ValidationError{Msg: partChecksumHeader + " header is required"})
+        return
+    }
+
+    // Parts outlive the server's read timeout; the request context still bounds the transfer.
+    _ = http.NewResponseController(c.Writer).SetReadDeadline(time.Time{})
+    body := http.MaxBytesReader(c.Writer, c.Request.Body, size)
+    p, err := h.svc.UploadPart(c.Request.Context(), uid, c.Param("id"), index, int32(part), body, size, checksum)
+    if err != nil {
+        httpError(c, err)
+        return
+    }
+    c.JSON(http.StatusOK, dto.FromUploadedPart(*p))
+}
+
+// complete registers the build version once every part is stored.
+func (h *PublishHandler) complete(c *gin.Context) {
+    uid, ok := publisherID(c)
+    if !ok {
+        return
+    }
+    m, err := h.svc.CompleteBuildUpload(publishContext(c), uid, c.Param("id"))
+    if err != nil {
+        httpError(c, err)
+        return
+    }
+    c.JSON(http.StatusOK, publishedBuildResponse(m))
+}
+
+func (h *PublishHandler) abort(c *gin.Context) {
+    uid, ok := publisherID(c)
+    if !ok {
+        return
+    }
+    if err := h.svc.AbortBuildUpload(c.Request.Context(), uid, c.Param("id")); err != nil {
+        httpError(c, err)
+        return
+    }
+    c.Status(http.StatusNoContent)
+}
+
+func buildUploadResponse(u *cache.BuildUpload, parts []cache.UploadedPart) dto.BuildUploadResponse {
+    resp := dto.BuildUploadResponse{
+        ID:        u.ID,
+        GameID:    u.GameID,
+        Version:   u.Version,
+        PartSize:  u.PartSize,
+        Files:     make([]dto.BuildUploadFileResponse, len(u.Files)),
+        Uploaded:  make([]dto.UploadedPartResponse, 0, len(parts)),
+        CreatedAt: u.CreatedAt.Unix(),
+    }
+    for i, f := range u.Files {
+        resp.Files[i] = dto.BuildUploadFileResponse{Index: i, Path: f.Path, Size: f.Size, Parts: services.PartCount(f.Size, u.PartSize)}
+    }
+    for _, p := range parts {
+        resp.Uploaded = append(resp.Uploaded, dto.FromUploadedPart(p))
+    }
+    return resp
+}
+
+func publishedBuildResponse(m *services.Manifest) dto.PublishedBuildResponse {
+    return dto.PublishedBuildResponse{
+        GameID:    m.GameID,
+        Version:   m.Version,
+        BuildID:   m.BuildID,
+        Files:     len(m.Files),
+        TotalSize: m.TotalSize(),
+    }
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+    "errors"
+    "fmt"
+    "net/http"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+
+    "download-service/internal/clients/s3"
+    "download-service/internal/observability"
+)
+
+// StorageHandler serves objects of the filesystem storage driver to holders of a
+// signed URL, standing in for presigned bucket URLs when there is no S3.
+type StorageHandler struct {
+    storage *s3.FSClient
+}
+
+func NewStorageHandler(storage *s3.FSClient) *StorageHandler {
+    return &StorageHandler{storage: storage}
+}
+
+// RegisterRoutes wires the object routes; they must not sit behind the API auth.
+func (h *StorageHandler) RegisterRoutes(r *gin.RouterGroup) {
+    r.GET("/objects/*key", h.serveObject)
+    r.HEAD("/objects/*key", h.serveObject)
+}
+
+// serveObject serves an object, with range support, if the URL signature is valid.
+func (h *StorageHandler) serveObject(c *gin.Context) {
+    key := strings.TrimPrefix(c.Param("key"), "/")
+    if err := h.storage.VerifySignature(key, c.Query("expires"), c.Query("signature")); err != nil {
+        c.JSON(http.StatusForbidden, gin.H{"error": "invalid or expired signature"})
+        return
+    }
+    ctx := c.Request.Context()
+    info, err := h.storage.StatObject(ctx, key)
+    if err != nil {
+        if errors.Is(err, s3.ErrNotFound) {
+            c.JSON(http.StatusNotFound, gin.H{"error": "object not found"})
+            return
+        }
+        httpError(c, err)
+        return
+    }
+    reader := s3.NewObjectReader(ctx, h.storage, key, info.Size)
+    defer reader.Close()
+
+    hdr := c.Writer.Header()
+    hdr.Set("ETag", fmt.Sprintf("%q", info.ETag))
+    hdr.Set("Content-Type", "application/octet-stream")
+
+    // Game artifacts outlive the server's write timeout; the request context still bounds the transfer.
+    _ = http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+
+    w := &countingWriter{ResponseWriter: c.Writer}
+    http.ServeContent(w, c.Request, "", info.LastModified, reader)
+    if w.n > 0 {
+        observability.AddServedBytes(c.Writer.Status(), w.n)
+    }
+}
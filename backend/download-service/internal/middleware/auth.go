@@ -1,35 +1,94 @@
 package middleware
 
 import (
+    "context"
     "errors"
     "net/http"
     "strings"
 
     "github.com/gin-gonic/gin"
     jwt "github.com/golang-jwt/jwt/v5"
+
+    "download-service/internal/clients/tier"
 )
 
 const (
-    CtxUserIDKey = "auth_user_id"
+    CtxUserIDKey     = "auth_user_id"
+    CtxUserTierKey   = "auth_user_tier"
+    CtxUserRolesKey  = "auth_user_roles"
+    CtxUserScopesKey = "auth_user_scopes"
+    CtxUserGamesKey  = "auth_user_games"
 )
 
+// DefaultTierClaim is the token claim holding the user's subscription tier.
+const DefaultTierClaim = "tier"
+
+// DefaultRolesClaim is the token claim holding the user's roles.
+const DefaultRolesClaim = "roles"
+
+// DefaultGamesClaim is the token claim listing the games a publisher may publish builds of.
+const DefaultGamesClaim = "publisher_games"
+
 type AuthOptions struct {
     Enabled bool
-    // If Secret is empty, middleware falls back to trusting X-User-Id header (dev only)
+    // Secret verifies HMAC-signed tokens.
     Secret  string
+    // Keys verifies RSA and ECDSA-signed tokens by their kid header, e.g. a JWKS.
+    Keys    KeySource
     Issuer  string
     Audience string
+    // Algorithms lists the accepted signing algorithms. When empty, HS256/384/512
+    // are accepted with a Secret and RS256 and ES256 with Keys.
+    Algorithms []string
+    // TrustUserHeader accepts the X-User-Id header as the identity when neither
+    // Secret nor Keys is set. Development only: anyone reaching the service can
+    // claim any identity.
+    TrustUserHeader bool
+    // TierClaim names the claim carrying the subscription tier; DefaultTierClaim when empty.
+    TierClaim string
+    // RolesClaim names the claim carrying the user's roles; DefaultRolesClaim when empty.
+    // Scopes are read from the standard "scope" (space-separated) or "scp" claim.
+    RolesClaim string
+    // GamesClaim names the claim listing the games the user may publish builds of;
+    // DefaultGamesClaim when empty.
+    GamesClaim string
 }
 
-// Auth validates Authorization: Bearer <jwt> with HS256 secret and sets user id into context.
-// If disabled or no secret provided, it accepts X-User-Id header (for local/dev behind API Gateway).
+// Auth validates Authorization: Bearer <jwt> against the secret or public keys and
+// sets user id into context. Without either, it accepts the X-User-Id header if
+// TrustUserHeader is set and rejects every request otherwise.
+// A tier claim (or X-User-Tier in dev mode) is stored as well, including in the request
+// context where the services read it, and so are roles, scopes and publisher games
+// (X-User-Roles, X-User-Scopes and X-User-Games in dev mode).
 func Auth(opts AuthOptions) gin.HandlerFunc {
+    if opts.TierClaim == "" {
+        opts.TierClaim = DefaultTierClaim
+    }
+    if opts.RolesClaim == "" {
+        opts.RolesClaim = DefaultRolesClaim
+    }
+    if opts.GamesClaim == "" {
+        opts.GamesClaim = DefaultGamesClaim
+    }
+    algorithms := opts.Algorithms
+    if len(algorithms) == 0 {
+        if opts.Secret != "" {
+            algorithms = append(algorithms, "HS256", "HS384", "HS512")
+        }
+        if opts.Keys != nil {
+            algorithms = append(algorithms, "RS256", "ES256")
+        }
+    }
     return func(c *gin.Context) {
         if !opts.Enabled {
             c.Next()
             return
         }
-        if opts.Secret == "" {
+        if opts.Secret == "" && opts.Keys == nil {
+            if !opts.TrustUserHeader {
+                c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "authentication is not configured"})
+                return
+            }
             // Dev fallback
             uid := c.Request.Header.Get("X-User-Id")
             if uid == "" {
@@ -37,6 +96,8 @@ func Auth(opts AuthOptions) gin.HandlerFunc {
                 return
             }
             c.Set(CtxUserIDKey, uid)
+            setTier(c, c.Request.Header.Get("X-User-Tier"))
+            setGrants(c, splitList(c.Request.Header.Get("X-User-Roles")), splitList(c.Request.Header.Get("X-User-Scopes")), splitList(c.Request.Header.Get("X-User-Games")))
             c.Next()
             return
         }
@@ -47,11 +108,8 @@ func Auth(opts AuthOptions) gin.HandlerFunc {
         }
         tokenStr := strings.TrimSpace(auth[len("Bearer "):])
         token, err := jwt.Parse(tokenStr, func(t *jwt.Token) (any, error) {
-            if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-                return nil, errors.New("unexpected signing method")
-            }
-            return []byte(opts.Secret), nil
-        }, jwt.WithAudience(opts.Audience), jwt.WithIssuer(opts.Issuer))
+            return verificationKey(c.Request.Context(), opts, t)
+        }, jwt.WithValidMethods(algorithms), jwt.WithAudience(opts.Audience), jwt.WithIssuer(opts.Issuer))
         if err != nil || !token.Valid {
             c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
             return
@@ -67,10 +125,81 @@ func Auth(opts AuthOptions) gin.HandlerFunc {
             return
         }
         c.Set(CtxUserIDKey, sub)
+        t, _ := claims[opts.TierClaim].(string)
+        setTier(c, t)
+        scopes := claimList(claims["scope"])
+        if len(scopes) == 0 {
+            scopes = claimList(claims["scp"])
+        }
+        setGrants(c, claimList(claims[opts.RolesClaim]), scopes, claimList(claims[opts.GamesClaim]))
         c.Next()
     }
 }
 
+// verificationKey picks the key matching the token's algorithm family, so a token
+// cannot pass off a public key as an HMAC secret.
+func verificationKey(ctx context.Context, opts AuthOptions, t *jwt.Token) (any, error) {
+    switch t.Method.(type) {
+    case *jwt.SigningMethodHMAC:
+        if opts.Secret == "" {
+            return nil, errors.New("HMAC tokens are not accepted")
+        }
+        return []byte(opts.Secret), nil
+    case *jwt.SigningMethodRSA, *jwt.SigningMethodECDSA, *jwt.SigningMethodRSAPSS:
+        if opts.Keys == nil {
+            return nil, errors.New("signing keys are not configured")
+        }
+        kid, _ := t.Header["kid"].(string)
+        return opts.Keys.Key(ctx, kid)
+    default:
+        return nil, errors.New("unexpected signing method")
+    }
+}
+
+func setTier(c *gin.Context, t string) {
+    if t == "" {
+        return
+    }
+    c.Set(CtxUserTierKey, t)
+    c.Request = c.Request.WithContext(tier.NewContext(c.Request.Context(), t))
+}
+
+func setGrants(c *gin.Context, roles, scopes, games []string) {
+    if len(roles) > 0 {
+        c.Set(CtxUserRolesKey, roles)
+    }
+    if len(scopes) > 0 {
+        c.Set(CtxUserScopesKey, scopes)
+    }
+    if len(games) > 0 {
+        c.Set(CtxUserGamesKey, games)
+    }
+}
+
+// claimList reads a claim holding either a list of strings or a single string of
+// space-separated values, as OAuth2 scope claims do.
+func claimList(v any) []string {
+    switch v := v.(type) {
+    case string:
+        return strings.Fields(v)
+    case []any:
+        out := make([]string, 0, len(v))
+        for _, e := range v {
+            if s, ok := e.(string); ok && s != "" {
+                out = append(out, s)
+            }
+        }
+        return out
+    default:
+        return nil
+    }
+}
+
+// splitList splits a comma- or space-separated header value.
+func splitList(v string) []string {
+    return strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ' ' })
+}
+
 // UserIDFromContext returns the authenticated user id if available.
 func UserIDFromContext(c *gin.Context) (string, bool) {
     v, ok := c.Get(CtxUserIDKey)
@@ -78,3 +207,24 @@ func UserIDFromContext(c *gin.Context) (string, bool) {
     s, _ := v.(string)
     return s, s != ""
 }
+
+// RolesFromContext returns the roles of the authenticated user.
+func RolesFromContext(c *gin.Context) []string {
+    v, _ := c.Get(CtxUserRolesKey)
+    roles, _ := v.([]string)
+    return roles
+}
+
+// ScopesFromContext returns the scopes granted to the authenticated user's token.
+func ScopesFromContext(c *gin.Context) []string {
+    v, _ := c.Get(CtxUserScopesKey)
+    scopes, _ := v.([]string)
+    return scopes
+}
+
+// GamesFromContext returns the games the authenticated user may publish builds of.
+func GamesFromContext(c *gin.Context) []string {
+    v, _ := c.Get(CtxUserGamesKey)
+    games, _ := v.([]string)
+    return games
+}
@@ -0,0 +1,265 @@
+package middleware
+
+import (
+    "context"
+    "crypto"
+    "crypto/ecdsa"
+    "crypto/elliptic"
+    "crypto/rsa"
+    "encoding/base64"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "math/big"
+    "net/http"
+    "os"
+    "sync"
+    "time"
+)
+
+// Defaults of JWKSOptions.
+const (
+    DefaultJWKSRefresh    = 10 * time.Minute
+    DefaultJWKSMinRefresh = 30 * time.Second
+)
+
+// KeySource looks up the public key a token was signed with by its kid header.
+type KeySource interface {
+    Key(ctx context.Context, kid string) (crypto.PublicKey, error)
+}
+
+// JWKSOptions configures a JWKS key set. Exactly one of URL and File is used;
+// File is meant for tests and local setups.
+type JWKSOptions struct {
+    URL        string
+    File       string
+    Refresh    time.Duration // how often Run reloads the set; DefaultJWKSRefresh when zero
+    MinRefresh time.Duration // least time between reloads for unknown kids; DefaultJWKSMinRefresh when zero
+    HTTPClient *http.Client  // optional custom client
+    // OnKeyError is told about each key of a loaded set that cannot be used and is
+    // skipped; it may be nil.
+    OnKeyError func(kid string, err error)
+}
+
+// JWKS is a cached JSON Web Key Set of RSA and EC signing keys. A token with a kid
+// the cache does not know reloads the set, so keys rotated in by the issuer are
+// accepted before the next scheduled refresh.
+type JWKS struct {
+    opts JWKSOptions
+    hc   *http.Client
+
+    mu      sync.RWMutex
+    keys    map[string]crypto.PublicKey
+    fetched time.Time
+    refresh sync.Mutex // one reload at a time
+}
+
+func NewJWKS(opts JWKSOptions) *JWKS {
+    if opts.Refresh <= 0 {
+        opts.Refresh = DefaultJWKSRefresh
+    }
+    if opts.MinRefresh <= 0 {
+        opts.MinRefresh = DefaultJWKSMinRefresh
+    }
+    hc := opts.HTTPClient
+    if hc == nil {
+        hc = &http.Client{Timeout: 5 * time.Second}
+    }
+    return &JWKS{opts: opts, hc: hc, keys: map[string]crypto.PublicKey{}}
+}
+
+// Key returns the key with the given kid. A token without a kid is accepted only
+// while the set holds a single key.
+func (k *JWKS) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+    if key, ok := k.lookup(kid); ok {
+        return key, nil
+    }
+    k.mu.RLock()
+    stale := time.Since(k.fetched) >= k.opts.MinRefresh
+    k.mu.RUnlock()
+    if stale {
+        if err := k.Refresh(ctx); err != nil {
+            return nil, err
+        }
+        if key, ok := k.lookup(kid); ok {
+            return key, nil
+        }
+    }
+    return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+func (k *JWKS) lookup(kid string) (crypto.PublicKey, bool) {
+    k.mu.RLock()
+    defer k.mu.RUnlock()
+    if kid == "" && len(k.keys) == 1 {
+        for _, key := range k.keys {
+            return key, true
+        }
+    }
+    key, ok := k.keys[kid]
+    return key, ok
+}
+
+// Refresh reloads the key set. On failure the cached keys are kept.
+func (k *JWKS) Refresh(ctx context.Context) error {
+    k.refresh.Lock()
+    defer k.refresh.Unlock()
+    raw, err := k.load(ctx)
+    if err == nil {
+        var keys map[string]crypto.PublicKey
+        if keys, err = parseJWKS(raw, k.opts.OnKeyError); err == nil {
+            k.mu.Lock()
+            k.keys = keys
+            k.fetched = time.Now()
+            k.mu.Unlock()
+            return nil
+        }
+    }
+    // Back off the reloads triggered by unknown kids as well.
+    k.mu.Lock()
+    k.fetched = time.Now()
+    k.mu.Unlock()
+    return fmt.Errorf("jwks: %w", err)
+}
+
+// Run refreshes the key set periodically until ctx is cancelled. Failures are
+// passed to onError, which may be nil.
+func (k *JWKS) Run(ctx context.Context, onError func(error)) {
+    ticker := time.NewTicker(k.opts.Refresh)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+            if err := k.Refresh(ctx); err != nil && onError != nil {
+                onError(err)
+            }
+        }
+    }
+}
+
+func (k *JWKS) load(ctx context.Context) ([]byte, error) {
+    if k.opts.File != "" {
+        return os.ReadFile(k.opts.File)
+    }
+    if k.opts.URL == "" {
+        return nil, errors.New("no URL or file configured")
+    }
+    req, err := http.NewRequestWithContext(ctx, http.MethodGet, k.opts.URL, nil)
+    if err != nil {
+        return nil, err
+    }
+    req.Header.Set("Accept", "application/json")
+    resp, err := k.hc.Do(req)
+    if err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode != http.StatusOK {
+        return nil, fmt.Errorf("GET %s: status %d", k.opts.URL, resp.StatusCode)
+    }
+    return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+type jwk struct {
+    Kty string `json:"kty"`
+    Kid string `json:"kid"`
+    Use string `json:"use"`
+    N   string `json:"n"`
+    E   string `json:"e"`
+    Crv string `json:"crv"`
+    X   string `json:"x"`
+    Y   string `json:"y"`
+}
+
+// parseJWKS keeps the RSA and EC signing keys of a set and skips any other. A key
+// that cannot be parsed is passed to onKeyError, if set, and skipped, so it does
+// not take the valid keys of the set down with it.
+func parseJWKS(raw []byte, onKeyError func(kid string, err error)) (map[string]crypto.PublicKey, error) {
+    var set struct {
+        Keys []jwk `json:"keys"`
+    }
+    if err := json.Unmarshal(raw, &set); err != nil {
+        return nil, err
+    }
+    keys := make(map[string]crypto.PublicKey, len(set.Keys))
+    for _, j := range set.Keys {
+        if j.Use != "" && j.Use != "sig" {
+            continue
+        }
+        var (
+            key crypto.PublicKey
+            err error
+        )
+        switch j.Kty {
+        case "RSA":
+            key, err = j.rsaKey()
+        case "EC":
+            key, err = j.ecKey()
+        default:
+            continue
+        }
+        if err != nil {
+            if onKeyError != nil {
+                onKeyError(j.Kid, err)
+            }
+            continue
+        }
+        keys[j.Kid] = key
+    }
+    if len(keys) == 0 {
+        return nil, errors.New("no usable signing keys")
+    }
+    return keys, nil
+}
+
+func (j jwk) rsaKey() (*rsa.PublicKey, error) {
+    n, err := b64Int(j.N)
+    if err != nil {
+        return nil, err
+    }
+    e, err := b64Int(j.E)
+    if err != nil {
+        return nil, err
+    }
+    if !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+        return nil, errors.New("invalid RSA exponent")
+    }
+    return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+}
+
+func (j jwk) ecKey() (*ecdsa.PublicKey, error) {
+    var curve elliptic.Curve
+    switch j.Crv {
+    case "P-256":
+        curve = elliptic.P256()
+    case "P-384":
+        curve = elliptic.P384()
+    case "P-521":
+        curve = elliptic.P521()
+    default:
+        return nil, fmt.Errorf("unsupported curve %q", j.Crv)
+    }
+    x, err := b64Int(j.X)
+    if err != nil {
+        return nil, err
+    }
+    y, err := b64Int(j.Y)
+    if err != nil {
+        return nil, err
+    }
+    if !curve.IsOnCurve(x, y) {
+        return nil, errors.New("point is not on the curve")
+    }
+    return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
+
+func b64Int(s string) (*big.Int, error) {
+    b, err := base64.RawURLEncoding.DecodeString(s)
+    if err != nil || len(b) == 0 {
+        return nil, errors.New("invalid base64url integer")
+    }
+    return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,151 @@
+package middleware
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func b64(i *big.Int) string { return base64.RawURLEncoding.EncodeToString(i.Bytes()) }
+
+func rsaJWK(kid string, k *rsa.PublicKey) map[string]string {
+	return map[string]string{"kty": "RSA", "kid": kid, "use": "sig", "n": b64(k.N), "e": b64(big.NewInt(int64(k.E)))}
+}
+
+func ecJWK(kid string, k *ecdsa.PublicKey) map[string]string {
+	return map[string]string{"kty": "EC", "kid": kid, "crv": "P-256", "x": b64(k.X), "y": b64(k.Y)}
+}
+
+func jwksJSON(t *testing.T, keys ...map[string]string) []byte {
+	t.Helper()
+	raw, err := json.Marshal(map[string]any{"keys": keys})
+	require.NoError(t, err)
+	return raw
+}
+
+func signed(t *testing.T, method jwt.SigningMethod, kid string, key any) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, jwt.MapClaims{"sub": "user-123", "exp": time.Now().Add(time.Hour).Unix()})
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	s, err := token.SignedString(key)
+	require.NoError(t, err)
+	return s
+}
+
+func authStatus(r *gin.Engine, token string) int {
+	req := httptest.NewRequest("GET", "/test", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	return resp.Code
+}
+
+func authRouter(opts AuthOptions) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Auth(opts))
+	r.GET("/test", func(c *gin.Context) {
+		uid, _ := UserIDFromContext(c)
+		c.JSON(200, gin.H{"userId": uid})
+	})
+	return r
+}
+
+func TestAuth_JWKSRotation(t *testing.T) {
+	oldKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	body := jwksJSON(t, rsaJWK("old", &oldKey.PublicKey))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		_, _ = w.Write(body)
+	}))
+	defer srv.Close()
+
+	jwks := NewJWKS(JWKSOptions{URL: srv.URL, MinRefresh: time.Millisecond})
+	r := authRouter(AuthOptions{Enabled: true, Keys: jwks})
+
+	assert.Equal(t, 200, authStatus(r, signed(t, jwt.SigningMethodRS256, "old", oldKey)))
+	assert.Equal(t, 401, authStatus(r, signed(t, jwt.SigningMethodRS256, "new", newKey)))
+
+	// The issuer publishes a new key; the unknown kid triggers a reload.
+	mu.Lock()
+	body = jwksJSON(t, rsaJWK("old", &oldKey.PublicKey), rsaJWK("new", &newKey.PublicKey))
+	mu.Unlock()
+	time.Sleep(2 * time.Millisecond)
+	assert.Equal(t, 200, authStatus(r, signed(t, jwt.SigningMethodRS256, "new", newKey)))
+
+	// A token claiming the old kid but signed with another key is rejected.
+	assert.Equal(t, 401, authStatus(r, signed(t, jwt.SigningMethodRS256, "old", newKey)))
+}
+
+func TestAuth_JWKSFileAndAlgorithms(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	file := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(file, jwksJSON(t, ecJWK("ec", &ecKey.PublicKey), rsaJWK("rsa", &rsaKey.PublicKey)), 0o600))
+
+	jwks := NewJWKS(JWKSOptions{File: file})
+	require.NoError(t, jwks.Refresh(context.Background()))
+	r := authRouter(AuthOptions{Enabled: true, Keys: jwks, Algorithms: []string{"ES256"}})
+
+	assert.Equal(t, 200, authStatus(r, signed(t, jwt.SigningMethodES256, "ec", ecKey)))
+	assert.Equal(t, 401, authStatus(r, signed(t, jwt.SigningMethodRS256, "rsa", rsaKey)), "RS256 is not in the allowed list")
+
+	// The public key must never work as an HMAC secret.
+	der, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	require.NoError(t, err)
+	r = authRouter(AuthOptions{Enabled: true, Keys: jwks, Algorithms: []string{"HS256", "RS256"}})
+	assert.Equal(t, 401, authStatus(r, signed(t, jwt.SigningMethodHS256, "rsa", der)))
+}
+
+func TestJWKS_SkipsUnusableKeys(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	malformed := rsaJWK("malformed", &rsaKey.PublicKey)
+	malformed["e"] = "!"
+	curve := map[string]string{"kty": "EC", "kid": "p224", "crv": "P-224", "x": "AQ", "y": "AQ"}
+	file := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(file, jwksJSON(t, malformed, rsaJWK("good", &rsaKey.PublicKey), curve), 0o600))
+
+	var skipped []string
+	jwks := NewJWKS(JWKSOptions{File: file, OnKeyError: func(kid string, err error) {
+		assert.Error(t, err)
+		skipped = append(skipped, kid)
+	}})
+	require.NoError(t, jwks.Refresh(context.Background()))
+	assert.Equal(t, []string{"malformed", "p224"}, skipped)
+	r := authRouter(AuthOptions{Enabled: true, Keys: jwks})
+	assert.Equal(t, 200, authStatus(r, signed(t, jwt.SigningMethodRS256, "good", rsaKey)))
+
+	// A set without a single usable key fails and keeps the cached keys.
+	require.NoError(t, os.WriteFile(file, jwksJSON(t, malformed, curve), 0o600))
+	assert.Error(t, jwks.Refresh(context.Background()))
+	assert.Equal(t, 200, authStatus(r, signed(t, jwt.SigningMethodRS256, "good", rsaKey)))
+}
@@ -1,10 +1,14 @@
 package middleware
 
 import (
+	"context"
+	"errors"
 	"net/http/httptest"
 	"testing"
 	"time"
 
+	"download-service/internal/cache"
+	"download-service/internal/clients/tier"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/assert"
@@ -28,7 +32,7 @@ func TestAuth_Disabled(t *testing.T) {
 func TestAuth_DevMode(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	r := gin.New()
-	r.Use(Auth(AuthOptions{Enabled: true, Secret: ""}))
+	r.Use(Auth(AuthOptions{Enabled: true, TrustUserHeader: true}))
 	r.GET("/test", func(c *gin.Context) {
 		uid, ok := UserIDFromContext(c)
 		if ok {
@@ -47,6 +51,22 @@ func TestAuth_DevMode(t *testing.T) {
 	assert.Contains(t, resp.Body.String(), "test-user-123")
 }
 
+func TestAuth_UserHeaderNeedsFlag(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Auth(AuthOptions{Enabled: true}))
+	r.GET("/test", func(c *gin.Context) {
+		c.JSON(200, gin.H{"status": "ok"})
+	})
+
+	req := httptest.NewRequest("GET", "/test", nil)
+	req.Header.Set("X-User-Id", "test-user-123")
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+
+	assert.Equal(t, 401, resp.Code)
+}
+
 func TestAuth_JWT(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	secret := "test-secret"
@@ -85,6 +105,148 @@ func TestAuth_JWT(t *testing.T) {
 	assert.Contains(t, resp.Body.String(), "user-123")
 }
 
+func TestAuth_TierClaim(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	secret := "test-secret"
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":  "user-123",
+		"plan": "premium",
+		"exp":  time.Now().Add(time.Hour).Unix(),
+	})
+	tokenString, _ := token.SignedString([]byte(secret))
+
+	r := gin.New()
+	r.Use(Auth(AuthOptions{Enabled: true, Secret: secret, TierClaim: "plan"}))
+	r.GET("/test", func(c *gin.Context) {
+		got, _ := tier.FromContext(c.Request.Context())
+		c.JSON(200, gin.H{"tier": got})
+	})
+
+	req := httptest.NewRequest("GET", "/test", nil)
+	req.Header.Set("Authorization", "Bearer "+tokenString)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code)
+	assert.Contains(t, resp.Body.String(), "premium")
+}
+
+func TestAuth_RolesAndScopes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	secret := "test-secret"
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":             "user-123",
+		"roles":           []string{"support"},
+		"scope":           "downloads:read downloads:admin:read",
+		"publisher_games": []string{"g1"},
+		"exp":             time.Now().Add(time.Hour).Unix(),
+	})
+	tokenString, _ := token.SignedString([]byte(secret))
+
+	r := gin.New()
+	r.Use(Auth(AuthOptions{Enabled: true, Secret: secret}))
+	r.GET("/test", func(c *gin.Context) {
+		c.JSON(200, gin.H{"roles": RolesFromContext(c), "scopes": ScopesFromContext(c), "games": GamesFromContext(c)})
+	})
+
+	req := httptest.NewRequest("GET", "/test", nil)
+	req.Header.Set("Authorization", "Bearer "+tokenString)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+
+	assert.Equal(t, 200, resp.Code)
+	assert.JSONEq(t, `{"roles":["support"],"scopes":["downloads:read","downloads:admin:read"],"games":["g1"]}`, resp.Body.String())
+}
+
+func TestAdmin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Auth(AuthOptions{Enabled: true, TrustUserHeader: true}))
+	admin := r.Group("/admin", Admin(AdminOptions{}))
+	admin.GET("/downloads", func(c *gin.Context) { c.Status(200) })
+	admin.POST("/downloads/1/cancel", func(c *gin.Context) { c.Status(200) })
+
+	tests := []struct {
+		name, method, roles, scopes string
+		want                        int
+	}{
+		{"plain user", "GET", "", "downloads:read", 403},
+		{"support role", "POST", "support", "", 200},
+		{"admin scope", "POST", "", "downloads:admin", 200},
+		{"read scope reads", "GET", "", "downloads:admin:read", 200},
+		{"read scope cannot write", "POST", "", "downloads:admin:read", 403},
+		{"other role", "POST", "player", "", 403},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := "/admin/downloads"
+			if tt.method == "POST" {
+				path += "/1/cancel"
+			}
+			req := httptest.NewRequest(tt.method, path, nil)
+			req.Header.Set("X-User-Id", "user-123")
+			req.Header.Set("X-User-Roles", tt.roles)
+			req.Header.Set("X-User-Scopes", tt.scopes)
+			resp := httptest.NewRecorder()
+			r.ServeHTTP(resp, req)
+			assert.Equal(t, tt.want, resp.Code)
+		})
+	}
+}
+
+func TestPublisher(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Auth(AuthOptions{Enabled: true, TrustUserHeader: true}))
+	r.POST("/publish/games/g1/builds", Publisher(PublisherOptions{Roles: []string{"studio"}}), func(c *gin.Context) { c.Status(201) })
+
+	for _, tt := range []struct {
+		name, roles, scopes string
+		want                int
+	}{
+		{"plain user", "", "downloads:read", 403},
+		{"configured role", "studio", "", 201},
+		{"default role replaced", "publisher", "", 403},
+		{"publish scope", "", "builds:publish", 201},
+		{"admin", "admin", "downloads:admin", 403},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/publish/games/g1/builds", nil)
+			req.Header.Set("X-User-Id", "user-123")
+			req.Header.Set("X-User-Roles", tt.roles)
+			req.Header.Set("X-User-Scopes", tt.scopes)
+			resp := httptest.NewRecorder()
+			r.ServeHTTP(resp, req)
+			assert.Equal(t, tt.want, resp.Code)
+		})
+	}
+}
+
+func TestInternalToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/internal/a", InternalToken("X-Internal-Token", "s3cret"), func(c *gin.Context) { c.Status(204) })
+	r.POST("/internal/b", InternalToken("X-Internal-Token", ""), func(c *gin.Context) { c.Status(204) })
+
+	for _, tt := range []struct {
+		path, token string
+		want        int
+	}{
+		{"/internal/a", "s3cret", 204},
+		{"/internal/a", "wrong", 401},
+		{"/internal/a", "", 401},
+		{"/internal/b", "", 503},
+	} {
+		req := httptest.NewRequest("POST", tt.path, nil)
+		if tt.token != "" {
+			req.Header.Set("X-Internal-Token", tt.token)
+		}
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		assert.Equal(t, tt.want, resp.Code, "%s with %q", tt.path, tt.token)
+	}
+}
+
 func TestAuth_InvalidToken(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	r := gin.New()
@@ -128,6 +290,81 @@ func TestRateLimit(t *testing.T) {
 	assert.Equal(t, 429, resp2.Code)
 }
 
+func TestRateLimit_Headers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(RateLimit(RateLimitOptions{RPS: 0.5, Burst: 2}))
+	r.GET("/test", func(c *gin.Context) { c.Status(200) })
+
+	serve := func() *httptest.ResponseRecorder {
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, httptest.NewRequest("GET", "/test", nil))
+		return resp
+	}
+	resp := serve()
+	assert.Equal(t, 200, resp.Code)
+	assert.Equal(t, "2", resp.Header().Get("X-RateLimit-Limit"))
+	assert.Equal(t, "1", resp.Header().Get("X-RateLimit-Remaining"))
+	assert.Equal(t, "2", resp.Header().Get("X-RateLimit-Reset"))
+	assert.Empty(t, resp.Header().Get("Retry-After"))
+
+	assert.Equal(t, 200, serve().Code)
+	resp = serve()
+	assert.Equal(t, 429, resp.Code)
+	assert.Equal(t, "0", resp.Header().Get("X-RateLimit-Remaining"))
+	assert.Equal(t, "2", resp.Header().Get("Retry-After"))
+}
+
+func TestRateLimit_RouteClasses(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(RateLimit(RateLimitOptions{
+		RPS:     1,
+		Burst:   3,
+		Classes: map[string]cache.RateQuota{"start": {Rate: 1, Burst: 1}},
+		Routes: map[string]RouteLimit{
+			"POST /items":            {Class: "start"},
+			"POST /items/:id/verify": {Cost: 2},
+		},
+	}))
+	ok := func(c *gin.Context) { c.Status(200) }
+	r.GET("/items/:id", ok)
+	r.POST("/items", ok)
+	r.POST("/items/:id/verify", ok)
+
+	serve := func(method, path string) int {
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, httptest.NewRequest(method, path, nil))
+		return resp.Code
+	}
+	// The start class has its own quota.
+	assert.Equal(t, 200, serve("POST", "/items"))
+	assert.Equal(t, 429, serve("POST", "/items"))
+	// Verify costs two of the default class's three requests.
+	assert.Equal(t, 200, serve("POST", "/items/1/verify"))
+	assert.Equal(t, 200, serve("GET", "/items/1"))
+	assert.Equal(t, 429, serve("GET", "/items/2"))
+}
+
+type failingLimiter struct{}
+
+func (failingLimiter) Allow(ctx context.Context, key string, q cache.RateQuota, cost int) (cache.RateDecision, error) {
+	return cache.RateDecision{}, errors.New("redis down")
+}
+
+func TestRateLimit_LimiterFallback(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(RateLimit(RateLimitOptions{RPS: 1, Burst: 1, Limiter: failingLimiter{}}))
+	r.GET("/test", func(c *gin.Context) { c.Status(200) })
+
+	for _, want := range []int{200, 429} {
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, httptest.NewRequest("GET", "/test", nil))
+		assert.Equal(t, want, resp.Code)
+	}
+}
+
 func TestRequestID(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	r := gin.New()
@@ -1,20 +1,49 @@
 package middleware
 
 import (
+    "context"
+    "math"
     "net"
     "net/http"
+    "strconv"
     "sync"
     "time"
 
     "github.com/gin-gonic/gin"
     "golang.org/x/time/rate"
+
+    "download-service/internal/cache"
 )
 
+// DefaultRateClass is the quota class of routes without a RouteLimit.
+const DefaultRateClass = "default"
+
+// Limiter spends requests against a key's quota. cache.RedisRateLimiter shares
+// the counters between replicas.
+type Limiter interface {
+    Allow(ctx context.Context, key string, q cache.RateQuota, cost int) (cache.RateDecision, error)
+}
+
 type RateLimitOptions struct {
     RPS   float64
     Burst int
     // KeyFunc allows custom keying (e.g., user id). If nil, uses client IP.
     KeyFunc func(*gin.Context) string
+    // Limiter holds the counters. If nil, they are kept in process memory, so each
+    // replica enforces the limits separately and they reset on restart.
+    Limiter Limiter
+    // Classes are named quotas with counters of their own; DefaultRateClass uses
+    // RPS and Burst unless listed. A class missing here gets the default quota.
+    Classes map[string]cache.RateQuota
+    // Routes assigns routes, keyed by method and registered path such as
+    // "POST /api/downloads", to a quota class and cost.
+    Routes map[string]RouteLimit
+}
+
+// RouteLimit puts a route in a quota class and sets how many requests a call counts as.
+type RouteLimit struct {
+    Class string // DefaultRateClass when empty
+    Cost  int    // 1 when zero; at most the class's burst
 }
 
 type limiterEntry struct {
@@ -48,6 +77,25 @@ func (s *limiterStore) get(key string, rps float64, burst int) *rate.Limiter {
     return l
 }
 
+// Allow implements Limiter with a token bucket per key.
+func (s *limiterStore) Allow(ctx context.Context, key string, q cache.RateQuota, cost int) (cache.RateDecision, error) {
+    lim := s.get(key, q.Rate, q.Burst)
+    now := time.Now()
+    r := lim.ReserveN(now, cost)
+    if delay := r.DelayFrom(now); !r.OK() || delay > 0 {
+        r.CancelAt(now)
+        tokens := lim.TokensAt(now)
+        return cache.RateDecision{Remaining: int(math.Max(tokens, 0)), RetryAfter: delay, ResetAfter: refill(q, tokens)}, nil
+    }
+    tokens := lim.TokensAt(now)
+    return cache.RateDecision{Allowed: true, Remaining: int(tokens), ResetAfter: refill(q, tokens)}, nil
+}
+
+// refill is how long a bucket holding tokens takes to fill up.
+func refill(q cache.RateQuota, tokens float64) time.Duration {
+    return time.Duration((float64(q.Burst) - tokens) / q.Rate * float64(time.Second))
+}
+
 func clientIP(c *gin.Context) string {
     ip := c.ClientIP()
     if ip == "" {
@@ -57,7 +105,10 @@ func clientIP(c *gin.Context) string {
     return ip
 }
 
-// RateLimit applies a token-bucket limiter per key (user/IP) and returns 429 if exceeded.
+// RateLimit limits requests per key (user/IP) and quota class, returning 429 once a
+// quota is spent. Responses carry X-RateLimit-Limit, X-RateLimit-Remaining and
+// X-RateLimit-Reset (seconds until the full burst is back), and rejections a
+// Retry-After. If the Limiter fails, the request is counted in process memory.
 func RateLimit(opts RateLimitOptions) gin.HandlerFunc {
     store := newStore()
     keyFn := opts.KeyFunc
@@ -73,10 +124,40 @@ func RateLimit(opts RateLimitOptions) gin.HandlerFunc {
     }
     if opts.RPS <= 0 { opts.RPS = 5 }
     if opts.Burst <= 0 { opts.Burst = 10 }
+    var limiter Limiter = store
+    if opts.Limiter != nil {
+        limiter = opts.Limiter
+    }
+    quota := func(class string) cache.RateQuota {
+        if q, ok := opts.Classes[class]; ok && q.Rate > 0 && q.Burst > 0 {
+            return q
+        }
+        return cache.RateQuota{Rate: opts.RPS, Burst: opts.Burst}
+    }
     return func(c *gin.Context) {
-        key := keyFn(c)
-        lim := store.get(key, opts.RPS, opts.Burst)
-        if !lim.Allow() {
+        route := opts.Routes[c.Request.Method+" "+c.FullPath()]
+        if route.Class == "" {
+            route.Class = DefaultRateClass
+        }
+        q := quota(route.Class)
+        cost := route.Cost
+        if cost <= 0 {
+            cost = 1
+        }
+        if cost > q.Burst {
+            cost = q.Burst
+        }
+        key := route.Class + ":" + keyFn(c)
+        d, err := limiter.Allow(c.Request.Context(), key, q, cost)
+        if err != nil {
+            d, _ = store.Allow(c.Request.Context(), key, q, cost)
+        }
+        h := c.Writer.Header()
+        h.Set("X-RateLimit-Limit", strconv.Itoa(q.Burst))
+        h.Set("X-RateLimit-Remaining", strconv.Itoa(d.Remaining))
+        h.Set("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(d.ResetAfter)))
+        if !d.Allowed {
+            h.Set("Retry-After", strconv.Itoa(max(ceilSeconds(d.RetryAfter), 1)))
             c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "rate limit exceeded"})
             return
         }
@@ -84,3 +165,6 @@ func RateLimit(opts RateLimitOptions) gin.HandlerFunc {
     }
 }
 
+func ceilSeconds(d time.Duration) int {
+    return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// AuditEntry records one action taken through the admin API: who did what to
+// which download, why, and whether it succeeded.
+type AuditEntry struct {
+	ID           string            `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	Actor        string            `json:"actor" gorm:"type:text;not null;index:idx_audit_entries_actor"` // user id of the operator
+	Action       string            `json:"action" gorm:"type:text;not null"`
+	DownloadID   string            `json:"downloadId,omitempty" gorm:"type:text;index:idx_audit_entries_download"`
+	TargetUserID string            `json:"targetUserId,omitempty" gorm:"type:text"` // owner of the download acted on
+	Reason       string            `json:"reason,omitempty" gorm:"type:text"`
+	Details      map[string]string `json:"details,omitempty" gorm:"type:jsonb;serializer:json"`
+	Outcome      string            `json:"outcome" gorm:"type:text;not null"` // "ok" or the error returned
+	RequestID    string            `json:"requestId,omitempty" gorm:"type:text"`
+	CreatedAt    time.Time         `json:"createdAt" gorm:"index"`
+}
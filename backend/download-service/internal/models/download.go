@@ -15,21 +15,49 @@ const (
     StatusCompleted   DownloadStatus = "completed"
     StatusFailed      DownloadStatus = "failed"
     StatusCancelled   DownloadStatus = "cancelled"
+
+    // File-only states recorded by integrity verification.
+    StatusVerified  DownloadStatus = "verified"
+    StatusCorrupted DownloadStatus = "corrupted"
+)
+
+// DownloadType distinguishes fresh installs from patches of an installed version.
+type DownloadType string
+
+const (
+    DownloadTypeFull   DownloadType = "full"
+    DownloadTypeUpdate DownloadType = "update"
+)
+
+// Bounds of Download.Priority.
+const (
+    MinPriority = 0
+    MaxPriority = 100
 )
 
 // Download represents a game download with complete validation tags
 type Download struct {
-    ID             string         `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()" validate:"omitempty,uuid4"`
-    UserID         string         `json:"userId" gorm:"type:uuid;not null;index:idx_downloads_user;index:idx_downloads_user_game_status,priority:1" validate:"required,uuid4"`
-    GameID         string         `json:"gameId" gorm:"type:uuid;not null;index:idx_downloads_game;index:idx_downloads_user_game_status,priority:2" validate:"required,uuid4"`
-    Status         DownloadStatus `json:"status" gorm:"type:text;not null;index:idx_downloads_status;index:idx_downloads_user_game_status,priority:3" validate:"required,oneof=pending downloading paused completed failed cancelled"`
-    Progress       int            `json:"progress" gorm:"default:0;check:progress >= 0 AND progress <= 100" validate:"min=0,max=100"`
-    TotalSize      int64          `json:"totalSize" gorm:"default:0" validate:"min=0"`
-    DownloadedSize int64          `json:"downloadedSize" gorm:"default:0" validate:"min=0"`
-    Speed          int64          `json:"speed" gorm:"default:0" validate:"min=0"`
-    Files          []DownloadFile `json:"files,omitempty" gorm:"foreignKey:DownloadID"`
-    CreatedAt      time.Time      `json:"createdAt"`
-    UpdatedAt      time.Time      `json:"updatedAt"`
+    ID             string            `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()" validate:"omitempty,uuid4"`
+    UserID         string            `json:"userId" gorm:"type:uuid;not null;index:idx_downloads_user;index:idx_downloads_user_game_status,priority:1" validate:"required,uuid4"`
+    GameID         string            `json:"gameId" gorm:"type:uuid;not null;index:idx_downloads_game;index:idx_downloads_user_game_status,priority:2" validate:"required,uuid4"`
+    Status         DownloadStatus    `json:"status" gorm:"type:text;not null;index:idx_downloads_status;index:idx_downloads_user_game_status,priority:3" validate:"required,oneof=pending downloading paused completed failed cancelled"`
+    Type           DownloadType      `json:"type" gorm:"type:text;not null;default:full" validate:"omitempty,oneof=full update"`
+    Version        string            `json:"version,omitempty" gorm:"type:text"`     // build version being installed
+    FromVersion    string            `json:"fromVersion,omitempty" gorm:"type:text"` // installed version an update patches
+    Progress       int               `json:"progress" gorm:"default:0;check:progress >= 0 AND progress <= 100" validate:"min=0,max=100"`
+    TotalSize      int64             `json:"totalSize" gorm:"default:0" validate:"min=0"`
+    DownloadedSize int64             `json:"downloadedSize" gorm:"default:0" validate:"min=0"`
+    Speed          int64             `json:"speed" gorm:"default:0" validate:"min=0"`
+    Priority       int               `json:"priority" gorm:"not null;default:0" validate:"min=0,max=100"` // higher runs first
+    QueuePosition  int64             `json:"queuePosition" gorm:"not null;default:0"`                     // lower starts first among equal priorities
+    Tier           string            `json:"tier,omitempty" gorm:"type:text"`                             // subscription tier the download was started under
+    Schedule       *DownloadSchedule `json:"schedule,omitempty" gorm:"type:jsonb;serializer:json"`        // when the transfer may run; nil means any time
+    FailureReason  string            `json:"failureReason,omitempty" gorm:"type:text"`
+    LeaseOwner     string            `json:"-" gorm:"type:text;index:idx_downloads_lease"` // replica running the transfer
+    LeaseExpiresAt *time.Time        `json:"-"`                                           // pushed forward by the owner's heartbeat
+    Files          []DownloadFile    `json:"files,omitempty" gorm:"foreignKey:DownloadID"`
+    CreatedAt      time.Time         `json:"createdAt"`
+    UpdatedAt      time.Time         `json:"updatedAt"`
 }
 
 // DownloadFile represents a file within a download with complete validation tags
@@ -39,9 +67,11 @@ type DownloadFile struct {
     Download       *Download      `json:"download,omitempty" gorm:"foreignKey:DownloadID;constraint:OnDelete:CASCADE"`
     FileName       string         `json:"fileName" gorm:"not null;index:idx_download_files_name" validate:"required,min=1,max=255"`
     FilePath       string         `json:"filePath" gorm:"not null" validate:"required,min=1,max=500"`
-    FileSize       int64          `json:"fileSize" validate:"min=0"`
+    ObjectKey      string         `json:"-" gorm:"type:text"` // empty when the file is assembled from chunks
+    FileSize       int64          `json:"fileSize" validate:"min=0"` // bytes to transfer; for updates only the missing chunks count
     DownloadedSize int64          `json:"downloadedSize" validate:"min=0"`
-    Status         DownloadStatus `json:"status" gorm:"type:text;index:idx_download_files_status" validate:"required,oneof=pending downloading paused completed failed cancelled"`
+    Checksum       string         `json:"checksum,omitempty" gorm:"type:text" validate:"omitempty,len=64,hexadecimal"`
+    Status         DownloadStatus `json:"status" gorm:"type:text;index:idx_download_files_status" validate:"required,oneof=pending downloading paused completed failed cancelled verified corrupted"`
     CreatedAt      time.Time      `json:"createdAt"`
     UpdatedAt      time.Time      `json:"updatedAt"`
 }
@@ -0,0 +1,60 @@
+package models
+
+import "time"
+
+// Actors recorded on download history entries besides "user:<id>".
+const (
+	ActorSystem      = "system"      // the transfer engine finishing or failing a download
+	ActorEntitlement = "entitlement" // the library revoking the user's game, e.g. after a refund
+)
+
+// UserActor names the user who caused a transition.
+func UserActor(userID string) string { return "user:" + userID }
+
+// AdminActor names the operator who caused a transition through the admin API.
+func AdminActor(userID string) string { return "admin:" + userID }
+
+// ReplicaActor names the replica that caused a transition, e.g. during recovery.
+func ReplicaActor(instanceID string) string { return "replica:" + instanceID }
+
+// DownloadEvent records one status transition of a download, so support can
+// answer why a download ended up where it is.
+type DownloadEvent struct {
+	ID         string         `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	DownloadID string         `json:"downloadId" gorm:"type:uuid;not null;index:idx_download_events_download"`
+	FromStatus DownloadStatus `json:"fromStatus" gorm:"type:text"` // empty for the creating transition
+	ToStatus   DownloadStatus `json:"toStatus" gorm:"type:text;not null"`
+	Actor      string         `json:"actor" gorm:"type:text;not null"`
+	Reason     string         `json:"reason,omitempty" gorm:"type:text"`
+	CreatedAt  time.Time      `json:"createdAt" gorm:"index:idx_download_events_download"`
+}
+
+// transitions lists the statuses a download may move to from each status.
+// Completed, failed and cancelled downloads are final.
+var transitions = map[DownloadStatus][]DownloadStatus{
+	StatusPending:     {StatusDownloading, StatusPaused, StatusCancelled, StatusFailed},
+	StatusDownloading: {StatusPaused, StatusCompleted, StatusFailed, StatusCancelled},
+	// A transfer can finish or fail in the moment a pause is being applied.
+	// A paused download resumed while its user has no free slot waits in pending.
+	StatusPaused: {StatusDownloading, StatusPending, StatusCancelled, StatusCompleted, StatusFailed},
+}
+
+// UnfinishedStatuses are the statuses a download can still move on from.
+var UnfinishedStatuses = []DownloadStatus{StatusPending, StatusDownloading, StatusPaused}
+
+// CanTransition reports whether a download in status from may move to status to.
+func CanTransition(from, to DownloadStatus) bool {
+	for _, s := range transitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// CanRetry reports whether an operator may send a download in status from back to
+// the queue. Only failed downloads can be retried; users never can.
+func CanRetry(from DownloadStatus) bool {
+	return from == StatusFailed
+}
+
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from, to DownloadStatus
+		want     bool
+	}{
+		{StatusPending, StatusDownloading, true},
+		{StatusDownloading, StatusPaused, true},
+		{StatusDownloading, StatusCompleted, true},
+		{StatusPaused, StatusDownloading, true},
+		{StatusPaused, StatusCancelled, true},
+		{StatusPaused, StatusPending, true},
+		{StatusDownloading, StatusPending, false},
+		{StatusDownloading, StatusDownloading, false},
+		{StatusPaused, StatusPaused, false},
+		{StatusCompleted, StatusDownloading, false},
+		{StatusCancelled, StatusDownloading, false},
+		{StatusFailed, StatusPaused, false},
+		{StatusCompleted, StatusVerified, false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, CanTransition(tt.from, tt.to), "%s -> %s", tt.from, tt.to)
+	}
+}
+
+func TestTerminalStatusesHaveNoTransitions(t *testing.T) {
+	all := []DownloadStatus{StatusPending, StatusDownloading, StatusPaused, StatusCompleted, StatusFailed, StatusCancelled}
+	for _, from := range []DownloadStatus{StatusCompleted, StatusFailed, StatusCancelled} {
+		for _, to := range all {
+			assert.False(t, CanTransition(from, to), "%s -> %s", from, to)
+		}
+	}
+}
+
+func TestCanRetry(t *testing.T) {
+	assert.True(t, CanRetry(StatusFailed))
+	for _, from := range []DownloadStatus{StatusPending, StatusDownloading, StatusPaused, StatusCompleted, StatusCancelled} {
+		assert.False(t, CanRetry(from), from)
+	}
+}
@@ -0,0 +1,104 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ActorScheduler names the background scheduler on download history entries.
+const ActorScheduler = "scheduler"
+
+// maxScheduleWindows bounds DownloadSchedule.Windows.
+const maxScheduleWindows = 24
+
+// HourWindow is the daily span of hours [From, To). It wraps past midnight when
+// From is after To, so 22-6 allows the night and 0-24 the whole day.
+type HourWindow struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+}
+
+// Validate reports whether the window names real hours and is not empty.
+func (w HourWindow) Validate() error {
+	if w.From < 0 || w.From > 23 || w.To < 0 || w.To > 24 {
+		return fmt.Errorf("hour window %d-%d: from must be 0-23 and to 0-24", w.From, w.To)
+	}
+	if w.From == w.To {
+		return fmt.Errorf("hour window %d-%d is empty", w.From, w.To)
+	}
+	return nil
+}
+
+// Contains reports whether the hour of day falls inside the window.
+func (w HourWindow) Contains(hour int) bool {
+	if w.From <= w.To {
+		return hour >= w.From && hour < w.To
+	}
+	return hour >= w.From || hour < w.To
+}
+
+// DownloadSchedule restricts when a download may transfer. Every condition set
+// must hold; a download outside its schedule waits in pending.
+type DownloadSchedule struct {
+	StartAt  *time.Time   `json:"startAt,omitempty"`  // not before this instant
+	Windows  []HourWindow `json:"windows,omitempty"`  // only within one of these, read in Timezone
+	OffPeak  bool         `json:"offPeak,omitempty"`  // only within the service's off-peak hours
+	Timezone string       `json:"timezone,omitempty"` // IANA zone of Windows; UTC when empty
+}
+
+// IsZero reports whether the schedule places no restriction.
+func (s *DownloadSchedule) IsZero() bool {
+	return s == nil || (s.StartAt == nil && len(s.Windows) == 0 && !s.OffPeak)
+}
+
+// Validate checks the windows and time zone.
+func (s *DownloadSchedule) Validate() error {
+	if s == nil {
+		return nil
+	}
+	if len(s.Windows) > maxScheduleWindows {
+		return fmt.Errorf("at most %d windows are allowed", maxScheduleWindows)
+	}
+	for _, w := range s.Windows {
+		if err := w.Validate(); err != nil {
+			return err
+		}
+	}
+	if s.Timezone != "" {
+		if _, err := time.LoadLocation(s.Timezone); err != nil {
+			return errors.New("unknown timezone " + s.Timezone)
+		}
+	}
+	return nil
+}
+
+// Allows reports whether the download may transfer at now. offPeak is the
+// service's off-peak window in UTC. A nil schedule allows any time.
+func (s *DownloadSchedule) Allows(now time.Time, offPeak HourWindow) bool {
+	if s == nil {
+		return true
+	}
+	if s.StartAt != nil && now.Before(*s.StartAt) {
+		return false
+	}
+	if s.OffPeak && !offPeak.Contains(now.UTC().Hour()) {
+		return false
+	}
+	if len(s.Windows) == 0 {
+		return true
+	}
+	loc := time.UTC
+	if s.Timezone != "" {
+		if l, err := time.LoadLocation(s.Timezone); err == nil {
+			loc = l
+		}
+	}
+	hour := now.In(loc).Hour()
+	for _, w := range s.Windows {
+		if w.Contains(hour) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDownloadSchedule_Allows(t *testing.T) {
+	// 23:30 UTC is 02:30 in Moscow.
+	now := time.Date(2026, 3, 14, 23, 30, 0, 0, time.UTC)
+	later := now.Add(time.Hour)
+	offPeak := HourWindow{From: 22, To: 6}
+	tests := []struct {
+		name     string
+		schedule *DownloadSchedule
+		want     bool
+	}{
+		{"no schedule", nil, true},
+		{"start time passed", &DownloadSchedule{StartAt: &now}, true},
+		{"start time ahead", &DownloadSchedule{StartAt: &later}, false},
+		{"window wrapping midnight", &DownloadSchedule{Windows: []HourWindow{{From: 22, To: 6}}}, true},
+		{"window closed", &DownloadSchedule{Windows: []HourWindow{{From: 9, To: 17}}}, false},
+		{"any of several windows", &DownloadSchedule{Windows: []HourWindow{{From: 9, To: 17}, {From: 23, To: 24}}}, true},
+		{"window in time zone", &DownloadSchedule{Windows: []HourWindow{{From: 1, To: 5}}, Timezone: "Europe/Moscow"}, true},
+		{"off-peak", &DownloadSchedule{OffPeak: true}, true},
+		{"every condition must hold", &DownloadSchedule{OffPeak: true, StartAt: &later}, false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, tt.schedule.Allows(now, offPeak), tt.name)
+	}
+	assert.False(t, (&DownloadSchedule{OffPeak: true}).Allows(now, HourWindow{From: 2, To: 8}))
+}
+
+func TestDownloadSchedule_Validate(t *testing.T) {
+	assert.NoError(t, (&DownloadSchedule{Windows: []HourWindow{{From: 0, To: 24}, {From: 22, To: 6}}, Timezone: "Asia/Tokyo"}).Validate())
+	assert.Error(t, (&DownloadSchedule{Windows: []HourWindow{{From: 5, To: 5}}}).Validate())
+	assert.Error(t, (&DownloadSchedule{Windows: []HourWindow{{From: 24, To: 2}}}).Validate())
+	assert.Error(t, (&DownloadSchedule{Timezone: "Mars/Olympus"}).Validate())
+	assert.True(t, (&DownloadSchedule{}).IsZero())
+}
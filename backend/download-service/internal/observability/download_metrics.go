@@ -1,5 +1,7 @@
 package observability
 
+import "strconv"
+
 // Status labels for the downloads_total metric.
 const (
 	StatusStarted   = "started"
@@ -27,3 +29,14 @@ func DecActiveDownloads() {
 func AddDownloadedBytes(bytes float64) {
 	downloadBytesTotal.Add(bytes)
 }
+
+// AddServedBytes records bytes of game content streamed by the service, labelled by HTTP status.
+func AddServedBytes(status int, bytes int64) {
+	servedBytesTotal.WithLabelValues(strconv.Itoa(status)).Add(float64(bytes))
+}
+
+// SetAllocatedBandwidth records the bytes per second granted to running transfers;
+// +Inf when any of them is unlimited.
+func SetAllocatedBandwidth(bytesPerSecond float64) {
+	downloadBandwidthAllocated.Set(bytesPerSecond)
+}
@@ -50,6 +50,19 @@ var (
 			Help: "Total bytes downloaded by all clients.",
 		},
 	)
+	downloadBandwidthAllocated = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "download_bandwidth_allocated_bytes_per_second",
+			Help: "Bandwidth currently granted to running transfers of this replica.",
+		},
+	)
+	servedBytesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "download_served_bytes_total",
+			Help: "Total bytes of game content streamed directly to clients.",
+		},
+		[]string{"status"}, // HTTP status of the response: 200, 206
+	)
 
 	// Library Service integration metrics
 	libraryRequestsTotal = prometheus.NewCounterVec(
@@ -74,12 +87,36 @@ var (
 		},
 		[]string{},
 	)
+	libraryCacheTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "library_ownership_cache_total",
+			Help: "Ownership checks by how the cache answered them.",
+		},
+		[]string{"result"}, // hit, negative_hit, miss, stale
+	)
+
+	// Storage origin metrics
+	storageOriginRequestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "storage_origin_requests_total",
+			Help: "Total number of requests to storage origins.",
+		},
+		[]string{"origin", "method", "status"}, // status: success/not_found/error/circuit_open
+	)
+	storageOriginCircuitState = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "storage_origin_circuit_breaker_state",
+			Help: "Current state of each storage origin's circuit breaker (0=closed, 1=open).",
+		},
+		[]string{"origin"},
+	)
 )
 
 func init() {
 	prometheus.MustRegister(httpRequestsTotal, httpRequestDuration, httpInFlight)
-	prometheus.MustRegister(downloadsTotal, downloadsActive, downloadBytesTotal)
-	prometheus.MustRegister(libraryRequestsTotal, libraryRequestDuration, libraryCircuitBreakerState)
+	prometheus.MustRegister(downloadsTotal, downloadsActive, downloadBytesTotal, downloadBandwidthAllocated, servedBytesTotal)
+	prometheus.MustRegister(libraryRequestsTotal, libraryRequestDuration, libraryCircuitBreakerState, libraryCacheTotal)
+	prometheus.MustRegister(storageOriginRequestsTotal, storageOriginCircuitState)
 }
 
 // GinMetrics is a middleware that records Prometheus metrics per request.
@@ -116,3 +153,20 @@ func SetLibraryCircuitBreakerState(isOpen bool) {
     }
 }
 
+func RecordLibraryCache(result string) {
+    libraryCacheTotal.WithLabelValues(result).Inc()
+}
+
+// Storage origin metrics helpers
+
+func RecordStorageOriginRequest(origin, method, status string) {
+    storageOriginRequestsTotal.WithLabelValues(origin, method, status).Inc()
+}
+
+func SetStorageOriginCircuitState(origin string, isOpen bool) {
+    if isOpen {
+        storageOriginCircuitState.WithLabelValues(origin).Set(1)
+    } else {
+        storageOriginCircuitState.WithLabelValues(origin).Set(0)
+    }
+}
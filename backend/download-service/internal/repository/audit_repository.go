@@ -0,0 +1,56 @@
+package repository
+
+import (
+    "context"
+
+    "download-service/internal/models"
+    "gorm.io/gorm"
+)
+
+// AuditFilter selects audit entries; empty fields match everything.
+type AuditFilter struct {
+    Actor      string
+    DownloadID string
+    Action     string
+    Limit      int
+    Offset     int
+}
+
+// AuditRepository stores the log of actions taken through the admin API.
+type AuditRepository interface {
+    Create(ctx context.Context, e *models.AuditEntry) error
+    // List returns the entries matching the filter, newest first.
+    List(ctx context.Context, f AuditFilter) ([]models.AuditEntry, error)
+}
+
+type auditRepo struct{ db *gorm.DB }
+
+func NewAuditRepository(db *gorm.DB) AuditRepository { return &auditRepo{db: db} }
+
+func (r *auditRepo) Create(ctx context.Context, e *models.AuditEntry) error {
+    return r.db.WithContext(ctx).Create(e).Error
+}
+
+func (r *auditRepo) List(ctx context.Context, f AuditFilter) ([]models.AuditEntry, error) {
+    var list []models.AuditEntry
+    q := r.db.WithContext(ctx).Order("created_at DESC")
+    if f.Actor != "" {
+        q = q.Where("actor = ?", f.Actor)
+    }
+    if f.DownloadID != "" {
+        q = q.Where("download_id = ?", f.DownloadID)
+    }
+    if f.Action != "" {
+        q = q.Where("action = ?", f.Action)
+    }
+    if f.Limit > 0 {
+        q = q.Limit(f.Limit)
+    }
+    if f.Offset > 0 {
+        q = q.Offset(f.Offset)
+    }
+    if err := q.Find(&list).Error; err != nil {
+        return nil, err
+    }
+    return list, nil
+}
@@ -0,0 +1,39 @@
+package repository
+
+import (
+    "context"
+    "testing"
+
+    "download-service/internal/models"
+    "github.com/stretchr/testify/assert"
+    "github.com/stretchr/testify/require"
+)
+
+func TestAuditRepository_List(t *testing.T) {
+    db := setupTestDB(t)
+    if db == nil {
+        return // Test was skipped
+    }
+    repo := NewAuditRepository(db)
+    ctx := context.Background()
+
+    downloadID := "550e8400-e29b-41d4-a716-446655440010"
+    require.NoError(t, repo.Create(ctx, &models.AuditEntry{Actor: "op-1", Action: "downloads.list", Outcome: "ok", Details: map[string]string{"status": "failed"}}))
+    require.NoError(t, repo.Create(ctx, &models.AuditEntry{Actor: "op-1", Action: "download.fail", DownloadID: downloadID, Reason: "stuck", Outcome: "ok"}))
+    require.NoError(t, repo.Create(ctx, &models.AuditEntry{Actor: "op-2", Action: "download.retry", DownloadID: downloadID, Outcome: "ok"}))
+
+    list, err := repo.List(ctx, AuditFilter{Actor: "op-1"})
+    require.NoError(t, err)
+    require.Len(t, list, 2)
+    assert.Equal(t, map[string]string{"status": "failed"}, list[1].Details)
+
+    list, err = repo.List(ctx, AuditFilter{DownloadID: downloadID})
+    require.NoError(t, err)
+    require.Len(t, list, 2)
+    assert.Equal(t, "download.retry", list[0].Action, "newest first")
+
+    list, err = repo.List(ctx, AuditFilter{DownloadID: downloadID, Action: "download.fail"})
+    require.NoError(t, err)
+    require.Len(t, list, 1)
+    assert.Equal(t, "stuck", list[0].Reason)
+}
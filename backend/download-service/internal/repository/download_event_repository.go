@@ -0,0 +1,31 @@
+package repository
+
+import (
+    "context"
+
+    "download-service/internal/models"
+    "gorm.io/gorm"
+)
+
+// DownloadEventRepository stores the status history of downloads.
+type DownloadEventRepository interface {
+    Create(ctx context.Context, e *models.DownloadEvent) error
+    ListByDownload(ctx context.Context, downloadID string) ([]models.DownloadEvent, error)
+}
+
+type downloadEventRepo struct{ db *gorm.DB }
+
+func NewDownloadEventRepository(db *gorm.DB) DownloadEventRepository { return &downloadEventRepo{db: db} }
+
+func (r *downloadEventRepo) Create(ctx context.Context, e *models.DownloadEvent) error {
+    return r.db.WithContext(ctx).Create(e).Error
+}
+
+// ListByDownload returns a download's transitions, oldest first.
+func (r *downloadEventRepo) ListByDownload(ctx context.Context, downloadID string) ([]models.DownloadEvent, error) {
+    var list []models.DownloadEvent
+    if err := r.db.WithContext(ctx).Where("download_id = ?", downloadID).Order("created_at ASC").Find(&list).Error; err != nil {
+        return nil, err
+    }
+    return list, nil
+}
@@ -0,0 +1,75 @@
+package repository
+
+import (
+    "context"
+    "testing"
+
+    "download-service/internal/models"
+    "github.com/stretchr/testify/assert"
+    "github.com/stretchr/testify/require"
+)
+
+func TestDownloadRepository_Transition(t *testing.T) {
+    db := setupTestDB(t)
+    if db == nil {
+        return // Test was skipped
+    }
+    repo := NewDownloadRepository(db)
+    ctx := context.Background()
+
+    download := &models.Download{
+        UserID: "550e8400-e29b-41d4-a716-446655440001",
+        GameID: "550e8400-e29b-41d4-a716-446655440002",
+        Status: models.StatusDownloading,
+    }
+    require.NoError(t, repo.Create(ctx, download))
+
+    ok, err := repo.Transition(ctx, download.ID, models.StatusPaused, models.StatusDownloading, "")
+    require.NoError(t, err)
+    assert.False(t, ok, "status no longer matches")
+
+    ok, err = repo.Transition(ctx, download.ID, models.StatusDownloading, models.StatusFailed, "disk full")
+    require.NoError(t, err)
+    assert.True(t, ok)
+
+    got, err := repo.GetByID(ctx, download.ID)
+    require.NoError(t, err)
+    assert.Equal(t, models.StatusFailed, got.Status)
+    assert.Equal(t, "disk full", got.FailureReason)
+
+    // Retrying a failed download clears its failure reason.
+    ok, err = repo.Transition(ctx, download.ID, models.StatusFailed, models.StatusPending, "")
+    require.NoError(t, err)
+    assert.True(t, ok)
+    got, err = repo.GetByID(ctx, download.ID)
+    require.NoError(t, err)
+    assert.Empty(t, got.FailureReason)
+}
+
+func TestDownloadEventRepository_ListByDownload(t *testing.T) {
+    db := setupTestDB(t)
+    if db == nil {
+        return // Test was skipped
+    }
+    downloads := NewDownloadRepository(db)
+    repo := NewDownloadEventRepository(db)
+    ctx := context.Background()
+
+    download := &models.Download{
+        UserID: "550e8400-e29b-41d4-a716-446655440001",
+        GameID: "550e8400-e29b-41d4-a716-446655440002",
+        Status: models.StatusDownloading,
+    }
+    require.NoError(t, downloads.Create(ctx, download))
+
+    require.NoError(t, repo.Create(ctx, &models.DownloadEvent{DownloadID: download.ID, ToStatus: models.StatusDownloading, Actor: models.UserActor(download.UserID)}))
+    require.NoError(t, repo.Create(ctx, &models.DownloadEvent{DownloadID: download.ID, FromStatus: models.StatusDownloading, ToStatus: models.StatusFailed, Actor: models.ActorSystem, Reason: "disk full"}))
+
+    list, err := repo.ListByDownload(ctx, download.ID)
+    require.NoError(t, err)
+    require.Len(t, list, 2)
+    assert.Equal(t, models.StatusDownloading, list[0].ToStatus)
+    assert.Equal(t, models.StatusFailed, list[1].ToStatus)
+    assert.Equal(t, "disk full", list[1].Reason)
+    assert.NotEmpty(t, list[1].ID)
+}
@@ -2,11 +2,21 @@ package repository
 
 import (
     "context"
+    "time"
 
     "download-service/internal/models"
     "gorm.io/gorm"
 )
 
+// DownloadFilter selects downloads of any user; empty fields match everything.
+type DownloadFilter struct {
+    UserID string
+    GameID string
+    Status models.DownloadStatus
+    Limit  int
+    Offset int
+}
+
 type DownloadRepository interface {
     Create(ctx context.Context, d *models.Download) error
     GetByID(ctx context.Context, id string) (*models.Download, error)
@@ -14,10 +24,37 @@ type DownloadRepository interface {
     Update(ctx context.Context, d *models.Download) error
     UpdateStatus(ctx context.Context, id string, status models.DownloadStatus) error
     UpdateProgress(ctx context.Context, id string, progress int, downloadedSize int64, speed int64) error
+    // Transition moves a download from status from to status to and reports false if
+    // it was no longer in from. reason is stored as the failure reason when to is failed
+    // and the failure reason is cleared when a failed download is retried.
+    Transition(ctx context.Context, id string, from, to models.DownloadStatus, reason string) (bool, error)
+    UpdatePriority(ctx context.Context, id string, priority int) error
     ListByUser(ctx context.Context, userID string, limit, offset int) ([]models.Download, error)
     ListByUserAndStatus(ctx context.Context, userID string, status models.DownloadStatus, limit, offset int) ([]models.Download, error)
     Delete(ctx context.Context, id string) error
     CountByUser(ctx context.Context, userID string) (int64, error)
+    ListByStatus(ctx context.Context, status models.DownloadStatus, limit, offset int) ([]models.Download, error)
+    CountByUserAndStatus(ctx context.Context, userID string, status models.DownloadStatus) (int64, error)
+    // ListQueue returns a user's pending downloads in the order they should start.
+    ListQueue(ctx context.Context, userID string, limit int) ([]models.Download, error)
+    // SetQueueOrder places the given pending downloads of a user at the front of
+    // their priority band, in the order listed.
+    SetQueueOrder(ctx context.Context, userID string, ids []string) error
+    UpdateSchedule(ctx context.Context, id string, schedule *models.DownloadSchedule) error
+    // ListScheduled returns pending and downloading downloads that have a schedule.
+    ListScheduled(ctx context.Context, limit, offset int) ([]models.Download, error)
+    // List returns the downloads matching the filter, newest first.
+    List(ctx context.Context, f DownloadFilter) ([]models.Download, error)
+    // ListUnfinished returns the user's downloads of the given games that are not yet final.
+    ListUnfinished(ctx context.Context, userID string, gameIDs []string) ([]models.Download, error)
+
+    // Leases record which replica runs a download's transfer.
+    AcquireLease(ctx context.Context, id, owner string, ttl time.Duration) (bool, error)
+    RenewLease(ctx context.Context, id, owner string, ttl time.Duration) (bool, error)
+    ReleaseLease(ctx context.Context, id, owner string) error
+    // ListOrphaned returns up to limit orphaned downloads with an id after afterID,
+    // in id order, so a scan that changes their status can page by key.
+    ListOrphaned(ctx context.Context, now time.Time, afterID string, limit int) ([]models.Download, error)
 }
 
 type downloadRepo struct{ db *gorm.DB }
@@ -61,6 +98,21 @@ func (r *downloadRepo) UpdateProgress(ctx context.Context, id string, progress i
     return r.db.WithContext(ctx).Model(&models.Download{}).Where("id = ?", id).Updates(updates).Error
 }
 
+func (r *downloadRepo) Transition(ctx context.Context, id string, from, to models.DownloadStatus, reason string) (bool, error) {
+    updates := map[string]interface{}{"status": to}
+    if to == models.StatusFailed {
+        updates["failure_reason"] = reason
+    } else if from == models.StatusFailed {
+        updates["failure_reason"] = ""
+    }
+    res := r.db.WithContext(ctx).Model(&models.Download{}).Where("id = ? AND status = ?", id, from).Updates(updates)
+    return res.RowsAffected == 1, res.Error
+}
+
+func (r *downloadRepo) UpdatePriority(ctx context.Context, id string, priority int) error {
+    return r.db.WithContext(ctx).Model(&models.Download{}).Where("id = ?", id).Update("priority", priority).Error
+}
+
 func (r *downloadRepo) ListByUser(ctx context.Context, userID string, limit, offset int) ([]models.Download, error) {
     var list []models.Download
     q := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at DESC")
@@ -103,3 +155,159 @@ func (r *downloadRepo) CountByUser(ctx context.Context, userID string) (int64, e
     return count, nil
 }
 
+// ListByStatus returns downloads of every user in the given status, oldest first.
+func (r *downloadRepo) ListByStatus(ctx context.Context, status models.DownloadStatus, limit, offset int) ([]models.Download, error) {
+    var list []models.Download
+    q := r.db.WithContext(ctx).Where("status = ?", status).Order("created_at ASC")
+    if limit > 0 {
+        q = q.Limit(limit)
+    }
+    if offset > 0 {
+        q = q.Offset(offset)
+    }
+    if err := q.Find(&list).Error; err != nil {
+        return nil, err
+    }
+    return list, nil
+}
+
+func (r *downloadRepo) CountByUserAndStatus(ctx context.Context, userID string, status models.DownloadStatus) (int64, error) {
+    var count int64
+    if err := r.db.WithContext(ctx).Model(&models.Download{}).Where("user_id = ? AND status = ?", userID, status).Count(&count).Error; err != nil {
+        return 0, err
+    }
+    return count, nil
+}
+
+// ListQueue orders by priority, then queue position, then age.
+func (r *downloadRepo) ListQueue(ctx context.Context, userID string, limit int) ([]models.Download, error) {
+    var list []models.Download
+    q := r.db.WithContext(ctx).Where("user_id = ? AND status = ?", userID, models.StatusPending).
+        Order("priority DESC").Order("queue_position ASC").Order("created_at ASC")
+    if limit > 0 {
+        q = q.Limit(limit)
+    }
+    if err := q.Find(&list).Error; err != nil {
+        return nil, err
+    }
+    return list, nil
+}
+
+// SetQueueOrder assigns negative positions so the listed downloads sort ahead of
+// those never reordered, which keep position 0 and their creation order.
+func (r *downloadRepo) SetQueueOrder(ctx context.Context, userID string, ids []string) error {
+    return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+        for i, id := range ids {
+            err := tx.Model(&models.Download{}).
+                Where("id = ? AND user_id = ? AND status = ?", id, userID, models.StatusPending).
+                Update("queue_position", i-len(ids)).Error
+            if err != nil {
+                return err
+            }
+        }
+        return nil
+    })
+}
+
+// UpdateSchedule stores the schedule of a download; nil clears it.
+func (r *downloadRepo) UpdateSchedule(ctx context.Context, id string, schedule *models.DownloadSchedule) error {
+    return r.db.WithContext(ctx).Model(&models.Download{ID: id}).Select("schedule").Updates(&models.Download{Schedule: schedule}).Error
+}
+
+func (r *downloadRepo) ListScheduled(ctx context.Context, limit, offset int) ([]models.Download, error) {
+    var list []models.Download
+    q := r.db.WithContext(ctx).
+        Where("schedule IS NOT NULL AND status IN ?", []models.DownloadStatus{models.StatusPending, models.StatusDownloading}).
+        Order("created_at ASC")
+    if limit > 0 {
+        q = q.Limit(limit)
+    }
+    if offset > 0 {
+        q = q.Offset(offset)
+    }
+    if err := q.Find(&list).Error; err != nil {
+        return nil, err
+    }
+    return list, nil
+}
+
+func (r *downloadRepo) List(ctx context.Context, f DownloadFilter) ([]models.Download, error) {
+    var list []models.Download
+    q := r.db.WithContext(ctx).Order("created_at DESC")
+    if f.UserID != "" {
+        q = q.Where("user_id = ?", f.UserID)
+    }
+    if f.GameID != "" {
+        q = q.Where("game_id = ?", f.GameID)
+    }
+    if f.Status != "" {
+        q = q.Where("status = ?", f.Status)
+    }
+    if f.Limit > 0 {
+        q = q.Limit(f.Limit)
+    }
+    if f.Offset > 0 {
+        q = q.Offset(f.Offset)
+    }
+    if err := q.Find(&list).Error; err != nil {
+        return nil, err
+    }
+    return list, nil
+}
+
+func (r *downloadRepo) ListUnfinished(ctx context.Context, userID string, gameIDs []string) ([]models.Download, error) {
+    var list []models.Download
+    if len(gameIDs) == 0 {
+        return list, nil
+    }
+    err := r.db.WithContext(ctx).
+        Where("user_id = ? AND game_id IN ? AND status IN ?", userID, gameIDs, models.UnfinishedStatuses).
+        Find(&list).Error
+    if err != nil {
+        return nil, err
+    }
+    return list, nil
+}
+
+// AcquireLease takes the lease if it is free, expired or already held by owner.
+func (r *downloadRepo) AcquireLease(ctx context.Context, id, owner string, ttl time.Duration) (bool, error) {
+    now := time.Now()
+    res := r.db.WithContext(ctx).Model(&models.Download{}).
+        Where("id = ? AND (lease_owner IS NULL OR lease_owner = '' OR lease_owner = ? OR lease_expires_at IS NULL OR lease_expires_at < ?)", id, owner, now).
+        Updates(map[string]interface{}{"lease_owner": owner, "lease_expires_at": now.Add(ttl)})
+    return res.RowsAffected == 1, res.Error
+}
+
+// RenewLease extends a lease still held by owner; false means it was lost.
+func (r *downloadRepo) RenewLease(ctx context.Context, id, owner string, ttl time.Duration) (bool, error) {
+    res := r.db.WithContext(ctx).Model(&models.Download{}).
+        Where("id = ? AND lease_owner = ?", id, owner).
+        Update("lease_expires_at", time.Now().Add(ttl))
+    return res.RowsAffected == 1, res.Error
+}
+
+func (r *downloadRepo) ReleaseLease(ctx context.Context, id, owner string) error {
+    return r.db.WithContext(ctx).Model(&models.Download{}).
+        Where("id = ? AND lease_owner = ?", id, owner).
+        Updates(map[string]interface{}{"lease_owner": "", "lease_expires_at": nil}).Error
+}
+
+// ListOrphaned returns active downloads nobody holds a live lease on: downloading
+// rows without a lease, and downloading or paused rows whose owner stopped heartbeating.
+func (r *downloadRepo) ListOrphaned(ctx context.Context, now time.Time, afterID string, limit int) ([]models.Download, error) {
+    var list []models.Download
+    q := r.db.WithContext(ctx).
+        Where("((status = ? AND (lease_owner IS NULL OR lease_owner = '')) OR (status IN ? AND lease_owner <> '' AND lease_expires_at < ?))",
+            models.StatusDownloading, []models.DownloadStatus{models.StatusDownloading, models.StatusPaused}, now).
+        Order("id ASC")
+    if afterID != "" {
+        q = q.Where("id > ?", afterID)
+    }
+    if limit > 0 {
+        q = q.Limit(limit)
+    }
+    if err := q.Find(&list).Error; err != nil {
+        return nil, err
+    }
+    return list, nil
+}
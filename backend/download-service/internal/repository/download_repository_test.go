@@ -352,4 +352,110 @@ func TestDownloadRepository_CountByUser(t *testing.T) {
     count, err = repo.CountByUser(ctx, userID)
     assert.NoError(t, err)
     assert.Equal(t, int64(5), count)
-}
\ No newline at end of file
+}
+
+func TestDownloadRepository_ListQueue(t *testing.T) {
+    db := setupTestDB(t)
+    if db == nil {
+        return // Test was skipped
+    }
+    repo := NewDownloadRepository(db)
+    ctx := context.Background()
+
+    userID := "550e8400-e29b-41d4-a716-446655440001"
+    var ids []string
+    for i, priority := range []int{0, 10, 0} {
+        download := &models.Download{
+            UserID:   userID,
+            GameID:   "550e8400-e29b-41d4-a716-44665544000" + string(rune('2'+i)),
+            Status:   models.StatusPending,
+            Priority: priority,
+        }
+        require.NoError(t, repo.Create(ctx, download))
+        ids = append(ids, download.ID)
+    }
+    running := &models.Download{UserID: userID, GameID: "550e8400-e29b-41d4-a716-446655440009", Status: models.StatusDownloading}
+    require.NoError(t, repo.Create(ctx, running))
+
+    // Higher priority first, then oldest
+    queue, err := repo.ListQueue(ctx, userID, 0)
+    require.NoError(t, err)
+    require.Len(t, queue, 3)
+    assert.Equal(t, []string{ids[1], ids[0], ids[2]}, []string{queue[0].ID, queue[1].ID, queue[2].ID})
+
+    // An explicit order applies within a priority
+    require.NoError(t, repo.SetQueueOrder(ctx, userID, []string{ids[2], ids[0]}))
+    queue, err = repo.ListQueue(ctx, userID, 0)
+    require.NoError(t, err)
+    assert.Equal(t, []string{ids[1], ids[2], ids[0]}, []string{queue[0].ID, queue[1].ID, queue[2].ID})
+
+    count, err := repo.CountByUserAndStatus(ctx, userID, models.StatusDownloading)
+    assert.NoError(t, err)
+    assert.Equal(t, int64(1), count)
+}
+
+func TestDownloadRepository_ListScheduled(t *testing.T) {
+    db := setupTestDB(t)
+    if db == nil {
+        return // Test was skipped
+    }
+    repo := NewDownloadRepository(db)
+    ctx := context.Background()
+
+    userID := "550e8400-e29b-41d4-a716-446655440001"
+    plain := &models.Download{UserID: userID, GameID: "550e8400-e29b-41d4-a716-446655440002", Status: models.StatusPending}
+    require.NoError(t, repo.Create(ctx, plain))
+    night := &models.DownloadSchedule{Windows: []models.HourWindow{{From: 22, To: 6}}, Timezone: "Europe/Moscow"}
+    scheduled := &models.Download{UserID: userID, GameID: "550e8400-e29b-41d4-a716-446655440003", Status: models.StatusPending, Schedule: night}
+    require.NoError(t, repo.Create(ctx, scheduled))
+    done := &models.Download{UserID: userID, GameID: "550e8400-e29b-41d4-a716-446655440004", Status: models.StatusCompleted, Schedule: night}
+    require.NoError(t, repo.Create(ctx, done))
+
+    list, err := repo.ListScheduled(ctx, 0, 0)
+    require.NoError(t, err)
+    require.Len(t, list, 1)
+    assert.Equal(t, scheduled.ID, list[0].ID)
+    assert.Equal(t, night, list[0].Schedule)
+
+    // Scheduling an existing download, then clearing it
+    require.NoError(t, repo.UpdateSchedule(ctx, plain.ID, &models.DownloadSchedule{OffPeak: true}))
+    list, err = repo.ListScheduled(ctx, 0, 0)
+    require.NoError(t, err)
+    assert.Len(t, list, 2)
+    require.NoError(t, repo.UpdateSchedule(ctx, plain.ID, nil))
+    got, err := repo.GetByID(ctx, plain.ID)
+    require.NoError(t, err)
+    assert.Nil(t, got.Schedule)
+}
+
+func TestDownloadRepository_List(t *testing.T) {
+    db := setupTestDB(t)
+    if db == nil {
+        return // Test was skipped
+    }
+    repo := NewDownloadRepository(db)
+    ctx := context.Background()
+
+    alice := "550e8400-e29b-41d4-a716-446655440001"
+    bob := "550e8400-e29b-41d4-a716-446655440005"
+    game := "550e8400-e29b-41d4-a716-446655440002"
+    require.NoError(t, repo.Create(ctx, &models.Download{UserID: alice, GameID: game, Status: models.StatusFailed}))
+    time.Sleep(time.Millisecond)
+    require.NoError(t, repo.Create(ctx, &models.Download{UserID: bob, GameID: game, Status: models.StatusFailed}))
+    time.Sleep(time.Millisecond)
+    require.NoError(t, repo.Create(ctx, &models.Download{UserID: bob, GameID: "550e8400-e29b-41d4-a716-446655440003", Status: models.StatusCompleted}))
+
+    all, err := repo.List(ctx, DownloadFilter{})
+    require.NoError(t, err)
+    assert.Len(t, all, 3)
+
+    failed, err := repo.List(ctx, DownloadFilter{Status: models.StatusFailed, GameID: game})
+    require.NoError(t, err)
+    require.Len(t, failed, 2)
+    assert.Equal(t, bob, failed[0].UserID, "newest first")
+
+    list, err := repo.List(ctx, DownloadFilter{UserID: bob, Limit: 1, Offset: 1})
+    require.NoError(t, err)
+    require.Len(t, list, 1)
+    assert.Equal(t, models.StatusFailed, list[0].Status)
+}
@@ -6,7 +6,6 @@ import (
 	"testing"
 
 	"download-service/internal/database"
-	"download-service/internal/models"
 	"github.com/stretchr/testify/require"
 	"gorm.io/gorm"
 )
@@ -42,7 +41,13 @@ func cleanupTables(t *testing.T, db *gorm.DB) {
 	t.Helper()
 
 	// Delete in correct order due to foreign key constraints
-	err := db.Exec("DELETE FROM download_files").Error
+	err := db.Exec("DELETE FROM audit_entries").Error
+	require.NoError(t, err)
+
+	err = db.Exec("DELETE FROM download_events").Error
+	require.NoError(t, err)
+
+	err = db.Exec("DELETE FROM download_files").Error
 	require.NoError(t, err)
 
 	err = db.Exec("DELETE FROM downloads").Error
@@ -9,6 +9,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
+	"download-service/internal/cache"
 	"download-service/internal/handlers"
 	intramw "download-service/internal/middleware"
 	"download-service/internal/observability"
@@ -23,6 +24,11 @@ type RouterOptions struct {
 	DownloadHandler     *handlers.DownloadHandler
 	FileHandler         *handlers.FileHandler
 	HealthHandler       *handlers.HealthHandler
+	AdminHandler        *handlers.AdminHandler
+	EdgeHandler         *handlers.EdgeHandler
+	EntitlementHandler  *handlers.EntitlementHandler
+	StorageHandler      *handlers.StorageHandler
+	PublishHandler      *handlers.PublishHandler
 	EnableProfiling     bool
 	EnableMetrics       bool
 	CORSAllowedOrigins  []string
@@ -31,6 +37,10 @@ type RouterOptions struct {
 	CORSExposeHeaders   []string
 	CORSAllowCredentials bool
 	CORSMaxAge          time.Duration
+	// AuthKeys verifies asymmetrically signed tokens, e.g. a *middleware.JWKS.
+	AuthKeys            intramw.KeySource
+	// RateLimiter shares rate limit counters between replicas; nil keeps them per process.
+	RateLimiter         intramw.Limiter
 }
 
 // SetupRouter creates and configures the Gin router with all middleware and routes
@@ -48,7 +58,14 @@ func SetupRouter(opts RouterOptions) *gin.Engine {
 	setupCORSMiddleware(r, opts)
 	
 	// Compression middleware
-	r.Use(gzip.Gzip(gzip.DefaultCompression))
+	// Ranged file content must be served byte-exact; compressing it would break Content-Range offsets.
+	// Event streams are flushed per event, which the gzip writer would buffer.
+	r.Use(gzip.Gzip(gzip.DefaultCompression, gzip.WithExcludedPathsRegexs([]string{
+		`^/api/downloads/[^/]+/files/[^/]+/content$`,
+		`^/api/(downloads/[^/]+|users/[^/]+/downloads)/events$`,
+		`^/edge/downloads/[^/]+/files/[^/]+/content$`,
+		`^/storage/objects/`,
+	})))
 	
 	// Observability middleware
 	r.Use(observability.GinMetrics())
@@ -69,6 +86,22 @@ func SetupRouter(opts RouterOptions) *gin.Engine {
 	// API routes with authentication and rate limiting
 	setupAPIRoutes(r, opts)
 
+	// File content for download token holders (the token is the authentication)
+	if opts.EdgeHandler != nil {
+		opts.EdgeHandler.RegisterRoutes(r.Group("/edge", rateLimit(opts)))
+	}
+
+	// Objects of the filesystem storage driver (the URL signature is the authentication)
+	if opts.StorageHandler != nil {
+		opts.StorageHandler.RegisterRoutes(r.Group("/storage", rateLimit(opts)))
+	}
+
+	// Service-to-service events (shared internal token)
+	if opts.EntitlementHandler != nil {
+		internal := r.Group("/internal", intramw.InternalToken(opts.Config.LibraryInternalHeader, opts.Config.InternalWebhookToken))
+		opts.EntitlementHandler.RegisterRoutes(internal)
+	}
+
 	return r
 }
 
@@ -90,7 +123,7 @@ func setupCORSMiddleware(r *gin.Engine, opts RouterOptions) {
 		AllowOrigins:     getStringSliceOrDefault(opts.CORSAllowedOrigins, []string{"*"}),
 		AllowMethods:     getStringSliceOrDefault(opts.CORSAllowedMethods, []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}),
 		AllowHeaders:     getStringSliceOrDefault(opts.CORSAllowedHeaders, []string{"Origin", "Content-Type", "Authorization", "X-Request-ID"}),
-		ExposeHeaders:    getStringSliceOrDefault(opts.CORSExposeHeaders, []string{"X-Request-ID"}),
+		ExposeHeaders:    getStringSliceOrDefault(opts.CORSExposeHeaders, []string{"X-Request-ID", "Retry-After", "X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset"}),
 		AllowCredentials: opts.CORSAllowCredentials,
 		MaxAge:           getDurationOrDefault(opts.CORSMaxAge, 12*time.Hour),
 		AllowWildcard:    true, // Allow wildcard subdomains
@@ -132,14 +165,47 @@ func setupAPIRoutes(r *gin.Engine, opts RouterOptions) {
 	
 	// Authentication middleware
 	api.Use(intramw.Auth(intramw.AuthOptions{
-		Enabled:  opts.Config.AuthJwtEnabled,
-		Secret:   opts.Config.AuthJwtSecret,
-		Issuer:   opts.Config.AuthJwtIssuer,
-		Audience: opts.Config.AuthJwtAudience,
+		Enabled:         opts.Config.AuthJwtEnabled,
+		Secret:          opts.Config.AuthJwtSecret,
+		Keys:            opts.AuthKeys,
+		Issuer:          opts.Config.AuthJwtIssuer,
+		Audience:        opts.Config.AuthJwtAudience,
+		Algorithms:      opts.Config.JwtAlgorithms(),
+		TrustUserHeader: opts.Config.AuthDevTrustUserHeader,
+		TierClaim:       opts.Config.AuthJwtTierClaim,
+		RolesClaim:      opts.Config.AuthJwtRolesClaim,
+		GamesClaim:      opts.Config.AuthJwtGamesClaim,
 	}))
 	
 	// Rate limiting middleware (keyed by user when available, else IP)
-	api.Use(intramw.RateLimit(intramw.RateLimitOptions{
+	api.Use(rateLimit(opts))
+
+	// Register handler routes
+	if opts.DownloadHandler != nil {
+		opts.DownloadHandler.RegisterRoutes(api)
+	}
+	if opts.FileHandler != nil {
+		opts.FileHandler.RegisterRoutes(api)
+	}
+	if opts.AdminHandler != nil {
+		admin := api.Group("/admin", intramw.Admin(intramw.AdminOptions{Roles: opts.Config.AdminRoles()}))
+		opts.AdminHandler.RegisterRoutes(admin)
+	}
+	if opts.PublishHandler != nil {
+		publish := api.Group("/publish", intramw.Publisher(intramw.PublisherOptions{Roles: opts.Config.PublisherRoles()}))
+		opts.PublishHandler.RegisterRoutes(publish)
+	}
+}
+
+// rateLimit builds the rate limiting middleware of the API and edge routes.
+func rateLimit(opts RouterOptions) gin.HandlerFunc {
+	// Validate has already checked the class spec.
+	classes, _ := config.ParseRateClasses(opts.Config.RateLimitClasses)
+	quotas := make(map[string]cache.RateQuota, len(classes))
+	for _, rc := range classes {
+		quotas[rc.Name] = cache.RateQuota{Rate: rc.RPS, Burst: rc.Burst}
+	}
+	return intramw.RateLimit(intramw.RateLimitOptions{
 		RPS:   float64(opts.Config.RateLimitRPS),
 		Burst: opts.Config.RateLimitBurst,
 		KeyFunc: func(c *gin.Context) string {
@@ -148,15 +214,31 @@ func setupAPIRoutes(r *gin.Engine, opts RouterOptions) {
 			}
 			return ""
 		},
-	}))
+		Limiter: opts.RateLimiter,
+		Classes: quotas,
+		Routes:  rateLimitRoutes,
+	})
+}
 
-	// Register handler routes
-	if opts.DownloadHandler != nil {
-		opts.DownloadHandler.RegisterRoutes(api)
-	}
-	if opts.FileHandler != nil {
-		opts.FileHandler.RegisterRoutes(api)
-	}
+// rateLimitRoutes gives routes that are expensive or called in bulk quotas of their
+// own, so they neither starve nor crowd out the control API.
+var rateLimitRoutes = map[string]intramw.RouteLimit{
+	// Plans the build and creates a record per file.
+	"POST /api/downloads": {Class: "start"},
+	// Plans a build per game.
+	"POST /api/downloads/batch": {Class: "start", Cost: 5},
+	// Clients fetch content in many ranged requests.
+	"GET /api/downloads/:id/files/:fileId/content":  {Class: "content"},
+	"GET /edge/downloads/:id/files/:fileId/content": {Class: "content"},
+	"GET /storage/objects/*key":                     {Class: "content"},
+	// Publishers send builds in many large parts.
+	"PUT /api/publish/uploads/:id/files/:index/parts/:part": {Class: "content"},
+	// Long-lived connections.
+	"GET /api/downloads/ws":                   {Class: "stream"},
+	"GET /api/downloads/:id/events":           {Class: "stream"},
+	"GET /api/users/:userId/downloads/events": {Class: "stream"},
+	// Hashes every file of the download.
+	"POST /api/downloads/:id/verify": {Cost: 5},
 }
 
 // Helper functions for default values
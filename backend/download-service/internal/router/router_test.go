@@ -1,8 +1,15 @@
 package router
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -10,6 +17,9 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"download-service/internal/clients/s3"
+	"download-service/internal/handlers"
+	"download-service/internal/services"
 	"download-service/pkg/config"
 	"download-service/pkg/logger"
 )
@@ -321,4 +331,181 @@ func TestSetupRouter_ProductionCORSDefaults(t *testing.T) {
 
 	assert.Equal(t, http.StatusOK, resp.Code)
 	assert.Contains(t, resp.Body.String(), "ok")
-}
\ No newline at end of file
+}
+func TestSetupRouter_AdminRoutesNeedAdminAccess(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.Config{
+		Env:                    "test",
+		AuthJwtEnabled:         true,
+		AuthDevTrustUserHeader: true,
+		AuthAdminRoles:         "support",
+		RateLimitRPS:           10,
+		RateLimitBurst:         20,
+	}
+	r := SetupRouter(RouterOptions{Config: cfg, Logger: logger.New(), AdminHandler: handlers.NewAdminHandler(nil)})
+
+	req := httptest.NewRequest("GET", "/api/admin/downloads", nil)
+	req.Header.Set("X-User-Id", "user-1")
+	req.Header.Set("X-User-Roles", "admin")
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusForbidden, resp.Code, "only the configured roles are admins")
+
+	req = httptest.NewRequest("POST", "/api/admin/downloads/1/retry", nil)
+	req.Header.Set("X-User-Id", "user-1")
+	req.Header.Set("X-User-Scopes", "downloads:admin:read")
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+}
+
+func TestSetupRouter_EdgeRoutesSkipAPIAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.Config{
+		Env:            "test",
+		AuthJwtEnabled: true,
+		AuthJwtSecret:  "0123456789abcdef0123456789abcdef",
+		RateLimitRPS:   10,
+		RateLimitBurst: 20,
+	}
+	r := SetupRouter(RouterOptions{Config: cfg, Logger: logger.New(), EdgeHandler: handlers.NewEdgeHandler(nil, nil)})
+
+	// The edge handler, not the API auth, turns away a request without a download token.
+	req := httptest.NewRequest("GET", "/edge/downloads/1/files/2/content", nil)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	assert.Contains(t, resp.Body.String(), "invalid download token")
+}
+
+func TestSetupRouter_InternalRoutesNeedServiceToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.Config{
+		Env:                   "test",
+		AuthJwtEnabled:        true,
+		AuthJwtSecret:         "0123456789abcdef0123456789abcdef",
+		LibraryInternalHeader: "X-Internal-Token",
+		InternalWebhookToken:  "s3cret",
+		RateLimitRPS:          10,
+		RateLimitBurst:        20,
+	}
+	r := SetupRouter(RouterOptions{Config: cfg, Logger: logger.New(), EntitlementHandler: handlers.NewEntitlementHandler(nil)})
+
+	req := httptest.NewRequest("POST", "/internal/entitlements/revoked", strings.NewReader(`{}`))
+	req.Header.Set("Authorization", "Bearer user-token")
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code, "user tokens are not service tokens")
+
+	// With the service token the request reaches the handler, which validates the body.
+	req = httptest.NewRequest("POST", "/internal/entitlements/revoked", strings.NewReader(`{}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Internal-Token", "s3cret")
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+}
+
+func TestSetupRouter_StorageObjectsNeedSignature(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.Config{
+		Env:            "test",
+		AuthJwtEnabled: true,
+		AuthJwtSecret:  "0123456789abcdef0123456789abcdef",
+		RateLimitRPS:   10,
+		RateLimitBurst: 20,
+	}
+	storage, err := s3.NewFSClient(s3.FSOptions{Root: t.TempDir(), SigningKey: []byte("0123456789abcdef0123456789abcdef")})
+	require.NoError(t, err)
+	_, err = storage.PutObject(context.Background(), "games/g1/game.zip", strings.NewReader("0123456789"))
+	require.NoError(t, err)
+	r := SetupRouter(RouterOptions{Config: cfg, Logger: logger.New(), StorageHandler: handlers.NewStorageHandler(storage)})
+
+	signed, err := storage.GetPresignedURL(context.Background(), "games/g1/game.zip", time.Minute)
+	require.NoError(t, err)
+	req := httptest.NewRequest("GET", signed, nil)
+	req.Header.Set("Range", "bytes=2-5")
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusPartialContent, resp.Code)
+	assert.Equal(t, "2345", resp.Body.String())
+	assert.Equal(t, "bytes 2-5/10", resp.Header().Get("Content-Range"))
+
+	req = httptest.NewRequest("GET", strings.Replace(signed, "g1", "g2", 1), nil)
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+}
+
+func TestSetupRouter_PublishBuild(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.Config{
+		Env:                    "test",
+		AuthJwtEnabled:         true,
+		AuthDevTrustUserHeader: true,
+		AuthPublisherRoles:     "publisher",
+		RateLimitRPS:           10,
+		RateLimitBurst:         20,
+	}
+	storage := s3.NewMockClient()
+	fileSvc := services.NewFileService(storage)
+	publishSvc := services.NewPublishService(storage, fileSvc, logger.New())
+	r := SetupRouter(RouterOptions{Config: cfg, Logger: logger.New(), PublishHandler: handlers.NewPublishHandler(publishSvc)})
+
+	content := "#!/bin/sh\necho hello\n"
+	sum := sha256.Sum256([]byte(content))
+	send := func(method, path, roles, body string, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("X-User-Id", "pub-1")
+		req.Header.Set("X-User-Roles", roles)
+		req.Header.Set("X-User-Games", "g1")
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		return resp
+	}
+	create := `{"version":"1.0","files":[{"path":"bin/start.sh","size":` + strconv.Itoa(len(content)) + `,"sha256":"` + hex.EncodeToString(sum[:]) + `"}]}`
+
+	resp := send("POST", "/api/publish/games/g1/builds", "player", create, nil)
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+
+	resp = send("POST", "/api/publish/games/g2/builds", "publisher", create, nil)
+	assert.Equal(t, http.StatusForbidden, resp.Code, "not a publisher of g2")
+
+	resp = send("POST", "/api/publish/games/g1/builds", "publisher", create, nil)
+	require.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+	var up struct {
+		ID    string `json:"id"`
+		Files []struct {
+			Parts int `json:"parts"`
+		} `json:"files"`
+	}
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &up))
+	require.Equal(t, 1, up.Files[0].Parts)
+
+	partPath := "/api/publish/uploads/" + up.ID + "/files/0/parts/1"
+	resp = send("PUT", partPath, "publisher", content, map[string]string{"X-Checksum-SHA256": base64.StdEncoding.EncodeToString(make([]byte, 32))})
+	assert.Equal(t, http.StatusBadRequest, resp.Code, "checksum mismatch")
+	resp = send("PUT", partPath, "publisher", content, map[string]string{"X-Checksum-SHA256": base64.StdEncoding.EncodeToString(sum[:])})
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+
+	resp = send("POST", "/api/publish/uploads/"+up.ID+"/complete", "publisher", "", nil)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	assert.Contains(t, resp.Body.String(), `"version":"1.0"`)
+
+	m, err := fileSvc.LoadManifest(context.Background(), "g1")
+	require.NoError(t, err)
+	assert.Equal(t, "1.0", m.Version)
+
+	resp = send("POST", "/api/publish/games/g1/builds", "publisher", create, nil)
+	assert.Equal(t, http.StatusConflict, resp.Code, "the version is taken")
+	resp = send("DELETE", "/api/publish/uploads/"+up.ID, "publisher", "", nil)
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+}
@@ -0,0 +1,196 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	derr "download-service/internal/errors"
+	"download-service/internal/models"
+	"download-service/internal/repository"
+	"download-service/pkg/logger"
+
+	"gorm.io/gorm"
+)
+
+// Actions recorded in the audit log.
+const (
+	AuditListDownloads = "downloads.list"
+	AuditViewDownload  = "download.view"
+	AuditViewHistory   = "download.history"
+	AuditCancel        = "download.cancel"
+	AuditFail          = "download.fail"
+	AuditRetry         = "download.retry"
+)
+
+// auditOK is the outcome of an action that succeeded.
+const auditOK = "ok"
+
+// Operator identifies who performs an admin action.
+type Operator struct {
+	UserID    string
+	RequestID string
+}
+
+// AdminService lets operators inspect and repair the downloads of any user. Every
+// call is written to the audit log, including those that fail.
+type AdminService struct {
+	downloads *DownloadService
+	audit     repository.AuditRepository
+	logger    logger.Logger
+}
+
+func NewAdminService(downloads *DownloadService, audit repository.AuditRepository, logger logger.Logger) *AdminService {
+	return &AdminService{downloads: downloads, audit: audit, logger: logger}
+}
+
+// ListDownloads returns the downloads of every user matching the filter, newest first.
+func (a *AdminService) ListDownloads(ctx context.Context, op Operator, f repository.DownloadFilter) ([]models.Download, error) {
+	list, err := a.downloads.repo.List(ctx, f)
+	details := map[string]string{"limit": strconv.Itoa(f.Limit), "offset": strconv.Itoa(f.Offset)}
+	if f.UserID != "" {
+		details["userId"] = f.UserID
+	}
+	if f.GameID != "" {
+		details["gameId"] = f.GameID
+	}
+	if f.Status != "" {
+		details["status"] = string(f.Status)
+	}
+	a.record(ctx, op, models.AuditEntry{Action: AuditListDownloads, TargetUserID: f.UserID, Details: details}, err)
+	return list, err
+}
+
+// GetDownload returns any user's download.
+func (a *AdminService) GetDownload(ctx context.Context, op Operator, downloadID string) (*models.Download, error) {
+	d, err := a.load(ctx, downloadID)
+	a.record(ctx, op, entryFor(AuditViewDownload, downloadID, d, ""), err)
+	return d, err
+}
+
+// DownloadHistory returns the status transitions of any user's download, oldest first.
+func (a *AdminService) DownloadHistory(ctx context.Context, op Operator, downloadID string) ([]models.DownloadEvent, error) {
+	d, err := a.load(ctx, downloadID)
+	var events []models.DownloadEvent
+	if err == nil {
+		events, err = a.downloads.history.ListByDownload(ctx, downloadID)
+	}
+	a.record(ctx, op, entryFor(AuditViewHistory, downloadID, d, ""), err)
+	return events, err
+}
+
+// ForceCancel cancels a download on behalf of its owner.
+func (a *AdminService) ForceCancel(ctx context.Context, op Operator, downloadID, reason string) (*models.Download, error) {
+	d, err := a.load(ctx, downloadID)
+	if err == nil {
+		err = a.downloads.stop(ctx, d, models.StatusCancelled, models.AdminActor(op.UserID), reasonOr(reason, "cancelled by operator"))
+	}
+	a.record(ctx, op, entryFor(AuditCancel, downloadID, d, reason), err)
+	return d, err
+}
+
+// ForceFail fails a download that is stuck or known to be broken. The reason
+// becomes its failure reason.
+func (a *AdminService) ForceFail(ctx context.Context, op Operator, downloadID, reason string) (*models.Download, error) {
+	d, err := a.load(ctx, downloadID)
+	if err == nil {
+		err = a.downloads.stop(ctx, d, models.StatusFailed, models.AdminActor(op.UserID), reasonOr(reason, "failed by operator"))
+	}
+	a.record(ctx, op, entryFor(AuditFail, downloadID, d, reason), err)
+	return d, err
+}
+
+// Retry sends a failed download back to its owner's queue. It continues from the
+// progress already made and starts right away if the owner has a free slot and
+// its schedule allows.
+func (a *AdminService) Retry(ctx context.Context, op Operator, downloadID, reason string) (*models.Download, error) {
+	d, err := a.load(ctx, downloadID)
+	if err == nil {
+		err = a.retry(ctx, op, d, reason)
+	}
+	a.record(ctx, op, entryFor(AuditRetry, downloadID, d, reason), err)
+	if err != nil {
+		return d, err
+	}
+	// Promotion may have started it.
+	return a.load(ctx, downloadID)
+}
+
+// AuditLog returns the recorded admin actions matching the filter, newest first.
+func (a *AdminService) AuditLog(ctx context.Context, f repository.AuditFilter) ([]models.AuditEntry, error) {
+	return a.audit.List(ctx, f)
+}
+
+func (a *AdminService) retry(ctx context.Context, op Operator, d *models.Download, reason string) error {
+	s := a.downloads
+	if !models.CanRetry(d.Status) {
+		return derr.InvalidTransitionError{ID: d.ID, From: string(d.Status), To: string(models.StatusPending)}
+	}
+	// A session stopped by ForceFail may still be shutting down; resuming it would
+	// leave the download without a transfer.
+	owners, err := s.leases.Owners(ctx, []string{d.ID})
+	if err != nil {
+		return err
+	}
+	if _, held := owners[d.ID]; held || s.stream.Active(d.ID) {
+		return derr.LeaseConflictError{ID: d.ID}
+	}
+	files, err := s.fileRepo.ListByDownload(ctx, d.ID)
+	if err != nil {
+		return err
+	}
+	if err := s.applyTransition(ctx, d, models.StatusPending, models.AdminActor(op.UserID), reasonOr(reason, "retried by operator")); err != nil {
+		return err
+	}
+	// Files the transfer gave up on are fetched again from their persisted progress.
+	for _, f := range files {
+		if f.Status == models.StatusFailed || f.Status == models.StatusCorrupted {
+			if err := s.fileRepo.UpdateStatus(ctx, f.ID, models.StatusPending); err != nil {
+				logger.Error(a.logger, "reset file status failed", "error", err, "downloadID", d.ID, "fileID", f.ID)
+			}
+		}
+	}
+	s.promote(ctx, d.UserID)
+	return nil
+}
+
+func (a *AdminService) load(ctx context.Context, downloadID string) (*models.Download, error) {
+	d, err := a.downloads.repo.GetByID(ctx, downloadID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, derr.DownloadNotFoundError{ID: downloadID}
+		}
+		return nil, err
+	}
+	return d, nil
+}
+
+// record writes an audit entry, even if the request was cancelled meanwhile. The
+// action has already happened, so a failed write is logged rather than reported.
+func (a *AdminService) record(ctx context.Context, op Operator, e models.AuditEntry, err error) {
+	e.Actor = op.UserID
+	e.RequestID = op.RequestID
+	e.Outcome = auditOK
+	if err != nil {
+		e.Outcome = err.Error()
+	}
+	logger.Info(a.logger, "admin action", "actor", e.Actor, "action", e.Action, "downloadID", e.DownloadID, "outcome", e.Outcome)
+	if err := a.audit.Create(context.WithoutCancel(ctx), &e); err != nil {
+		logger.Error(a.logger, "write audit entry failed", "error", err, "actor", e.Actor, "action", e.Action, "downloadID", e.DownloadID)
+	}
+}
+
+func entryFor(action, downloadID string, d *models.Download, reason string) models.AuditEntry {
+	e := models.AuditEntry{Action: action, DownloadID: downloadID, Reason: reason}
+	if d != nil {
+		e.TargetUserID = d.UserID
+	}
+	return e
+}
+
+func reasonOr(reason, fallback string) string {
+	if reason == "" {
+		return fallback
+	}
+	return reason
+}
@@ -0,0 +1,143 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	derr "download-service/internal/errors"
+	"download-service/internal/models"
+	"download-service/internal/repository"
+	"download-service/pkg/logger"
+	"github.com/stretchr/testify/require"
+)
+
+type memAuditRepo struct {
+	mu      sync.Mutex
+	entries []models.AuditEntry
+}
+
+func (r *memAuditRepo) Create(ctx context.Context, e *models.AuditEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e.CreatedAt = time.Now()
+	r.entries = append(r.entries, *e)
+	return nil
+}
+
+func (r *memAuditRepo) List(ctx context.Context, f repository.AuditFilter) ([]models.AuditEntry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []models.AuditEntry
+	for i := len(r.entries) - 1; i >= 0; i-- {
+		e := r.entries[i]
+		if (f.Actor == "" || e.Actor == f.Actor) && (f.DownloadID == "" || e.DownloadID == f.DownloadID) && (f.Action == "" || e.Action == f.Action) {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+func newAdminTestService(t *testing.T) (*AdminService, *DownloadService, *memDownloadRepo, *memAuditRepo, string) {
+	t.Helper()
+	svc, repo, gameID := newScheduleTestService(t)
+	audit := &memAuditRepo{}
+	return NewAdminService(svc, audit, logger.New()), svc, repo, audit, gameID
+}
+
+// waitStopped waits until the session of a stopped download is gone and its lease released.
+func waitStopped(t *testing.T, svc *DownloadService, downloadID string) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		owners, err := svc.leases.Owners(context.Background(), []string{downloadID})
+		_, held := owners[downloadID]
+		return err == nil && !held && !svc.stream.Active(downloadID)
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestAdmin_FailAndRetry(t *testing.T) {
+	admin, svc, repo, audit, gameID := newAdminTestService(t)
+	userID := "e7000000-0000-0000-0000-000000000001"
+	op := Operator{UserID: "e7000000-0000-0000-0000-0000000000ff", RequestID: "req-1"}
+	ctx := context.Background()
+
+	d, err := svc.StartDownload(ctx, userID, gameID)
+	require.NoError(t, err)
+	require.Equal(t, models.StatusDownloading, d.Status)
+
+	d, err = admin.ForceFail(ctx, op, d.ID, "stuck at 99%")
+	require.NoError(t, err)
+	require.Equal(t, models.StatusFailed, d.Status)
+	require.Equal(t, "stuck at 99%", d.FailureReason)
+	waitStopped(t, svc, d.ID)
+
+	d, err = admin.Retry(ctx, op, d.ID, "")
+	require.NoError(t, err)
+	require.Equal(t, models.StatusDownloading, d.Status, "the user has a free slot")
+	require.Empty(t, d.FailureReason)
+	require.True(t, svc.stream.Active(d.ID))
+
+	history, err := admin.DownloadHistory(ctx, op, d.ID)
+	require.NoError(t, err)
+	last := history[len(history)-3:]
+	require.Equal(t, models.StatusFailed, last[0].ToStatus)
+	require.Equal(t, models.AdminActor(op.UserID), last[0].Actor)
+	require.Equal(t, models.StatusPending, last[1].ToStatus)
+	require.Equal(t, "retried by operator", last[1].Reason)
+	require.Equal(t, models.StatusDownloading, last[2].ToStatus)
+
+	entries, err := admin.AuditLog(ctx, repository.AuditFilter{DownloadID: d.ID})
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	require.Equal(t, AuditViewHistory, entries[0].Action)
+	require.Equal(t, AuditRetry, entries[1].Action)
+	require.Equal(t, AuditFail, entries[2].Action)
+	require.Equal(t, "stuck at 99%", entries[2].Reason)
+	require.Equal(t, userID, entries[2].TargetUserID)
+	require.Equal(t, "req-1", entries[2].RequestID)
+	require.Equal(t, "ok", entries[2].Outcome)
+	require.Len(t, audit.entries, 3)
+
+	requireStatus(t, repo, d.ID, models.StatusDownloading)
+}
+
+func TestAdmin_CancelAndRefusals(t *testing.T) {
+	admin, svc, _, audit, gameID := newAdminTestService(t)
+	userID := "e7000000-0000-0000-0000-000000000002"
+	op := Operator{UserID: "e7000000-0000-0000-0000-0000000000ff"}
+	ctx := context.Background()
+
+	d, err := svc.StartDownload(ctx, userID, gameID)
+	require.NoError(t, err)
+
+	list, err := admin.ListDownloads(ctx, op, repository.DownloadFilter{UserID: userID, Status: models.StatusDownloading})
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+
+	d, err = admin.ForceCancel(ctx, op, d.ID, "")
+	require.NoError(t, err)
+	require.Equal(t, models.StatusCancelled, d.Status)
+	waitStopped(t, svc, d.ID)
+
+	// Cancelled downloads are final, even for operators.
+	_, err = admin.Retry(ctx, op, d.ID, "user asked")
+	require.True(t, errors.As(err, &derr.InvalidTransitionError{}))
+	_, err = admin.ForceFail(ctx, op, d.ID, "")
+	require.True(t, errors.As(err, &derr.InvalidTransitionError{}))
+	_, err = admin.GetDownload(ctx, op, "e7000000-0000-0000-0000-000000000404")
+	require.True(t, errors.As(err, &derr.DownloadNotFoundError{}))
+
+	// Refused actions are audited with their outcome.
+	entries, err := admin.AuditLog(ctx, repository.AuditFilter{Actor: op.UserID})
+	require.NoError(t, err)
+	require.Len(t, entries, 5)
+	require.Equal(t, AuditViewDownload, entries[0].Action)
+	require.Contains(t, entries[0].Outcome, "not found")
+	require.Contains(t, entries[2].Outcome, "cannot move from cancelled")
+	require.Equal(t, AuditListDownloads, entries[4].Action)
+	require.Equal(t, userID, entries[4].Details["userId"])
+	require.Equal(t, "downloading", entries[4].Details["status"])
+	require.Len(t, audit.entries, 5)
+}
@@ -0,0 +1,210 @@
+package services
+
+import (
+	"math"
+	"sort"
+
+	"download-service/internal/observability"
+
+	"golang.org/x/time/rate"
+)
+
+// BandwidthOptions bound the egress of a replica. Zero values mean no limit.
+type BandwidthOptions struct {
+	NodeBytesPerSecond int64 // shared by every session of this replica
+	UserBytesPerSecond int64 // shared by the sessions of one user
+}
+
+// SessionOptions describe how a session shares bandwidth with the others.
+type SessionOptions struct {
+	UserID         string // sessions of one user share the per-user cap
+	Weight         int    // share of contended bandwidth relative to other sessions; < 1 counts as 1
+	BytesPerSecond int64  // the session's own limit; <= 0 means none
+	// UserBytesPerSecond replaces BandwidthOptions.UserBytesPerSecond for the
+	// session's user, e.g. from their subscription tier; <= 0 keeps the default.
+	UserBytesPerSecond int64
+}
+
+// ConfigureBandwidth sets the node and per-user budgets and rebalances running sessions.
+func (ss *StreamService) ConfigureBandwidth(opts BandwidthOptions) {
+	ss.mu.Lock()
+	ss.bandwidth = opts
+	ss.mu.Unlock()
+	ss.rebalance()
+}
+
+// SetWeight changes a session's share of contended bandwidth.
+func (ss *StreamService) SetWeight(downloadID string, weight int) {
+	ss.mu.Lock()
+	s, ok := ss.sessions[downloadID]
+	if ok {
+		s.weight = normalWeight(weight)
+	}
+	ss.mu.Unlock()
+	if ok {
+		ss.rebalance()
+	}
+}
+
+// AllocatedSpeed returns the bytes per second a session may currently use, 0 if
+// it is unlimited and -1 if there is no such session.
+func (ss *StreamService) AllocatedSpeed(downloadID string) int64 {
+	s := ss.get(downloadID)
+	if s == nil {
+		return -1
+	}
+	limit := s.limiter.Limit()
+	if limit == rate.Inf {
+		return 0
+	}
+	return int64(limit)
+}
+
+func normalWeight(w int) int {
+	if w < 1 {
+		return 1
+	}
+	return w
+}
+
+// rebalance splits the node budget among users and each user's share among
+// their sessions by weighted max-min fairness: no session gets more than its own
+// limit, and what a capped session leaves unused goes to the others. Paused
+// sessions take no share. Rebalancing is serialised so limits are applied in the
+// order they were computed.
+func (ss *StreamService) rebalance() {
+	ss.rebalanceMu.Lock()
+	defer ss.rebalanceMu.Unlock()
+
+	ss.mu.Lock()
+	opts := ss.bandwidth
+	byUser := make(map[string]*userShare)
+	var users []*userShare
+	for _, s := range ss.sessions {
+		key := s.userID
+		if key == "" {
+			key = "session:" + s.id // not attributed to a user, so no user cap applies
+		}
+		u, ok := byUser[key]
+		if !ok {
+			u = &userShare{key: key, share: share{limit: math.Inf(1)}}
+			if s.userID != "" {
+				u.limit = bpsLimit(opts.UserBytesPerSecond)
+			}
+			byUser[key] = u
+			users = append(users, u)
+		}
+		if s.userRate > 0 {
+			// Sessions started before a tier change may disagree; the most generous wins.
+			if !u.ownLimit || float64(s.userRate) > u.limit {
+				u.limit = float64(s.userRate)
+			}
+			u.ownLimit = true
+		}
+		sh := &share{s: s, weight: float64(s.weight), limit: bpsLimit(s.maxRate)}
+		if s.isPaused() {
+			sh.weight = 0
+		}
+		u.sessions = append(u.sessions, sh)
+	}
+	ss.mu.Unlock()
+	sort.Slice(users, func(i, j int) bool { return users[i].key < users[j].key })
+
+	shares := make([]*share, len(users))
+	for i, u := range users {
+		demand := 0.0
+		for _, sh := range u.sessions {
+			if sh.weight > 0 {
+				u.weight += sh.weight
+				demand += sh.limit
+			}
+		}
+		u.limit = math.Min(u.limit, demand)
+		shares[i] = &u.share
+	}
+	waterFill(bpsLimit(opts.NodeBytesPerSecond), shares)
+
+	total := 0.0
+	for _, u := range users {
+		waterFill(u.alloc, u.sessions)
+		for _, sh := range u.sessions {
+			if sh.weight == 0 {
+				continue // a paused session sends nothing; its limit is reset on resume
+			}
+			total += sh.alloc
+			if math.IsInf(sh.alloc, 1) {
+				sh.s.setLimit(rate.Inf, ss.bufferSize)
+			} else {
+				sh.s.setLimit(rate.Limit(math.Max(sh.alloc, 1)), ss.bufferSize)
+			}
+		}
+	}
+	observability.SetAllocatedBandwidth(total)
+}
+
+// userShare groups the sessions that share one user's cap.
+type userShare struct {
+	share
+	key      string
+	ownLimit bool // limit comes from a session's UserBytesPerSecond
+	sessions []*share
+}
+
+// share is one claimant of bandwidth: a user or one of their sessions.
+type share struct {
+	s      *session
+	weight float64
+	limit  float64 // +Inf when unlimited
+	alloc  float64
+}
+
+func bpsLimit(bps int64) float64 {
+	if bps <= 0 {
+		return math.Inf(1)
+	}
+	return float64(bps)
+}
+
+// waterFill divides budget among shares in proportion to their weights. Shares
+// whose proportional part exceeds their limit get the limit, and the rest is
+// divided again among the others. Shares with zero weight get nothing.
+func waterFill(budget float64, shares []*share) {
+	open := make([]*share, 0, len(shares))
+	for _, sh := range shares {
+		sh.alloc = 0
+		if sh.weight > 0 {
+			open = append(open, sh)
+		}
+	}
+	for len(open) > 0 {
+		if math.IsInf(budget, 1) {
+			for _, sh := range open {
+				sh.alloc = sh.limit
+			}
+			return
+		}
+		weights := 0.0
+		for _, sh := range open {
+			weights += sh.weight
+		}
+		perWeight := budget / weights
+		next := open[:0]
+		saturated := false
+		for _, sh := range open {
+			if sh.limit <= sh.weight*perWeight {
+				sh.alloc = sh.limit
+				budget -= sh.limit
+				saturated = true
+			} else {
+				next = append(next, sh)
+			}
+		}
+		if !saturated {
+			for _, sh := range next {
+				sh.alloc = sh.weight * perWeight
+			}
+			return
+		}
+		open = next
+	}
+}
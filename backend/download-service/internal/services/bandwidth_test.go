@@ -0,0 +1,113 @@
+package services
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"download-service/internal/clients/s3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWaterFill(t *testing.T) {
+	inf := math.Inf(1)
+	tests := []struct {
+		name    string
+		budget  float64
+		weights []float64
+		limits  []float64
+		want    []float64
+	}{
+		{"weighted split", 1000, []float64{1, 1, 2}, []float64{inf, inf, inf}, []float64{250, 250, 500}},
+		{"capped share is redistributed", 1000, []float64{1, 1, 2}, []float64{100, inf, inf}, []float64{100, 300, 600}},
+		{"budget above demand", 1000, []float64{1, 1}, []float64{100, 200}, []float64{100, 200}},
+		{"zero weight gets nothing", 1000, []float64{0, 1}, []float64{inf, inf}, []float64{0, 1000}},
+		{"unlimited budget", inf, []float64{1, 3}, []float64{100, inf}, []float64{100, inf}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shares := make([]*share, len(tt.weights))
+			for i := range shares {
+				shares[i] = &share{weight: tt.weights[i], limit: tt.limits[i]}
+			}
+			waterFill(tt.budget, shares)
+			for i, sh := range shares {
+				require.InDelta(t, tt.want[i], sh.alloc, 0.001, "share %d", i)
+			}
+		})
+	}
+}
+
+// startIdle starts a session that transfers slowly enough to stay active for a test.
+func startIdle(t *testing.T, ss *StreamService, storage *s3.MockClient, id string, opts SessionOptions) {
+	t.Helper()
+	file := putFile(storage, "games/"+id+"/game.zip", patterned(4*1024*1024, 1))
+	ss.StartWith(context.Background(), id, []TransferFile{file}, opts, nil, nil)
+	t.Cleanup(func() { ss.Stop(id) })
+}
+
+func requireAllocated(t *testing.T, ss *StreamService, want map[string]int64) {
+	t.Helper()
+	for id, bps := range want {
+		require.Equal(t, bps, ss.AllocatedSpeed(id), "session %s", id)
+	}
+}
+
+func TestStreamService_FairShare(t *testing.T) {
+	storage := s3.NewMockClient()
+	ss := newTestStream(storage, nil)
+	ss.ConfigureBandwidth(BandwidthOptions{NodeBytesPerSecond: 12000, UserBytesPerSecond: 8000})
+
+	startIdle(t, ss, storage, "a1", SessionOptions{UserID: "alice", Weight: 1})
+	startIdle(t, ss, storage, "a2", SessionOptions{UserID: "alice", Weight: 3})
+	requireAllocated(t, ss, map[string]int64{"a1": 2000, "a2": 6000})
+
+	// Users split the node budget by weight; alice's share stays under her cap.
+	startIdle(t, ss, storage, "b1", SessionOptions{UserID: "bob", Weight: 2})
+	requireAllocated(t, ss, map[string]int64{"a1": 2000, "a2": 6000, "b1": 4000})
+
+	// A session's own limit leaves the rest of the user's share to its siblings.
+	ss.SetSpeed("a2", 1000)
+	requireAllocated(t, ss, map[string]int64{"a1": 7000, "a2": 1000, "b1": 4000})
+
+	ss.Pause("a1")
+	requireAllocated(t, ss, map[string]int64{"a2": 1000, "b1": 8000})
+	ss.Resume("a1")
+	requireAllocated(t, ss, map[string]int64{"a1": 7000, "a2": 1000, "b1": 4000})
+
+	ss.Stop("b1")
+	require.Eventually(t, func() bool { return !ss.Active("b1") }, 2*time.Second, 10*time.Millisecond)
+	requireAllocated(t, ss, map[string]int64{"a1": 7000, "a2": 1000})
+}
+
+func TestStreamService_UnlimitedWithoutBudget(t *testing.T) {
+	storage := s3.NewMockClient()
+	ss := newTestStream(storage, nil)
+	ss.ConfigureBandwidth(BandwidthOptions{NodeBytesPerSecond: 1000})
+	startIdle(t, ss, storage, "s1", SessionOptions{UserID: "alice"})
+	startIdle(t, ss, storage, "s2", SessionOptions{UserID: "bob", BytesPerSecond: 300})
+	requireAllocated(t, ss, map[string]int64{"s1": 700, "s2": 300})
+
+	ss.ConfigureBandwidth(BandwidthOptions{})
+	requireAllocated(t, ss, map[string]int64{"s1": 0, "s2": 300})
+}
+
+func TestStreamService_SpeedChangeCutsWaitShort(t *testing.T) {
+	storage := s3.NewMockClient()
+	ss := NewStreamService(storage, nil)
+	file := putFile(storage, "games/slow/game.zip", patterned(256*1024, 2))
+
+	done := make(chan error, 1)
+	ss.Start(context.Background(), "slow", []TransferFile{file}, 1024, nil, func(err error) { done <- err })
+	time.Sleep(100 * time.Millisecond)
+
+	// At 1 KB/s the transfer would take minutes; waits reserved at that rate must not delay the new one.
+	ss.SetSpeed("slow", 64*1024*1024)
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(3 * time.Second):
+		t.Fatal("speed change did not apply to the running transfer")
+	}
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	derr "download-service/internal/errors"
+	"download-service/internal/models"
+	"download-service/pkg/logger"
+)
+
+// MaxBatchSize bounds how many games one batch may start.
+const MaxBatchSize = 200
+
+// BatchRequest asks for full downloads of several games at once, e.g. to restore
+// a library on a new PC.
+type BatchRequest struct {
+	GameIDs  []string
+	AllOwned bool                     // every game in the user's library; GameIDs must be empty
+	Schedule *models.DownloadSchedule // applied to every download
+}
+
+// BatchItem is the outcome for one game of a batch: its download or why there is none.
+type BatchItem struct {
+	GameID   string
+	Download *models.Download
+	Err      error
+}
+
+// StartBatch creates a download per game with one ownership request to the
+// library. Downloads beyond the user's free slots wait in the queue. Games that
+// are not owned, already have an unfinished download or fail to start are
+// reported per item; the error return is for failures of the whole batch.
+func (s *DownloadService) StartBatch(ctx context.Context, userID string, req BatchRequest) ([]BatchItem, error) {
+	dreq, err := DownloadRequest{Type: models.DownloadTypeFull, Schedule: req.Schedule}.normalize()
+	if err != nil {
+		return nil, err
+	}
+	if req.AllOwned == (len(req.GameIDs) > 0) {
+		return nil, derr.ValidationError{Msg: "give either game ids or all owned, not both"}
+	}
+
+	var gameIDs []string
+	var owned map[string]bool
+	if req.AllOwned {
+		if gameIDs, err = s.library.ListUserGames(ctx, userID); err != nil {
+			logger.Error(s.logger, "library list games failed", "error", err, "userID", userID)
+			return nil, err
+		}
+		owned = make(map[string]bool, len(gameIDs))
+		for _, id := range gameIDs {
+			owned[id] = true
+		}
+	} else {
+		seen := make(map[string]bool, len(req.GameIDs))
+		for _, id := range req.GameIDs {
+			if !seen[id] {
+				seen[id] = true
+				gameIDs = append(gameIDs, id)
+			}
+		}
+	}
+	if len(gameIDs) > MaxBatchSize {
+		return nil, derr.ValidationError{Msg: fmt.Sprintf("a batch may start at most %d games, got %d", MaxBatchSize, len(gameIDs))}
+	}
+	if owned == nil && len(gameIDs) > 0 {
+		if owned, err = s.library.CheckOwnershipBatch(ctx, userID, gameIDs); err != nil {
+			logger.Error(s.logger, "library batch ownership check failed", "error", err, "userID", userID, "games", len(gameIDs))
+			return nil, err
+		}
+	}
+
+	unfinished, err := s.unfinishedDownloads(ctx, userID, gameIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]BatchItem, 0, len(gameIDs))
+	started := 0
+	for _, gameID := range gameIDs {
+		item := BatchItem{GameID: gameID}
+		switch {
+		case !owned[gameID]:
+			item.Err = derr.AccessDeniedError{Reason: "game not owned"}
+		case unfinished[gameID] != "":
+			item.Err = derr.DuplicateDownloadError{GameID: gameID, DownloadID: unfinished[gameID]}
+		default:
+			r := dreq
+			r.GameID = gameID
+			item.Download, item.Err = s.create(ctx, userID, r)
+		}
+		if item.Err == nil {
+			started++
+		}
+		items = append(items, item)
+	}
+	logger.Info(s.logger, "batch download requested", "userID", userID, "games", len(gameIDs), "created", started)
+	return items, nil
+}
+
+// unfinishedDownloads maps each of the games the user already has an unfinished
+// download of to that download's id.
+func (s *DownloadService) unfinishedDownloads(ctx context.Context, userID string, gameIDs []string) (map[string]string, error) {
+	existing, err := s.repo.ListUnfinished(ctx, userID, gameIDs)
+	if err != nil {
+		return nil, err
+	}
+	unfinished := make(map[string]string, len(existing))
+	for _, d := range existing {
+		unfinished[d.GameID] = d.ID
+	}
+	return unfinished, nil
+}
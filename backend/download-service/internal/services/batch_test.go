@@ -0,0 +1,118 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	lib "download-service/internal/clients/library"
+	derr "download-service/internal/errors"
+	"download-service/internal/models"
+	"github.com/stretchr/testify/require"
+)
+
+// batchLibrary counts single and batch ownership checks.
+type batchLibrary struct {
+	*lib.MockClient
+	single, batch int
+}
+
+func (l *batchLibrary) CheckOwnership(ctx context.Context, userID, gameID string) (bool, error) {
+	l.single++
+	return l.MockClient.CheckOwnership(ctx, userID, gameID)
+}
+
+func (l *batchLibrary) CheckOwnershipBatch(ctx context.Context, userID string, gameIDs []string) (map[string]bool, error) {
+	l.batch++
+	return l.MockClient.CheckOwnershipBatch(ctx, userID, gameIDs)
+}
+
+func newBatchTestService(t *testing.T) (*DownloadService, *memDownloadRepo, *batchLibrary, []string) {
+	t.Helper()
+	svc, repo, games := newQueueTestService(t, 4)
+	library := &batchLibrary{MockClient: lib.NewMockClient()}
+	svc.library = library
+	t.Cleanup(func() {
+		for _, id := range svc.stream.ActiveIDs() {
+			svc.stream.Stop(id)
+		}
+	})
+	return svc, repo, library, games
+}
+
+func TestStartBatch_ListedGames(t *testing.T) {
+	svc, repo, library, games := newBatchTestService(t)
+	userID := "e3000000-0000-0000-0000-000000000001"
+	library.SetUserGames(userID, games[:3])
+	ctx := context.Background()
+
+	// games[2] already has an unfinished download.
+	existing, err := svc.StartDownload(ctx, userID, games[2])
+	require.NoError(t, err)
+	library.single = 0
+
+	items, err := svc.StartBatch(ctx, userID, BatchRequest{GameIDs: []string{games[0], games[1], games[0], games[2], games[3]}})
+	require.NoError(t, err)
+	require.Equal(t, 1, library.batch)
+	require.Zero(t, library.single, "no per-game ownership requests")
+	require.Len(t, items, 4, "duplicates are dropped")
+
+	require.Equal(t, games[0], items[0].GameID)
+	require.NoError(t, items[0].Err)
+	require.NoError(t, items[1].Err)
+	// The user's one slot is taken, so the new downloads queue.
+	requireStatus(t, repo, items[0].Download.ID, models.StatusPending)
+	requireStatus(t, repo, items[1].Download.ID, models.StatusPending)
+
+	var dup derr.DuplicateDownloadError
+	require.True(t, errors.As(items[2].Err, &dup))
+	require.Equal(t, existing.ID, dup.DownloadID)
+	require.True(t, errors.As(items[3].Err, &derr.AccessDeniedError{}))
+}
+
+func TestStartDownload_RefusesUnfinishedDuplicate(t *testing.T) {
+	svc, _, library, games := newBatchTestService(t)
+	userID := "e3000000-0000-0000-0000-000000000003"
+	library.SetUserGames(userID, games[:1])
+	ctx := context.Background()
+
+	first, err := svc.StartDownload(ctx, userID, games[0])
+	require.NoError(t, err)
+	require.NoError(t, svc.PauseDownload(ctx, userID, first.ID))
+
+	// A paused download is still unfinished.
+	var dup derr.DuplicateDownloadError
+	_, err = svc.StartDownload(ctx, userID, games[0])
+	require.True(t, errors.As(err, &dup))
+	require.Equal(t, first.ID, dup.DownloadID)
+
+	require.NoError(t, svc.CancelDownload(ctx, userID, first.ID))
+	again, err := svc.StartDownload(ctx, userID, games[0])
+	require.NoError(t, err)
+	require.NotEqual(t, first.ID, again.ID)
+}
+
+func TestStartBatch_AllOwned(t *testing.T) {
+	svc, repo, library, games := newBatchTestService(t)
+	userID := "e3000000-0000-0000-0000-000000000002"
+	library.SetUserGames(userID, games[1:3])
+	ctx := context.Background()
+
+	items, err := svc.StartBatch(ctx, userID, BatchRequest{AllOwned: true})
+	require.NoError(t, err)
+	require.Zero(t, library.batch+library.single, "the library listing is proof of ownership")
+	require.Len(t, items, 2)
+	require.Equal(t, games[1], items[0].GameID)
+	requireStatus(t, repo, items[0].Download.ID, models.StatusDownloading)
+	requireStatus(t, repo, items[1].Download.ID, models.StatusPending)
+
+	for _, req := range []BatchRequest{{}, {AllOwned: true, GameIDs: games}} {
+		_, err := svc.StartBatch(ctx, userID, req)
+		require.True(t, errors.As(err, &derr.ValidationError{}))
+	}
+
+	// A failing library fails the whole batch.
+	library.SetError("CheckOwnershipBatch", errors.New("library client: circuit open"))
+	_, err = svc.StartBatch(ctx, userID, BatchRequest{GameIDs: games[:1]})
+	require.Error(t, err)
+}
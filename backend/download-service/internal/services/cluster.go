@@ -0,0 +1,241 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"download-service/internal/cache"
+	"download-service/internal/models"
+	"download-service/pkg/logger"
+)
+
+// LeaseStore records which replica runs each download's transfer session.
+// Leases expire unless renewed, which hands a dead replica's downloads over.
+type LeaseStore interface {
+	Acquire(ctx context.Context, downloadID, owner string, ttl time.Duration) (bool, error)
+	Renew(ctx context.Context, downloadID, owner string, ttl time.Duration) (bool, error)
+	Release(ctx context.Context, downloadID, owner string) error
+	Owners(ctx context.Context, downloadIDs []string) (map[string]string, error)
+}
+
+// CommandBus relays control commands to the replica that owns a session.
+type CommandBus interface {
+	Publish(ctx context.Context, owner string, cmd cache.Command) error
+	Subscribe(ctx context.Context, owner string) (<-chan cache.Command, error)
+}
+
+// ClusterOptions configures how the service coordinates with other replicas.
+// Zero values keep the single-process defaults.
+type ClusterOptions struct {
+	InstanceID string        // lease owner name of this replica
+	LeaseTTL   time.Duration // how long a lease lasts without a heartbeat
+	Leases     LeaseStore
+	Commands   CommandBus
+	Events     EventLog // download event history shared by every replica
+}
+
+// ConfigureCluster replaces the in-process lease store, command bus and event log.
+func (s *DownloadService) ConfigureCluster(opts ClusterOptions) {
+	s.ConfigureLeases(opts.InstanceID, opts.LeaseTTL)
+	if opts.Leases != nil {
+		s.leases = opts.Leases
+	}
+	if opts.Commands != nil {
+		s.commands = opts.Commands
+	}
+	if opts.Events != nil {
+		s.events = opts.Events
+	}
+}
+
+// control applies a command to the local session if there is one, and otherwise
+// forwards it to the replica holding the download's lease. The persisted status
+// is already updated, so a download without an owner needs nothing more.
+func (s *DownloadService) control(ctx context.Context, cmd cache.Command) error {
+	if s.stream.Active(cmd.DownloadID) {
+		s.applyCommand(cmd)
+		return nil
+	}
+	owners, err := s.leases.Owners(ctx, []string{cmd.DownloadID})
+	if err != nil {
+		return err
+	}
+	owner, ok := owners[cmd.DownloadID]
+	if !ok || owner == s.instanceID {
+		return nil
+	}
+	logger.Info(s.logger, "forwarding download command", "op", cmd.Op, "downloadID", cmd.DownloadID, "owner", owner)
+	return s.commands.Publish(ctx, owner, cmd)
+}
+
+func (s *DownloadService) applyCommand(cmd cache.Command) {
+	switch cmd.Op {
+	case cache.CommandPause:
+		s.stream.Pause(cmd.DownloadID)
+	case cache.CommandResume:
+		s.stream.Resume(cmd.DownloadID)
+	case cache.CommandCancel:
+		s.stream.Stop(cmd.DownloadID)
+	case cache.CommandSpeed:
+		s.stream.SetSpeed(cmd.DownloadID, cmd.BytesPerSecond)
+	}
+}
+
+// RunCoordinator executes commands forwarded by other replicas, runs the lease
+// keeper, applies download schedules and starts queued downloads until ctx is
+// cancelled.
+func (s *DownloadService) RunCoordinator(ctx context.Context) error {
+	cmds, err := s.commands.Subscribe(ctx, s.instanceID)
+	if err != nil {
+		return err
+	}
+	go s.RunLeaseKeeper(ctx)
+	ticker := time.NewTicker(s.leaseTTL / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case cmd, ok := <-cmds:
+			if !ok {
+				return nil
+			}
+			s.applyCommand(cmd)
+		case <-ticker.C:
+			if err := s.ApplySchedules(ctx); err != nil {
+				logger.Error(s.logger, "scheduled download scan failed", "error", err)
+			}
+			if err := s.PromoteQueued(ctx); err != nil {
+				logger.Error(s.logger, "queued download scan failed", "error", err)
+			}
+		}
+	}
+}
+
+// heartbeat renews the lease of every local session. A session whose lease was
+// taken over is stopped so a download never runs twice. Sessions other than
+// repairs are also reconciled with the persisted status and priority in case a
+// forwarded command was lost or the priority was changed on another replica.
+func (s *DownloadService) heartbeat(ctx context.Context) {
+	for _, id := range s.stream.ActiveIDs() {
+		ok, err := s.renewLease(ctx, id)
+		if err != nil {
+			logger.Error(s.logger, "renew download lease failed", "error", err, "downloadID", id)
+			continue
+		}
+		if !ok {
+			logger.Info(s.logger, "download lease lost, stopping local transfer", "downloadID", id)
+			s.stream.Stop(id)
+			continue
+		}
+		if s.repairs.has(id) {
+			continue
+		}
+		d, err := s.repo.GetByID(ctx, id)
+		if err != nil {
+			continue
+		}
+		s.stream.SetWeight(id, priorityWeight(d.Priority))
+		switch d.Status {
+		case models.StatusPaused, models.StatusPending:
+			s.stream.Pause(id)
+		case models.StatusDownloading:
+			s.stream.Resume(id)
+		case models.StatusCancelled, models.StatusFailed, models.StatusCompleted:
+			s.stream.Stop(id)
+		}
+	}
+}
+
+// localLeases is the single-process LeaseStore used when no cluster is configured.
+type localLeases struct {
+	mu     sync.Mutex
+	owners map[string]localLease
+}
+
+type localLease struct {
+	owner   string
+	expires time.Time
+}
+
+func newLocalLeases() *localLeases { return &localLeases{owners: make(map[string]localLease)} }
+
+func (l *localLeases) Acquire(ctx context.Context, downloadID, owner string, ttl time.Duration) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if cur, ok := l.owners[downloadID]; ok && cur.owner != owner && cur.expires.After(now) {
+		return false, nil
+	}
+	l.owners[downloadID] = localLease{owner: owner, expires: now.Add(ttl)}
+	return true, nil
+}
+
+func (l *localLeases) Renew(ctx context.Context, downloadID, owner string, ttl time.Duration) (bool, error) {
+	return l.Acquire(ctx, downloadID, owner, ttl)
+}
+
+func (l *localLeases) Release(ctx context.Context, downloadID, owner string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if cur, ok := l.owners[downloadID]; ok && cur.owner == owner {
+		delete(l.owners, downloadID)
+	}
+	return nil
+}
+
+func (l *localLeases) Owners(ctx context.Context, downloadIDs []string) (map[string]string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	out := make(map[string]string, len(downloadIDs))
+	for _, id := range downloadIDs {
+		if cur, ok := l.owners[id]; ok && cur.expires.After(now) {
+			out[id] = cur.owner
+		}
+	}
+	return out, nil
+}
+
+// localBus is the in-process CommandBus used when no cluster is configured.
+type localBus struct {
+	mu   sync.Mutex
+	subs map[string][]chan cache.Command
+}
+
+func newLocalBus() *localBus { return &localBus{subs: make(map[string][]chan cache.Command)} }
+
+func (b *localBus) Publish(ctx context.Context, owner string, cmd cache.Command) error {
+	b.mu.Lock()
+	subs := append([]chan cache.Command(nil), b.subs[owner]...)
+	b.mu.Unlock()
+	for _, ch := range subs {
+		select {
+		case ch <- cmd:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (b *localBus) Subscribe(ctx context.Context, owner string) (<-chan cache.Command, error) {
+	ch := make(chan cache.Command, 16)
+	b.mu.Lock()
+	b.subs[owner] = append(b.subs[owner], ch)
+	b.mu.Unlock()
+	go func() {
+		<-ctx.Done()
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		subs := b.subs[owner]
+		for i, c := range subs {
+			if c == ch {
+				b.subs[owner] = append(subs[:i], subs[i+1:]...)
+				break
+			}
+		}
+	}()
+	return ch, nil
+}
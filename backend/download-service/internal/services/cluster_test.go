@@ -0,0 +1,141 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"download-service/internal/cache"
+	"download-service/internal/clients/s3"
+	"download-service/internal/models"
+	"download-service/pkg/logger"
+	"github.com/stretchr/testify/require"
+)
+
+// newReplicas returns two services sharing one database, bucket, lease store and
+// command bus, each running its coordinator.
+func newReplicas(t *testing.T) (a, b *DownloadService, repo *memDownloadRepo, storage *s3.MockClient) {
+	t.Helper()
+	repo = newMemDownloadRepo()
+	fileRepo := newMemDownloadFileRepo()
+	storage = s3.NewMockClient()
+	leases, bus := newLocalLeases(), newLocalBus()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	replica := func(name string) *DownloadService {
+		svc := NewDownloadService(nil, nil, repo, fileRepo, newMemDownloadEventRepo(), NewStreamService(storage, nil), NewFileService(storage), mockLibrary{owned: true}, logger.New())
+		svc.defaultSpeed = 16 * 1024
+		svc.ConfigureCluster(ClusterOptions{InstanceID: name, LeaseTTL: time.Minute, Leases: leases, Commands: bus})
+		ready := make(chan struct{})
+		go func() {
+			cmds, err := svc.commands.Subscribe(ctx, svc.instanceID)
+			require.NoError(t, err)
+			close(ready)
+			for cmd := range cmds {
+				svc.applyCommand(cmd)
+			}
+		}()
+		<-ready
+		return svc
+	}
+	return replica("replica-a"), replica("replica-b"), repo, storage
+}
+
+func sessionPaused(ss *StreamService, downloadID string) bool {
+	s := ss.get(downloadID)
+	if s == nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.paused
+}
+
+func TestCluster_CommandsReachOwningReplica(t *testing.T) {
+	a, b, repo, storage := newReplicas(t)
+	gameID := "c1000000-0000-0000-0000-000000000001"
+	userID := "c1000000-0000-0000-0000-000000000002"
+	seedGame(storage, gameID)
+
+	d, err := a.StartDownload(context.Background(), userID, gameID)
+	require.NoError(t, err)
+	require.True(t, a.stream.Active(d.ID))
+
+	// The pause request lands on replica B, which holds no session for it.
+	require.NoError(t, b.PauseDownload(context.Background(), userID, d.ID))
+	require.False(t, b.stream.Active(d.ID))
+	require.Eventually(t, func() bool {
+		return sessionPaused(a.stream, d.ID)
+	}, 2*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, b.SetDownloadSpeed(context.Background(), userID, d.ID, 1<<30))
+	require.NoError(t, b.ResumeDownload(context.Background(), userID, d.ID))
+	require.False(t, b.stream.Active(d.ID), "resume must not start a second transfer")
+	require.Eventually(t, func() bool {
+		got, _ := repo.GetByID(context.Background(), d.ID)
+		return got.Status == models.StatusCompleted
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestCluster_CancelStopsRemoteSession(t *testing.T) {
+	a, b, repo, storage := newReplicas(t)
+	gameID := "c1000000-0000-0000-0000-000000000003"
+	userID := "c1000000-0000-0000-0000-000000000002"
+	seedGame(storage, gameID)
+
+	d, err := a.StartDownload(context.Background(), userID, gameID)
+	require.NoError(t, err)
+	require.NoError(t, b.CancelDownload(context.Background(), userID, d.ID))
+	require.Eventually(t, func() bool { return !a.stream.Active(d.ID) }, 2*time.Second, 10*time.Millisecond)
+	got, _ := repo.GetByID(context.Background(), d.ID)
+	require.Equal(t, models.StatusCancelled, got.Status)
+}
+
+func TestCluster_DeadReplicaIsTakenOver(t *testing.T) {
+	a, b, repo, storage := newReplicas(t)
+	gameID := "c1000000-0000-0000-0000-000000000004"
+	userID := "c1000000-0000-0000-0000-000000000002"
+	seedGame(storage, gameID)
+
+	d, err := a.StartDownload(context.Background(), userID, gameID)
+	require.NoError(t, err)
+	res, err := b.RecoverDownloads(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, RecoveryResult{}, res)
+
+	// Replica A dies: its transfer stops and its lease runs out without release.
+	a.stream.Stop(d.ID)
+	require.Eventually(t, func() bool { return !a.stream.Active(d.ID) }, 2*time.Second, 10*time.Millisecond)
+	_, _ = repo.AcquireLease(context.Background(), d.ID, "replica-a", -time.Second)
+	_, _ = a.leases.Acquire(context.Background(), d.ID, "replica-a", -time.Second)
+
+	res, err = b.RecoverDownloads(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, res.Resumed)
+	owners, _ := b.leases.Owners(context.Background(), []string{d.ID})
+	require.Equal(t, "replica-b", owners[d.ID])
+
+	// Commands sent through the old owner now reach the adopting replica.
+	require.NoError(t, a.PauseDownload(context.Background(), userID, d.ID))
+	require.Eventually(t, func() bool {
+		return sessionPaused(b.stream, d.ID)
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestLocalBus_DeliversToSubscriber(t *testing.T) {
+	bus := newLocalBus()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch, err := bus.Subscribe(ctx, "replica-a")
+	require.NoError(t, err)
+
+	require.NoError(t, bus.Publish(ctx, "replica-b", cache.Command{Op: cache.CommandPause, DownloadID: "x"}))
+	require.NoError(t, bus.Publish(ctx, "replica-a", cache.Command{Op: cache.CommandSpeed, DownloadID: "y", BytesPerSecond: 10}))
+	select {
+	case cmd := <-ch:
+		require.Equal(t, cache.Command{Op: cache.CommandSpeed, DownloadID: "y", BytesPerSecond: 10}, cmd)
+	case <-time.After(time.Second):
+		t.Fatal("command not delivered")
+	}
+}
@@ -0,0 +1,162 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"download-service/internal/clients/s3"
+	derr "download-service/internal/errors"
+)
+
+// chunkPrefix is where chunked builds keep their content-addressed chunks. A chunk
+// is stored once under its SHA-256 digest and shared by every file, version and
+// game that contains the same bytes.
+const chunkPrefix = "chunks/"
+
+// ChunkObjectKey returns the storage key of the chunk with the given SHA-256 digest.
+func ChunkObjectKey(digest string) string {
+	return fmt.Sprintf("%s%s/%s", chunkPrefix, digest[:2], digest)
+}
+
+// FileSegment is a byte range of a stored object that is written at Offset of the
+// destination file.
+type FileSegment struct {
+	ObjectKey    string
+	SourceOffset int64 // offset within the stored object
+	Offset       int64 // offset within the destination file
+	Size         int64
+	SHA256       string // digest of the segment's bytes, if known
+}
+
+// BuildPlan lists the files, and for chunked builds the chunks, that must be
+// transferred to bring an install to Version.
+type BuildPlan struct {
+	Version string
+	Files   []GameFile
+}
+
+// TotalSize returns the number of bytes the plan transfers.
+func (p *BuildPlan) TotalSize() int64 {
+	var total int64
+	for _, f := range p.Files {
+		total += f.Size
+	}
+	return total
+}
+
+// segmentsByPath indexes the planned segments of each file by install path.
+func (p *BuildPlan) segmentsByPath() map[string][]FileSegment {
+	out := make(map[string][]FileSegment, len(p.Files))
+	for _, f := range p.Files {
+		if len(f.Segments) > 0 {
+			out[f.Path] = f.Segments
+		}
+	}
+	return out
+}
+
+// PlanFull returns everything needed for a fresh install of version ("" for the
+// current build). Games without a manifest fall back to the legacy single archive.
+func (s *FileService) PlanFull(ctx context.Context, gameID, version string) (*BuildPlan, error) {
+	m, err := s.LoadManifestVersion(ctx, gameID, version)
+	if err == nil {
+		return &BuildPlan{Version: m.Version, Files: gameFilesFromManifest(gameID, m)}, nil
+	}
+	if !errors.Is(err, s3.ErrNotFound) {
+		return nil, err
+	}
+	if version != "" {
+		return nil, derr.GameBuildNotFoundError{GameID: gameID}
+	}
+
+	key := objectKeyForGame(gameID)
+	info, err := s.storage.StatObject(ctx, key)
+	if err != nil {
+		if errors.Is(err, s3.ErrNotFound) {
+			return nil, derr.GameBuildNotFoundError{GameID: gameID}
+		}
+		return nil, fmt.Errorf("stat object: %w", err)
+	}
+	return &BuildPlan{Files: []GameFile{{Path: gameArchiveName, ObjectKey: key, Size: info.Size}}}, nil
+}
+
+// PlanUpdate diffs the manifest of the installed version against the target version
+// ("" for the current build). Unchanged files are skipped. For chunked builds only
+// chunks the install does not already hold are scheduled; the client assembles the
+// remaining ranges from its local copies. A new chunk is scheduled at every range
+// it fills, since each range is written on its own and nothing copies between
+// staged ranges. Non-chunked builds are patched file by file.
+func (s *FileService) PlanUpdate(ctx context.Context, gameID, fromVersion, toVersion string) (*BuildPlan, error) {
+	if fromVersion == "" {
+		return nil, derr.ValidationError{Msg: "installed version is required for an update"}
+	}
+	installed, err := s.LoadManifestVersion(ctx, gameID, fromVersion)
+	if err != nil {
+		if errors.Is(err, s3.ErrNotFound) {
+			return nil, derr.ValidationError{Msg: fmt.Sprintf("installed version %s is unknown", fromVersion)}
+		}
+		return nil, err
+	}
+	target, err := s.LoadManifestVersion(ctx, gameID, toVersion)
+	if err != nil {
+		if errors.Is(err, s3.ErrNotFound) {
+			return nil, derr.GameBuildNotFoundError{GameID: gameID}
+		}
+		return nil, err
+	}
+	if target.Version == "" {
+		return nil, derr.ManifestInvalidError{GameID: gameID, Reason: "target build has no version"}
+	}
+	if target.Version == installed.Version {
+		return nil, derr.ValidationError{Msg: fmt.Sprintf("version %s is already installed", target.Version)}
+	}
+
+	installedFiles := make(map[string]string, len(installed.Files))
+	have := make(map[string]struct{})
+	for _, f := range installed.Files {
+		installedFiles[f.Path] = f.SHA256
+		if installed.Chunked {
+			for _, c := range f.Chunks {
+				have[c.SHA256] = struct{}{}
+			}
+		}
+	}
+
+	plan := &BuildPlan{Version: target.Version}
+	for _, f := range target.Files {
+		if sum, ok := installedFiles[f.Path]; ok && sum == f.SHA256 {
+			continue
+		}
+		if !target.Chunked {
+			plan.Files = append(plan.Files, wholeGameFile(gameID, f))
+			continue
+		}
+		var missing []ManifestChunk
+		for _, c := range f.Chunks {
+			if _, ok := have[c.SHA256]; !ok {
+				missing = append(missing, c)
+			}
+		}
+		if len(missing) == 0 {
+			continue
+		}
+		plan.Files = append(plan.Files, chunkedGameFile(f, missing))
+	}
+	return plan, nil
+}
+
+// chunkedGameFile builds a transfer entry that fetches the given chunks of f from the chunk store.
+func chunkedGameFile(f ManifestFile, chunks []ManifestChunk) GameFile {
+	gf := GameFile{Path: f.Path, SHA256: f.SHA256}
+	for _, c := range chunks {
+		gf.Segments = append(gf.Segments, FileSegment{
+			ObjectKey: ChunkObjectKey(c.SHA256),
+			Offset:    c.Offset,
+			Size:      c.Size,
+			SHA256:    c.SHA256,
+		})
+		gf.Size += c.Size
+	}
+	return gf
+}
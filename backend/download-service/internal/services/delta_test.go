@@ -0,0 +1,223 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"download-service/internal/clients/s3"
+	derr "download-service/internal/errors"
+	"download-service/internal/models"
+	"download-service/pkg/logger"
+	"github.com/stretchr/testify/require"
+)
+
+// chunkedFile is a test file given as its list of chunk contents.
+type chunkedFile struct {
+	path   string
+	chunks [][]byte
+}
+
+// putChunkedVersion stores the chunks in the chunk store and publishes the version's
+// manifest; current also makes it the game's current build.
+func putChunkedVersion(t testing.TB, storage *s3.MockClient, gameID, version string, current bool, files ...chunkedFile) *Manifest {
+	m := &Manifest{GameID: gameID, Version: version, Chunked: true}
+	for _, cf := range files {
+		f := ManifestFile{Path: cf.path}
+		var whole []byte
+		for _, c := range cf.chunks {
+			digest := sha256Hex(c)
+			storage.PutObject(ChunkObjectKey(digest), int64(len(c)), c)
+			f.Chunks = append(f.Chunks, ManifestChunk{Offset: f.Size, Size: int64(len(c)), SHA256: digest})
+			f.Size += int64(len(c))
+			whole = append(whole, c...)
+		}
+		f.SHA256 = sha256Hex(whole)
+		m.Files = append(m.Files, f)
+	}
+	data, err := json.Marshal(m)
+	require.NoError(t, err)
+	storage.PutObject(manifestKeyForVersion(gameID, version), int64(len(data)), data)
+	if current {
+		storage.PutObject(manifestKeyForGame(gameID), int64(len(data)), data)
+	}
+	return m
+}
+
+func TestFileService_PlanUpdateChunked(t *testing.T) {
+	storage := s3.NewMockClient()
+	svc := NewFileService(storage)
+	gameID := "f0000000-0000-0000-0000-000000000001"
+	a, b, c, d := patterned(100, 1), patterned(200, 2), patterned(300, 3), patterned(400, 4)
+
+	putChunkedVersion(t, storage, gameID, "1.0", false,
+		chunkedFile{"bin/game.exe", [][]byte{a, b}},
+		chunkedFile{"data/assets.pak", [][]byte{c}},
+	)
+	putChunkedVersion(t, storage, gameID, "1.1", true,
+		chunkedFile{"bin/game.exe", [][]byte{a, d}},   // second chunk changed
+		chunkedFile{"data/assets.pak", [][]byte{c}},   // unchanged
+		chunkedFile{"data/extra.pak", [][]byte{d, b}}, // new; shares the new chunk d, and b is installed
+		chunkedFile{"data/moved.pak", [][]byte{c, a}}, // new, built entirely from installed chunks
+	)
+
+	plan, err := svc.PlanUpdate(context.Background(), gameID, "1.0", "")
+	require.NoError(t, err)
+	require.Equal(t, "1.1", plan.Version)
+	require.Len(t, plan.Files, 2)
+	f := plan.Files[0]
+	require.Equal(t, "bin/game.exe", f.Path)
+	require.Empty(t, f.ObjectKey)
+	require.Equal(t, int64(len(d)), f.Size)
+	require.Equal(t, []FileSegment{{ObjectKey: ChunkObjectKey(sha256Hex(d)), Offset: int64(len(a)), Size: int64(len(d)), SHA256: sha256Hex(d)}}, f.Segments)
+	// Every file needing the new chunk gets its own segment for it.
+	extra := plan.Files[1]
+	require.Equal(t, "data/extra.pak", extra.Path)
+	require.Equal(t, []FileSegment{{ObjectKey: ChunkObjectKey(sha256Hex(d)), Offset: 0, Size: int64(len(d)), SHA256: sha256Hex(d)}}, extra.Segments)
+	require.Equal(t, int64(2*len(d)), plan.TotalSize())
+
+	full, err := svc.PlanFull(context.Background(), gameID, "1.0")
+	require.NoError(t, err)
+	require.Equal(t, "1.0", full.Version)
+	require.Equal(t, int64(len(a)+len(b)+len(c)), full.TotalSize())
+}
+
+func TestFileService_PlanUpdateWholeFiles(t *testing.T) {
+	storage := s3.NewMockClient()
+	svc := NewFileService(storage)
+	gameID := "f0000000-0000-0000-0000-000000000002"
+
+	old := &Manifest{GameID: gameID, Version: "1", Files: []ManifestFile{
+		{Path: "a.bin", Size: 1, SHA256: sha256Hex([]byte("a"))},
+		{Path: "b.bin", Size: 1, SHA256: sha256Hex([]byte("b"))},
+	}}
+	data, _ := json.Marshal(old)
+	storage.PutObject(manifestKeyForVersion(gameID, "1"), int64(len(data)), data)
+	putManifest(t, storage, gameID, map[string][]byte{"a.bin": []byte("a"), "b.bin": []byte("B")})
+	current, err := svc.LoadManifest(context.Background(), gameID)
+	require.NoError(t, err)
+	current.Version = "2"
+	data, _ = json.Marshal(current)
+	storage.PutObject(manifestKeyForGame(gameID), int64(len(data)), data)
+
+	plan, err := svc.PlanUpdate(context.Background(), gameID, "1", "2")
+	require.NoError(t, err)
+	require.Len(t, plan.Files, 1)
+	require.Equal(t, "b.bin", plan.Files[0].Path)
+	require.Equal(t, "games/"+gameID+"/files/b.bin", plan.Files[0].ObjectKey)
+}
+
+func TestFileService_PlanUpdateErrors(t *testing.T) {
+	storage := s3.NewMockClient()
+	svc := NewFileService(storage)
+	gameID := "f0000000-0000-0000-0000-000000000003"
+	putChunkedVersion(t, storage, gameID, "1.0", true, chunkedFile{"a", [][]byte{patterned(10, 1)}})
+
+	_, err := svc.PlanUpdate(context.Background(), gameID, "", "")
+	require.True(t, errors.As(err, &derr.ValidationError{}))
+	_, err = svc.PlanUpdate(context.Background(), gameID, "0.9", "")
+	require.True(t, errors.As(err, &derr.ValidationError{}))
+	_, err = svc.PlanUpdate(context.Background(), gameID, "1.0", "")
+	require.True(t, errors.As(err, &derr.ValidationError{}))
+	_, err = svc.PlanUpdate(context.Background(), gameID, "1.0", "2.0")
+	require.True(t, errors.As(err, &derr.GameBuildNotFoundError{}))
+	_, err = svc.PlanUpdate(context.Background(), gameID, "../1.0", "")
+	require.True(t, errors.As(err, &derr.ValidationError{}))
+}
+
+func TestDownloadService_StartUpdateTransfersMissingChunks(t *testing.T) {
+	repo := newMemDownloadRepo()
+	fileRepo := newMemDownloadFileRepo()
+	storage := s3.NewMockClient()
+	root := t.TempDir()
+	stream := NewStreamService(storage, DirSink{Root: root})
+	stream.chunkSize = 64
+	svc := NewDownloadService(nil, nil, repo, fileRepo, newMemDownloadEventRepo(), stream, NewFileService(storage), mockLibrary{owned: true}, logger.New())
+	svc.defaultSpeed = 0
+
+	gameID := "f0000000-0000-0000-0000-000000000004"
+	a, b, c := patterned(150, 1), patterned(250, 2), patterned(90, 3)
+	putChunkedVersion(t, storage, gameID, "1.0", false, chunkedFile{"game.bin", [][]byte{a, b}})
+	putChunkedVersion(t, storage, gameID, "2.0", true, chunkedFile{"game.bin", [][]byte{a, c, b}})
+
+	d, err := svc.StartUpdate(context.Background(), "f0000000-0000-0000-0000-000000000005", gameID, "1.0", "")
+	require.NoError(t, err)
+	require.Equal(t, models.DownloadTypeUpdate, d.Type)
+	require.Equal(t, "2.0", d.Version)
+	require.Equal(t, "1.0", d.FromVersion)
+	require.Equal(t, int64(len(c)), d.TotalSize)
+
+	require.Eventually(t, func() bool {
+		got, _ := repo.GetByID(context.Background(), d.ID)
+		return got != nil && got.Status == models.StatusCompleted
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Only the new chunk is written, at its offset within the patched file.
+	written, err := os.ReadFile(filepath.Join(root, d.ID, "game.bin"))
+	require.NoError(t, err)
+	require.Len(t, written, len(a)+len(c))
+	require.Equal(t, c, written[len(a):])
+}
+
+func TestDownloadService_StartUpdateWritesSharedNewChunkEverywhere(t *testing.T) {
+	repo := newMemDownloadRepo()
+	storage := s3.NewMockClient()
+	root := t.TempDir()
+	stream := NewStreamService(storage, DirSink{Root: root})
+	stream.chunkSize = 64
+	svc := NewDownloadService(nil, nil, repo, newMemDownloadFileRepo(), newMemDownloadEventRepo(), stream, NewFileService(storage), mockLibrary{owned: true}, logger.New())
+	svc.defaultSpeed = 0
+
+	gameID := "f0000000-0000-0000-0000-000000000008"
+	a, b, shared := patterned(150, 1), patterned(250, 2), patterned(90, 3)
+	putChunkedVersion(t, storage, gameID, "1.0", false, chunkedFile{"one.bin", [][]byte{a}}, chunkedFile{"two.bin", [][]byte{b}})
+	putChunkedVersion(t, storage, gameID, "2.0", true,
+		chunkedFile{"one.bin", [][]byte{a, shared}},
+		chunkedFile{"two.bin", [][]byte{shared, b}},
+	)
+
+	d, err := svc.StartUpdate(context.Background(), "f0000000-0000-0000-0000-000000000009", gameID, "1.0", "")
+	require.NoError(t, err)
+	require.Equal(t, int64(2*len(shared)), d.TotalSize)
+	require.Eventually(t, func() bool {
+		got, _ := repo.GetByID(context.Background(), d.ID)
+		return got != nil && got.Status == models.StatusCompleted
+	}, 5*time.Second, 10*time.Millisecond)
+
+	one, err := os.ReadFile(filepath.Join(root, d.ID, "one.bin"))
+	require.NoError(t, err)
+	require.Equal(t, shared, one[len(a):])
+	two, err := os.ReadFile(filepath.Join(root, d.ID, "two.bin"))
+	require.NoError(t, err)
+	require.Equal(t, shared, two[:len(shared)])
+}
+
+func TestDownloadService_ResumeRebuildsChunkPlan(t *testing.T) {
+	repo := newMemDownloadRepo()
+	fileRepo := newMemDownloadFileRepo()
+	storage := s3.NewMockClient()
+	svc := NewDownloadService(nil, nil, repo, fileRepo, newMemDownloadEventRepo(), NewStreamService(storage, nil), NewFileService(storage), mockLibrary{owned: true}, logger.New())
+	svc.defaultSpeed = 0
+
+	userID := "f0000000-0000-0000-0000-000000000006"
+	gameID := "f0000000-0000-0000-0000-000000000007"
+	m := putChunkedVersion(t, storage, gameID, "3.0", true, chunkedFile{"game.bin", [][]byte{patterned(120, 1), patterned(80, 2)}})
+
+	// A paused download left behind by another process: no session exists here.
+	d := &models.Download{UserID: userID, GameID: gameID, Status: models.StatusPaused, Type: models.DownloadTypeFull, Version: "3.0", TotalSize: m.TotalSize()}
+	require.NoError(t, repo.Create(context.Background(), d))
+	require.NoError(t, fileRepo.Create(context.Background(), &models.DownloadFile{DownloadID: d.ID, FileName: "game.bin", FilePath: "game.bin", FileSize: m.TotalSize(), DownloadedSize: 120, Status: models.StatusDownloading}))
+
+	require.NoError(t, svc.ResumeDownload(context.Background(), userID, d.ID))
+	require.Eventually(t, func() bool {
+		got, _ := repo.GetByID(context.Background(), d.ID)
+		return got != nil && got.Status == models.StatusCompleted
+	}, 5*time.Second, 10*time.Millisecond)
+	got, err := repo.GetByID(context.Background(), d.ID)
+	require.NoError(t, err)
+	require.Equal(t, m.TotalSize(), got.DownloadedSize)
+}
@@ -3,7 +3,10 @@ package services
 import (
     "context"
     "errors"
+    "fmt"
     "math"
+    "path"
+    "sync"
     "time"
 
     "download-service/internal/cache"
@@ -19,102 +22,383 @@ import (
 )
 
 type DownloadService struct {
-    db       *gorm.DB
-    repo     repository.DownloadRepository
-    rdb      *redis.Client
-    stream   *StreamService
-    library  lib.Interface
-    logger   logger.Logger
-    // Tuning params for MVP simulation
-    defaultTotalSize int64 // bytes
-    defaultSpeed     int64 // bytes per tick (1s)
-}
-
-func NewDownloadService(db *gorm.DB, rdb *redis.Client, repo repository.DownloadRepository, stream *StreamService, library lib.Interface, logger logger.Logger) *DownloadService {
+    db           *gorm.DB
+    repo         repository.DownloadRepository
+    fileRepo     repository.DownloadFileRepository
+    history      repository.DownloadEventRepository
+    rdb          *redis.Client
+    stream       *StreamService
+    files        *FileService
+    library      lib.Interface
+    logger       logger.Logger
+    defaultSpeed int64         // bytes per second applied to new sessions
+    instanceID   string        // lease owner name of this replica
+    leaseTTL     time.Duration // how long a lease lasts without a heartbeat
+    leases       LeaseStore
+    commands     CommandBus
+    events       EventLog
+    maxActive    int // transferring downloads per user; 0 means unlimited
+    queueLocks   [queueLockStripes]sync.Mutex
+    tiers        TierOptions
+    offPeak      models.HourWindow // UTC hours off-peak schedules may run in
+    tokens       TokenOptions
+    entitlements *entitlements
+    repairs      repairSet // local sessions that repair completed downloads
+}
+
+func NewDownloadService(db *gorm.DB, rdb *redis.Client, repo repository.DownloadRepository, fileRepo repository.DownloadFileRepository, history repository.DownloadEventRepository, stream *StreamService, files *FileService, library lib.Interface, logger logger.Logger) *DownloadService {
     return &DownloadService{
-        db:               db,
-        repo:             repo,
-        rdb:              rdb,
-        stream:           stream,
-        library:          library,
-        logger:           logger,
-        defaultTotalSize: 128 * 1024 * 1024, // 128MB
-        defaultSpeed:     5 * 1024 * 1024,   // 5MB/s
+        db:           db,
+        repo:         repo,
+        fileRepo:     fileRepo,
+        history:      history,
+        rdb:          rdb,
+        stream:       stream,
+        files:        files,
+        library:      library,
+        logger:       logger,
+        defaultSpeed: 5 * 1024 * 1024, // 5MB/s
+        instanceID:   defaultInstanceID,
+        leaseTTL:     defaultLeaseTTL,
+        leases:       newLocalLeases(),
+        commands:     newLocalBus(),
+        events:       newLocalEventLog(),
+        offPeak:      defaultOffPeak,
+        entitlements: newEntitlements(),
     }
 }
 
+// DownloadRequest describes a download to create.
+type DownloadRequest struct {
+    GameID      string
+    Type        models.DownloadType      // full when empty
+    FromVersion string                   // installed version an update patches
+    Version     string                   // update target; the current build when empty
+    Schedule    *models.DownloadSchedule // when the transfer may run; nil starts it once a slot is free
+}
+
+// StartDownload installs the current build of a game.
 func (s *DownloadService) StartDownload(ctx context.Context, userID, gameID string) (*models.Download, error) {
-    owned, err := s.library.CheckOwnership(ctx, userID, gameID)
+    return s.Start(ctx, userID, DownloadRequest{GameID: gameID, Type: models.DownloadTypeFull})
+}
+
+// StartUpdate patches an installed build from fromVersion to toVersion (the current
+// build when empty), transferring only the files and chunks that changed.
+func (s *DownloadService) StartUpdate(ctx context.Context, userID, gameID, fromVersion, toVersion string) (*models.Download, error) {
+    return s.Start(ctx, userID, DownloadRequest{GameID: gameID, Type: models.DownloadTypeUpdate, FromVersion: fromVersion, Version: toVersion})
+}
+
+// Start creates a download and starts transferring it when the user has a free
+// slot and its schedule allows; otherwise it waits in pending. A game can have
+// only one unfinished download per user.
+func (s *DownloadService) Start(ctx context.Context, userID string, req DownloadRequest) (*models.Download, error) {
+    req, err := req.normalize()
     if err != nil {
-        logger.Error(s.logger, "library ownership check failed", "error", err, "userID", userID, "gameID", gameID)
+        return nil, err
+    }
+
+    owned, err := s.library.CheckOwnership(ctx, userID, req.GameID)
+    if err != nil {
+        logger.Error(s.logger, "library ownership check failed", "error", err, "userID", userID, "gameID", req.GameID)
         return nil, err
     }
     if !owned {
         err := derr.AccessDeniedError{Reason: "game not owned"}
-        logger.Info(s.logger, "user denied access to game", "error", err, "userID", userID, "gameID", gameID)
+        logger.Info(s.logger, "user denied access to game", "error", err, "userID", userID, "gameID", req.GameID)
+        return nil, err
+    }
+    unfinished, err := s.unfinishedDownloads(ctx, userID, []string{req.GameID})
+    if err != nil {
         return nil, err
     }
+    if id := unfinished[req.GameID]; id != "" {
+        return nil, derr.DuplicateDownloadError{GameID: req.GameID, DownloadID: id}
+    }
+    return s.create(ctx, userID, req)
+}
+
+// normalize validates a request and fills in its defaults.
+func (req DownloadRequest) normalize() (DownloadRequest, error) {
+    if err := req.Schedule.Validate(); err != nil {
+        return req, derr.ValidationError{Msg: "schedule: " + err.Error()}
+    }
+    if req.Schedule.IsZero() {
+        req.Schedule = nil
+    }
+    if req.Type == "" {
+        req.Type = models.DownloadTypeFull
+    }
+    return req, nil
+}
 
-    persistCtx := context.Background()
-    cacheCtx := context.Background()
+// create plans and records a download of a game the user is known to own, and
+// starts it if a slot is free and its schedule allows.
+func (s *DownloadService) create(ctx context.Context, userID string, req DownloadRequest) (*models.Download, error) {
+    gameID, typ, fromVersion, toVersion := req.GameID, req.Type, req.FromVersion, req.Version
+
+    var plan *BuildPlan
+    var err error
+    if typ == models.DownloadTypeUpdate {
+        plan, err = s.files.PlanUpdate(ctx, gameID, fromVersion, toVersion)
+    } else {
+        plan, err = s.files.PlanFull(ctx, gameID, toVersion)
+    }
+    if err != nil {
+        logger.Error(s.logger, "failed to plan game files", "error", err, "gameID", gameID, "type", typ)
+        return nil, err
+    }
+    totalSize := plan.TotalSize()
+    tierName := s.resolveTier(ctx, userID)
 
     d := &models.Download{
         UserID:         userID,
         GameID:         gameID,
-        Status:         models.StatusDownloading,
+        Tier:           tierName,
+        Priority:       s.tierLimits(tierName).Priority,
+        Schedule:       req.Schedule,
+        Type:           typ,
+        Version:        plan.Version,
+        FromVersion:    fromVersion,
         Progress:       0,
-        TotalSize:      s.defaultTotalSize,
+        TotalSize:      totalSize,
         DownloadedSize: 0,
-        Speed:          s.defaultSpeed,
+        Speed:          0,
+    }
+    // Hold the user's queue lock until the file rows exist, so a promotion never
+    // starts the download with a partial file list.
+    mu := s.queueLock(userID)
+    mu.Lock()
+    defer mu.Unlock()
+    free, err := s.hasSlot(ctx, userID, tierName)
+    if err != nil {
+        return nil, err
+    }
+    d.Status = models.StatusDownloading
+    if !free || !s.scheduleOpen(d) {
+        d.Status = models.StatusPending
     }
     if err := s.repo.Create(ctx, d); err != nil {
         logger.Error(s.logger, "failed to create download record", "error", err)
         return nil, err
     }
+    s.recordTransition(ctx, d.ID, "", d.Status, models.UserActor(userID), string(typ)+" download requested")
 
-    logger.Info(s.logger, "download started", "downloadID", d.ID, "userID", d.UserID, "gameID", d.GameID)
+    files := make([]models.DownloadFile, 0, len(plan.Files))
+    for _, gf := range plan.Files {
+        f := models.DownloadFile{
+            DownloadID: d.ID,
+            FileName:   path.Base(gf.Path),
+            FilePath:   gf.Path,
+            ObjectKey:  gf.ObjectKey,
+            FileSize:   gf.Size,
+            Checksum:   gf.SHA256,
+            Status:     models.StatusPending,
+        }
+        if err := s.fileRepo.Create(ctx, &f); err != nil {
+            logger.Error(s.logger, "failed to create download file record", "error", err, "downloadID", d.ID)
+            _ = s.transition(ctx, d, models.StatusFailed, models.ActorSystem, "create file records: "+err.Error())
+            return nil, err
+        }
+        files = append(files, f)
+    }
+    d.Files = files
+
+    if d.Status == models.StatusPending {
+        logger.Info(s.logger, "download queued", "downloadID", d.ID, "userID", d.UserID, "gameID", d.GameID, "priority", d.Priority, "scheduled", d.Schedule != nil)
+        s.publishStatus(ctx, d)
+        return d, nil
+    }
+
+    // The row is new, so no other replica can hold its lease; a failure here only
+    // means the lease store is unreachable, and the orphan scan will adopt it later.
+    if acquired, err := s.acquireLease(ctx, d.ID); err != nil || !acquired {
+        logger.Error(s.logger, "acquire download lease failed", "error", err, "downloadID", d.ID)
+        return d, nil
+    }
+
+    logger.Info(s.logger, "download started", "downloadID", d.ID, "userID", d.UserID, "gameID", d.GameID, "type", d.Type, "version", d.Version, "files", len(files), "totalSize", totalSize)
     observability.RecordDownloadStatus(observability.StatusStarted)
+    s.publishStatus(ctx, d)
+
+    s.startStream(d, files, plan)
+    return d, nil
+}
+
+// priorityWeight maps a download's priority to its share of contended bandwidth,
+// so a priority-100 download transfers 11 times as fast as a priority-0 one.
+func priorityWeight(priority int) int {
+    return 1 + priority/10
+}
+
+// planFor rebuilds the transfer plan of an existing download. Segments are not
+// persisted, so it is needed for files assembled from chunks or verified per chunk.
+func (s *DownloadService) planFor(ctx context.Context, d *models.Download, files []models.DownloadFile) (*BuildPlan, error) {
+    needed := false
+    for _, f := range files {
+        if (f.ObjectKey == "" || f.Checksum != "") && f.FileSize > 0 {
+            needed = true
+            break
+        }
+    }
+    if !needed {
+        return nil, nil
+    }
+    if d.Type == models.DownloadTypeUpdate {
+        return s.files.PlanUpdate(ctx, d.GameID, d.FromVersion, d.Version)
+    }
+    return s.files.PlanFull(ctx, d.GameID, d.Version)
+}
+
+// sessionOptions describes how a transfer session of d shares bandwidth. A tier's
+// ceiling is both the user's budget and the starting speed of each session.
+func (s *DownloadService) sessionOptions(d *models.Download) SessionOptions {
+    opts := SessionOptions{UserID: d.UserID, Weight: priorityWeight(d.Priority), BytesPerSecond: s.defaultSpeed}
+    if max := s.tierLimits(d.Tier).MaxBytesPerSecond; max > 0 {
+        opts.BytesPerSecond = max
+        opts.UserBytesPerSecond = max
+    }
+    return opts
+}
+
+// startStream hands the download's files to the transfer engine and persists
+// real progress for the download and each of its files as bytes arrive.
+// plan supplies the segments of chunk-assembled files and may be nil otherwise.
+// The caller must hold the download's lease; it is released when the session ends.
+func (s *DownloadService) startStream(d *models.Download, files []models.DownloadFile, plan *BuildPlan) {
+    persistCtx := context.Background()
+    cacheCtx := context.Background()
     observability.IncActiveDownloads()
 
-    s.stream.Start(context.Background(), d.ID, d.DownloadedSize, d.TotalSize, s.defaultSpeed, func(upd StreamUpdate) bool {
-        bytesSinceLastTick := upd.DownloadedSize - d.DownloadedSize
-        if bytesSinceLastTick > 0 {
-            observability.AddDownloadedBytes(float64(bytesSinceLastTick))
+    var segments map[string][]FileSegment
+    if plan != nil {
+        segments = plan.segmentsByPath()
+    }
+    transfer := make([]TransferFile, 0, len(files))
+    for _, f := range files {
+        tf := TransferFile{
+            ID:         f.ID,
+            ObjectKey:  f.ObjectKey,
+            Path:       f.FilePath,
+            Size:       f.FileSize,
+            Downloaded: f.DownloadedSize,
         }
-        d.DownloadedSize = upd.DownloadedSize
-        d.TotalSize = upd.TotalSize
-        d.Speed = upd.Speed
-        if d.TotalSize > 0 {
-            d.Progress = int(math.Round(float64(d.DownloadedSize) * 100 / float64(d.TotalSize)))
+        for _, seg := range segments[f.FilePath] {
+            tf.Segments = append(tf.Segments, TransferSegment{
+                ObjectKey:    seg.ObjectKey,
+                SourceOffset: seg.SourceOffset,
+                Offset:       seg.Offset,
+                Size:         seg.Size,
+                SHA256:       seg.SHA256,
+            })
         }
-        if err := s.repo.Update(persistCtx, d); err != nil {
-            logger.Error(s.logger, "update progress failed", "error", err, "downloadID", d.ID)
+        transfer = append(transfer, tf)
+    }
+
+    downloadID := d.ID
+    userID := d.UserID
+    totalSize := d.TotalSize
+    lastDownloaded := d.DownloadedSize
+    currentFile := ""
+
+    started := s.stream.StartWith(context.Background(), downloadID, transfer, s.sessionOptions(d), func(upd StreamUpdate) bool {
+        if delta := upd.DownloadedSize - lastDownloaded; delta > 0 {
+            observability.AddDownloadedBytes(float64(delta))
+        }
+        lastDownloaded = upd.DownloadedSize
+
+        progress := 0
+        if upd.TotalSize > 0 {
+            progress = int(math.Round(float64(upd.DownloadedSize) * 100 / float64(upd.TotalSize)))
+        }
+        if err := s.repo.UpdateProgress(persistCtx, downloadID, progress, upd.DownloadedSize, upd.Speed); err != nil {
+            logger.Error(s.logger, "update progress failed", "error", err, "downloadID", downloadID)
+        }
+        if upd.FileID != "" {
+            if upd.FileID != currentFile {
+                currentFile = upd.FileID
+                _ = s.fileRepo.UpdateStatus(persistCtx, upd.FileID, models.StatusDownloading)
+            }
+            if err := s.fileRepo.UpdateProgress(persistCtx, upd.FileID, upd.FileDownloaded); err != nil {
+                logger.Error(s.logger, "update file progress failed", "error", err, "downloadID", downloadID, "fileID", upd.FileID)
+            }
+            if upd.FileCompleted {
+                if err := s.fileRepo.UpdateStatus(persistCtx, upd.FileID, models.StatusCompleted); err != nil {
+                    logger.Error(s.logger, "update file status failed", "error", err, "downloadID", downloadID, "fileID", upd.FileID)
+                }
+            }
         }
         if s.rdb != nil {
-            _ = cache.SetDownloadStatus(cacheCtx, s.rdb, d.ID, cache.DownloadStatusValue{
-                Status:         string(d.Status),
-                Progress:       d.Progress,
-                DownloadedSize: d.DownloadedSize,
-                TotalSize:      d.TotalSize,
-                Speed:          d.Speed,
+            _ = cache.SetDownloadStatus(cacheCtx, s.rdb, downloadID, cache.DownloadStatusValue{
+                Status:         string(models.StatusDownloading),
+                Progress:       progress,
+                DownloadedSize: upd.DownloadedSize,
+                TotalSize:      upd.TotalSize,
+                Speed:          upd.Speed,
             }, 30*time.Second)
         }
+        s.publish(cacheCtx, userID, cache.DownloadEvent{
+            Type:           cache.EventProgress,
+            DownloadID:     downloadID,
+            Status:         string(models.StatusDownloading),
+            Progress:       progress,
+            DownloadedSize: upd.DownloadedSize,
+            TotalSize:      upd.TotalSize,
+            Speed:          upd.Speed,
+            FileID:         upd.FileID,
+        })
         return false
-    }, func() {
-        d.Status = models.StatusCompleted
-        d.Progress = 100
-        if err := s.repo.Update(persistCtx, d); err != nil {
-            logger.Error(s.logger, "finalize download failed", "error", err, "downloadID", d.ID)
-        }
+    }, func(err error) {
+        // Every session ends here exactly once, however it was stopped.
+        observability.DecActiveDownloads()
         if s.rdb != nil {
-            _ = cache.DeleteDownloadStatus(cacheCtx, s.rdb, d.ID)
+            _ = cache.DeleteDownloadStatus(cacheCtx, s.rdb, downloadID)
+        }
+        defer func() {
+            if err := s.releaseLease(persistCtx, downloadID); err != nil {
+                logger.Error(s.logger, "release download lease failed", "error", err, "downloadID", downloadID)
+            }
+        }()
+        switch {
+        case err == nil:
+            if err := s.repo.UpdateProgress(persistCtx, downloadID, 100, lastDownloaded, 0); err != nil {
+                logger.Error(s.logger, "finalize download progress failed", "error", err, "downloadID", downloadID)
+            }
+            s.finish(persistCtx, downloadID, models.StatusCompleted, "")
+            logger.Info(s.logger, "download completed", "downloadID", downloadID)
+            observability.RecordDownloadStatus(observability.StatusCompleted)
+        case errors.Is(err, ErrStreamStopped):
+            // Stopped by cancel; the caller owns the status transition.
+        default:
+            failedFile := currentFile
+            var te *TransferError
+            if errors.As(err, &te) {
+                failedFile = te.FileID
+            }
+            if failedFile != "" {
+                fileStatus := models.StatusFailed
+                if errors.As(err, &derr.ChunkCorruptedError{}) {
+                    fileStatus = models.StatusCorrupted
+                }
+                _ = s.fileRepo.UpdateStatus(persistCtx, failedFile, fileStatus)
+            }
+            logger.Error(s.logger, "download failed", "error", err, "downloadID", downloadID)
+            s.publish(cacheCtx, userID, cache.DownloadEvent{
+                Type:           cache.EventError,
+                DownloadID:     downloadID,
+                Status:         string(models.StatusFailed),
+                DownloadedSize: lastDownloaded,
+                TotalSize:      totalSize,
+                FileID:         failedFile,
+                Error:          err.Error(),
+            })
+            s.finish(persistCtx, downloadID, models.StatusFailed, err.Error())
+            observability.RecordDownloadStatus(observability.StatusFailed)
         }
-        logger.Info(s.logger, "download completed", "downloadID", d.ID)
-        observability.RecordDownloadStatus(observability.StatusCompleted)
-        observability.DecActiveDownloads()
     })
-
-    return d, nil
+    if !started {
+        // An existing session was woken instead; it is already counted.
+        observability.DecActiveDownloads()
+    }
 }
 
 func (s *DownloadService) PauseDownload(ctx context.Context, userID, downloadID string) error {
@@ -130,14 +414,12 @@ func (s *DownloadService) PauseDownload(ctx context.Context, userID, downloadID
         logger.Info(s.logger, "pause download access denied", "error", err, "authUserID", userID, "downloadID", downloadID)
         return err
     }
-    if d.Status != models.StatusDownloading {
-        return nil
-    }
-    s.stream.Pause(downloadID)
-    d.Status = models.StatusPaused
-    if err := s.repo.Update(ctx, d); err != nil {
+    if err := s.transition(ctx, d, models.StatusPaused, models.UserActor(userID), "paused by user"); err != nil {
         return err
     }
+    if err := s.control(ctx, cache.Command{Op: cache.CommandPause, DownloadID: d.ID}); err != nil {
+        logger.Error(s.logger, "route pause command failed", "error", err, "downloadID", d.ID)
+    }
     logger.Info(s.logger, "download paused", "downloadID", d.ID)
     return nil
 }
@@ -156,17 +438,79 @@ func (s *DownloadService) ResumeDownload(ctx context.Context, userID, downloadID
         return err
     }
     if d.Status != models.StatusPaused {
+        return derr.InvalidTransitionError{ID: d.ID, From: string(d.Status), To: string(models.StatusDownloading)}
+    }
+    if err := s.requireOwnership(ctx, userID, d.GameID); err != nil {
+        return err
+    }
+    mu := s.queueLock(userID)
+    mu.Lock()
+    defer mu.Unlock()
+    if !s.scheduleOpen(d) {
+        if err := s.transition(ctx, d, models.StatusPending, models.UserActor(userID), "resume queued: outside schedule"); err != nil {
+            return err
+        }
+        logger.Info(s.logger, "download queued until its schedule opens", "downloadID", d.ID)
         return nil
     }
-    s.stream.Resume(downloadID)
-    d.Status = models.StatusDownloading
-    if err := s.repo.Update(ctx, d); err != nil {
+    free, err := s.hasSlot(ctx, userID, d.Tier)
+    if err != nil {
+        return err
+    }
+    if !free {
+        if err := s.transition(ctx, d, models.StatusPending, models.UserActor(userID), "resume queued: active download limit reached"); err != nil {
+            return err
+        }
+        logger.Info(s.logger, "download queued", "downloadID", d.ID)
+        return nil
+    }
+    if err := s.launch(ctx, d, models.UserActor(userID), "resumed by user"); err != nil {
         return err
     }
     logger.Info(s.logger, "download resumed", "downloadID", d.ID)
     return nil
 }
 
+// launch moves a paused or queued download to downloading. A replica still holding
+// its paused session is woken; otherwise a new session continues from the persisted
+// file progress (e.g. after a restart). The caller holds the user's queue lock.
+func (s *DownloadService) launch(ctx context.Context, d *models.Download, actor, reason string) error {
+    owners, err := s.leases.Owners(ctx, []string{d.ID})
+    if err != nil {
+        return err
+    }
+    if owner, ok := owners[d.ID]; (ok && owner != s.instanceID) || s.stream.Active(d.ID) {
+        if err := s.transition(ctx, d, models.StatusDownloading, actor, reason); err != nil {
+            return err
+        }
+        if err := s.control(ctx, cache.Command{Op: cache.CommandResume, DownloadID: d.ID}); err != nil {
+            logger.Error(s.logger, "route resume command failed", "error", err, "downloadID", d.ID, "owner", owner)
+        }
+        return nil
+    }
+    files, err := s.fileRepo.ListByDownload(ctx, d.ID)
+    if err != nil {
+        return err
+    }
+    plan, err := s.planFor(ctx, d, files)
+    if err != nil {
+        return err
+    }
+    acquired, err := s.acquireLease(ctx, d.ID)
+    if err != nil {
+        return err
+    }
+    if !acquired {
+        return derr.LeaseConflictError{ID: d.ID}
+    }
+    if err := s.transition(ctx, d, models.StatusDownloading, actor, reason); err != nil {
+        _ = s.releaseLease(ctx, d.ID)
+        return err
+    }
+    s.startStream(d, files, plan)
+    return nil
+}
+
 func (s *DownloadService) GetDownload(ctx context.Context, userID, downloadID string) (*models.Download, error) {
     d, err := s.repo.GetByID(ctx, downloadID)
     if err != nil {
@@ -183,6 +527,25 @@ func (s *DownloadService) GetDownload(ctx context.Context, userID, downloadID st
     return d, nil
 }
 
+// GetDownloadFile returns a file of a download after checking the caller owns the download.
+func (s *DownloadService) GetDownloadFile(ctx context.Context, userID, downloadID, fileID string) (*models.Download, *models.DownloadFile, error) {
+    d, err := s.GetDownload(ctx, userID, downloadID)
+    if err != nil {
+        return nil, nil, err
+    }
+    f, err := s.fileRepo.GetByID(ctx, fileID)
+    if err != nil {
+        if errors.Is(err, gorm.ErrRecordNotFound) {
+            return nil, nil, derr.DownloadNotFoundError{ID: downloadID + "/" + fileID}
+        }
+        return nil, nil, err
+    }
+    if f.DownloadID != d.ID {
+        return nil, nil, derr.DownloadNotFoundError{ID: downloadID + "/" + fileID}
+    }
+    return d, f, nil
+}
+
 func (s *DownloadService) ListUserDownloads(ctx context.Context, userID string, limit, offset int) ([]models.Download, error) {
     return s.repo.ListByUser(ctx, userID, limit, offset)
 }
@@ -200,21 +563,44 @@ func (s *DownloadService) CancelDownload(ctx context.Context, userID, downloadID
         logger.Info(s.logger, "cancel download access denied", "error", err, "authUserID", userID, "downloadID", downloadID)
         return err
     }
+    return s.stop(ctx, d, models.StatusCancelled, models.UserActor(userID), "cancelled by user")
+}
 
-    if d.Status != models.StatusDownloading && d.Status != models.StatusPaused {
-        return nil
+// stop moves d to cancelled or failed and ends its transfer session on whichever
+// replica runs it. A session stopped this way leaves the status to its caller.
+func (s *DownloadService) stop(ctx context.Context, d *models.Download, to models.DownloadStatus, actor, reason string) error {
+    if err := s.transition(ctx, d, to, actor, reason); err != nil {
+        return err
+    }
+    if err := s.control(ctx, cache.Command{Op: cache.CommandCancel, DownloadID: d.ID}); err != nil {
+        logger.Error(s.logger, "route cancel command failed", "error", err, "downloadID", d.ID)
     }
 
-    s.stream.Stop(downloadID)
-    d.Status = models.StatusCancelled
+    logger.Info(s.logger, "download stopped", "downloadID", d.ID, "status", to, "actor", actor)
+    if to == models.StatusFailed {
+        observability.RecordDownloadStatus(observability.StatusFailed)
+    } else {
+        observability.RecordDownloadStatus(observability.StatusCancelled)
+    }
+    return nil
+}
 
-    if err := s.repo.Update(ctx, d); err != nil {
+// SetDownloadPriority changes where a download ranks in the user's queue; higher
+// priorities start first. Running downloads are not preempted.
+func (s *DownloadService) SetDownloadPriority(ctx context.Context, userID, downloadID string, priority int) error {
+    if priority < models.MinPriority || priority > models.MaxPriority {
+        return derr.ValidationError{Msg: fmt.Sprintf("priority must be between %d and %d", models.MinPriority, models.MaxPriority)}
+    }
+    d, err := s.GetDownload(ctx, userID, downloadID)
+    if err != nil {
         return err
     }
-
-    logger.Info(s.logger, "download cancelled", "downloadID", d.ID)
-    observability.RecordDownloadStatus(observability.StatusCancelled)
-    observability.DecActiveDownloads()
+    if err := s.repo.UpdatePriority(ctx, d.ID, priority); err != nil {
+        return err
+    }
+    // A session on another replica picks the weight up on its next heartbeat.
+    s.stream.SetWeight(d.ID, priorityWeight(priority))
+    logger.Info(s.logger, "download priority set", "downloadID", d.ID, "priority", priority)
     return nil
 }
 
@@ -223,7 +609,8 @@ func (s *DownloadService) ListUserLibraryGames(ctx context.Context, userID strin
     return s.library.ListUserGames(ctx, userID)
 }
 
-// SetDownloadSpeed updates the speed for an active download.
+// SetDownloadSpeed caps the speed of an active download. The session may get less
+// while the node or user bandwidth budget is contended.
 func (s *DownloadService) SetDownloadSpeed(ctx context.Context, userID, downloadID string, bytesPerSecond int64) error {
     if bytesPerSecond <= 0 {
         return derr.ValidationError{Msg: "bytesPerSecond must be positive"}
@@ -245,8 +632,14 @@ func (s *DownloadService) SetDownloadSpeed(ctx context.Context, userID, download
     if d.Status != models.StatusDownloading && d.Status != models.StatusPaused {
         return derr.ValidationError{Msg: "cannot set speed for a download that is not active"}
     }
+    if clamped := s.clampSpeed(s.resolveTier(ctx, userID), bytesPerSecond); clamped != bytesPerSecond {
+        logger.Info(s.logger, "requested speed above tier ceiling", "downloadID", downloadID, "requestedBps", bytesPerSecond, "ceilingBps", clamped)
+        bytesPerSecond = clamped
+    }
 
-    s.stream.SetSpeed(downloadID, bytesPerSecond)
+    if err := s.control(ctx, cache.Command{Op: cache.CommandSpeed, DownloadID: downloadID, BytesPerSecond: bytesPerSecond}); err != nil {
+        return err
+    }
     logger.Info(s.logger, "download speed set", "downloadID", downloadID, "newSpeedBps", bytesPerSecond)
     return nil
 }
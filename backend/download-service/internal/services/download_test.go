@@ -5,22 +5,30 @@ import (
     "errors"
     "fmt"
     "sync"
+    "os"
+    "path"
+    "path/filepath"
+    "sort"
     "sync/atomic"
     "testing"
     "time"
 
+    lib "download-service/internal/clients/library"
+    "download-service/internal/clients/s3"
     derr "download-service/internal/errors"
     "download-service/internal/models"
+    "download-service/internal/repository"
     "download-service/pkg/logger"
+    "github.com/stretchr/testify/require"
     "github.com/stretchr/testify/suite"
     "gorm.io/gorm"
 )
 
 type downloadServiceSuite struct {
     suite.Suite
-    repo   *memDownloadRepo
-    stream *StreamService
-    svc    *DownloadService
+    repo    *memDownloadRepo
+    storage *s3.MockClient
+    svc     *DownloadService
 }
 
 type memDownloadRepo struct {
@@ -108,6 +116,36 @@ func (r *memDownloadRepo) UpdateProgress(ctx context.Context, id string, progres
     return gorm.ErrRecordNotFound
 }
 
+func (r *memDownloadRepo) Transition(ctx context.Context, id string, from, to models.DownloadStatus, reason string) (bool, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    d, ok := r.m[id]
+    if !ok || d.Status != from {
+        return false, nil
+    }
+    d.Status = to
+    if to == models.StatusFailed {
+        d.FailureReason = reason
+    } else if from == models.StatusFailed {
+        d.FailureReason = ""
+    }
+    d.UpdatedAt = time.Now()
+    r.m[id] = d
+    return true, nil
+}
+
+func (r *memDownloadRepo) UpdatePriority(ctx context.Context, id string, priority int) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    if d, ok := r.m[id]; ok {
+        d.Priority = priority
+        d.UpdatedAt = time.Now()
+        r.m[id] = d
+        return nil
+    }
+    return gorm.ErrRecordNotFound
+}
+
 func (r *memDownloadRepo) ListByUserAndStatus(ctx context.Context, userID string, status models.DownloadStatus, limit, offset int) ([]models.Download, error) {
     r.mu.Lock()
     defer r.mu.Unlock()
@@ -142,6 +180,325 @@ func (r *memDownloadRepo) CountByUser(ctx context.Context, userID string) (int64
     return count, nil
 }
 
+func (r *memDownloadRepo) ListByStatus(ctx context.Context, status models.DownloadStatus, limit, offset int) ([]models.Download, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    out := make([]models.Download, 0)
+    for _, v := range r.m {
+        if v.Status == status {
+            out = append(out, v)
+        }
+    }
+    sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+    if offset >= len(out) {
+        return []models.Download{}, nil
+    }
+    out = out[offset:]
+    if limit > 0 && len(out) > limit {
+        out = out[:limit]
+    }
+    return out, nil
+}
+
+func (r *memDownloadRepo) ListUnfinished(ctx context.Context, userID string, gameIDs []string) ([]models.Download, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    games := make(map[string]bool, len(gameIDs))
+    for _, id := range gameIDs {
+        games[id] = true
+    }
+    out := make([]models.Download, 0)
+    for _, v := range r.m {
+        if v.UserID == userID && games[v.GameID] && models.CanTransition(v.Status, models.StatusCancelled) {
+            out = append(out, v)
+        }
+    }
+    return out, nil
+}
+
+func (r *memDownloadRepo) AcquireLease(ctx context.Context, id, owner string, ttl time.Duration) (bool, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    d, ok := r.m[id]
+    if !ok {
+        return false, nil
+    }
+    now := time.Now()
+    if d.LeaseOwner != "" && d.LeaseOwner != owner && d.LeaseExpiresAt != nil && d.LeaseExpiresAt.After(now) {
+        return false, nil
+    }
+    exp := now.Add(ttl)
+    d.LeaseOwner, d.LeaseExpiresAt = owner, &exp
+    r.m[id] = d
+    return true, nil
+}
+
+func (r *memDownloadRepo) RenewLease(ctx context.Context, id, owner string, ttl time.Duration) (bool, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    d, ok := r.m[id]
+    if !ok || d.LeaseOwner != owner {
+        return false, nil
+    }
+    exp := time.Now().Add(ttl)
+    d.LeaseExpiresAt = &exp
+    r.m[id] = d
+    return true, nil
+}
+
+func (r *memDownloadRepo) ReleaseLease(ctx context.Context, id, owner string) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    if d, ok := r.m[id]; ok && d.LeaseOwner == owner {
+        d.LeaseOwner, d.LeaseExpiresAt = "", nil
+        r.m[id] = d
+    }
+    return nil
+}
+
+func (r *memDownloadRepo) ListOrphaned(ctx context.Context, now time.Time, afterID string, limit int) ([]models.Download, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    out := make([]models.Download, 0)
+    for _, v := range r.m {
+        expired := v.LeaseOwner != "" && v.LeaseExpiresAt != nil && v.LeaseExpiresAt.Before(now)
+        if v.ID > afterID && ((v.Status == models.StatusDownloading && (v.LeaseOwner == "" || expired)) || (v.Status == models.StatusPaused && expired)) {
+            out = append(out, v)
+        }
+    }
+    sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+    if limit > 0 && len(out) > limit {
+        out = out[:limit]
+    }
+    return out, nil
+}
+
+func (r *memDownloadRepo) CountByUserAndStatus(ctx context.Context, userID string, status models.DownloadStatus) (int64, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    count := int64(0)
+    for _, v := range r.m {
+        if v.UserID == userID && v.Status == status {
+            count++
+        }
+    }
+    return count, nil
+}
+
+func (r *memDownloadRepo) ListQueue(ctx context.Context, userID string, limit int) ([]models.Download, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    out := make([]models.Download, 0)
+    for _, v := range r.m {
+        if v.UserID == userID && v.Status == models.StatusPending {
+            out = append(out, v)
+        }
+    }
+    sort.Slice(out, func(i, j int) bool {
+        a, b := out[i], out[j]
+        if a.Priority != b.Priority {
+            return a.Priority > b.Priority
+        }
+        if a.QueuePosition != b.QueuePosition {
+            return a.QueuePosition < b.QueuePosition
+        }
+        return a.CreatedAt.Before(b.CreatedAt)
+    })
+    if limit > 0 && len(out) > limit {
+        out = out[:limit]
+    }
+    return out, nil
+}
+
+func (r *memDownloadRepo) SetQueueOrder(ctx context.Context, userID string, ids []string) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    for i, id := range ids {
+        if d, ok := r.m[id]; ok && d.UserID == userID && d.Status == models.StatusPending {
+            d.QueuePosition = int64(i - len(ids))
+            r.m[id] = d
+        }
+    }
+    return nil
+}
+
+func (r *memDownloadRepo) UpdateSchedule(ctx context.Context, id string, schedule *models.DownloadSchedule) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    if d, ok := r.m[id]; ok {
+        d.Schedule = schedule
+        d.UpdatedAt = time.Now()
+        r.m[id] = d
+        return nil
+    }
+    return gorm.ErrRecordNotFound
+}
+
+func (r *memDownloadRepo) ListScheduled(ctx context.Context, limit, offset int) ([]models.Download, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    out := make([]models.Download, 0)
+    for _, v := range r.m {
+        if v.Schedule != nil && (v.Status == models.StatusPending || v.Status == models.StatusDownloading) {
+            out = append(out, v)
+        }
+    }
+    sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+    if offset >= len(out) {
+        return []models.Download{}, nil
+    }
+    out = out[offset:]
+    if limit > 0 && len(out) > limit {
+        out = out[:limit]
+    }
+    return out, nil
+}
+
+func (r *memDownloadRepo) List(ctx context.Context, f repository.DownloadFilter) ([]models.Download, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    out := make([]models.Download, 0)
+    for _, v := range r.m {
+        if (f.UserID == "" || v.UserID == f.UserID) && (f.GameID == "" || v.GameID == f.GameID) && (f.Status == "" || v.Status == f.Status) {
+            out = append(out, v)
+        }
+    }
+    sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+    if f.Offset >= len(out) {
+        return []models.Download{}, nil
+    }
+    out = out[f.Offset:]
+    if f.Limit > 0 && len(out) > f.Limit {
+        out = out[:f.Limit]
+    }
+    return out, nil
+}
+
+type memDownloadEventRepo struct {
+    mu     sync.Mutex
+    events []models.DownloadEvent
+}
+
+func newMemDownloadEventRepo() *memDownloadEventRepo { return &memDownloadEventRepo{} }
+
+func (r *memDownloadEventRepo) Create(ctx context.Context, e *models.DownloadEvent) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    e.ID = fmt.Sprintf("ev-%d", len(r.events)+1)
+    e.CreatedAt = time.Now()
+    r.events = append(r.events, *e)
+    return nil
+}
+
+func (r *memDownloadEventRepo) ListByDownload(ctx context.Context, downloadID string) ([]models.DownloadEvent, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    var out []models.DownloadEvent
+    for _, e := range r.events {
+        if e.DownloadID == downloadID {
+            out = append(out, e)
+        }
+    }
+    return out, nil
+}
+
+type memDownloadFileRepo struct {
+    mu  sync.Mutex
+    m   map[string]models.DownloadFile
+    seq int
+}
+
+func newMemDownloadFileRepo() *memDownloadFileRepo {
+    return &memDownloadFileRepo{m: make(map[string]models.DownloadFile)}
+}
+
+func (r *memDownloadFileRepo) Create(ctx context.Context, f *models.DownloadFile) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    r.seq++
+    if f.ID == "" {
+        f.ID = fmt.Sprintf("file-%d", r.seq)
+    }
+    now := time.Now()
+    f.CreatedAt = now
+    f.UpdatedAt = now
+    r.m[f.ID] = *f
+    return nil
+}
+
+func (r *memDownloadFileRepo) GetByID(ctx context.Context, id string) (*models.DownloadFile, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    if v, ok := r.m[id]; ok {
+        return &v, nil
+    }
+    return nil, gorm.ErrRecordNotFound
+}
+
+func (r *memDownloadFileRepo) ListByDownload(ctx context.Context, downloadID string) ([]models.DownloadFile, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    out := make([]models.DownloadFile, 0)
+    for _, v := range r.m {
+        if v.DownloadID == downloadID {
+            out = append(out, v)
+        }
+    }
+    sort.Slice(out, func(i, j int) bool { return out[i].FileName < out[j].FileName })
+    return out, nil
+}
+
+func (r *memDownloadFileRepo) Update(ctx context.Context, f *models.DownloadFile) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    if _, ok := r.m[f.ID]; !ok {
+        return gorm.ErrRecordNotFound
+    }
+    f.UpdatedAt = time.Now()
+    r.m[f.ID] = *f
+    return nil
+}
+
+func (r *memDownloadFileRepo) UpdateStatus(ctx context.Context, id string, status models.DownloadStatus) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    if f, ok := r.m[id]; ok {
+        f.Status = status
+        r.m[id] = f
+        return nil
+    }
+    return gorm.ErrRecordNotFound
+}
+
+func (r *memDownloadFileRepo) UpdateProgress(ctx context.Context, id string, downloadedSize int64) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    if f, ok := r.m[id]; ok {
+        f.DownloadedSize = downloadedSize
+        r.m[id] = f
+        return nil
+    }
+    return gorm.ErrRecordNotFound
+}
+
+func (r *memDownloadFileRepo) Delete(ctx context.Context, id string) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    delete(r.m, id)
+    return nil
+}
+
+func (r *memDownloadFileRepo) DeleteByDownload(ctx context.Context, downloadID string) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    for id, f := range r.m {
+        if f.DownloadID == downloadID {
+            delete(r.m, id)
+        }
+    }
+    return nil
+}
+
 type mockLibrary struct {
     owned bool
     err   error
@@ -149,6 +506,27 @@ type mockLibrary struct {
 
 func (m mockLibrary) CheckOwnership(ctx context.Context, userID, gameID string) (bool, error) { return m.owned, m.err }
 func (m mockLibrary) ListUserGames(ctx context.Context, userID string) ([]string, error)  { return nil, nil }
+func (m mockLibrary) CheckOwnershipBatch(ctx context.Context, userID string, gameIDs []string) (map[string]bool, error) {
+    out := make(map[string]bool, len(gameIDs))
+    for _, id := range gameIDs {
+        out[id] = m.owned
+    }
+    return out, m.err
+}
+
+const testGameSize = 512 * 1024
+
+// newTestDownloadService wires a DownloadService against in-memory repositories and storage.
+func newTestDownloadService(repo *memDownloadRepo, library lib.Interface) (*DownloadService, *s3.MockClient) {
+    storage := s3.NewMockClient()
+    svc := NewDownloadService(nil, nil, repo, newMemDownloadFileRepo(), newMemDownloadEventRepo(), NewStreamService(storage, nil), NewFileService(storage), library, logger.New())
+    return svc, storage
+}
+
+// seedGame stores a single-archive build for the game.
+func seedGame(storage *s3.MockClient, gameID string) {
+    storage.PutObject(objectKeyForGame(gameID), testGameSize, nil)
+}
 
 func fmtID(i int) string {
     return "dl-" + time.Now().Format("150405") + "-" + string(rune('a'+(i%26)))
@@ -156,14 +534,13 @@ func fmtID(i int) string {
 
 func (s *downloadServiceSuite) SetupTest() {
     s.repo = newMemDownloadRepo()
-    s.stream = NewStreamService()
-    s.svc = NewDownloadService(nil, nil, s.repo, s.stream, mockLibrary{owned: true}, logger.New())
-    s.svc.defaultTotalSize = 512 * 1024
-    s.svc.defaultSpeed = 512 * 1024
+    s.svc, s.storage = newTestDownloadService(s.repo, mockLibrary{owned: true})
+    // Slow enough that a download stays active for the duration of a test.
+    s.svc.defaultSpeed = 64 * 1024
 }
 
 func (s *downloadServiceSuite) TestStartDownloadDenied() {
-    svc := NewDownloadService(nil, nil, s.repo, s.stream, mockLibrary{owned: false}, logger.New())
+    svc, _ := newTestDownloadService(s.repo, mockLibrary{owned: false})
     _, err := svc.StartDownload(context.Background(), "00000000-0000-0000-0000-000000000001", "00000000-0000-0000-0000-000000000002")
     s.Require().Error(err)
     s.Require().True(errors.As(err, &derr.AccessDeniedError{}))
@@ -172,6 +549,7 @@ func (s *downloadServiceSuite) TestStartDownloadDenied() {
 func (s *downloadServiceSuite) TestStartPauseResume() {
     userID := "10000000-0000-0000-0000-000000000001"
     gameID := "20000000-0000-0000-0000-000000000001"
+    seedGame(s.storage, gameID)
 
     d, err := s.svc.StartDownload(context.Background(), userID, gameID)
     s.Require().NoError(err)
@@ -206,6 +584,7 @@ func (s *downloadServiceSuite) TestActionsAccessDenied() {
 func (s *downloadServiceSuite) TestSetDownloadSpeedValidation() {
     userID := "30000000-0000-0000-0000-000000000001"
     gameID := "40000000-0000-0000-0000-000000000001"
+    seedGame(s.storage, gameID)
     d, err := s.svc.StartDownload(context.Background(), userID, gameID)
     s.Require().NoError(err)
 
@@ -215,6 +594,140 @@ func (s *downloadServiceSuite) TestSetDownloadSpeedValidation() {
     s.Require().NoError(s.svc.SetDownloadSpeed(context.Background(), userID, d.ID, 1024))
 }
 
+func (s *downloadServiceSuite) TestSetDownloadPriority() {
+    ownerID := "30000000-0000-0000-0000-000000000011"
+    _ = s.repo.Create(context.Background(), &models.Download{ID: "dl-prio", UserID: ownerID, Status: models.StatusPaused})
+
+    err := s.svc.SetDownloadPriority(context.Background(), ownerID, "dl-prio", models.MaxPriority+1)
+    s.Require().True(errors.As(err, &derr.ValidationError{}))
+    err = s.svc.SetDownloadPriority(context.Background(), "30000000-0000-0000-0000-000000000022", "dl-prio", 10)
+    s.Require().True(errors.As(err, &derr.AccessDeniedError{}))
+
+    s.Require().NoError(s.svc.SetDownloadPriority(context.Background(), ownerID, "dl-prio", 10))
+    d, err := s.svc.GetDownload(context.Background(), ownerID, "dl-prio")
+    s.Require().NoError(err)
+    s.Require().Equal(10, d.Priority)
+}
+
+func (s *downloadServiceSuite) TestStartDownloadUnknownGame() {
+    _, err := s.svc.StartDownload(context.Background(), "50000000-0000-0000-0000-000000000001", "60000000-0000-0000-0000-000000000001")
+    s.Require().True(errors.As(err, &derr.GameBuildNotFoundError{}))
+}
+
+func (s *downloadServiceSuite) TestCancelStopsTransfer() {
+    userID := "70000000-0000-0000-0000-000000000001"
+    gameID := "80000000-0000-0000-0000-000000000001"
+    seedGame(s.storage, gameID)
+    d, err := s.svc.StartDownload(context.Background(), userID, gameID)
+    s.Require().NoError(err)
+
+    s.Require().NoError(s.svc.CancelDownload(context.Background(), userID, d.ID))
+    s.Eventually(func() bool { return !s.svc.stream.Active(d.ID) }, 2*time.Second, 10*time.Millisecond)
+
+    got, err := s.repo.GetByID(context.Background(), d.ID)
+    s.Require().NoError(err)
+    s.Equal(models.StatusCancelled, got.Status)
+}
+
+func (s *downloadServiceSuite) TestGetDownloadFileAccessControl() {
+    userID := "b0000000-0000-0000-0000-000000000001"
+    gameID := "c0000000-0000-0000-0000-000000000001"
+    seedGame(s.storage, gameID)
+    d, err := s.svc.StartDownload(context.Background(), userID, gameID)
+    s.Require().NoError(err)
+    s.Require().Len(d.Files, 1)
+    fileID := d.Files[0].ID
+
+    _, f, err := s.svc.GetDownloadFile(context.Background(), userID, d.ID, fileID)
+    s.Require().NoError(err)
+    s.Equal(objectKeyForGame(gameID), f.ObjectKey)
+
+    _, _, err = s.svc.GetDownloadFile(context.Background(), "b0000000-0000-0000-0000-000000000002", d.ID, fileID)
+    s.Require().True(errors.As(err, &derr.AccessDeniedError{}))
+
+    _ = s.repo.Create(context.Background(), &models.Download{ID: "dl-other", UserID: userID})
+    _, _, err = s.svc.GetDownloadFile(context.Background(), userID, "dl-other", fileID)
+    s.Require().True(errors.As(err, &derr.DownloadNotFoundError{}))
+}
+
+func TestDownloadService_TransfersRealBytes(t *testing.T) {
+    repo := newMemDownloadRepo()
+    fileRepo := newMemDownloadFileRepo()
+    storage := s3.NewMockClient()
+    root := t.TempDir()
+    stream := NewStreamService(storage, DirSink{Root: root})
+    stream.chunkSize = 64 * 1024
+    svc := NewDownloadService(nil, nil, repo, fileRepo, newMemDownloadEventRepo(), stream, NewFileService(storage), mockLibrary{owned: true}, logger.New())
+    svc.defaultSpeed = 0
+
+    gameID := "90000000-0000-0000-0000-000000000001"
+    content := make([]byte, 300*1024+17)
+    for i := range content {
+        content[i] = byte(i % 251)
+    }
+    storage.PutObject(objectKeyForGame(gameID), int64(len(content)), content)
+
+    d, err := svc.StartDownload(context.Background(), "a0000000-0000-0000-0000-000000000001", gameID)
+    require.NoError(t, err)
+    require.Equal(t, int64(len(content)), d.TotalSize)
+    require.Len(t, d.Files, 1)
+
+    require.Eventually(t, func() bool {
+        got, _ := repo.GetByID(context.Background(), d.ID)
+        return got != nil && got.Status == models.StatusCompleted
+    }, 5*time.Second, 10*time.Millisecond)
+
+    got, err := repo.GetByID(context.Background(), d.ID)
+    require.NoError(t, err)
+    require.Equal(t, int64(len(content)), got.DownloadedSize)
+    require.Equal(t, 100, got.Progress)
+
+    files, err := fileRepo.ListByDownload(context.Background(), d.ID)
+    require.NoError(t, err)
+    require.Len(t, files, 1)
+    require.Equal(t, models.StatusCompleted, files[0].Status)
+    require.Equal(t, int64(len(content)), files[0].DownloadedSize)
+
+    written, err := os.ReadFile(filepath.Join(root, d.ID, gameArchiveName))
+    require.NoError(t, err)
+    require.Equal(t, content, written)
+}
+
+func TestDownloadService_StartDownloadExpandsManifest(t *testing.T) {
+    repo := newMemDownloadRepo()
+    fileRepo := newMemDownloadFileRepo()
+    storage := s3.NewMockClient()
+    svc := NewDownloadService(nil, nil, repo, fileRepo, newMemDownloadEventRepo(), NewStreamService(storage, nil), NewFileService(storage), mockLibrary{owned: true}, logger.New())
+    svc.defaultSpeed = 0
+
+    gameID := "e0000000-0000-0000-0000-000000000001"
+    m := putManifest(t, storage, gameID, map[string][]byte{
+        "bin/game.exe":    make([]byte, 4096),
+        "data/level1.pak": make([]byte, 8192),
+        "readme.txt":      []byte("hello"),
+    })
+
+    d, err := svc.StartDownload(context.Background(), "e0000000-0000-0000-0000-000000000002", gameID)
+    require.NoError(t, err)
+    require.Equal(t, m.TotalSize(), d.TotalSize)
+    require.Len(t, d.Files, 3)
+
+    require.Eventually(t, func() bool {
+        got, _ := repo.GetByID(context.Background(), d.ID)
+        return got != nil && got.Status == models.StatusCompleted
+    }, 5*time.Second, 10*time.Millisecond)
+
+    files, err := fileRepo.ListByDownload(context.Background(), d.ID)
+    require.NoError(t, err)
+    require.Len(t, files, 3)
+    for _, f := range files {
+        require.Equal(t, models.StatusCompleted, f.Status, f.FilePath)
+        require.Equal(t, f.FileSize, f.DownloadedSize, f.FilePath)
+        require.Len(t, f.Checksum, 64)
+        require.Equal(t, path.Base(f.FilePath), f.FileName)
+    }
+}
+
 func TestDownloadServiceSuite(t *testing.T) {
     suite.Run(t, new(downloadServiceSuite))
 }
@@ -222,14 +735,14 @@ func TestDownloadServiceSuite(t *testing.T) {
 // Benchmark tests for download operations
 func BenchmarkDownloadService_StartDownload(b *testing.B) {
     repo := newMemDownloadRepo()
-    stream := NewStreamService()
-    svc := NewDownloadService(nil, nil, repo, stream, mockLibrary{owned: true}, logger.New())
+    svc, storage := newTestDownloadService(repo, mockLibrary{owned: true})
     ctx := context.Background()
     
     b.ResetTimer()
     for i := 0; i < b.N; i++ {
         userID := fmt.Sprintf("user-%d", i)
         gameID := fmt.Sprintf("game-%d", i)
+        seedGame(storage, gameID)
         _, err := svc.StartDownload(ctx, userID, gameID)
         if err != nil {
             b.Fatal(err)
@@ -239,8 +752,7 @@ func BenchmarkDownloadService_StartDownload(b *testing.B) {
 
 func BenchmarkDownloadService_GetDownload(b *testing.B) {
     repo := newMemDownloadRepo()
-    stream := NewStreamService()
-    svc := NewDownloadService(nil, nil, repo, stream, mockLibrary{owned: true}, logger.New())
+    svc, storage := newTestDownloadService(repo, mockLibrary{owned: true})
     ctx := context.Background()
     
     // Setup test downloads
@@ -250,6 +762,7 @@ func BenchmarkDownloadService_GetDownload(b *testing.B) {
     
     for i := 0; i < numDownloads; i++ {
         gameID := fmt.Sprintf("game-%d", i)
+        seedGame(storage, gameID)
         d, err := svc.StartDownload(ctx, userID, gameID)
         if err != nil {
             b.Fatal(err)
@@ -269,12 +782,12 @@ func BenchmarkDownloadService_GetDownload(b *testing.B) {
 
 func BenchmarkDownloadService_UpdateProgress(b *testing.B) {
     repo := newMemDownloadRepo()
-    stream := NewStreamService()
-    svc := NewDownloadService(nil, nil, repo, stream, mockLibrary{owned: true}, logger.New())
+    svc, storage := newTestDownloadService(repo, mockLibrary{owned: true})
     ctx := context.Background()
     
     userID := "benchmark-user"
     gameID := "benchmark-game"
+    seedGame(storage, gameID)
     d, err := svc.StartDownload(ctx, userID, gameID)
     if err != nil {
         b.Fatal(err)
@@ -293,8 +806,7 @@ func BenchmarkDownloadService_UpdateProgress(b *testing.B) {
 // Concurrent tests for download operations
 func TestDownloadService_ConcurrentStartDownload(t *testing.T) {
     repo := newMemDownloadRepo()
-    stream := NewStreamService()
-    svc := NewDownloadService(nil, nil, repo, stream, mockLibrary{owned: true}, logger.New())
+    svc, storage := newTestDownloadService(repo, mockLibrary{owned: true})
     ctx := context.Background()
     
     const numGoroutines = 50
@@ -311,7 +823,8 @@ func TestDownloadService_ConcurrentStartDownload(t *testing.T) {
             for j := 0; j < downloadsPerGoroutine; j++ {
                 userID := fmt.Sprintf("user-%d", goroutineID)
                 gameID := fmt.Sprintf("game-%d-%d", goroutineID, j)
-                
+                seedGame(storage, gameID)
+
                 download, err := svc.StartDownload(ctx, userID, gameID)
                 if err != nil {
                     errors <- err
@@ -345,8 +858,8 @@ func TestDownloadService_ConcurrentStartDownload(t *testing.T) {
 
 func TestDownloadService_ConcurrentPauseResume(t *testing.T) {
     repo := newMemDownloadRepo()
-    stream := NewStreamService()
-    svc := NewDownloadService(nil, nil, repo, stream, mockLibrary{owned: true}, logger.New())
+    svc, storage := newTestDownloadService(repo, mockLibrary{owned: true})
+    svc.defaultSpeed = 64 * 1024 // keep downloads active while toggling
     ctx := context.Background()
     
     // Create initial downloads
@@ -356,6 +869,7 @@ func TestDownloadService_ConcurrentPauseResume(t *testing.T) {
     
     for i := 0; i < numDownloads; i++ {
         gameID := fmt.Sprintf("concurrent-game-%d", i)
+        seedGame(storage, gameID)
         d, err := svc.StartDownload(ctx, userID, gameID)
         if err != nil {
             t.Fatal(err)
@@ -408,12 +922,12 @@ func TestDownloadService_ConcurrentPauseResume(t *testing.T) {
 
 func TestDownloadService_ConcurrentProgressUpdates(t *testing.T) {
     repo := newMemDownloadRepo()
-    stream := NewStreamService()
-    svc := NewDownloadService(nil, nil, repo, stream, mockLibrary{owned: true}, logger.New())
+    svc, storage := newTestDownloadService(repo, mockLibrary{owned: true})
     ctx := context.Background()
     
     userID := "progress-user"
     gameID := "progress-game"
+    seedGame(storage, gameID)
     d, err := svc.StartDownload(ctx, userID, gameID)
     if err != nil {
         t.Fatal(err)
@@ -463,12 +977,12 @@ func TestDownloadService_ConcurrentProgressUpdates(t *testing.T) {
 
 func TestDownloadService_ConcurrentAccessControl(t *testing.T) {
     repo := newMemDownloadRepo()
-    stream := NewStreamService()
-    svc := NewDownloadService(nil, nil, repo, stream, mockLibrary{owned: true}, logger.New())
+    svc, storage := newTestDownloadService(repo, mockLibrary{owned: true})
     ctx := context.Background()
     
     ownerID := "owner-user"
     gameID := "access-control-game"
+    seedGame(storage, gameID)
     d, err := svc.StartDownload(ctx, ownerID, gameID)
     if err != nil {
         t.Fatal(err)
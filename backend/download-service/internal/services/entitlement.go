@@ -0,0 +1,203 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	lib "download-service/internal/clients/library"
+	derr "download-service/internal/errors"
+	"download-service/internal/models"
+	"download-service/internal/repository"
+	"download-service/pkg/logger"
+)
+
+// DefaultOwnershipCacheTTL is how long an ownership re-check is trusted.
+const DefaultOwnershipCacheTTL = 30 * time.Second
+
+// RevocationStore records when a user lost a game, so every replica refuses
+// tokens issued before and stops trusting cached ownership.
+type RevocationStore interface {
+	Revoke(ctx context.Context, userID, gameID string, at time.Time, ttl time.Duration) error
+	RevokedAt(ctx context.Context, userID, gameID string) (time.Time, bool, error)
+}
+
+// EntitlementOptions configures ownership re-checks. Zero values keep the
+// in-process defaults.
+type EntitlementOptions struct {
+	CacheTTL    time.Duration // how long a re-check is trusted; DefaultOwnershipCacheTTL when zero
+	Revocations RevocationStore
+}
+
+// RevocationResult is what revoking an entitlement did.
+type RevocationResult struct {
+	Cancelled []string // downloads that were stopped
+}
+
+type ownershipEntry struct {
+	owned     bool
+	checkedAt time.Time
+}
+
+// entitlements caches ownership re-checks of existing downloads in process, on
+// top of whatever caching the library client does.
+type entitlements struct {
+	mu          sync.Mutex
+	cacheTTL    time.Duration
+	cache       map[string]ownershipEntry
+	revocations RevocationStore
+}
+
+func newEntitlements() *entitlements {
+	return &entitlements{
+		cacheTTL:    DefaultOwnershipCacheTTL,
+		cache:       make(map[string]ownershipEntry),
+		revocations: newLocalRevocations(),
+	}
+}
+
+func ownershipKey(userID, gameID string) string { return userID + "/" + gameID }
+
+// ConfigureEntitlements replaces the ownership cache lifetime and revocation store.
+func (s *DownloadService) ConfigureEntitlements(opts EntitlementOptions) {
+	s.entitlements.mu.Lock()
+	defer s.entitlements.mu.Unlock()
+	if opts.CacheTTL > 0 {
+		s.entitlements.cacheTTL = opts.CacheTTL
+	}
+	if opts.Revocations != nil {
+		s.entitlements.revocations = opts.Revocations
+	}
+}
+
+// revokedAt returns when the user last lost the game. Store errors are logged and
+// treated as no revocation; the library stays the source of truth.
+func (s *DownloadService) revokedAt(ctx context.Context, userID, gameID string) (time.Time, bool) {
+	at, ok, err := s.entitlements.revocations.RevokedAt(ctx, userID, gameID)
+	if err != nil {
+		logger.Error(s.logger, "read entitlement revocation failed", "error", err, "userID", userID, "gameID", gameID)
+		return time.Time{}, false
+	}
+	return at, ok
+}
+
+// ownsGame re-checks that the user still owns the game, trusting a recent answer
+// unless the entitlement was revoked since.
+func (s *DownloadService) ownsGame(ctx context.Context, userID, gameID string) (bool, error) {
+	key := ownershipKey(userID, gameID)
+	revoked, isRevoked := s.revokedAt(ctx, userID, gameID)
+	e := s.entitlements
+	e.mu.Lock()
+	entry, ok := e.cache[key]
+	fresh := ok && time.Since(entry.checkedAt) < e.cacheTTL && (!isRevoked || entry.checkedAt.After(revoked))
+	e.mu.Unlock()
+	if fresh {
+		return entry.owned, nil
+	}
+
+	owned, err := s.library.CheckOwnership(ctx, userID, gameID)
+	if err != nil {
+		logger.Error(s.logger, "library ownership re-check failed", "error", err, "userID", userID, "gameID", gameID)
+		return false, err
+	}
+	e.mu.Lock()
+	e.cache[key] = ownershipEntry{owned: owned, checkedAt: time.Now()}
+	e.mu.Unlock()
+	return owned, nil
+}
+
+// requireOwnership fails with AccessDeniedError if the user no longer owns the game.
+func (s *DownloadService) requireOwnership(ctx context.Context, userID, gameID string) error {
+	owned, err := s.ownsGame(ctx, userID, gameID)
+	if err != nil {
+		return err
+	}
+	if !owned {
+		err := derr.AccessDeniedError{Reason: "game not owned"}
+		logger.Info(s.logger, "user no longer owns game", "error", err, "userID", userID, "gameID", gameID)
+		return err
+	}
+	return nil
+}
+
+// CheckEntitlement fails with AccessDeniedError if the owner of d no longer owns its game.
+func (s *DownloadService) CheckEntitlement(ctx context.Context, d *models.Download) error {
+	return s.requireOwnership(ctx, d.UserID, d.GameID)
+}
+
+// RevokeEntitlement handles the library revoking a user's game, e.g. after a
+// refund or chargeback: tokens issued until now stop working and the user's
+// unfinished downloads of the game are cancelled. Revoking twice is harmless.
+func (s *DownloadService) RevokeEntitlement(ctx context.Context, userID, gameID, reason string) (*RevocationResult, error) {
+	// Kept as long as the longest-lived token issued before it.
+	if err := s.entitlements.revocations.Revoke(ctx, userID, gameID, time.Now(), MaxTokenTTL); err != nil {
+		return nil, err
+	}
+	s.entitlements.mu.Lock()
+	s.entitlements.cache[ownershipKey(userID, gameID)] = ownershipEntry{owned: false, checkedAt: time.Now()}
+	s.entitlements.mu.Unlock()
+	if inv, ok := s.library.(lib.Invalidator); ok {
+		if err := inv.Invalidate(ctx, userID, gameID); err != nil {
+			logger.Error(s.logger, "invalidate cached ownership failed", "error", err, "userID", userID, "gameID", gameID)
+		}
+	}
+
+	list, err := s.repo.List(ctx, repository.DownloadFilter{UserID: userID, GameID: gameID})
+	if err != nil {
+		return nil, err
+	}
+	why := "entitlement revoked"
+	if reason != "" {
+		why += ": " + reason
+	}
+	res := &RevocationResult{Cancelled: []string{}}
+	for i := range list {
+		d := &list[i]
+		if !models.CanTransition(d.Status, models.StatusCancelled) {
+			continue
+		}
+		if err := s.stop(ctx, d, models.StatusCancelled, models.ActorEntitlement, why); err != nil {
+			return res, err
+		}
+		res.Cancelled = append(res.Cancelled, d.ID)
+	}
+	logger.Info(s.logger, "entitlement revoked", "userID", userID, "gameID", gameID, "cancelled", len(res.Cancelled))
+	return res, nil
+}
+
+// localRevocations keeps revocations in process memory, for a single replica.
+type localRevocations struct {
+	mu sync.Mutex
+	m  map[string]localRevocation
+}
+
+type localRevocation struct {
+	at      time.Time
+	expires time.Time
+}
+
+func newLocalRevocations() *localRevocations {
+	return &localRevocations{m: make(map[string]localRevocation)}
+}
+
+func (r *localRevocations) Revoke(ctx context.Context, userID, gameID string, at time.Time, ttl time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.m[ownershipKey(userID, gameID)] = localRevocation{at: at, expires: time.Now().Add(ttl)}
+	return nil
+}
+
+func (r *localRevocations) RevokedAt(ctx context.Context, userID, gameID string) (time.Time, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := ownershipKey(userID, gameID)
+	rev, ok := r.m[key]
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	if time.Now().After(rev.expires) {
+		delete(r.m, key)
+		return time.Time{}, false, nil
+	}
+	return rev.at, true, nil
+}
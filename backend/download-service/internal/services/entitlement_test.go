@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	derr "download-service/internal/errors"
+	"download-service/internal/models"
+	"github.com/stretchr/testify/require"
+)
+
+// countingLibrary answers ownership checks from a switch and counts them.
+type countingLibrary struct {
+	owned atomic.Bool
+	calls atomic.Int32
+}
+
+func (l *countingLibrary) CheckOwnership(ctx context.Context, userID, gameID string) (bool, error) {
+	l.calls.Add(1)
+	return l.owned.Load(), nil
+}
+
+func (l *countingLibrary) ListUserGames(ctx context.Context, userID string) ([]string, error) {
+	return nil, nil
+}
+
+func (l *countingLibrary) CheckOwnershipBatch(ctx context.Context, userID string, gameIDs []string) (map[string]bool, error) {
+	out := make(map[string]bool, len(gameIDs))
+	for _, id := range gameIDs {
+		out[id], _ = l.CheckOwnership(ctx, userID, id)
+	}
+	return out, nil
+}
+
+func TestEntitlement_RevokeStopsDownloadsAndTokens(t *testing.T) {
+	library := &countingLibrary{}
+	library.owned.Store(true)
+	repo := newMemDownloadRepo()
+	svc, storage := newTestDownloadService(repo, library)
+	svc.ConfigureTokens(TokenOptions{Secret: []byte("0123456789abcdef0123456789abcdef")})
+	gameID := "e9000000-0000-0000-0000-000000000001"
+	userID := "e9000000-0000-0000-0000-0000000000a1"
+	seedGame(storage, gameID)
+	ctx := context.Background()
+
+	// One finished install with a token for its file, one download still running.
+	done, err := svc.StartDownload(ctx, userID, gameID)
+	require.NoError(t, err)
+	requireStatus(t, repo, done.ID, models.StatusCompleted)
+	files, err := svc.fileRepo.ListByDownload(ctx, done.ID)
+	require.NoError(t, err)
+	tok, err := svc.IssueDownloadToken(ctx, userID, done.ID, "203.0.113.7", TokenScope{FileID: files[0].ID})
+	require.NoError(t, err)
+	_, err = svc.VerifyDownloadToken(ctx, tok.Token, done.ID, files[0].ID, "203.0.113.7")
+	require.NoError(t, err)
+
+	svc.defaultSpeed = 16 * 1024
+	running, err := svc.StartDownload(ctx, userID, gameID)
+	require.NoError(t, err)
+	t.Cleanup(func() { svc.stream.Stop(running.ID) })
+
+	res, err := svc.RevokeEntitlement(ctx, userID, gameID, "refund")
+	require.NoError(t, err)
+	require.Equal(t, []string{running.ID}, res.Cancelled)
+	requireStatus(t, repo, running.ID, models.StatusCancelled)
+	requireStatus(t, repo, done.ID, models.StatusCompleted)
+	history, err := svc.DownloadHistory(ctx, userID, running.ID)
+	require.NoError(t, err)
+	last := history[len(history)-1]
+	require.Equal(t, models.ActorEntitlement, last.Actor)
+	require.Equal(t, "entitlement revoked: refund", last.Reason)
+
+	// Tokens issued before the revocation are dead, even while the library still
+	// reports the game as owned.
+	_, err = svc.VerifyDownloadToken(ctx, tok.Token, done.ID, files[0].ID, "203.0.113.7")
+	var invalid derr.InvalidTokenError
+	require.True(t, errors.As(err, &invalid))
+	require.Equal(t, "revoked", invalid.Reason)
+	require.True(t, errors.As(svc.CheckEntitlement(ctx, done), &derr.AccessDeniedError{}))
+
+	// Redelivered events change nothing.
+	res, err = svc.RevokeEntitlement(ctx, userID, gameID, "refund")
+	require.NoError(t, err)
+	require.Empty(t, res.Cancelled)
+}
+
+func TestEntitlement_ResumeRechecksOwnership(t *testing.T) {
+	library := &countingLibrary{}
+	library.owned.Store(true)
+	repo := newMemDownloadRepo()
+	svc, storage := newTestDownloadService(repo, library)
+	svc.defaultSpeed = 16 * 1024
+	gameID := "e9000000-0000-0000-0000-000000000002"
+	userID := "e9000000-0000-0000-0000-0000000000a2"
+	seedGame(storage, gameID)
+	ctx := context.Background()
+
+	d, err := svc.StartDownload(ctx, userID, gameID)
+	require.NoError(t, err)
+	t.Cleanup(func() { svc.stream.Stop(d.ID) })
+	require.NoError(t, svc.PauseDownload(ctx, userID, d.ID))
+	require.Equal(t, int32(1), library.calls.Load())
+
+	// Refunded without an event reaching this service.
+	library.owned.Store(false)
+	err = svc.ResumeDownload(ctx, userID, d.ID)
+	require.True(t, errors.As(err, &derr.AccessDeniedError{}))
+	requireStatus(t, repo, d.ID, models.StatusPaused)
+	require.Equal(t, int32(2), library.calls.Load())
+
+	// The answer is cached for a while.
+	require.Error(t, svc.CheckEntitlement(ctx, d))
+	require.Equal(t, int32(2), library.calls.Load())
+
+	svc.ConfigureEntitlements(EntitlementOptions{CacheTTL: time.Nanosecond})
+	library.owned.Store(true)
+	require.NoError(t, svc.CheckEntitlement(ctx, d))
+	require.Equal(t, int32(3), library.calls.Load())
+}
@@ -0,0 +1,254 @@
+package services
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"download-service/internal/cache"
+	derr "download-service/internal/errors"
+	"download-service/internal/models"
+	"download-service/pkg/logger"
+)
+
+// EventLog stores the event history subscribers read from. Event IDs are ordered
+// within a stream and have the Redis stream ID form "<ms>-<seq>".
+type EventLog interface {
+	Append(ctx context.Context, streams []string, ev cache.DownloadEvent) error
+	Last(ctx context.Context, stream string) (string, error)
+	Read(ctx context.Context, stream, after string, block time.Duration) ([]cache.DownloadEvent, error)
+}
+
+const (
+	// eventReadBlock bounds how long one read waits, so a closed subscriber is noticed.
+	eventReadBlock = 5 * time.Second
+	eventRetryWait = time.Second
+	// eventSnapshotLimit bounds the downloads described when a user stream opens.
+	eventSnapshotLimit = 50
+)
+
+var eventIDPattern = regexp.MustCompile(`^\d+-\d+$`)
+
+// publish appends ev to the download's stream and its owner's stream. Event
+// delivery is best effort and never fails the operation that produced it.
+func (s *DownloadService) publish(ctx context.Context, userID string, ev cache.DownloadEvent) {
+	ev.UserID = userID
+	ev.AtUnixMilli = time.Now().UnixMilli()
+	streams := []string{cache.DownloadEventsKey(ev.DownloadID), cache.UserDownloadEventsKey(userID)}
+	if err := s.events.Append(ctx, streams, ev); err != nil {
+		logger.Error(s.logger, "publish download event failed", "error", err, "downloadID", ev.DownloadID, "type", ev.Type)
+	}
+}
+
+// publishStatus announces that d moved to d.Status.
+func (s *DownloadService) publishStatus(ctx context.Context, d *models.Download) {
+	s.publish(ctx, d.UserID, statusEvent(d))
+}
+
+func statusEvent(d *models.Download) cache.DownloadEvent {
+	return cache.DownloadEvent{
+		Type:           cache.EventStatus,
+		DownloadID:     d.ID,
+		Status:         string(d.Status),
+		Progress:       d.Progress,
+		DownloadedSize: d.DownloadedSize,
+		TotalSize:      d.TotalSize,
+		Speed:          d.Speed,
+		Error:          d.FailureReason,
+	}
+}
+
+// DownloadEvents streams the events of one download until ctx is cancelled. With
+// an empty lastEventID the stream opens with the download's current state;
+// otherwise it replays the retained events after lastEventID.
+func (s *DownloadService) DownloadEvents(ctx context.Context, userID, downloadID, lastEventID string) (<-chan cache.DownloadEvent, error) {
+	if err := validateEventID(lastEventID); err != nil {
+		return nil, err
+	}
+	d, err := s.GetDownload(ctx, userID, downloadID)
+	if err != nil {
+		return nil, err
+	}
+	stream := cache.DownloadEventsKey(downloadID)
+	return s.subscribe(ctx, stream, lastEventID, func() []cache.DownloadEvent {
+		// Read the row again: the first read happened before the stream position was taken.
+		if fresh, err := s.repo.GetByID(ctx, downloadID); err == nil {
+			d = fresh
+		}
+		return []cache.DownloadEvent{s.snapshotEvent(ctx, d)}
+	})
+}
+
+// UserDownloadEvents streams the events of every download of userID until ctx is
+// cancelled, opening with the state of its unfinished downloads when lastEventID is empty.
+func (s *DownloadService) UserDownloadEvents(ctx context.Context, userID, lastEventID string) (<-chan cache.DownloadEvent, error) {
+	if err := validateEventID(lastEventID); err != nil {
+		return nil, err
+	}
+	stream := cache.UserDownloadEventsKey(userID)
+	return s.subscribe(ctx, stream, lastEventID, func() []cache.DownloadEvent {
+		list, err := s.repo.ListByUser(ctx, userID, eventSnapshotLimit, 0)
+		if err != nil {
+			logger.Error(s.logger, "list downloads for event snapshot failed", "error", err, "userID", userID)
+			return nil
+		}
+		var out []cache.DownloadEvent
+		for i := range list {
+			switch list[i].Status {
+			case models.StatusPending, models.StatusDownloading, models.StatusPaused:
+				out = append(out, s.snapshotEvent(ctx, &list[i]))
+			}
+		}
+		return out
+	})
+}
+
+// snapshotEvent describes the current state of d, preferring the live progress
+// the transfer caches over the periodically persisted row.
+func (s *DownloadService) snapshotEvent(ctx context.Context, d *models.Download) cache.DownloadEvent {
+	ev := statusEvent(d)
+	ev.UserID = d.UserID
+	ev.AtUnixMilli = time.Now().UnixMilli()
+	if s.rdb != nil {
+		if stat, _ := cache.GetDownloadStatus(ctx, s.rdb, d.ID); stat != nil {
+			ev.Progress = stat.Progress
+			ev.DownloadedSize = stat.DownloadedSize
+			ev.TotalSize = stat.TotalSize
+			ev.Speed = stat.Speed
+		}
+	}
+	return ev
+}
+
+// subscribe pumps stream into a channel. Without lastEventID the current stream
+// position is taken before the snapshot is built, so no event is lost between them.
+func (s *DownloadService) subscribe(ctx context.Context, stream, lastEventID string, snapshot func() []cache.DownloadEvent) (<-chan cache.DownloadEvent, error) {
+	after := lastEventID
+	var initial []cache.DownloadEvent
+	if after == "" {
+		last, err := s.events.Last(ctx, stream)
+		if err != nil {
+			return nil, err
+		}
+		after = last
+		initial = snapshot()
+	}
+
+	out := make(chan cache.DownloadEvent)
+	go func() {
+		defer close(out)
+		send := func(ev cache.DownloadEvent) bool {
+			select {
+			case out <- ev:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+		for _, ev := range initial {
+			if !send(ev) {
+				return
+			}
+		}
+		for ctx.Err() == nil {
+			evs, err := s.events.Read(ctx, stream, after, eventReadBlock)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				logger.Error(s.logger, "read download events failed", "error", err, "stream", stream)
+				if sleepCtx(ctx, eventRetryWait) != nil {
+					return
+				}
+				continue
+			}
+			for _, ev := range evs {
+				if !send(ev) {
+					return
+				}
+				after = ev.ID
+			}
+		}
+	}()
+	return out, nil
+}
+
+func validateEventID(id string) error {
+	if id != "" && !eventIDPattern.MatchString(id) {
+		return derr.ValidationError{Msg: "invalid Last-Event-ID"}
+	}
+	return nil
+}
+
+// localEventLog is the in-process EventLog used when no cluster is configured.
+type localEventLog struct {
+	mu      sync.Mutex
+	seq     uint64
+	streams map[string][]cache.DownloadEvent
+	changed chan struct{} // closed and replaced on every append
+}
+
+func newLocalEventLog() *localEventLog {
+	return &localEventLog{streams: make(map[string][]cache.DownloadEvent), changed: make(chan struct{})}
+}
+
+func (l *localEventLog) Append(ctx context.Context, streams []string, ev cache.DownloadEvent) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, stream := range streams {
+		l.seq++
+		ev.ID = strconv.FormatUint(l.seq, 10) + "-0"
+		list := append(l.streams[stream], ev)
+		if len(list) > 1000 {
+			list = list[len(list)-1000:]
+		}
+		l.streams[stream] = list
+	}
+	close(l.changed)
+	l.changed = make(chan struct{})
+	return nil
+}
+
+func (l *localEventLog) Last(ctx context.Context, stream string) (string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if list := l.streams[stream]; len(list) > 0 {
+		return list[len(list)-1].ID, nil
+	}
+	return "0-0", nil
+}
+
+func (l *localEventLog) Read(ctx context.Context, stream, after string, block time.Duration) ([]cache.DownloadEvent, error) {
+	min := localEventSeq(after)
+	timer := time.NewTimer(block)
+	defer timer.Stop()
+	for {
+		l.mu.Lock()
+		var out []cache.DownloadEvent
+		for _, ev := range l.streams[stream] {
+			if localEventSeq(ev.ID) > min {
+				out = append(out, ev)
+			}
+		}
+		changed := l.changed
+		l.mu.Unlock()
+		if len(out) > 0 {
+			return out, nil
+		}
+		select {
+		case <-changed:
+		case <-timer.C:
+			return nil, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func localEventSeq(id string) uint64 {
+	n, _ := strconv.ParseUint(strings.SplitN(id, "-", 2)[0], 10, 64)
+	return n
+}
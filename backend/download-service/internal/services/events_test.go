@@ -0,0 +1,134 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"download-service/internal/cache"
+	derr "download-service/internal/errors"
+	"download-service/internal/models"
+	"github.com/stretchr/testify/require"
+)
+
+// nextEvent waits for the next event of ch.
+func nextEvent(t *testing.T, ch <-chan cache.DownloadEvent) cache.DownloadEvent {
+	t.Helper()
+	select {
+	case ev, ok := <-ch:
+		require.True(t, ok, "event stream closed")
+		return ev
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event received")
+		return cache.DownloadEvent{}
+	}
+}
+
+// eventUntil reads ch until an event of the given type and status arrives.
+func eventUntil(t *testing.T, ch <-chan cache.DownloadEvent, typ, status string) []cache.DownloadEvent {
+	t.Helper()
+	var seen []cache.DownloadEvent
+	for {
+		ev := nextEvent(t, ch)
+		seen = append(seen, ev)
+		if ev.Type == typ && ev.Status == status {
+			return seen
+		}
+	}
+}
+
+func TestDownloadEvents_StreamsProgressAndStatus(t *testing.T) {
+	svc, storage := newTestDownloadService(newMemDownloadRepo(), mockLibrary{owned: true})
+	svc.defaultSpeed = 256 * 1024
+	userID := "e1000000-0000-0000-0000-000000000001"
+	gameID := "e1000000-0000-0000-0000-000000000002"
+	seedGame(storage, gameID)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d, err := svc.StartDownload(ctx, userID, gameID)
+	require.NoError(t, err)
+	events, err := svc.DownloadEvents(ctx, userID, d.ID, "")
+	require.NoError(t, err)
+
+	snapshot := nextEvent(t, events)
+	require.Equal(t, cache.EventStatus, snapshot.Type)
+	require.Empty(t, snapshot.ID, "snapshots are not part of the replayable history")
+	require.Equal(t, d.ID, snapshot.DownloadID)
+
+	seen := eventUntil(t, events, cache.EventStatus, string(models.StatusCompleted))
+	require.Greater(t, len(seen), 1)
+	require.Equal(t, cache.EventProgress, seen[0].Type)
+	last := seen[len(seen)-1]
+	require.Equal(t, 100, last.Progress)
+	require.Equal(t, int64(testGameSize), last.DownloadedSize)
+	for _, ev := range seen {
+		require.NotEmpty(t, ev.ID)
+		require.Equal(t, userID, ev.UserID)
+	}
+}
+
+func TestDownloadEvents_ResumesAfterLastEventID(t *testing.T) {
+	svc, storage := newTestDownloadService(newMemDownloadRepo(), mockLibrary{owned: true})
+	svc.defaultSpeed = 0
+	userID := "e1000000-0000-0000-0000-000000000003"
+	gameID := "e1000000-0000-0000-0000-000000000004"
+	seedGame(storage, gameID)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d, err := svc.StartDownload(ctx, userID, gameID)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		got, _ := svc.repo.GetByID(ctx, d.ID)
+		return got.Status == models.StatusCompleted
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Replay the whole history, then resume from the middle of it.
+	all, err := svc.DownloadEvents(ctx, userID, d.ID, "0-0")
+	require.NoError(t, err)
+	history := eventUntil(t, all, cache.EventStatus, string(models.StatusCompleted))
+	require.Equal(t, string(models.StatusDownloading), history[0].Status)
+	require.GreaterOrEqual(t, len(history), 3)
+
+	from := history[len(history)-3]
+	resumed, err := svc.DownloadEvents(ctx, userID, d.ID, from.ID)
+	require.NoError(t, err)
+	require.Equal(t, history[len(history)-2].ID, nextEvent(t, resumed).ID)
+	require.Equal(t, history[len(history)-1].ID, nextEvent(t, resumed).ID)
+}
+
+func TestDownloadEvents_Validation(t *testing.T) {
+	repo := newMemDownloadRepo()
+	svc, _ := newTestDownloadService(repo, mockLibrary{owned: true})
+	require.NoError(t, repo.Create(context.Background(), &models.Download{ID: "dl-events", UserID: "e1000000-0000-0000-0000-000000000005"}))
+
+	_, err := svc.DownloadEvents(context.Background(), "e1000000-0000-0000-0000-000000000005", "dl-events", "not-an-id")
+	require.True(t, errors.As(err, &derr.ValidationError{}))
+	_, err = svc.DownloadEvents(context.Background(), "e1000000-0000-0000-0000-000000000006", "dl-events", "")
+	require.True(t, errors.As(err, &derr.AccessDeniedError{}))
+}
+
+func TestUserDownloadEvents_ReceivesStatusTransitions(t *testing.T) {
+	svc, storage := newTestDownloadService(newMemDownloadRepo(), mockLibrary{owned: true})
+	svc.defaultSpeed = 16 * 1024
+	userID := "e1000000-0000-0000-0000-000000000007"
+	gameID := "e1000000-0000-0000-0000-000000000008"
+	seedGame(storage, gameID)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d, err := svc.StartDownload(ctx, userID, gameID)
+	require.NoError(t, err)
+	events, err := svc.UserDownloadEvents(ctx, userID, "")
+	require.NoError(t, err)
+	snapshot := nextEvent(t, events)
+	require.Equal(t, d.ID, snapshot.DownloadID)
+	require.Equal(t, string(models.StatusDownloading), snapshot.Status)
+
+	require.NoError(t, svc.PauseDownload(ctx, userID, d.ID))
+	eventUntil(t, events, cache.EventStatus, string(models.StatusPaused))
+	require.NoError(t, svc.CancelDownload(ctx, userID, d.ID))
+	eventUntil(t, events, cache.EventStatus, string(models.StatusCancelled))
+}
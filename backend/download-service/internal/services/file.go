@@ -18,26 +18,95 @@ const tempPrefixTemplate = "temp/%s/"
 // FileService handles file-related operations, such as generating download URLs.
 type FileService struct {
     storage s3.Interface
+    urls    URLOptions
 }
 
 // NewFileService creates a new FileService.
 func NewFileService(storage s3.Interface) *FileService {
-    return &FileService{storage: storage}
+    s := &FileService{storage: storage}
+    s.ConfigureURLs(URLOptions{})
+    return s
+}
+
+const gameArchiveName = "game.zip"
+
+// GameFile describes a single file of a game build and where its bytes come from.
+type GameFile struct {
+    Path      string // install path relative to the game root
+    ObjectKey string // whole-file object; empty when the file is assembled from Segments
+    Size      int64  // bytes to transfer
+    SHA256    string // expected content digest; empty for legacy single-archive builds
+    Segments  []FileSegment
 }
 
 func objectKeyForGame(gameID string) string {
-    return fmt.Sprintf("games/%s/game.zip", gameID)
+    return fmt.Sprintf("games/%s/%s", gameID, gameArchiveName)
+}
+
+// ResolveGameFiles returns the storage objects that must be transferred to install
+// the current build of a game.
+func (s *FileService) ResolveGameFiles(ctx context.Context, gameID string) ([]GameFile, error) {
+    plan, err := s.PlanFull(ctx, gameID, "")
+    if err != nil {
+        return nil, err
+    }
+    return plan.Files, nil
+}
+
+// FileURL is a signed URL of one file of a download.
+type FileURL struct {
+    Path string
+    Size int64
+    URL  string
+}
+
+// GetDownloadURLs generates signed URLs of the objects the download transfers,
+// resolved from its build version the way the transfer engine resolves them.
+// URLs are served from an origin in the client's region when the signer can
+// choose one, and larger games get longer-lived URLs.
+func (s *FileService) GetDownloadURLs(ctx context.Context, download *models.Download, region string) ([]FileURL, error) {
+    var plan *BuildPlan
+    var err error
+    if download.Type == models.DownloadTypeUpdate {
+        plan, err = s.PlanUpdate(ctx, download.GameID, download.FromVersion, download.Version)
+    } else {
+        plan, err = s.PlanFull(ctx, download.GameID, download.Version)
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    lifetime := s.urlTTL(download.TotalSize)
+    urls := make([]FileURL, 0, len(plan.Files))
+    for _, f := range plan.Files {
+        if f.Size == 0 {
+            continue
+        }
+        if f.ObjectKey == "" {
+            return nil, derr.ValidationError{Msg: "files of chunked builds have no single object to sign; request a download token"}
+        }
+        url, err := s.urls.Signer.SignURL(ctx, f.ObjectKey, lifetime, region)
+        if err != nil {
+            return nil, fmt.Errorf("could not sign download URL: %w", err)
+        }
+        urls = append(urls, FileURL{Path: f.Path, Size: f.Size, URL: url})
+    }
+    return urls, nil
 }
 
-// GetDownloadURL generates a presigned URL for a given download.
-func (s *FileService) GetDownloadURL(ctx context.Context, download *models.Download) (string, error) {
-    objectKey := objectKeyForGame(download.GameID)
+// ObjectContent is an open, seekable view of a stored object together with its metadata.
+type ObjectContent struct {
+    Reader *s3.ObjectReader
+    Info   s3.ObjectInfo
+}
 
-    url, err := s.storage.GetPresignedURL(ctx, objectKey, presignedURLLifetime)
+// OpenObject stats the object and returns a seekable reader suitable for serving byte ranges.
+func (s *FileService) OpenObject(ctx context.Context, objectKey string) (*ObjectContent, error) {
+    info, err := s.storage.StatObject(ctx, objectKey)
     if err != nil {
-        return "", fmt.Errorf("could not get presigned URL: %w", err)
+        return nil, fmt.Errorf("stat object: %w", err)
     }
-    return url, nil
+    return &ObjectContent{Reader: s3.NewObjectReader(ctx, s.storage, objectKey, info.Size), Info: info}, nil
 }
 
 // VerifyFile checks object metadata to ensure the expected size matches the stored file.
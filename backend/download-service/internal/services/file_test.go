@@ -2,7 +2,9 @@ package services
 
 import (
     "context"
+    "errors"
     "fmt"
+    "io"
     "sync"
     "testing"
 
@@ -33,15 +35,71 @@ func TestFileService_VerifyAndCleanup(t *testing.T) {
     require.NoError(t, fileSvc.CleanupFiles(context.Background(), "download-1"))
 }
 
-func TestFileService_GetDownloadURL(t *testing.T) {
+func TestFileService_GetDownloadURLs(t *testing.T) {
     mock := s3.NewMockClient()
     fileSvc := NewFileService(mock)
     download := &models.Download{GameID: "bbbbbbbb-bbbb-bbbb-bbbb-bbbbbbbbbbbb"}
 
-    url, err := fileSvc.GetDownloadURL(context.Background(), download)
+    _, err := fileSvc.GetDownloadURLs(context.Background(), download, "")
+    require.IsType(t, derr.GameBuildNotFoundError{}, err, "no URL to a missing object")
+
+    seedGame(mock, download.GameID)
+    urls, err := fileSvc.GetDownloadURLs(context.Background(), download, "")
+    require.NoError(t, err)
+    require.Len(t, urls, 1)
+    require.Contains(t, urls[0].URL, "/games/")
+    require.Contains(t, urls[0].URL, "expires_in")
+}
+
+func TestFileService_GetDownloadURLsOfManifestBuild(t *testing.T) {
+    mock := s3.NewMockClient()
+    fileSvc := NewFileService(mock)
+    gameID := "cccccccc-cccc-cccc-cccc-cccccccccccc"
+    m := putManifest(t, mock, gameID, map[string][]byte{"bin/game": []byte("binary"), "data/assets.pak": []byte("assets")})
+
+    urls, err := fileSvc.GetDownloadURLs(context.Background(), &models.Download{GameID: gameID}, "")
+    require.NoError(t, err)
+    require.Len(t, urls, 2)
+    for i, u := range urls {
+        require.Equal(t, m.Files[i].Path, u.Path)
+        require.Contains(t, u.URL, m.Files[i].objectKey(gameID))
+        require.NotContains(t, u.URL, gameArchiveName)
+    }
+
+    // Chunked builds have no whole-file objects to sign.
+    putChunkedVersion(t, mock, gameID, "2.0", false, chunkedFile{"bin/game", [][]byte{[]byte("chunk")}})
+    _, err = fileSvc.GetDownloadURLs(context.Background(), &models.Download{GameID: gameID, Version: "2.0"}, "")
+    require.IsType(t, derr.ValidationError{}, err)
+}
+
+func TestFileService_OpenObjectRanges(t *testing.T) {
+    mock := s3.NewMockClient()
+    fileSvc := NewFileService(mock)
+    content := []byte("0123456789abcdefghij")
+    mock.PutObject("games/x/game.zip", int64(len(content)), content)
+
+    obj, err := fileSvc.OpenObject(context.Background(), "games/x/game.zip")
+    require.NoError(t, err)
+    defer obj.Reader.Close()
+    require.Equal(t, int64(len(content)), obj.Info.Size)
+    require.NotEmpty(t, obj.Info.ETag)
+
+    _, err = obj.Reader.Seek(10, io.SeekStart)
+    require.NoError(t, err)
+    buf := make([]byte, 5)
+    _, err = io.ReadFull(obj.Reader, buf)
     require.NoError(t, err)
-    require.Contains(t, url, "/games/")
-    require.Contains(t, url, "expires_in")
+    require.Equal(t, "abcde", string(buf))
+
+    end, err := obj.Reader.Seek(-3, io.SeekEnd)
+    require.NoError(t, err)
+    require.Equal(t, int64(17), end)
+    rest, err := io.ReadAll(obj.Reader)
+    require.NoError(t, err)
+    require.Equal(t, "hij", string(rest))
+
+    _, err = fileSvc.OpenObject(context.Background(), "games/missing/game.zip")
+    require.True(t, errors.Is(err, s3.ErrNotFound))
 }
 
 // FileServiceSuite provides comprehensive testing with testify/suite
@@ -58,12 +116,13 @@ func (s *FileServiceSuite) SetupTest() {
 
 func (s *FileServiceSuite) TestGetDownloadURL_Success() {
     download := &models.Download{GameID: "test-game-id"}
+    seedGame(s.mockStorage, download.GameID)
     
-    url, err := s.service.GetDownloadURL(context.Background(), download)
+    urls, err := s.service.GetDownloadURLs(context.Background(), download, "")
     
-    s.NoError(err)
-    s.Contains(url, "games/test-game-id/game.zip")
-    s.Contains(url, "expires_in")
+    s.Require().NoError(err)
+    s.Contains(urls[0].URL, "games/test-game-id/game.zip")
+    s.Contains(urls[0].URL, "expires_in")
 }
 
 func (s *FileServiceSuite) TestVerifyFile_Success() {
@@ -136,11 +195,12 @@ func BenchmarkFileService_GetDownloadURL(b *testing.B) {
     mock := s3.NewMockClient()
     service := NewFileService(mock)
     download := &models.Download{GameID: "benchmark-game-id"}
+    seedGame(mock, download.GameID)
     ctx := context.Background()
     
     b.ResetTimer()
     for i := 0; i < b.N; i++ {
-        _, err := service.GetDownloadURL(ctx, download)
+        _, err := service.GetDownloadURLs(ctx, download, "")
         if err != nil {
             b.Fatal(err)
         }
@@ -203,6 +263,9 @@ func TestFileService_ConcurrentGetDownloadURL(t *testing.T) {
     
     const numGoroutines = 100
     const numOperations = 10
+    for j := 0; j < numOperations; j++ {
+        seedGame(mock, fmt.Sprintf("game-%d", j))
+    }
     
     var wg sync.WaitGroup
     errors := make(chan error, numGoroutines*numOperations)
@@ -212,8 +275,8 @@ func TestFileService_ConcurrentGetDownloadURL(t *testing.T) {
         go func(id int) {
             defer wg.Done()
             for j := 0; j < numOperations; j++ {
-                download := &models.Download{GameID: fmt.Sprintf("game-%d-%d", id, j)}
-                _, err := service.GetDownloadURL(ctx, download)
+                download := &models.Download{GameID: fmt.Sprintf("game-%d", j)}
+                _, err := service.GetDownloadURLs(ctx, download, "")
                 if err != nil {
                     errors <- err
                     return
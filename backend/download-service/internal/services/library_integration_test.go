@@ -3,10 +3,12 @@ package services
 import (
 	"context"
 	"errors"
+	"fmt"
 	"testing"
 	"time"
 
 	"download-service/internal/clients/library"
+	"download-service/internal/clients/s3"
 	derr "download-service/internal/errors"
 	"download-service/internal/models"
 	"download-service/pkg/logger"
@@ -16,22 +18,27 @@ import (
 type LibraryIntegrationTestSuite struct {
 	suite.Suite
 	repo         *memDownloadRepo
-	stream       *StreamService
+	storage      *s3.MockClient
 	mockLibrary  *library.MockClient
 	svc          *DownloadService
 }
 
 func (s *LibraryIntegrationTestSuite) SetupTest() {
 	s.repo = newMemDownloadRepo()
-	s.stream = NewStreamService()
 	s.mockLibrary = library.NewMockClient()
 	
 	// Wrap with instrumentation
 	instrumentedLibrary := library.NewInstrumentedClient(s.mockLibrary, logger.New())
 	
-	s.svc = NewDownloadService(nil, nil, s.repo, s.stream, instrumentedLibrary, logger.New())
-	s.svc.defaultTotalSize = 1024 * 1024 // 1MB for faster tests
-	s.svc.defaultSpeed = 1024 * 1024     // 1MB/s for faster tests
+	s.svc, s.storage = newTestDownloadService(s.repo, instrumentedLibrary)
+	s.svc.defaultSpeed = 1024 * 1024 // 1MB/s for faster tests
+	// Any game the tests reference has a build in storage; ownership decides access.
+	for _, gameID := range []string{"game-456", "game-1", "game-2", "game-3", "game-4"} {
+		seedGame(s.storage, gameID)
+	}
+	for i := 0; i < 50; i++ {
+		seedGame(s.storage, "game-"+string(rune('a'+i)))
+	}
 }
 
 func (s *LibraryIntegrationTestSuite) TestStartDownload_OwnershipCheckSuccess() {
@@ -263,17 +270,22 @@ func (s *LibraryIntegrationTestSuite) TestLibraryServiceRetryBehavior() {
 
 func (s *LibraryIntegrationTestSuite) TestLibraryServicePerformance() {
 	userID := "perf-user"
-	gameID := "perf-game"
-	
-	// Setup: User owns the game
-	s.mockLibrary.SetUserGames(userID, []string{gameID})
 
 	// Measure performance of ownership checks
 	const numChecks = 100
+
+	// Setup: User owns the games; each can have only one unfinished download
+	gameIDs := make([]string, numChecks)
+	for i := range gameIDs {
+		gameIDs[i] = fmt.Sprintf("perf-game-%d", i)
+		seedGame(s.storage, gameIDs[i])
+	}
+	s.mockLibrary.SetUserGames(userID, gameIDs)
+
 	start := time.Now()
 	
 	for i := 0; i < numChecks; i++ {
-		_, err := s.svc.StartDownload(context.Background(), userID, gameID)
+		_, err := s.svc.StartDownload(context.Background(), userID, gameIDs[i])
 		s.Require().NoError(err)
 	}
 	
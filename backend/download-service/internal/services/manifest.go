@@ -0,0 +1,234 @@
+package services
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"download-service/internal/clients/s3"
+	derr "download-service/internal/errors"
+)
+
+const (
+	manifestName = "manifest.json"
+	// maxManifestSize bounds how much of a manifest object is read into memory.
+	maxManifestSize = 32 * 1024 * 1024
+)
+
+// Manifest describes every file that makes up a game build. The current build's
+// manifest is stored as JSON at games/{gameID}/manifest.json, next to the build's
+// files; every published version is also kept at games/{gameID}/versions/{version}/manifest.json.
+type Manifest struct {
+	GameID  string         `json:"gameId"`
+	BuildID string         `json:"buildId,omitempty"`
+	Version string         `json:"version,omitempty"`
+	Chunked bool           `json:"chunked,omitempty"` // files are assembled from the content-addressed chunk store
+	Files   []ManifestFile `json:"files"`
+}
+
+// ManifestFile is one installable file of a build.
+type ManifestFile struct {
+	Path   string          `json:"path"`             // install path relative to the game root
+	Size   int64           `json:"size"`
+	SHA256 string          `json:"sha256"`           // hex digest of the whole file
+	Object string          `json:"object,omitempty"` // object key relative to the game prefix; defaults to files/{path}
+	Chunks []ManifestChunk `json:"chunks,omitempty"`
+}
+
+// ManifestChunk is a contiguous byte range of a file together with its digest.
+type ManifestChunk struct {
+	Offset int64  `json:"offset"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+func manifestKeyForGame(gameID string) string {
+	return fmt.Sprintf("games/%s/%s", gameID, manifestName)
+}
+
+func manifestKeyForVersion(gameID, version string) string {
+	return fmt.Sprintf("games/%s/versions/%s/%s", gameID, version, manifestName)
+}
+
+// objectKey returns the storage key holding the file's bytes.
+func (f ManifestFile) objectKey(gameID string) string {
+	rel := f.Object
+	if rel == "" {
+		rel = path.Join("files", f.Path)
+	}
+	return fmt.Sprintf("games/%s/%s", gameID, cleanRelativePath(rel))
+}
+
+// TotalSize returns the sum of all file sizes in the manifest.
+func (m *Manifest) TotalSize() int64 {
+	var total int64
+	for _, f := range m.Files {
+		total += f.Size
+	}
+	return total
+}
+
+// Validate checks that paths are unique and stay inside the game root, that
+// digests are well formed and that chunk lists exactly cover their files.
+func (m *Manifest) Validate() error {
+	if len(m.Files) == 0 {
+		return errors.New("manifest lists no files")
+	}
+	seen := make(map[string]struct{}, len(m.Files))
+	for i, f := range m.Files {
+		clean := cleanRelativePath(f.Path)
+		if clean == "" || clean != f.Path {
+			return fmt.Errorf("file %d: invalid path %q", i, f.Path)
+		}
+		if _, dup := seen[clean]; dup {
+			return fmt.Errorf("file %d: duplicate path %q", i, f.Path)
+		}
+		seen[clean] = struct{}{}
+		if f.Size < 0 {
+			return fmt.Errorf("file %q: negative size", f.Path)
+		}
+		if !isSHA256Hex(f.SHA256) {
+			return fmt.Errorf("file %q: invalid sha256", f.Path)
+		}
+		if f.Object != "" && cleanRelativePath(f.Object) != f.Object {
+			return fmt.Errorf("file %q: invalid object %q", f.Path, f.Object)
+		}
+		if len(f.Chunks) == 0 {
+			if m.Chunked && f.Size > 0 {
+				return fmt.Errorf("file %q: chunked build lists no chunks", f.Path)
+			}
+			continue
+		}
+		var next int64
+		for j, c := range f.Chunks {
+			if c.Offset != next || c.Size <= 0 {
+				return fmt.Errorf("file %q: chunk %d does not continue at offset %d", f.Path, j, next)
+			}
+			if !isSHA256Hex(c.SHA256) {
+				return fmt.Errorf("file %q: chunk %d: invalid sha256", f.Path, j)
+			}
+			next += c.Size
+		}
+		if next != f.Size {
+			return fmt.Errorf("file %q: chunks cover %d of %d bytes", f.Path, next, f.Size)
+		}
+	}
+	return nil
+}
+
+func isSHA256Hex(s string) bool {
+	if len(s) != 64 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// ParseManifest decodes and validates a manifest document.
+func ParseManifest(data []byte) (*Manifest, error) {
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("decode manifest: %w", err)
+	}
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// LoadManifest reads the current build manifest for a game. It returns s3.ErrNotFound
+// (wrapped) when the game has no manifest and derr.ManifestInvalidError when
+// the stored document cannot be used.
+func (s *FileService) LoadManifest(ctx context.Context, gameID string) (*Manifest, error) {
+	return s.loadManifest(ctx, gameID, manifestKeyForGame(gameID))
+}
+
+// LoadManifestVersion reads the manifest of a specific build version; an empty
+// version means the current build. A version that was never archived under
+// versions/ is still found if it is the current build.
+func (s *FileService) LoadManifestVersion(ctx context.Context, gameID, version string) (*Manifest, error) {
+	if version == "" {
+		return s.LoadManifest(ctx, gameID)
+	}
+	if strings.ContainsAny(version, "/\\") || version == "." || version == ".." {
+		return nil, derr.ValidationError{Msg: fmt.Sprintf("invalid version %q", version)}
+	}
+	m, err := s.loadManifest(ctx, gameID, manifestKeyForVersion(gameID, version))
+	if !errors.Is(err, s3.ErrNotFound) {
+		return m, err
+	}
+	current, cerr := s.LoadManifest(ctx, gameID)
+	if cerr != nil || current.Version != version {
+		return nil, err
+	}
+	return current, nil
+}
+
+func (s *FileService) loadManifest(ctx context.Context, gameID, key string) (*Manifest, error) {
+	info, err := s.storage.StatObject(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("stat manifest: %w", err)
+	}
+	if info.Size <= 0 || info.Size > maxManifestSize {
+		return nil, derr.ManifestInvalidError{GameID: gameID, Reason: fmt.Sprintf("unexpected size %d", info.Size)}
+	}
+	rc, err := s.storage.GetObjectRange(ctx, key, 0, info.Size)
+	if err != nil {
+		return nil, fmt.Errorf("read manifest: %w", err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(io.LimitReader(rc, maxManifestSize))
+	if err != nil {
+		return nil, fmt.Errorf("read manifest: %w", err)
+	}
+
+	m, err := ParseManifest(data)
+	if err != nil {
+		return nil, derr.ManifestInvalidError{GameID: gameID, Reason: err.Error()}
+	}
+	if m.GameID != "" && m.GameID != gameID {
+		return nil, derr.ManifestInvalidError{GameID: gameID, Reason: fmt.Sprintf("manifest belongs to game %s", m.GameID)}
+	}
+	return m, nil
+}
+
+// gameFilesFromManifest expands a manifest into the objects the transfer engine copies.
+func gameFilesFromManifest(gameID string, m *Manifest) []GameFile {
+	files := make([]GameFile, 0, len(m.Files))
+	for _, f := range m.Files {
+		if m.Chunked {
+			files = append(files, chunkedGameFile(f, f.Chunks))
+			continue
+		}
+		files = append(files, wholeGameFile(gameID, f))
+	}
+	return files
+}
+
+// wholeGameFile builds a transfer entry that copies f from its own object. Each
+// manifest chunk becomes a verified segment; without chunks the whole file is one.
+func wholeGameFile(gameID string, f ManifestFile) GameFile {
+	gf := GameFile{Path: f.Path, ObjectKey: f.objectKey(gameID), Size: f.Size, SHA256: f.SHA256}
+	if f.Size == 0 {
+		return gf
+	}
+	if len(f.Chunks) == 0 {
+		gf.Segments = []FileSegment{{ObjectKey: gf.ObjectKey, Size: f.Size, SHA256: f.SHA256}}
+		return gf
+	}
+	for _, c := range f.Chunks {
+		gf.Segments = append(gf.Segments, FileSegment{
+			ObjectKey:    gf.ObjectKey,
+			SourceOffset: c.Offset,
+			Offset:       c.Offset,
+			Size:         c.Size,
+			SHA256:       c.SHA256,
+		})
+	}
+	return gf
+}
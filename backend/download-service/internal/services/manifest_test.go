@@ -0,0 +1,110 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"download-service/internal/clients/s3"
+	derr "download-service/internal/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// putManifest stores the files under the default layout and writes their manifest.
+func putManifest(t testing.TB, storage *s3.MockClient, gameID string, files map[string][]byte) *Manifest {
+	m := &Manifest{GameID: gameID}
+	for p, content := range files {
+		f := ManifestFile{Path: p, Size: int64(len(content)), SHA256: sha256Hex(content)}
+		storage.PutObject(f.objectKey(gameID), f.Size, content)
+		m.Files = append(m.Files, f)
+	}
+	data, err := json.Marshal(m)
+	require.NoError(t, err)
+	storage.PutObject(manifestKeyForGame(gameID), int64(len(data)), data)
+	return m
+}
+
+func TestParseManifest_Validation(t *testing.T) {
+	digest := sha256Hex([]byte("x"))
+	cases := map[string]string{
+		"no files":       `{"files":[]}`,
+		"escaping path":  `{"files":[{"path":"../etc/passwd","size":1,"sha256":"` + digest + `"}]}`,
+		"absolute path":  `{"files":[{"path":"/bin/game","size":1,"sha256":"` + digest + `"}]}`,
+		"duplicate path": `{"files":[{"path":"a","size":1,"sha256":"` + digest + `"},{"path":"a","size":1,"sha256":"` + digest + `"}]}`,
+		"bad digest":     `{"files":[{"path":"a","size":1,"sha256":"abc"}]}`,
+		"chunk gap":      `{"files":[{"path":"a","size":4,"sha256":"` + digest + `","chunks":[{"offset":0,"size":2,"sha256":"` + digest + `"},{"offset":3,"size":1,"sha256":"` + digest + `"}]}]}`,
+		"chunk short":    `{"files":[{"path":"a","size":4,"sha256":"` + digest + `","chunks":[{"offset":0,"size":2,"sha256":"` + digest + `"}]}]}`,
+		"malformed json": `{"files":`,
+	}
+	for name, doc := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseManifest([]byte(doc))
+			require.Error(t, err)
+		})
+	}
+
+	m, err := ParseManifest([]byte(`{"gameId":"g","files":[{"path":"bin/game.exe","size":4,"sha256":"` + digest + `","chunks":[{"offset":0,"size":3,"sha256":"` + digest + `"},{"offset":3,"size":1,"sha256":"` + digest + `"}]},{"path":"empty.cfg","size":0,"sha256":"` + digest + `"}]}`))
+	require.NoError(t, err)
+	require.Len(t, m.Files, 2)
+	require.Equal(t, int64(4), m.TotalSize())
+}
+
+func TestFileService_ResolveGameFilesFromManifest(t *testing.T) {
+	storage := s3.NewMockClient()
+	svc := NewFileService(storage)
+	gameID := "d0000000-0000-0000-0000-000000000001"
+	putManifest(t, storage, gameID, map[string][]byte{
+		"bin/game.exe":    []byte("binary"),
+		"data/level1.pak": []byte("level-one"),
+	})
+
+	files, err := svc.ResolveGameFiles(context.Background(), gameID)
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+	byPath := map[string]GameFile{}
+	for _, f := range files {
+		byPath[f.Path] = f
+	}
+	require.Equal(t, "games/"+gameID+"/files/data/level1.pak", byPath["data/level1.pak"].ObjectKey)
+	require.Equal(t, int64(len("level-one")), byPath["data/level1.pak"].Size)
+	require.Equal(t, sha256Hex([]byte("binary")), byPath["bin/game.exe"].SHA256)
+}
+
+func TestFileService_ResolveGameFilesLegacyArchive(t *testing.T) {
+	storage := s3.NewMockClient()
+	svc := NewFileService(storage)
+	gameID := "d0000000-0000-0000-0000-000000000002"
+	storage.PutObject(objectKeyForGame(gameID), 2048, nil)
+
+	files, err := svc.ResolveGameFiles(context.Background(), gameID)
+	require.NoError(t, err)
+	require.Equal(t, []GameFile{{Path: gameArchiveName, ObjectKey: objectKeyForGame(gameID), Size: 2048}}, files)
+
+	_, err = svc.ResolveGameFiles(context.Background(), "d0000000-0000-0000-0000-000000000003")
+	require.True(t, errors.As(err, &derr.GameBuildNotFoundError{}))
+}
+
+func TestFileService_LoadManifestInvalid(t *testing.T) {
+	storage := s3.NewMockClient()
+	svc := NewFileService(storage)
+	gameID := "d0000000-0000-0000-0000-000000000004"
+	doc := []byte(`{"files":[{"path":"../../escape","size":1,"sha256":"` + sha256Hex(nil) + `"}]}`)
+	storage.PutObject(manifestKeyForGame(gameID), int64(len(doc)), doc)
+
+	_, err := svc.LoadManifest(context.Background(), gameID)
+	require.True(t, errors.As(err, &derr.ManifestInvalidError{}))
+
+	other := putManifest(t, storage, "d0000000-0000-0000-0000-000000000005", map[string][]byte{"a": []byte("a")})
+	data, _ := json.Marshal(other)
+	storage.PutObject(manifestKeyForGame(gameID), int64(len(data)), data)
+	_, err = svc.LoadManifest(context.Background(), gameID)
+	require.True(t, errors.As(err, &derr.ManifestInvalidError{}))
+}
@@ -0,0 +1,648 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"download-service/internal/cache"
+	"download-service/internal/clients/s3"
+	derr "download-service/internal/errors"
+	"download-service/pkg/logger"
+)
+
+// UploadStore keeps build uploads in progress and the parts stored for them.
+type UploadStore interface {
+	Create(ctx context.Context, u *cache.BuildUpload, ttl time.Duration) error
+	Get(ctx context.Context, id string) (*cache.BuildUpload, bool, error)
+	PutPart(ctx context.Context, id string, p cache.UploadedPart, ttl time.Duration) error
+	Parts(ctx context.Context, id string) ([]cache.UploadedPart, error)
+	Delete(ctx context.Context, id string) error
+	CreatedBefore(ctx context.Context, t time.Time) ([]string, error)
+	// LockVersion reserves completing a build version for one upload until ttl
+	// passes or UnlockVersion; false means another upload holds it.
+	LockVersion(ctx context.Context, gameID, version, owner string, ttl time.Duration) (bool, error)
+	UnlockVersion(ctx context.Context, gameID, version, owner string) error
+}
+
+const (
+	DefaultPartSize int64 = 64 * 1024 * 1024
+	// MinPartSize and MaxPartSize are the S3 limits; only a file's last part may be smaller.
+	MinPartSize    int64 = 5 * 1024 * 1024
+	MaxPartSize    int64 = 5 * 1024 * 1024 * 1024
+	MaxUploadParts       = 10000
+	MaxBuildFiles        = 1000
+	// DefaultUploadStaleAfter is how long a build upload may stay unfinished
+	// before AbortStaleUploads discards it.
+	DefaultUploadStaleAfter = 24 * time.Hour
+	// completeLockTTL bounds how long a completion holds its version should its
+	// replica die; assembling and hashing large files takes minutes.
+	completeLockTTL = 30 * time.Minute
+)
+
+// BuildUploadRequest describes the build a publisher is about to upload.
+type BuildUploadRequest struct {
+	GameID   string
+	Version  string
+	PartSize int64 // DefaultPartSize when zero
+	Files    []BuildUploadFile
+}
+
+// BuildUploadFile is one installable file of the build and its expected content.
+type BuildUploadFile struct {
+	Path   string
+	Size   int64
+	SHA256 string // hex digest of the whole file
+}
+
+// BuildUploadState is a build upload together with the parts stored so far.
+type BuildUploadState struct {
+	Upload *cache.BuildUpload
+	Parts  []cache.UploadedPart // ordered by file, then part number
+}
+
+// PublishOptions configures PublishService. Zero values keep the in-process
+// store and DefaultUploadStaleAfter.
+type PublishOptions struct {
+	Uploads    UploadStore
+	StaleAfter time.Duration
+}
+
+// PublishService ingests new game builds: it uploads every file of a build as
+// an S3 multipart upload with SHA-256 checked parts and, once all parts are in,
+// registers the build version with its manifest.
+type PublishService struct {
+	storage    s3.Interface
+	files      *FileService
+	uploads    UploadStore
+	staleAfter time.Duration
+	logger     logger.Logger
+}
+
+func NewPublishService(storage s3.Interface, files *FileService, logger logger.Logger) *PublishService {
+	return &PublishService{
+		storage:    storage,
+		files:      files,
+		uploads:    newLocalUploads(),
+		staleAfter: DefaultUploadStaleAfter,
+		logger:     logger,
+	}
+}
+
+// ConfigurePublishing replaces the upload store and the stale upload age.
+func (s *PublishService) ConfigurePublishing(opts PublishOptions) {
+	if opts.Uploads != nil {
+		s.uploads = opts.Uploads
+	}
+	if opts.StaleAfter > 0 {
+		s.staleAfter = opts.StaleAfter
+	}
+}
+
+type publisherGamesKey struct{}
+
+// WithPublisherGames returns a context carrying the games the caller may publish
+// builds of, as granted by their token.
+func WithPublisherGames(ctx context.Context, gameIDs []string) context.Context {
+	return context.WithValue(ctx, publisherGamesKey{}, gameIDs)
+}
+
+// checkPublisher fails with derr.AccessDeniedError unless the context grants
+// userID the publishing of gameID's builds.
+func (s *PublishService) checkPublisher(ctx context.Context, userID, gameID string) error {
+	games, _ := ctx.Value(publisherGamesKey{}).([]string)
+	for _, g := range games {
+		if g == gameID {
+			return nil
+		}
+	}
+	err := derr.AccessDeniedError{Reason: "not a publisher of game"}
+	logger.Info(s.logger, "build publishing denied", "error", err, "authUserID", userID, "gameID", gameID)
+	return err
+}
+
+// uploadTTL is how long an upload is kept; past staleAfter so the reaper still
+// finds the multipart uploads to abort.
+func (s *PublishService) uploadTTL() time.Duration { return 2 * s.staleAfter }
+
+func (s *PublishService) uploader() (s3.Uploader, error) {
+	u, ok := s.storage.(s3.Uploader)
+	if !ok {
+		return nil, derr.StorageError{Msg: "storage does not accept uploads"}
+	}
+	return u, nil
+}
+
+// validSegment reports whether s can be used as one segment of an object key.
+func validSegment(s string) bool {
+	return s != "" && s != "." && s != ".." && !strings.ContainsAny(s, "/\\")
+}
+
+// PartCount returns the number of parts of per bytes a file of size bytes is uploaded in.
+func PartCount(size, per int64) int {
+	return int((size + per - 1) / per)
+}
+
+// partSize returns the size of part number of a file of size bytes.
+func partSize(size, per int64, number int32) int64 {
+	return min(per, size-int64(number-1)*per)
+}
+
+// CreateBuildUpload starts uploading a new build version of a game the caller
+// may publish (see WithPublisherGames). Each non-empty file gets its own
+// multipart upload; empty files need no upload.
+func (s *PublishService) CreateBuildUpload(ctx context.Context, userID string, req BuildUploadRequest) (*cache.BuildUpload, error) {
+	u, err := s.uploader()
+	if err != nil {
+		return nil, err
+	}
+	if !validSegment(req.GameID) {
+		return nil, derr.ValidationError{Msg: fmt.Sprintf("invalid game id %q", req.GameID)}
+	}
+	if err := s.checkPublisher(ctx, userID, req.GameID); err != nil {
+		return nil, err
+	}
+	if !validSegment(req.Version) {
+		return nil, derr.ValidationError{Msg: fmt.Sprintf("invalid version %q", req.Version)}
+	}
+	if req.PartSize == 0 {
+		req.PartSize = DefaultPartSize
+	}
+	if req.PartSize < MinPartSize || req.PartSize > MaxPartSize {
+		return nil, derr.ValidationError{Msg: fmt.Sprintf("part size must be between %d and %d bytes", MinPartSize, MaxPartSize)}
+	}
+	if len(req.Files) > MaxBuildFiles {
+		return nil, derr.ValidationError{Msg: fmt.Sprintf("a build has at most %d files", MaxBuildFiles)}
+	}
+	m := Manifest{GameID: req.GameID, Version: req.Version}
+	for _, f := range req.Files {
+		m.Files = append(m.Files, ManifestFile{Path: f.Path, Size: f.Size, SHA256: strings.ToLower(f.SHA256)})
+	}
+	if err := m.Validate(); err != nil {
+		return nil, derr.ValidationError{Msg: err.Error()}
+	}
+	for _, f := range m.Files {
+		if PartCount(f.Size, req.PartSize) > MaxUploadParts {
+			return nil, derr.ValidationError{Msg: fmt.Sprintf("file %q needs more than %d parts; use a larger part size", f.Path, MaxUploadParts)}
+		}
+	}
+	if err := s.checkVersionFree(ctx, req.GameID, req.Version); err != nil {
+		return nil, err
+	}
+
+	up := &cache.BuildUpload{
+		ID:        newBuildUploadID(),
+		GameID:    req.GameID,
+		Version:   req.Version,
+		CreatedBy: userID,
+		PartSize:  req.PartSize,
+		CreatedAt: time.Now(),
+	}
+	for _, f := range m.Files {
+		rel := path.Join("versions", req.Version, "files", f.Path)
+		uf := cache.UploadFile{Path: f.Path, Size: f.Size, SHA256: f.SHA256, ObjectKey: fmt.Sprintf("games/%s/%s", req.GameID, rel)}
+		if f.Size > 0 {
+			id, err := u.CreateMultipartUpload(ctx, uf.ObjectKey)
+			if err != nil {
+				s.abortFiles(ctx, up)
+				return nil, fmt.Errorf("create multipart upload for %s: %w", f.Path, err)
+			}
+			uf.UploadID = id
+		}
+		up.Files = append(up.Files, uf)
+	}
+	if err := s.uploads.Create(ctx, up, s.uploadTTL()); err != nil {
+		s.abortFiles(ctx, up)
+		return nil, err
+	}
+	logger.Info(s.logger, "build upload created", "uploadID", up.ID, "gameID", up.GameID, "version", up.Version, "userID", userID, "files", len(up.Files))
+	return up, nil
+}
+
+// checkVersionFree fails with derr.BuildVersionExistsError when the version has
+// already been published.
+func (s *PublishService) checkVersionFree(ctx context.Context, gameID, version string) error {
+	_, err := s.files.LoadManifestVersion(ctx, gameID, version)
+	switch {
+	case err == nil:
+		return derr.BuildVersionExistsError{GameID: gameID, Version: version}
+	case errors.Is(err, s3.ErrNotFound):
+		return nil
+	default:
+		var invalid derr.ManifestInvalidError
+		if errors.As(err, &invalid) {
+			return derr.BuildVersionExistsError{GameID: gameID, Version: version}
+		}
+		return err
+	}
+}
+
+func newBuildUploadID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// getUpload returns the upload if userID started it.
+func (s *PublishService) getUpload(ctx context.Context, userID, uploadID string) (*cache.BuildUpload, error) {
+	up, ok, err := s.uploads.Get(ctx, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, derr.UploadNotFoundError{ID: uploadID}
+	}
+	if up.CreatedBy != userID {
+		err := derr.AccessDeniedError{Reason: "not owner of upload"}
+		logger.Info(s.logger, "build upload access denied", "error", err, "authUserID", userID, "uploadID", uploadID)
+		return nil, err
+	}
+	return up, nil
+}
+
+// GetBuildUpload returns an upload with the parts stored so far, so an
+// interrupted publisher knows which parts to send again.
+func (s *PublishService) GetBuildUpload(ctx context.Context, userID, uploadID string) (*BuildUploadState, error) {
+	up, err := s.getUpload(ctx, userID, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	parts, err := s.uploads.Parts(ctx, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(parts, func(i, j int) bool {
+		if parts[i].File != parts[j].File {
+			return parts[i].File < parts[j].File
+		}
+		return parts[i].Number < parts[j].Number
+	})
+	return &BuildUploadState{Upload: up, Parts: parts}, nil
+}
+
+// UploadPart stores part number of the upload's file-th file. The body must be
+// exactly the part's size and match checksum, the base64 SHA-256 of the part;
+// a part may be sent again to replace it.
+func (s *PublishService) UploadPart(ctx context.Context, userID, uploadID string, file int, number int32, body io.Reader, size int64, checksum string) (*cache.UploadedPart, error) {
+	u, err := s.uploader()
+	if err != nil {
+		return nil, err
+	}
+	up, err := s.getUpload(ctx, userID, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	if file < 0 || file >= len(up.Files) || up.Files[file].UploadID == "" {
+		return nil, derr.ValidationError{Msg: fmt.Sprintf("upload has no file %d to send parts of", file)}
+	}
+	f := up.Files[file]
+	if number < 1 || int(number) > PartCount(f.Size, up.PartSize) {
+		return nil, derr.ValidationError{Msg: fmt.Sprintf("file %q has no part %d", f.Path, number)}
+	}
+	if want := partSize(f.Size, up.PartSize, number); size != want {
+		return nil, derr.ValidationError{Msg: fmt.Sprintf("part %d of file %q must be %d bytes, got %d", number, f.Path, want, size)}
+	}
+	sum, err := base64.StdEncoding.DecodeString(checksum)
+	if err != nil || len(sum) != 32 {
+		return nil, derr.ValidationError{Msg: "part checksum must be a base64 SHA-256 digest"}
+	}
+
+	cp, err := u.UploadPart(ctx, f.ObjectKey, f.UploadID, number, body, size, sum)
+	switch {
+	case errors.Is(err, s3.ErrChecksumMismatch):
+		return nil, derr.ValidationError{Msg: fmt.Sprintf("part %d of file %q does not match its checksum", number, f.Path)}
+	case errors.Is(err, s3.ErrNotFound):
+		return nil, derr.UploadNotFoundError{ID: uploadID}
+	case err != nil:
+		return nil, fmt.Errorf("upload part %d of %s: %w", number, f.Path, err)
+	}
+	part := cache.UploadedPart{File: file, Number: number, Size: size, ETag: cp.ETag, SHA256: hex.EncodeToString(sum)}
+	if err := s.uploads.PutPart(ctx, uploadID, part, s.uploadTTL()); err != nil {
+		return nil, err
+	}
+	return &part, nil
+}
+
+// CompleteBuildUpload assembles every file of the upload and registers the build
+// version: its manifest is stored under versions/ and becomes the game's current
+// manifest. Each part becomes a manifest chunk, so clients verify multipart
+// files part by part; the assembled file must also match its declared digest.
+func (s *PublishService) CompleteBuildUpload(ctx context.Context, userID, uploadID string) (*Manifest, error) {
+	u, err := s.uploader()
+	if err != nil {
+		return nil, err
+	}
+	up, err := s.getUpload(ctx, userID, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	// The grant may have been withdrawn since the upload started.
+	if err := s.checkPublisher(ctx, userID, up.GameID); err != nil {
+		return nil, err
+	}
+	stored, err := s.uploads.Parts(ctx, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	byFile := make([]map[int32]cache.UploadedPart, len(up.Files))
+	for _, p := range stored {
+		if p.File < 0 || p.File >= len(byFile) {
+			continue
+		}
+		if byFile[p.File] == nil {
+			byFile[p.File] = make(map[int32]cache.UploadedPart)
+		}
+		byFile[p.File][p.Number] = p
+	}
+	for i, f := range up.Files {
+		for n := 1; n <= PartCount(f.Size, up.PartSize); n++ {
+			if _, ok := byFile[i][int32(n)]; !ok {
+				return nil, derr.ValidationError{Msg: fmt.Sprintf("part %d of file %q was not uploaded", n, f.Path)}
+			}
+		}
+	}
+	// Uploads of the same version may complete at once; only one registers it.
+	locked, err := s.uploads.LockVersion(ctx, up.GameID, up.Version, uploadID, completeLockTTL)
+	if err != nil {
+		return nil, err
+	}
+	if !locked {
+		return nil, derr.BuildVersionExistsError{GameID: up.GameID, Version: up.Version}
+	}
+	defer func() {
+		if err := s.uploads.UnlockVersion(ctx, up.GameID, up.Version, uploadID); err != nil {
+			logger.Error(s.logger, "unlock build version failed", "error", err, "uploadID", uploadID)
+		}
+	}()
+	if err := s.checkVersionFree(ctx, up.GameID, up.Version); err != nil {
+		return nil, err
+	}
+
+	m := &Manifest{GameID: up.GameID, BuildID: up.ID, Version: up.Version}
+	prefix := fmt.Sprintf("games/%s/", up.GameID)
+	for i, f := range up.Files {
+		mf := ManifestFile{Path: f.Path, Size: f.Size, SHA256: f.SHA256, Object: strings.TrimPrefix(f.ObjectKey, prefix)}
+		if f.UploadID != "" {
+			n := PartCount(f.Size, up.PartSize)
+			parts := make([]s3.CompletedPart, 0, n)
+			for k := 1; k <= n; k++ {
+				p := byFile[i][int32(k)]
+				sum, _ := hex.DecodeString(p.SHA256)
+				parts = append(parts, s3.CompletedPart{Number: p.Number, ETag: p.ETag, SHA256: sum})
+				mf.Chunks = append(mf.Chunks, ManifestChunk{Offset: int64(k-1) * up.PartSize, Size: p.Size, SHA256: p.SHA256})
+			}
+			// A single part is the whole file; its digest must be the file's.
+			if n == 1 {
+				if mf.Chunks[0].SHA256 != f.SHA256 {
+					return nil, derr.ValidationError{Msg: fmt.Sprintf("file %q does not match its sha256", f.Path)}
+				}
+				mf.Chunks = nil
+			}
+			info, err := u.CompleteMultipartUpload(ctx, f.ObjectKey, f.UploadID, parts)
+			if errors.Is(err, s3.ErrNotFound) {
+				// Completed by an earlier attempt that failed on a later file.
+				info, err = s.storage.StatObject(ctx, f.ObjectKey)
+			}
+			if errors.Is(err, s3.ErrChecksumMismatch) {
+				return nil, derr.ValidationError{Msg: fmt.Sprintf("stored parts of file %q do not match their checksums; send them again", f.Path)}
+			}
+			if err != nil {
+				return nil, fmt.Errorf("complete upload of %s: %w", f.Path, err)
+			}
+			if info.Size != f.Size {
+				return nil, derr.StorageError{Msg: fmt.Sprintf("file %q stored as %d of %d bytes", f.Path, info.Size, f.Size)}
+			}
+			// The parts matched their own digests; the declared one covers the assembled file.
+			if n > 1 {
+				sum, err := s.objectSHA256(ctx, f.ObjectKey, f.Size)
+				if err != nil {
+					return nil, fmt.Errorf("hash %s: %w", f.Path, err)
+				}
+				if sum != f.SHA256 {
+					// The declared digest is fixed, so the upload can never complete.
+					s.abortFiles(ctx, up)
+					if err := s.uploads.Delete(ctx, uploadID); err != nil {
+						logger.Error(s.logger, "delete build upload failed", "error", err, "uploadID", uploadID)
+					}
+					logger.Info(s.logger, "build upload discarded", "uploadID", uploadID, "gameID", up.GameID, "version", up.Version, "file", f.Path, "reason", "sha256 mismatch")
+					return nil, derr.ValidationError{Msg: fmt.Sprintf("file %q does not match its sha256; the upload was discarded", f.Path)}
+				}
+			}
+		}
+		m.Files = append(m.Files, mf)
+	}
+	if err := m.Validate(); err != nil {
+		return nil, derr.ManifestInvalidError{GameID: up.GameID, Reason: err.Error()}
+	}
+	doc, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s3.PutSmallObject(ctx, u, manifestKeyForVersion(up.GameID, up.Version), doc); err != nil {
+		return nil, fmt.Errorf("store version manifest: %w", err)
+	}
+	if _, err := s3.PutSmallObject(ctx, u, manifestKeyForGame(up.GameID), doc); err != nil {
+		return nil, fmt.Errorf("store current manifest: %w", err)
+	}
+	if err := s.uploads.Delete(ctx, uploadID); err != nil {
+		logger.Error(s.logger, "delete completed build upload failed", "error", err, "uploadID", uploadID)
+	}
+	logger.Info(s.logger, "build version published", "uploadID", uploadID, "gameID", up.GameID, "version", up.Version, "userID", userID)
+	return m, nil
+}
+
+// objectSHA256 returns the hex SHA-256 digest of the first size bytes of an
+// object, read as a stream.
+func (s *PublishService) objectSHA256(ctx context.Context, objectKey string, size int64) (string, error) {
+	rc, err := s.storage.GetObjectRange(ctx, objectKey, 0, size)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, rc); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// AbortBuildUpload discards an upload and every part stored for it.
+func (s *PublishService) AbortBuildUpload(ctx context.Context, userID, uploadID string) error {
+	up, err := s.getUpload(ctx, userID, uploadID)
+	if err != nil {
+		return err
+	}
+	s.abortFiles(ctx, up)
+	return s.uploads.Delete(ctx, uploadID)
+}
+
+// AbortStaleUploads discards the uploads started more than the stale age ago
+// and returns how many it aborted.
+func (s *PublishService) AbortStaleUploads(ctx context.Context) (int, error) {
+	ids, err := s.uploads.CreatedBefore(ctx, time.Now().Add(-s.staleAfter))
+	if err != nil {
+		return 0, err
+	}
+	aborted := 0
+	for _, id := range ids {
+		up, ok, err := s.uploads.Get(ctx, id)
+		if err != nil {
+			return aborted, err
+		}
+		if ok {
+			s.abortFiles(ctx, up)
+			aborted++
+			logger.Info(s.logger, "stale build upload aborted", "uploadID", id, "gameID", up.GameID, "version", up.Version)
+		}
+		if err := s.uploads.Delete(ctx, id); err != nil {
+			return aborted, err
+		}
+	}
+	return aborted, nil
+}
+
+// RunUploadReaper aborts stale uploads every interval until ctx is cancelled.
+// Every replica may run it; aborting an upload twice is harmless.
+func (s *PublishService) RunUploadReaper(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if _, err := s.AbortStaleUploads(ctx); err != nil && ctx.Err() == nil {
+				logger.Error(s.logger, "abort stale build uploads failed", "error", err)
+			}
+		}
+	}
+}
+
+// abortFiles aborts the multipart uploads of up. Failures are logged; storage
+// lifecycle rules remove what is left behind.
+func (s *PublishService) abortFiles(ctx context.Context, up *cache.BuildUpload) {
+	u, err := s.uploader()
+	if err != nil {
+		return
+	}
+	for _, f := range up.Files {
+		if f.UploadID == "" {
+			continue
+		}
+		if err := u.AbortMultipartUpload(ctx, f.ObjectKey, f.UploadID); err != nil && !errors.Is(err, s3.ErrNotFound) {
+			logger.Error(s.logger, "abort multipart upload failed", "error", err, "uploadID", up.ID, "object", f.ObjectKey)
+		}
+	}
+}
+
+// localUploads keeps uploads in process memory; a single replica has to serve
+// every request of an upload.
+type localUploads struct {
+	mu      sync.Mutex
+	uploads map[string]localUpload
+	locks   map[string]localLock // by game and version
+}
+
+type localLock struct {
+	owner   string
+	expires time.Time
+}
+
+type localUpload struct {
+	upload  cache.BuildUpload
+	parts   map[string]cache.UploadedPart
+	expires time.Time
+}
+
+func newLocalUploads() *localUploads {
+	return &localUploads{uploads: make(map[string]localUpload), locks: make(map[string]localLock)}
+}
+
+func (l *localUploads) Create(ctx context.Context, u *cache.BuildUpload, ttl time.Duration) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.uploads[u.ID] = localUpload{upload: *u, parts: make(map[string]cache.UploadedPart), expires: time.Now().Add(ttl)}
+	return nil
+}
+
+func (l *localUploads) Get(ctx context.Context, id string) (*cache.BuildUpload, bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e, ok := l.uploads[id]
+	if !ok || time.Now().After(e.expires) {
+		return nil, false, nil
+	}
+	u := e.upload
+	u.Files = append([]cache.UploadFile(nil), e.upload.Files...)
+	return &u, true, nil
+}
+
+func (l *localUploads) PutPart(ctx context.Context, id string, p cache.UploadedPart, ttl time.Duration) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if e, ok := l.uploads[id]; ok {
+		e.parts[fmt.Sprintf("%d/%d", p.File, p.Number)] = p
+	}
+	return nil
+}
+
+func (l *localUploads) Parts(ctx context.Context, id string) ([]cache.UploadedPart, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var out []cache.UploadedPart
+	for _, p := range l.uploads[id].parts {
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+func (l *localUploads) Delete(ctx context.Context, id string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.uploads, id)
+	return nil
+}
+
+func (l *localUploads) CreatedBefore(ctx context.Context, t time.Time) ([]string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var out []string
+	for id, e := range l.uploads {
+		if e.upload.CreatedAt.Before(t) {
+			out = append(out, id)
+		}
+	}
+	return out, nil
+}
+
+func (l *localUploads) LockVersion(ctx context.Context, gameID, version, owner string, ttl time.Duration) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	key := gameID + "/" + version
+	if cur, ok := l.locks[key]; ok && time.Now().Before(cur.expires) {
+		return false, nil
+	}
+	l.locks[key] = localLock{owner: owner, expires: time.Now().Add(ttl)}
+	return true, nil
+}
+
+func (l *localUploads) UnlockVersion(ctx context.Context, gameID, version, owner string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	key := gameID + "/" + version
+	if l.locks[key].owner == owner {
+		delete(l.locks, key)
+	}
+	return nil
+}
@@ -0,0 +1,263 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"download-service/internal/clients/s3"
+	derr "download-service/internal/errors"
+	"download-service/pkg/logger"
+	"github.com/stretchr/testify/require"
+)
+
+func sha256Base64(data []byte) string {
+	sum := sha256.Sum256(data)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func newTestPublishService() (*PublishService, *s3.MockClient, *FileService) {
+	storage := s3.NewMockClient()
+	files := NewFileService(storage)
+	return NewPublishService(storage, files, logger.New()), storage, files
+}
+
+func TestPublishService_UploadAndRegisterBuild(t *testing.T) {
+	svc, storage, files := newTestPublishService()
+	ctx := WithPublisherGames(context.Background(), []string{"g1"})
+
+	game := bytes.Repeat([]byte("0123456789abcdef"), (7<<20)/16) // two parts of MinPartSize
+	config := []byte(`{"fullscreen":true}`)
+	up, err := svc.CreateBuildUpload(ctx, "pub-1", BuildUploadRequest{
+		GameID:   "g1",
+		Version:  "2.0",
+		PartSize: MinPartSize,
+		Files: []BuildUploadFile{
+			{Path: "bin/game", Size: int64(len(game)), SHA256: sha256Hex(game)},
+			{Path: "config.json", Size: int64(len(config)), SHA256: sha256Hex(config)},
+			{Path: "saves/.keep", Size: 0, SHA256: sha256Hex(nil)},
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, 2, PartCount(up.Files[0].Size, up.PartSize))
+	require.Empty(t, up.Files[2].UploadID, "empty files need no upload")
+	require.Equal(t, 2, storage.PendingUploads())
+
+	send := func(userID string, file int, number int32, data []byte, checksum string) error {
+		_, err := svc.UploadPart(ctx, userID, up.ID, file, number, bytes.NewReader(data), int64(len(data)), checksum)
+		return err
+	}
+	part1, part2 := game[:MinPartSize], game[MinPartSize:]
+
+	// Parts must have their exact size and checksum and belong to the uploader.
+	require.IsType(t, derr.ValidationError{}, send("pub-1", 0, 1, part2, sha256Base64(part2)))
+	require.IsType(t, derr.ValidationError{}, send("pub-1", 0, 2, part2, sha256Base64(part1)))
+	require.IsType(t, derr.ValidationError{}, send("pub-1", 0, 3, part2, sha256Base64(part2)))
+	require.IsType(t, derr.ValidationError{}, send("pub-1", 2, 1, nil, sha256Base64(nil)))
+	require.IsType(t, derr.AccessDeniedError{}, send("pub-2", 0, 2, part2, sha256Base64(part2)))
+
+	require.NoError(t, send("pub-1", 0, 2, part2, sha256Base64(part2)))
+	require.NoError(t, send("pub-1", 1, 1, config, sha256Base64(config)))
+	_, err = svc.CompleteBuildUpload(ctx, "pub-1", up.ID)
+	require.IsType(t, derr.ValidationError{}, err, "part 1 of bin/game is missing")
+
+	st, err := svc.GetBuildUpload(ctx, "pub-1", up.ID)
+	require.NoError(t, err)
+	require.Len(t, st.Parts, 2)
+	require.NoError(t, send("pub-1", 0, 1, part1, sha256Base64(part1)))
+
+	m, err := svc.CompleteBuildUpload(ctx, "pub-1", up.ID)
+	require.NoError(t, err)
+	require.Equal(t, up.ID, m.BuildID)
+	require.Zero(t, storage.PendingUploads())
+	_, err = svc.GetBuildUpload(ctx, "pub-1", up.ID)
+	require.IsType(t, derr.UploadNotFoundError{}, err)
+
+	// The version is registered and current; multipart files are verified per part.
+	for _, version := range []string{"2.0", ""} {
+		got, err := files.LoadManifestVersion(ctx, "g1", version)
+		require.NoError(t, err)
+		require.Equal(t, "2.0", got.Version)
+		require.Len(t, got.Files[0].Chunks, 2)
+		require.Equal(t, sha256Hex(part2), got.Files[0].Chunks[1].SHA256)
+		require.Empty(t, got.Files[1].Chunks)
+	}
+	gf := wholeGameFile("g1", m.Files[0])
+	require.Equal(t, "games/g1/versions/2.0/files/bin/game", gf.ObjectKey)
+	rc, err := storage.GetObjectRange(ctx, gf.ObjectKey, 0, gf.Size)
+	require.NoError(t, err)
+	data, _ := io.ReadAll(rc)
+	rc.Close()
+	require.Equal(t, game, data)
+
+	_, err = svc.CreateBuildUpload(ctx, "pub-1", BuildUploadRequest{
+		GameID: "g1", Version: "2.0",
+		Files: []BuildUploadFile{{Path: "config.json", Size: int64(len(config)), SHA256: sha256Hex(config)}},
+	})
+	require.IsType(t, derr.BuildVersionExistsError{}, err)
+}
+
+func TestPublishService_PublishersOnlyReachTheirGames(t *testing.T) {
+	svc, storage, files := newTestPublishService()
+	data := []byte("0123456789")
+	req := BuildUploadRequest{GameID: "g2", Version: "1.0", Files: []BuildUploadFile{{Path: "bin/game", Size: 10, SHA256: sha256Hex(data)}}}
+	publisherA := WithPublisherGames(context.Background(), []string{"g1"})
+	publisherB := WithPublisherGames(context.Background(), []string{"g2"})
+
+	_, err := svc.CreateBuildUpload(publisherA, "pub-a", req)
+	require.IsType(t, derr.AccessDeniedError{}, err)
+	_, err = svc.CreateBuildUpload(context.Background(), "pub-a", req)
+	require.IsType(t, derr.AccessDeniedError{}, err, "no grant is no game")
+	require.Zero(t, storage.PendingUploads())
+
+	// Completing checks the grant again: it may have been withdrawn meanwhile.
+	up, err := svc.CreateBuildUpload(publisherB, "pub-b", req)
+	require.NoError(t, err)
+	_, err = svc.UploadPart(publisherB, "pub-b", up.ID, 0, 1, bytes.NewReader(data), 10, sha256Base64(data))
+	require.NoError(t, err)
+	_, err = svc.CompleteBuildUpload(WithPublisherGames(context.Background(), []string{"g1"}), "pub-b", up.ID)
+	require.IsType(t, derr.AccessDeniedError{}, err)
+	_, err = files.LoadManifest(context.Background(), "g2")
+	require.ErrorIs(t, err, s3.ErrNotFound)
+
+	_, err = svc.CompleteBuildUpload(publisherB, "pub-b", up.ID)
+	require.NoError(t, err)
+}
+
+func TestPublishService_ChecksAssembledFileDigest(t *testing.T) {
+	svc, storage, files := newTestPublishService()
+	ctx := WithPublisherGames(context.Background(), []string{"g1"})
+
+	game := bytes.Repeat([]byte("0123456789abcdef"), (7<<20)/16)
+	up, err := svc.CreateBuildUpload(ctx, "pub-1", BuildUploadRequest{
+		GameID:   "g1",
+		Version:  "2.0",
+		PartSize: MinPartSize,
+		Files:    []BuildUploadFile{{Path: "bin/game", Size: int64(len(game)), SHA256: sha256Hex(game[1:])}},
+	})
+	require.NoError(t, err)
+	for i, part := range [][]byte{game[:MinPartSize], game[MinPartSize:]} {
+		_, err := svc.UploadPart(ctx, "pub-1", up.ID, 0, int32(i+1), bytes.NewReader(part), int64(len(part)), sha256Base64(part))
+		require.NoError(t, err)
+	}
+
+	// Every part matches its own digest, but the file is not the one declared.
+	_, err = svc.CompleteBuildUpload(ctx, "pub-1", up.ID)
+	require.IsType(t, derr.ValidationError{}, err)
+	_, err = files.LoadManifestVersion(ctx, "g1", "2.0")
+	require.ErrorIs(t, err, s3.ErrNotFound)
+	_, err = svc.GetBuildUpload(ctx, "pub-1", up.ID)
+	require.IsType(t, derr.UploadNotFoundError{}, err)
+	require.Zero(t, storage.PendingUploads())
+}
+
+func TestPublishService_OneUploadCompletesAVersion(t *testing.T) {
+	svc, _, files := newTestPublishService()
+	ctx := WithPublisherGames(context.Background(), []string{"g1"})
+	upload := func(content string) string {
+		data := []byte(content)
+		up, err := svc.CreateBuildUpload(ctx, "pub-1", BuildUploadRequest{GameID: "g1", Version: "1.0", Files: []BuildUploadFile{{Path: "bin/game", Size: int64(len(data)), SHA256: sha256Hex(data)}}})
+		require.NoError(t, err)
+		_, err = svc.UploadPart(ctx, "pub-1", up.ID, 0, 1, bytes.NewReader(data), int64(len(data)), sha256Base64(data))
+		require.NoError(t, err)
+		return up.ID
+	}
+	first, second := upload("first build"), upload("second build")
+
+	// While one upload completes the version, the other loses.
+	ok, err := svc.uploads.LockVersion(ctx, "g1", "1.0", first, time.Minute)
+	require.NoError(t, err)
+	require.True(t, ok)
+	_, err = svc.CompleteBuildUpload(ctx, "pub-1", second)
+	require.IsType(t, derr.BuildVersionExistsError{}, err)
+	require.NoError(t, svc.uploads.UnlockVersion(ctx, "g1", "1.0", first))
+
+	_, err = svc.CompleteBuildUpload(ctx, "pub-1", first)
+	require.NoError(t, err)
+	_, err = svc.CompleteBuildUpload(ctx, "pub-1", second)
+	require.IsType(t, derr.BuildVersionExistsError{}, err)
+	m, err := files.LoadManifest(ctx, "g1")
+	require.NoError(t, err)
+	require.Equal(t, first, m.BuildID)
+}
+
+// mismatchingStorage refuses to assemble uploads, as S3 does when a stored part
+// no longer matches the checksum it was listed with.
+type mismatchingStorage struct {
+	*s3.MockClient
+}
+
+func (m mismatchingStorage) CompleteMultipartUpload(ctx context.Context, objectKey, uploadID string, parts []s3.CompletedPart) (s3.ObjectInfo, error) {
+	return s3.ObjectInfo{}, fmt.Errorf("%w: part 1 is invalid", s3.ErrChecksumMismatch)
+}
+
+func TestPublishService_CompleteChecksumMismatchIsInvalid(t *testing.T) {
+	storage := mismatchingStorage{s3.NewMockClient()}
+	svc := NewPublishService(storage, NewFileService(storage), logger.New())
+	ctx := WithPublisherGames(context.Background(), []string{"g1"})
+	data := []byte("0123456789")
+
+	up, err := svc.CreateBuildUpload(ctx, "pub-1", BuildUploadRequest{GameID: "g1", Version: "1.0", Files: []BuildUploadFile{{Path: "bin/game", Size: 10, SHA256: sha256Hex(data)}}})
+	require.NoError(t, err)
+	_, err = svc.UploadPart(ctx, "pub-1", up.ID, 0, 1, bytes.NewReader(data), 10, sha256Base64(data))
+	require.NoError(t, err)
+	_, err = svc.CompleteBuildUpload(ctx, "pub-1", up.ID)
+	require.IsType(t, derr.ValidationError{}, err)
+}
+
+func TestPublishService_RejectsInvalidBuilds(t *testing.T) {
+	svc, storage, _ := newTestPublishService()
+	ctx := WithPublisherGames(context.Background(), []string{"g1"})
+	file := BuildUploadFile{Path: "bin/game", Size: 10, SHA256: sha256Hex([]byte("0123456789"))}
+
+	for name, req := range map[string]BuildUploadRequest{
+		"game id":        {GameID: "../g1", Version: "1.0", Files: []BuildUploadFile{file}},
+		"version":        {GameID: "g1", Version: "1.0/..", Files: []BuildUploadFile{file}},
+		"no files":       {GameID: "g1", Version: "1.0"},
+		"path":           {GameID: "g1", Version: "1.0", Files: []BuildUploadFile{{Path: "../escape", SHA256: file.SHA256}}},
+		"duplicate path": {GameID: "g1", Version: "1.0", Files: []BuildUploadFile{file, file}},
+		"small parts":    {GameID: "g1", Version: "1.0", PartSize: 1 << 20, Files: []BuildUploadFile{file}},
+		"too many parts": {GameID: "g1", Version: "1.0", PartSize: MinPartSize, Files: []BuildUploadFile{{Path: "big", Size: MinPartSize * (MaxUploadParts + 1), SHA256: file.SHA256}}},
+		"invalid sha256": {GameID: "g1", Version: "1.0", Files: []BuildUploadFile{{Path: "bin/game", Size: 10, SHA256: "abc"}}},
+	} {
+		_, err := svc.CreateBuildUpload(ctx, "pub-1", req)
+		require.IsType(t, derr.ValidationError{}, err, name)
+	}
+	require.Zero(t, storage.PendingUploads())
+}
+
+func TestPublishService_AbortsStaleUploads(t *testing.T) {
+	svc, storage, _ := newTestPublishService()
+	ctx := WithPublisherGames(context.Background(), []string{"g1"})
+	data := []byte("0123456789")
+	req := BuildUploadRequest{GameID: "g1", Version: "1.0", Files: []BuildUploadFile{{Path: "bin/game", Size: 10, SHA256: sha256Hex(data)}}}
+
+	stale, err := svc.CreateBuildUpload(ctx, "pub-1", req)
+	require.NoError(t, err)
+	_, err = svc.UploadPart(ctx, "pub-1", stale.ID, 0, 1, bytes.NewReader(data), 10, sha256Base64(data))
+	require.NoError(t, err)
+	req.Version = "1.1"
+	fresh, err := svc.CreateBuildUpload(ctx, "pub-1", req)
+	require.NoError(t, err)
+
+	local := svc.uploads.(*localUploads)
+	e := local.uploads[stale.ID]
+	e.upload.CreatedAt = time.Now().Add(-DefaultUploadStaleAfter - time.Minute)
+	local.uploads[stale.ID] = e
+	n, err := svc.AbortStaleUploads(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	require.Equal(t, 1, storage.PendingUploads())
+	_, err = svc.GetBuildUpload(ctx, "pub-1", stale.ID)
+	require.IsType(t, derr.UploadNotFoundError{}, err)
+
+	// Publishers abort their own uploads.
+	require.IsType(t, derr.AccessDeniedError{}, svc.AbortBuildUpload(ctx, "pub-2", fresh.ID))
+	require.NoError(t, svc.AbortBuildUpload(ctx, "pub-1", fresh.ID))
+	require.Zero(t, storage.PendingUploads())
+}
@@ -0,0 +1,178 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"sync"
+
+	derr "download-service/internal/errors"
+	"download-service/internal/models"
+	"download-service/pkg/logger"
+)
+
+// queueLockStripes bounds the locks guarding per-user slot accounting.
+const queueLockStripes = 64
+
+// ConfigureQueue limits how many downloads of one user transfer at once. Further
+// downloads wait in pending and start, highest priority first, as slots free up.
+// Zero or less removes the limit.
+func (s *DownloadService) ConfigureQueue(maxActivePerUser int) {
+	s.maxActive = maxActivePerUser
+}
+
+// queueLock serialises slot decisions for a user on this replica, so two requests
+// cannot both take the last slot. Replicas racing on the same user may briefly
+// run one download over the limit.
+func (s *DownloadService) queueLock(userID string) *sync.Mutex {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(userID))
+	return &s.queueLocks[h.Sum32()%queueLockStripes]
+}
+
+// hasSlot reports whether a user of the given tier may start another transfer.
+// The caller holds queueLock.
+func (s *DownloadService) hasSlot(ctx context.Context, userID, tierName string) (bool, error) {
+	limit := s.maxActiveFor(tierName)
+	if limit <= 0 {
+		return true, nil
+	}
+	n, err := s.repo.CountByUserAndStatus(ctx, userID, models.StatusDownloading)
+	if err != nil {
+		return false, err
+	}
+	return n < int64(limit), nil
+}
+
+// queueEnabled reports whether any user can have downloads waiting for a slot.
+func (s *DownloadService) queueEnabled() bool {
+	if s.maxActive > 0 {
+		return true
+	}
+	for _, l := range s.tiers.Limits {
+		if l.MaxActive > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// promote starts the user's queued downloads in order while slots are free.
+// Downloads outside their schedule keep their place but are passed over.
+func (s *DownloadService) promote(ctx context.Context, userID string) {
+	mu := s.queueLock(userID)
+	mu.Lock()
+	defer mu.Unlock()
+	for {
+		queue, err := s.repo.ListQueue(ctx, userID, 0)
+		if err != nil {
+			logger.Error(s.logger, "list download queue failed", "error", err, "userID", userID)
+			return
+		}
+		var d *models.Download
+		for i := range queue {
+			if s.scheduleOpen(&queue[i]) {
+				d = &queue[i]
+				break
+			}
+		}
+		if d == nil {
+			return
+		}
+		free, err := s.hasSlot(ctx, userID, d.Tier)
+		if err != nil {
+			logger.Error(s.logger, "count active downloads failed", "error", err, "userID", userID)
+			return
+		}
+		if !free {
+			return
+		}
+		err = s.launch(ctx, d, models.ActorSystem, "promoted from queue")
+		switch {
+		case err == nil:
+			logger.Info(s.logger, "queued download started", "downloadID", d.ID, "userID", userID, "priority", d.Priority)
+		case errors.As(err, &derr.InvalidTransitionError{}):
+			// Paused or cancelled while we looked; take the next one.
+		case errors.As(err, &derr.GameBuildNotFoundError{}):
+			// The build is gone and would block the queue forever.
+			if err := s.transition(ctx, d, models.StatusFailed, models.ActorSystem, "start queued download: "+err.Error()); err != nil {
+				logger.Error(s.logger, "fail queued download failed", "error", err, "downloadID", d.ID)
+				return
+			}
+		default:
+			// Likely transient; the coordinator retries on its next pass.
+			logger.Error(s.logger, "start queued download failed", "error", err, "downloadID", d.ID)
+			return
+		}
+	}
+}
+
+// promoteAfter frees the slot of a download that stopped transferring.
+func (s *DownloadService) promoteAfter(from models.DownloadStatus, userID string) {
+	if from != models.StatusDownloading || !s.queueEnabled() {
+		return
+	}
+	go s.promote(context.Background(), userID)
+}
+
+// PromoteQueued starts queued downloads of every user with a free slot, catching
+// up on promotions missed while no replica was running or after the limit was raised.
+func (s *DownloadService) PromoteQueued(ctx context.Context) error {
+	users := make(map[string]struct{})
+	for offset := 0; ; offset += recoveryBatchSize {
+		batch, err := s.repo.ListByStatus(ctx, models.StatusPending, recoveryBatchSize, offset)
+		if err != nil {
+			return err
+		}
+		for _, d := range batch {
+			users[d.UserID] = struct{}{}
+		}
+		if len(batch) < recoveryBatchSize {
+			break
+		}
+	}
+	for userID := range users {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		s.promote(ctx, userID)
+	}
+	return nil
+}
+
+// DownloadQueue returns the user's pending downloads in the order they will start.
+func (s *DownloadService) DownloadQueue(ctx context.Context, userID string) ([]models.Download, error) {
+	return s.repo.ListQueue(ctx, userID, 0)
+}
+
+// ReorderQueue moves the given pending downloads to the front of the user's queue
+// in the order listed. Priority still ranks first; the order applies among
+// downloads of equal priority.
+func (s *DownloadService) ReorderQueue(ctx context.Context, userID string, downloadIDs []string) ([]models.Download, error) {
+	if len(downloadIDs) == 0 {
+		return nil, derr.ValidationError{Msg: "downloadIds must not be empty"}
+	}
+	seen := make(map[string]bool, len(downloadIDs))
+	for _, id := range downloadIDs {
+		if seen[id] {
+			return nil, derr.ValidationError{Msg: "duplicate download id " + id}
+		}
+		seen[id] = true
+		d, err := s.GetDownload(ctx, userID, id)
+		if err != nil {
+			return nil, err
+		}
+		if d.Status != models.StatusPending {
+			return nil, derr.ValidationError{Msg: "download " + id + " is not queued"}
+		}
+	}
+	mu := s.queueLock(userID)
+	mu.Lock()
+	err := s.repo.SetQueueOrder(ctx, userID, downloadIDs)
+	mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	logger.Info(s.logger, "download queue reordered", "userID", userID, "count", len(downloadIDs))
+	return s.DownloadQueue(ctx, userID)
+}
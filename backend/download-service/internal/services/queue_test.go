@@ -0,0 +1,136 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	derr "download-service/internal/errors"
+	"download-service/internal/models"
+	"github.com/stretchr/testify/require"
+)
+
+// newQueueTestService returns a service allowing one active download per user and
+// the given number of seeded games.
+func newQueueTestService(t *testing.T, games int) (*DownloadService, *memDownloadRepo, []string) {
+	t.Helper()
+	repo := newMemDownloadRepo()
+	svc, storage := newTestDownloadService(repo, mockLibrary{owned: true})
+	svc.defaultSpeed = 16 * 1024
+	svc.ConfigureQueue(1)
+	ids := make([]string, games)
+	for i := range ids {
+		ids[i] = "e2000000-0000-0000-0000-00000000000" + string(rune('1'+i))
+		seedGame(storage, ids[i])
+	}
+	return svc, repo, ids
+}
+
+func requireStatus(t *testing.T, repo *memDownloadRepo, id string, want models.DownloadStatus) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		got, err := repo.GetByID(context.Background(), id)
+		return err == nil && got.Status == want
+	}, 5*time.Second, 10*time.Millisecond, "download %s never became %s", id, want)
+}
+
+func TestQueue_LimitsActiveDownloads(t *testing.T) {
+	svc, repo, games := newQueueTestService(t, 3)
+	userID := "e1000000-0000-0000-0000-000000000001"
+	ctx := context.Background()
+
+	var started []string
+	for _, gameID := range games {
+		d, err := svc.StartDownload(ctx, userID, gameID)
+		require.NoError(t, err)
+		started = append(started, d.ID)
+	}
+	requireStatus(t, repo, started[0], models.StatusDownloading)
+	requireStatus(t, repo, started[1], models.StatusPending)
+	requireStatus(t, repo, started[2], models.StatusPending)
+	require.False(t, svc.stream.Active(started[1]))
+
+	// Another user's downloads have their own slots.
+	other, err := svc.StartDownload(ctx, "e1000000-0000-0000-0000-000000000002", games[0])
+	require.NoError(t, err)
+	require.Equal(t, models.StatusDownloading, other.Status)
+
+	require.NoError(t, svc.CancelDownload(ctx, userID, started[0]))
+	requireStatus(t, repo, started[1], models.StatusDownloading)
+	require.Eventually(t, func() bool { return svc.stream.Active(started[1]) }, 2*time.Second, 10*time.Millisecond)
+	requireStatus(t, repo, started[2], models.StatusPending)
+
+	history, err := svc.DownloadHistory(ctx, userID, started[1])
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	require.Equal(t, models.StatusPending, history[0].ToStatus)
+	require.Equal(t, models.ActorSystem, history[1].Actor)
+}
+
+func TestQueue_PromotesOnCompletion(t *testing.T) {
+	svc, repo, games := newQueueTestService(t, 2)
+	svc.defaultSpeed = 0
+	userID := "e1000000-0000-0000-0000-000000000003"
+	ctx := context.Background()
+
+	first, err := svc.StartDownload(ctx, userID, games[0])
+	require.NoError(t, err)
+	second, err := svc.StartDownload(ctx, userID, games[1])
+	require.NoError(t, err)
+
+	requireStatus(t, repo, first.ID, models.StatusCompleted)
+	requireStatus(t, repo, second.ID, models.StatusCompleted)
+}
+
+func TestQueue_PriorityAndReorder(t *testing.T) {
+	svc, repo, games := newQueueTestService(t, 4)
+	userID := "e1000000-0000-0000-0000-000000000004"
+	ctx := context.Background()
+
+	var ids []string
+	for _, gameID := range games {
+		d, err := svc.StartDownload(ctx, userID, gameID)
+		require.NoError(t, err)
+		ids = append(ids, d.ID)
+	}
+
+	require.NoError(t, svc.SetDownloadPriority(ctx, userID, ids[3], 50))
+	queue, err := svc.ReorderQueue(ctx, userID, []string{ids[2], ids[1]})
+	require.NoError(t, err)
+	require.Equal(t, []string{ids[3], ids[2], ids[1]}, []string{queue[0].ID, queue[1].ID, queue[2].ID})
+
+	_, err = svc.ReorderQueue(ctx, userID, []string{ids[0]})
+	require.True(t, errors.As(err, &derr.ValidationError{}), "running downloads cannot be reordered")
+	_, err = svc.ReorderQueue(ctx, userID, []string{ids[1], ids[1]})
+	require.True(t, errors.As(err, &derr.ValidationError{}))
+	_, err = svc.ReorderQueue(ctx, "e1000000-0000-0000-0000-000000000005", []string{ids[1]})
+	require.True(t, errors.As(err, &derr.AccessDeniedError{}))
+
+	require.NoError(t, svc.CancelDownload(ctx, userID, ids[0]))
+	requireStatus(t, repo, ids[3], models.StatusDownloading)
+	requireStatus(t, repo, ids[2], models.StatusPending)
+}
+
+func TestQueue_ResumeWaitsForSlot(t *testing.T) {
+	svc, repo, games := newQueueTestService(t, 2)
+	userID := "e1000000-0000-0000-0000-000000000006"
+	ctx := context.Background()
+
+	first, err := svc.StartDownload(ctx, userID, games[0])
+	require.NoError(t, err)
+	require.NoError(t, svc.PauseDownload(ctx, userID, first.ID))
+
+	// A paused download gives up its slot.
+	second, err := svc.StartDownload(ctx, userID, games[1])
+	require.NoError(t, err)
+	require.Equal(t, models.StatusDownloading, second.Status)
+
+	require.NoError(t, svc.ResumeDownload(ctx, userID, first.ID))
+	requireStatus(t, repo, first.ID, models.StatusPending)
+	require.True(t, sessionPaused(svc.stream, first.ID))
+
+	require.NoError(t, svc.CancelDownload(ctx, userID, second.ID))
+	requireStatus(t, repo, first.ID, models.StatusDownloading)
+	require.Eventually(t, func() bool { return !sessionPaused(svc.stream, first.ID) }, 2*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,195 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"download-service/internal/cache"
+	derr "download-service/internal/errors"
+	"download-service/internal/models"
+	"download-service/internal/observability"
+	"download-service/pkg/logger"
+)
+
+const (
+	defaultInstanceID = "local"
+	defaultLeaseTTL   = 30 * time.Second
+	// recoveryBatchSize bounds how many orphaned downloads one scan adopts.
+	recoveryBatchSize = 100
+)
+
+// RecoveryResult summarises one reconciliation pass.
+type RecoveryResult struct {
+	Resumed int // transfers restarted from persisted progress
+	Paused  int // paused downloads checked and left for the user to resume
+	Failed  int // downloads that could not be continued
+	Skipped int // downloads another replica claimed first
+}
+
+// ConfigureLeases sets the name this replica holds download leases under and how
+// long a lease stays valid without a heartbeat.
+func (s *DownloadService) ConfigureLeases(owner string, ttl time.Duration) {
+	if owner != "" {
+		s.instanceID = owner
+	}
+	if ttl > 0 {
+		s.leaseTTL = ttl
+	}
+}
+
+// acquireLease takes a download's lease on the row, the durable record of which
+// replica runs it, and then in the lease store that routes commands to the owner.
+func (s *DownloadService) acquireLease(ctx context.Context, downloadID string) (bool, error) {
+	ok, err := s.repo.AcquireLease(ctx, downloadID, s.instanceID, s.leaseTTL)
+	if err != nil || !ok {
+		return false, err
+	}
+	ok, err = s.leases.Acquire(ctx, downloadID, s.instanceID, s.leaseTTL)
+	if err != nil || !ok {
+		_ = s.repo.ReleaseLease(ctx, downloadID, s.instanceID)
+		return false, err
+	}
+	return true, nil
+}
+
+// renewLease extends both records of a lease; false means either was lost.
+func (s *DownloadService) renewLease(ctx context.Context, downloadID string) (bool, error) {
+	ok, err := s.repo.RenewLease(ctx, downloadID, s.instanceID, s.leaseTTL)
+	if err != nil || !ok {
+		return false, err
+	}
+	return s.leases.Renew(ctx, downloadID, s.instanceID, s.leaseTTL)
+}
+
+func (s *DownloadService) releaseLease(ctx context.Context, downloadID string) error {
+	err := s.leases.Release(ctx, downloadID, s.instanceID)
+	if rerr := s.repo.ReleaseLease(ctx, downloadID, s.instanceID); rerr != nil {
+		return rerr
+	}
+	return err
+}
+
+// RecoverDownloads adopts downloads whose replica is gone: downloading rows with no
+// lease (e.g. after a restart) and rows whose lease owner stopped heartbeating.
+// Downloads that can still be continued resume from their persisted file progress;
+// paused ones are checked and left paused; the rest are marked failed with a reason.
+// Orphans are paged by id, since recovering one changes the rows being listed.
+func (s *DownloadService) RecoverDownloads(ctx context.Context) (RecoveryResult, error) {
+	var res RecoveryResult
+	found := 0
+	for afterID := ""; ; {
+		batch, err := s.repo.ListOrphaned(ctx, time.Now(), afterID, recoveryBatchSize)
+		if err != nil {
+			return res, fmt.Errorf("list orphaned downloads: %w", err)
+		}
+		for i := range batch {
+			found++
+			if err := s.recoverDownload(ctx, &batch[i], &res); err != nil {
+				logger.Error(s.logger, "download recovery failed", "error", err, "downloadID", batch[i].ID)
+			}
+		}
+		if len(batch) < recoveryBatchSize {
+			break
+		}
+		afterID = batch[len(batch)-1].ID
+	}
+	if found > 0 {
+		logger.Info(s.logger, "download recovery finished", "resumed", res.Resumed, "paused", res.Paused, "failed", res.Failed, "skipped", res.Skipped)
+	}
+	return res, nil
+}
+
+func (s *DownloadService) recoverDownload(ctx context.Context, d *models.Download, res *RecoveryResult) error {
+	acquired, err := s.acquireLease(ctx, d.ID)
+	if err != nil {
+		return err
+	}
+	if !acquired || s.stream.Active(d.ID) {
+		res.Skipped++
+		return nil
+	}
+
+	files, err := s.fileRepo.ListByDownload(ctx, d.ID)
+	if err != nil {
+		_ = s.releaseLease(ctx, d.ID)
+		return err
+	}
+	if len(files) == 0 && d.TotalSize > 0 {
+		res.Failed++
+		return s.failRecovery(ctx, d, "no file records to resume from")
+	}
+	plan, err := s.planFor(ctx, d, files)
+	if err != nil {
+		if isPermanentPlanError(err) {
+			res.Failed++
+			return s.failRecovery(ctx, d, err.Error())
+		}
+		// Storage may be briefly unavailable; leave the download for the next scan.
+		_ = s.releaseLease(ctx, d.ID)
+		return err
+	}
+
+	if d.Status == models.StatusPaused {
+		res.Paused++
+		return s.releaseLease(ctx, d.ID)
+	}
+	res.Resumed++
+	logger.Info(s.logger, "download recovered", "downloadID", d.ID, "downloadedSize", d.DownloadedSize, "totalSize", d.TotalSize)
+	s.startStream(d, files, plan)
+	return nil
+}
+
+func isPermanentPlanError(err error) bool {
+	return errors.As(err, &derr.GameBuildNotFoundError{}) ||
+		errors.As(err, &derr.ManifestInvalidError{}) ||
+		errors.As(err, &derr.ValidationError{})
+}
+
+func (s *DownloadService) failRecovery(ctx context.Context, d *models.Download, reason string) error {
+	reason = "recovery: " + reason
+	s.publish(ctx, d.UserID, cache.DownloadEvent{Type: cache.EventError, DownloadID: d.ID, Status: string(models.StatusFailed), Error: reason})
+	if err := s.transition(ctx, d, models.StatusFailed, models.ReplicaActor(s.instanceID), reason); err != nil {
+		_ = s.releaseLease(ctx, d.ID)
+		return err
+	}
+	logger.Info(s.logger, "orphaned download failed", "downloadID", d.ID, "reason", reason)
+	observability.RecordDownloadStatus(observability.StatusFailed)
+	return s.releaseLease(ctx, d.ID)
+}
+
+// ReleaseLeases stops every local session and gives up its lease so another
+// replica can continue the transfer. It is called on graceful shutdown.
+func (s *DownloadService) ReleaseLeases(ctx context.Context) {
+	ids := s.stream.ActiveIDs()
+	for _, id := range ids {
+		s.stream.Stop(id)
+	}
+	for _, id := range ids {
+		for s.stream.Active(id) && ctx.Err() == nil {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if err := s.releaseLease(ctx, id); err != nil {
+			logger.Error(s.logger, "release download lease failed", "error", err, "downloadID", id)
+		}
+	}
+}
+
+// RunLeaseKeeper heartbeats the leases of this replica's sessions and adopts
+// orphaned downloads until ctx is cancelled.
+func (s *DownloadService) RunLeaseKeeper(ctx context.Context) {
+	ticker := time.NewTicker(s.leaseTTL / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		s.heartbeat(ctx)
+		if _, err := s.RecoverDownloads(ctx); err != nil {
+			logger.Error(s.logger, "orphaned download scan failed", "error", err)
+		}
+	}
+}
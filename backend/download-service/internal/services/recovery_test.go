@@ -0,0 +1,210 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"download-service/internal/clients/s3"
+	"download-service/internal/models"
+	"download-service/pkg/logger"
+	"github.com/stretchr/testify/require"
+)
+
+func newRecoveryService(t *testing.T, owner string) (*DownloadService, *memDownloadRepo, *memDownloadFileRepo, *s3.MockClient) {
+	t.Helper()
+	repo := newMemDownloadRepo()
+	fileRepo := newMemDownloadFileRepo()
+	storage := s3.NewMockClient()
+	svc := NewDownloadService(nil, nil, repo, fileRepo, newMemDownloadEventRepo(), NewStreamService(storage, nil), NewFileService(storage), mockLibrary{owned: true}, logger.New())
+	svc.defaultSpeed = 0
+	svc.ConfigureCluster(ClusterOptions{InstanceID: owner, LeaseTTL: time.Second})
+	return svc, repo, fileRepo, storage
+}
+
+// seedOrphan stores a download of the legacy archive as another process left it.
+func seedOrphan(t *testing.T, repo *memDownloadRepo, fileRepo *memDownloadFileRepo, gameID string, status models.DownloadStatus, downloaded int64) *models.Download {
+	t.Helper()
+	d := &models.Download{UserID: "b1000000-0000-0000-0000-000000000001", GameID: gameID, Status: status, Type: models.DownloadTypeFull, TotalSize: testGameSize, DownloadedSize: downloaded}
+	require.NoError(t, repo.Create(context.Background(), d))
+	require.NoError(t, fileRepo.Create(context.Background(), &models.DownloadFile{
+		DownloadID: d.ID, FileName: gameArchiveName, FilePath: gameArchiveName, ObjectKey: objectKeyForGame(gameID),
+		FileSize: testGameSize, DownloadedSize: downloaded, Status: models.StatusDownloading,
+	}))
+	return d
+}
+
+// holdLease records owner's lease on both the row and the lease store, as the
+// replica that started the download would.
+func holdLease(t *testing.T, svc *DownloadService, repo *memDownloadRepo, downloadID, owner string, ttl time.Duration) {
+	t.Helper()
+	ok, err := repo.AcquireLease(context.Background(), downloadID, owner, ttl)
+	require.NoError(t, err)
+	require.True(t, ok)
+	ok, err = svc.leases.Acquire(context.Background(), downloadID, owner, ttl)
+	require.NoError(t, err)
+	require.True(t, ok)
+}
+
+func TestRecoverDownloads_ResumesFromPersistedProgress(t *testing.T) {
+	svc, repo, fileRepo, storage := newRecoveryService(t, "replica-b")
+	gameID := "b1000000-0000-0000-0000-000000000002"
+	seedGame(storage, gameID)
+	d := seedOrphan(t, repo, fileRepo, gameID, models.StatusDownloading, testGameSize/2)
+
+	res, err := svc.RecoverDownloads(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, RecoveryResult{Resumed: 1}, res)
+
+	require.Eventually(t, func() bool {
+		got, _ := repo.GetByID(context.Background(), d.ID)
+		return got.Status == models.StatusCompleted
+	}, 5*time.Second, 10*time.Millisecond)
+	got, _ := repo.GetByID(context.Background(), d.ID)
+	require.Equal(t, int64(testGameSize), got.DownloadedSize)
+	require.Eventually(t, func() bool {
+		owners, _ := svc.leases.Owners(context.Background(), []string{d.ID})
+		got, _ := repo.GetByID(context.Background(), d.ID)
+		return len(owners) == 0 && got.LeaseOwner == ""
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestRecoverDownloads_FailsWithoutFileRecords(t *testing.T) {
+	svc, repo, fileRepo, _ := newRecoveryService(t, "replica-b")
+	d := seedOrphan(t, repo, fileRepo, "b1000000-0000-0000-0000-000000000003", models.StatusDownloading, 0)
+	require.NoError(t, fileRepo.DeleteByDownload(context.Background(), d.ID))
+
+	res, err := svc.RecoverDownloads(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, res.Failed)
+	got, _ := repo.GetByID(context.Background(), d.ID)
+	require.Equal(t, models.StatusFailed, got.Status)
+	require.Contains(t, got.FailureReason, "recovery")
+	require.Empty(t, got.LeaseOwner)
+	owners, _ := svc.leases.Owners(context.Background(), []string{d.ID})
+	require.Empty(t, owners)
+}
+
+func TestRecoverDownloads_PagesPastFailedOrphans(t *testing.T) {
+	svc, repo, _, _ := newRecoveryService(t, "replica-b")
+	n := recoveryBatchSize + recoveryBatchSize/2
+	for i := 0; i < n; i++ {
+		// No file records, so every one of them fails.
+		require.NoError(t, repo.Create(context.Background(), &models.Download{
+			ID: fmt.Sprintf("orphan-%03d", i), UserID: "b1000000-0000-0000-0000-000000000001", GameID: "b1000000-0000-0000-0000-000000000009",
+			Status: models.StatusDownloading, Type: models.DownloadTypeFull, TotalSize: testGameSize,
+		}))
+	}
+
+	// Failing the first page moves it out of the listing; the second page is still found.
+	res, err := svc.RecoverDownloads(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, RecoveryResult{Failed: n}, res)
+}
+
+func TestRecoverDownloads_FailsWhenManifestIsGone(t *testing.T) {
+	svc, repo, fileRepo, _ := newRecoveryService(t, "replica-b")
+	d := &models.Download{UserID: "b1000000-0000-0000-0000-000000000001", GameID: "b1000000-0000-0000-0000-000000000004", Status: models.StatusDownloading, Version: "9", TotalSize: 10}
+	require.NoError(t, repo.Create(context.Background(), d))
+	require.NoError(t, fileRepo.Create(context.Background(), &models.DownloadFile{DownloadID: d.ID, FileName: "a", FilePath: "a", FileSize: 10, Checksum: sha256Hex([]byte("a"))}))
+
+	res, err := svc.RecoverDownloads(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, res.Failed)
+	got, _ := repo.GetByID(context.Background(), d.ID)
+	require.Equal(t, models.StatusFailed, got.Status)
+	require.Contains(t, got.FailureReason, "game build not found")
+}
+
+func TestRecoverDownloads_RespectsLiveLeases(t *testing.T) {
+	svc, repo, fileRepo, storage := newRecoveryService(t, "replica-b")
+	gameID := "b1000000-0000-0000-0000-000000000005"
+	seedGame(storage, gameID)
+	live := seedOrphan(t, repo, fileRepo, gameID, models.StatusDownloading, 0)
+	holdLease(t, svc, repo, live.ID, "replica-a", time.Minute)
+
+	res, err := svc.RecoverDownloads(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, RecoveryResult{}, res)
+	require.False(t, svc.stream.Active(live.ID))
+
+	// replica-a stops heartbeating: its lease expires and replica-b adopts the download.
+	holdLease(t, svc, repo, live.ID, "replica-a", -time.Second)
+	res, err = svc.RecoverDownloads(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, res.Resumed)
+	require.Eventually(t, func() bool {
+		got, _ := repo.GetByID(context.Background(), live.ID)
+		return got.Status == models.StatusCompleted
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestRecoverDownloads_KeepsPausedDownloadsPaused(t *testing.T) {
+	svc, repo, fileRepo, storage := newRecoveryService(t, "replica-b")
+	gameID := "b1000000-0000-0000-0000-000000000006"
+	seedGame(storage, gameID)
+	d := seedOrphan(t, repo, fileRepo, gameID, models.StatusPaused, 1024)
+	holdLease(t, svc, repo, d.ID, "replica-a", -time.Second)
+
+	// The owner of the paused session died: the row is checked and its lease cleared.
+	res, err := svc.RecoverDownloads(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, RecoveryResult{Paused: 1}, res)
+	got, _ := repo.GetByID(context.Background(), d.ID)
+	require.Equal(t, models.StatusPaused, got.Status)
+	require.Empty(t, got.LeaseOwner)
+	require.False(t, svc.stream.Active(d.ID))
+
+	res, err = svc.RecoverDownloads(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, RecoveryResult{}, res)
+
+	// Resuming starts the transfer on whichever replica handles the request.
+	require.NoError(t, svc.ResumeDownload(context.Background(), d.UserID, d.ID))
+	owners, _ := svc.leases.Owners(context.Background(), []string{d.ID})
+	require.Equal(t, "replica-b", owners[d.ID])
+	require.Eventually(t, func() bool {
+		got, _ := repo.GetByID(context.Background(), d.ID)
+		return got.Status == models.StatusCompleted
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestHeartbeat_StopsSessionWhenLeaseIsLost(t *testing.T) {
+	svc, _, _, storage := newRecoveryService(t, "replica-b")
+	svc.defaultSpeed = 16 * 1024
+	gameID := "b1000000-0000-0000-0000-000000000007"
+	seedGame(storage, gameID)
+	d, err := svc.StartDownload(context.Background(), "b1000000-0000-0000-0000-000000000001", gameID)
+	require.NoError(t, err)
+	owners, _ := svc.leases.Owners(context.Background(), []string{d.ID})
+	require.Equal(t, "replica-b", owners[d.ID])
+
+	svc.heartbeat(context.Background())
+	require.True(t, svc.stream.Active(d.ID))
+
+	// Another replica took the download over after a missed heartbeat.
+	_, _ = svc.leases.Renew(context.Background(), d.ID, "replica-b", -time.Second)
+	ok, err := svc.leases.Acquire(context.Background(), d.ID, "replica-c", time.Minute)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	svc.heartbeat(context.Background())
+	require.Eventually(t, func() bool { return !svc.stream.Active(d.ID) }, 2*time.Second, 10*time.Millisecond)
+	owners, _ = svc.leases.Owners(context.Background(), []string{d.ID})
+	require.Equal(t, "replica-c", owners[d.ID])
+}
+
+func TestHeartbeat_AppliesPersistedStatus(t *testing.T) {
+	svc, repo, _, storage := newRecoveryService(t, "replica-b")
+	svc.defaultSpeed = 16 * 1024
+	gameID := "b1000000-0000-0000-0000-000000000008"
+	seedGame(storage, gameID)
+	d, err := svc.StartDownload(context.Background(), "b1000000-0000-0000-0000-000000000001", gameID)
+	require.NoError(t, err)
+
+	// A cancel forwarded from another replica was lost; the row still says cancelled.
+	require.NoError(t, repo.UpdateStatus(context.Background(), d.ID, models.StatusCancelled))
+	svc.heartbeat(context.Background())
+	require.Eventually(t, func() bool { return !svc.stream.Active(d.ID) }, 2*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,121 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"download-service/internal/cache"
+	derr "download-service/internal/errors"
+	"download-service/internal/models"
+	"download-service/pkg/logger"
+)
+
+// defaultOffPeak is the UTC off-peak window used until ConfigureSchedule is called.
+var defaultOffPeak = models.HourWindow{From: 2, To: 8}
+
+// ConfigureSchedule sets the UTC hours in which downloads scheduled off-peak may
+// transfer.
+func (s *DownloadService) ConfigureSchedule(offPeak models.HourWindow) {
+	s.offPeak = offPeak
+}
+
+// scheduleOpen reports whether d's schedule lets it transfer now.
+func (s *DownloadService) scheduleOpen(d *models.Download) bool {
+	return d.Schedule.Allows(time.Now(), s.offPeak)
+}
+
+// SetDownloadSchedule replaces when a download may transfer; an empty schedule
+// removes the restriction. A running download outside its new schedule is paused
+// until the schedule opens, and a queued one inside it may start at once.
+func (s *DownloadService) SetDownloadSchedule(ctx context.Context, userID, downloadID string, schedule *models.DownloadSchedule) (*models.Download, error) {
+	if err := schedule.Validate(); err != nil {
+		return nil, derr.ValidationError{Msg: "schedule: " + err.Error()}
+	}
+	if schedule.IsZero() {
+		schedule = nil
+	}
+	d, err := s.GetDownload(ctx, userID, downloadID)
+	if err != nil {
+		return nil, err
+	}
+	switch d.Status {
+	case models.StatusPending, models.StatusDownloading, models.StatusPaused:
+	default:
+		return nil, derr.ValidationError{Msg: "cannot schedule a download that has ended"}
+	}
+	if err := s.repo.UpdateSchedule(ctx, d.ID, schedule); err != nil {
+		return nil, err
+	}
+	d.Schedule = schedule
+	logger.Info(s.logger, "download schedule set", "downloadID", d.ID, "scheduled", schedule != nil)
+
+	switch {
+	case d.Status == models.StatusDownloading && !s.scheduleOpen(d):
+		if err := s.holdForSchedule(ctx, d, models.UserActor(userID)); err != nil {
+			return nil, err
+		}
+	case d.Status == models.StatusPending && s.scheduleOpen(d):
+		s.promote(ctx, userID)
+	}
+	return s.GetDownload(ctx, userID, d.ID)
+}
+
+// holdForSchedule pauses a running download whose schedule has closed and queues
+// it until the schedule opens again. Its session stays paused on the owning
+// replica, so the transfer later continues where it stopped.
+func (s *DownloadService) holdForSchedule(ctx context.Context, d *models.Download, actor string) error {
+	if err := s.transition(ctx, d, models.StatusPaused, actor, "schedule closed"); err != nil {
+		return err
+	}
+	if err := s.control(ctx, cache.Command{Op: cache.CommandPause, DownloadID: d.ID}); err != nil {
+		logger.Error(s.logger, "route pause command failed", "error", err, "downloadID", d.ID)
+	}
+	return s.transition(ctx, d, models.StatusPending, actor, "waiting for schedule to open")
+}
+
+// ApplySchedules pauses running downloads whose schedule has closed and starts
+// queued ones whose schedule has opened, as far as their users have free slots.
+// Every replica runs it; a download another replica handled first is skipped.
+func (s *DownloadService) ApplySchedules(ctx context.Context) error {
+	var closed []models.Download
+	opened := make(map[string]struct{})
+	for offset := 0; ; offset += recoveryBatchSize {
+		batch, err := s.repo.ListScheduled(ctx, recoveryBatchSize, offset)
+		if err != nil {
+			return err
+		}
+		for _, d := range batch {
+			open := s.scheduleOpen(&d)
+			switch {
+			case d.Status == models.StatusDownloading && !open:
+				closed = append(closed, d)
+			case d.Status == models.StatusPending && open:
+				opened[d.UserID] = struct{}{}
+			}
+		}
+		if len(batch) < recoveryBatchSize {
+			break
+		}
+	}
+
+	for i := range closed {
+		d := &closed[i]
+		err := s.holdForSchedule(ctx, d, models.ActorScheduler)
+		switch {
+		case err == nil:
+			logger.Info(s.logger, "download paused by schedule", "downloadID", d.ID, "userID", d.UserID)
+		case errors.As(err, &derr.InvalidTransitionError{}):
+			// Paused, cancelled or finished in the meantime.
+		default:
+			logger.Error(s.logger, "pause scheduled download failed", "error", err, "downloadID", d.ID)
+		}
+	}
+	for userID := range opened {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		s.promote(ctx, userID)
+	}
+	return nil
+}
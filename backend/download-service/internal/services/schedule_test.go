@@ -0,0 +1,119 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	derr "download-service/internal/errors"
+	"download-service/internal/models"
+	"github.com/stretchr/testify/require"
+)
+
+// hoursFromNow returns the UTC window from now+from to now+to hours. Windows are
+// kept an hour clear of now so a test cannot straddle a window edge.
+func hoursFromNow(from, to int) *models.DownloadSchedule {
+	h := time.Now().UTC().Hour()
+	return &models.DownloadSchedule{Windows: []models.HourWindow{{From: (h + from + 24) % 24, To: (h + to + 24) % 24}}}
+}
+
+func newScheduleTestService(t *testing.T) (*DownloadService, *memDownloadRepo, string) {
+	t.Helper()
+	repo := newMemDownloadRepo()
+	svc, storage := newTestDownloadService(repo, mockLibrary{owned: true})
+	svc.defaultSpeed = 16 * 1024
+	gameID := "e5000000-0000-0000-0000-000000000001"
+	seedGame(storage, gameID)
+	t.Cleanup(func() {
+		for _, id := range svc.stream.ActiveIDs() {
+			svc.stream.Stop(id)
+		}
+	})
+	return svc, repo, gameID
+}
+
+func TestSchedule_StartsWhenWindowOpens(t *testing.T) {
+	svc, repo, gameID := newScheduleTestService(t)
+	userID := "e6000000-0000-0000-0000-000000000001"
+	ctx := context.Background()
+
+	d, err := svc.Start(ctx, userID, DownloadRequest{GameID: gameID, Schedule: hoursFromNow(2, 4)})
+	require.NoError(t, err)
+	require.Equal(t, models.StatusPending, d.Status)
+	require.False(t, svc.stream.Active(d.ID))
+
+	// The scheduler leaves it alone while the window is closed.
+	require.NoError(t, svc.ApplySchedules(ctx))
+	requireStatus(t, repo, d.ID, models.StatusPending)
+
+	// Moving the window over now starts it.
+	require.NoError(t, repo.UpdateSchedule(ctx, d.ID, hoursFromNow(-1, 2)))
+	require.NoError(t, svc.ApplySchedules(ctx))
+	requireStatus(t, repo, d.ID, models.StatusDownloading)
+	require.True(t, svc.stream.Active(d.ID))
+}
+
+func TestSchedule_PausesWhenWindowCloses(t *testing.T) {
+	svc, repo, gameID := newScheduleTestService(t)
+	userID := "e6000000-0000-0000-0000-000000000002"
+	ctx := context.Background()
+
+	d, err := svc.StartDownload(ctx, userID, gameID)
+	require.NoError(t, err)
+	require.Equal(t, models.StatusDownloading, d.Status)
+
+	d, err = svc.SetDownloadSchedule(ctx, userID, d.ID, hoursFromNow(2, 4))
+	require.NoError(t, err)
+	require.Equal(t, models.StatusPending, d.Status)
+	require.True(t, sessionPaused(svc.stream, d.ID))
+
+	// Clearing the schedule starts it again.
+	d, err = svc.SetDownloadSchedule(ctx, userID, d.ID, nil)
+	require.NoError(t, err)
+	require.Equal(t, models.StatusDownloading, d.Status)
+
+	// A user resuming outside the schedule keeps waiting for it.
+	require.NoError(t, svc.PauseDownload(ctx, userID, d.ID))
+	require.NoError(t, repo.UpdateSchedule(ctx, d.ID, hoursFromNow(2, 4)))
+	require.NoError(t, svc.ResumeDownload(ctx, userID, d.ID))
+	requireStatus(t, repo, d.ID, models.StatusPending)
+
+	// The scheduler resumes the session when the window opens and pauses it on close.
+	require.NoError(t, repo.UpdateSchedule(ctx, d.ID, hoursFromNow(-1, 2)))
+	require.NoError(t, svc.ApplySchedules(ctx))
+	requireStatus(t, repo, d.ID, models.StatusDownloading)
+	require.Eventually(t, func() bool { return !sessionPaused(svc.stream, d.ID) }, 2*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, repo.UpdateSchedule(ctx, d.ID, hoursFromNow(2, 4)))
+	require.NoError(t, svc.ApplySchedules(ctx))
+	requireStatus(t, repo, d.ID, models.StatusPending)
+	require.True(t, sessionPaused(svc.stream, d.ID))
+
+	history, err := svc.DownloadHistory(ctx, userID, d.ID)
+	require.NoError(t, err)
+	last := history[len(history)-2:]
+	require.Equal(t, models.StatusPaused, last[0].ToStatus)
+	require.Equal(t, models.ActorScheduler, last[0].Actor)
+	require.Equal(t, models.StatusPending, last[1].ToStatus)
+}
+
+func TestSchedule_Validation(t *testing.T) {
+	svc, _, gameID := newScheduleTestService(t)
+	userID := "e6000000-0000-0000-0000-000000000003"
+	ctx := context.Background()
+
+	_, err := svc.Start(ctx, userID, DownloadRequest{GameID: gameID, Schedule: &models.DownloadSchedule{Timezone: "Nowhere/Special"}})
+	require.True(t, errors.As(err, &derr.ValidationError{}))
+
+	d, err := svc.StartDownload(ctx, userID, gameID)
+	require.NoError(t, err)
+	_, err = svc.SetDownloadSchedule(ctx, userID, d.ID, &models.DownloadSchedule{Windows: []models.HourWindow{{From: 3, To: 3}}})
+	require.True(t, errors.As(err, &derr.ValidationError{}))
+	_, err = svc.SetDownloadSchedule(ctx, "e6000000-0000-0000-0000-000000000004", d.ID, hoursFromNow(2, 4))
+	require.True(t, errors.As(err, &derr.AccessDeniedError{}))
+
+	require.NoError(t, svc.CancelDownload(ctx, userID, d.ID))
+	_, err = svc.SetDownloadSchedule(ctx, userID, d.ID, hoursFromNow(2, 4))
+	require.True(t, errors.As(err, &derr.ValidationError{}), "finished downloads cannot be scheduled")
+}
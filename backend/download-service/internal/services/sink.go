@@ -0,0 +1,95 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// SinkFile is an open destination for one transferred file.
+type SinkFile interface {
+	io.WriterAt
+	io.Closer
+}
+
+// Sink is the destination for bytes pulled out of storage by the transfer engine.
+type Sink interface {
+	Open(downloadID string, file TransferFile) (SinkFile, error)
+}
+
+// StagedFile is a transferred file opened for reading.
+type StagedFile interface {
+	io.ReaderAt
+	io.Closer
+}
+
+// StagedSink is a sink whose files can be read back once written, so a download
+// can be verified against the bytes it actually staged.
+type StagedSink interface {
+	Sink
+	OpenStaged(downloadID, filePath string) (StagedFile, error)
+}
+
+// DirSink writes transferred files below Root/<downloadID>/<file path>.
+type DirSink struct {
+	Root string
+}
+
+func (s DirSink) filePath(downloadID, p string) (string, error) {
+	rel := cleanRelativePath(p)
+	if rel == "" {
+		return "", fmt.Errorf("sink: invalid file path %q", p)
+	}
+	return filepath.Join(s.Root, downloadID, filepath.FromSlash(rel)), nil
+}
+
+// Open creates (or reopens for resume) the destination file and its parent directories.
+func (s DirSink) Open(downloadID string, file TransferFile) (SinkFile, error) {
+	full, err := s.filePath(downloadID, file.Path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+		return nil, fmt.Errorf("sink: create directory: %w", err)
+	}
+	f, err := os.OpenFile(full, os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("sink: open file: %w", err)
+	}
+	return f, nil
+}
+
+// OpenStaged opens a transferred file for reading. A file that was never written
+// returns an error wrapping os.ErrNotExist.
+func (s DirSink) OpenStaged(downloadID, filePath string) (StagedFile, error) {
+	full, err := s.filePath(downloadID, filePath)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(full)
+	if err != nil {
+		return nil, fmt.Errorf("sink: open staged file: %w", err)
+	}
+	return f, nil
+}
+
+// DiscardSink drops transferred bytes. It is used when only byte accounting is needed.
+type DiscardSink struct{}
+
+func (DiscardSink) Open(downloadID string, file TransferFile) (SinkFile, error) {
+	return discardFile{}, nil
+}
+
+type discardFile struct{}
+
+func (discardFile) WriteAt(p []byte, off int64) (int, error) { return len(p), nil }
+func (discardFile) Close() error                               { return nil }
+
+// cleanRelativePath normalises a manifest path and strips any attempt to escape the download root.
+func cleanRelativePath(p string) string {
+	cleaned := path.Clean("/" + strings.ReplaceAll(p, "\\", "/"))
+	return strings.TrimPrefix(cleaned, "/")
+}
@@ -0,0 +1,75 @@
+package services
+
+import (
+	"context"
+
+	derr "download-service/internal/errors"
+	"download-service/internal/models"
+	"download-service/pkg/logger"
+)
+
+// transition moves d to status to if the state machine allows it and d is still in
+// the status it was read with, records who did it and why, and notifies subscribers.
+// reason becomes the failure reason when to is StatusFailed. Leaving downloading
+// frees a slot, so the user's next queued download is started.
+func (s *DownloadService) transition(ctx context.Context, d *models.Download, to models.DownloadStatus, actor, reason string) error {
+	if !models.CanTransition(d.Status, to) {
+		return derr.InvalidTransitionError{ID: d.ID, From: string(d.Status), To: string(to)}
+	}
+	return s.applyTransition(ctx, d, to, actor, reason)
+}
+
+// applyTransition is transition without the state machine check, for the moves
+// only operators may make, such as retrying a failed download.
+func (s *DownloadService) applyTransition(ctx context.Context, d *models.Download, to models.DownloadStatus, actor, reason string) error {
+	from := d.Status
+	ok, err := s.repo.Transition(ctx, d.ID, from, to, reason)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		// Another request moved the download first; report its current status.
+		if cur, err := s.repo.GetByID(ctx, d.ID); err == nil {
+			from = cur.Status
+		}
+		return derr.InvalidTransitionError{ID: d.ID, From: string(from), To: string(to)}
+	}
+	d.Status = to
+	if to == models.StatusFailed {
+		d.FailureReason = reason
+	}
+	s.recordTransition(ctx, d.ID, from, to, actor, reason)
+	s.publishStatus(ctx, d)
+	s.promoteAfter(from, d.UserID)
+	return nil
+}
+
+// finish applies the outcome of a transfer to whatever status the download has
+// now. It is a no-op if the user cancelled the download in the meantime.
+func (s *DownloadService) finish(ctx context.Context, downloadID string, to models.DownloadStatus, reason string) {
+	d, err := s.repo.GetByID(ctx, downloadID)
+	if err != nil {
+		logger.Error(s.logger, "load download to finish failed", "error", err, "downloadID", downloadID)
+		return
+	}
+	if err := s.transition(ctx, d, to, models.ActorSystem, reason); err != nil {
+		logger.Error(s.logger, "finish download failed", "error", err, "downloadID", downloadID, "status", to)
+	}
+}
+
+// recordTransition appends to the download's history. History is diagnostic, so a
+// failed write is logged rather than undoing the transition.
+func (s *DownloadService) recordTransition(ctx context.Context, downloadID string, from, to models.DownloadStatus, actor, reason string) {
+	e := &models.DownloadEvent{DownloadID: downloadID, FromStatus: from, ToStatus: to, Actor: actor, Reason: reason}
+	if err := s.history.Create(ctx, e); err != nil {
+		logger.Error(s.logger, "record download transition failed", "error", err, "downloadID", downloadID, "from", from, "to", to)
+	}
+}
+
+// DownloadHistory returns the status transitions of a download the user owns, oldest first.
+func (s *DownloadService) DownloadHistory(ctx context.Context, userID, downloadID string) ([]models.DownloadEvent, error) {
+	if _, err := s.GetDownload(ctx, userID, downloadID); err != nil {
+		return nil, err
+	}
+	return s.history.ListByDownload(ctx, downloadID)
+}
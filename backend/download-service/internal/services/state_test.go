@@ -0,0 +1,83 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	derr "download-service/internal/errors"
+	"download-service/internal/models"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransitions_RejectInvalidMoves(t *testing.T) {
+	repo := newMemDownloadRepo()
+	svc, storage := newTestDownloadService(repo, mockLibrary{owned: true})
+	svc.defaultSpeed = 16 * 1024
+	userID := "f1000000-0000-0000-0000-000000000001"
+	gameID := "f1000000-0000-0000-0000-000000000002"
+	seedGame(storage, gameID)
+	ctx := context.Background()
+
+	d, err := svc.StartDownload(ctx, userID, gameID)
+	require.NoError(t, err)
+
+	var terr derr.InvalidTransitionError
+	require.True(t, errors.As(svc.ResumeDownload(ctx, userID, d.ID), &terr))
+	require.Equal(t, string(models.StatusDownloading), terr.From)
+
+	require.NoError(t, svc.PauseDownload(ctx, userID, d.ID))
+	require.True(t, errors.As(svc.PauseDownload(ctx, userID, d.ID), &terr))
+	require.Equal(t, string(models.StatusPaused), terr.From)
+
+	require.NoError(t, svc.CancelDownload(ctx, userID, d.ID))
+	require.True(t, errors.As(svc.CancelDownload(ctx, userID, d.ID), &terr))
+	require.True(t, errors.As(svc.ResumeDownload(ctx, userID, d.ID), &terr))
+	require.Equal(t, string(models.StatusCancelled), terr.From)
+}
+
+func TestTransitions_RecordHistory(t *testing.T) {
+	repo := newMemDownloadRepo()
+	svc, storage := newTestDownloadService(repo, mockLibrary{owned: true})
+	svc.defaultSpeed = 0
+	userID := "f1000000-0000-0000-0000-000000000003"
+	gameID := "f1000000-0000-0000-0000-000000000004"
+	seedGame(storage, gameID)
+	ctx := context.Background()
+
+	d, err := svc.StartDownload(ctx, userID, gameID)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		got, _ := repo.GetByID(ctx, d.ID)
+		return got.Status == models.StatusCompleted
+	}, 5*time.Second, 10*time.Millisecond)
+
+	history, err := svc.DownloadHistory(ctx, userID, d.ID)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	require.Equal(t, models.DownloadStatus(""), history[0].FromStatus)
+	require.Equal(t, models.StatusDownloading, history[0].ToStatus)
+	require.Equal(t, models.UserActor(userID), history[0].Actor)
+	require.Equal(t, models.StatusDownloading, history[1].FromStatus)
+	require.Equal(t, models.StatusCompleted, history[1].ToStatus)
+	require.Equal(t, models.ActorSystem, history[1].Actor)
+
+	_, err = svc.DownloadHistory(ctx, "f1000000-0000-0000-0000-000000000009", d.ID)
+	require.True(t, errors.As(err, &derr.AccessDeniedError{}))
+}
+
+func TestTransitions_RecordFailureReason(t *testing.T) {
+	svc, repo, fileRepo, _ := newRecoveryService(t, "replica-b")
+	d := seedOrphan(t, repo, fileRepo, "f1000000-0000-0000-0000-000000000005", models.StatusDownloading, 0)
+	require.NoError(t, fileRepo.DeleteByDownload(context.Background(), d.ID))
+
+	_, err := svc.RecoverDownloads(context.Background())
+	require.NoError(t, err)
+	history, err := svc.DownloadHistory(context.Background(), d.UserID, d.ID)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	require.Equal(t, models.StatusFailed, history[0].ToStatus)
+	require.Equal(t, models.ReplicaActor("replica-b"), history[0].Actor)
+	require.Contains(t, history[0].Reason, "no file records")
+}
@@ -2,130 +2,593 @@ package services
 
 import (
     "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "hash"
+    "io"
     "sync"
     "time"
+
+    "download-service/internal/clients/s3"
+    derr "download-service/internal/errors"
+
+    "golang.org/x/time/rate"
+)
+
+const (
+    defaultChunkSize        = 4 * 1024 * 1024 // bytes requested per ranged read
+    defaultBufferSize       = 32 * 1024       // bytes copied (and rate limited) per write
+    defaultProgressInterval = 1 * time.Second
+    defaultChunkRetries     = 3
+    minBurst                = 512 // smallest write the limiter admits at once
 )
 
-// StreamUpdate carries incremental progress information to the caller on every tick.
+// ErrStreamStopped is passed to onDone when a session was stopped before it finished.
+var ErrStreamStopped = errors.New("stream stopped")
+
+// TransferError reports the file a transfer failed on.
+type TransferError struct {
+    FileID string
+    Err    error
+}
+
+func (e *TransferError) Error() string { return e.Err.Error() }
+func (e *TransferError) Unwrap() error { return e.Err }
+
+// TransferFile describes one destination file written by the transfer engine.
+type TransferFile struct {
+    ID         string // models.DownloadFile ID progress is recorded against
+    ObjectKey  string // source object in storage, copied whole when Segments is empty
+    Path       string // destination path relative to the download root
+    Size       int64  // bytes to transfer (the sum of Segments when set)
+    Downloaded int64  // bytes already written; the transfer resumes from here
+    Segments   []TransferSegment
+}
+
+// TransferSegment is a byte range of a storage object written at Offset of the destination file.
+type TransferSegment struct {
+    ObjectKey    string
+    SourceOffset int64
+    Offset       int64
+    Size         int64
+    SHA256       string // when set, the segment is verified after it is written
+}
+
+// segments returns the ranges to copy, treating a file without explicit segments as one whole object.
+func (f *TransferFile) segments() []TransferSegment {
+    if len(f.Segments) > 0 {
+        return f.Segments
+    }
+    return []TransferSegment{{ObjectKey: f.ObjectKey, Size: f.Size}}
+}
+
+// StreamUpdate carries incremental progress information to the caller.
 type StreamUpdate struct {
     DownloadID     string
+    FileID         string
+    FileDownloaded int64
+    FileCompleted  bool
     DownloadedSize int64
     TotalSize      int64
-    Speed          int64
+    Speed          int64 // measured throughput in bytes per second
 }
 
-// StreamService manages in-memory download progress simulation for MVP.
-// It drives periodic ticks and supports pause/resume.
+// StreamService is the transfer engine. Each session copies its files out of
+// storage in ranged chunks, writes them to the sink and reports real progress.
+// Sessions can be paused, resumed, throttled and stopped, and share the replica's
+// bandwidth as set by ConfigureBandwidth.
 type StreamService struct {
-    mu       sync.Mutex
-    sessions map[string]*session
+    storage s3.Interface
+    sink    Sink
+
+    mu          sync.Mutex
+    sessions    map[string]*session
+    bandwidth   BandwidthOptions
+    rebalanceMu sync.Mutex
+
+    chunkSize        int64
+    bufferSize       int
+    progressInterval time.Duration
+    chunkRetries     int
 }
 
 type session struct {
-    id         string
-    total      int64
-    downloaded int64
-    speed      int64
-    paused     bool
-    stopped    bool
-    ticker     *time.Ticker
-    cancel     context.CancelFunc
+    id      string
+    files   []TransferFile
+    total   int64
+    limiter *rate.Limiter
+    cancel  context.CancelFunc
+
+    // Scheduling inputs, guarded by StreamService.mu.
+    userID   string
+    weight   int
+    maxRate  int64 // the session's own limit; <= 0 means none
+    userRate int64 // the user's budget when it differs from the node default
+
+    mu          sync.Mutex
+    paused      bool
+    resumed     chan struct{}
+    stopped     bool
+    downloaded  int64
+    rateChanged chan struct{} // closed and replaced when the limit changes
 }
 
-func NewStreamService() *StreamService { return &StreamService{sessions: make(map[string]*session)} }
+func NewStreamService(storage s3.Interface, sink Sink) *StreamService {
+    if sink == nil {
+        sink = DiscardSink{}
+    }
+    return &StreamService{
+        storage:          storage,
+        sink:             sink,
+        sessions:         make(map[string]*session),
+        chunkSize:        defaultChunkSize,
+        bufferSize:       defaultBufferSize,
+        progressInterval: defaultProgressInterval,
+        chunkRetries:     defaultChunkRetries,
+    }
+}
 
-// Start begins a session with a given total size and bytes-per-second speed.
+// Start begins transferring files for a download, limited to bytesPerSecond (<= 0 means unlimited).
+// onTick is invoked from the session goroutine; returning true stops the session.
+// onDone receives nil on completion, ErrStreamStopped when stopped, or the transfer error.
 // If a session already exists, it is resumed.
-func (ss *StreamService) Start(ctx context.Context, downloadID string, startingDownloaded, totalSize, speed int64, onTick func(StreamUpdate) bool, onDone func()) {
+func (ss *StreamService) Start(ctx context.Context, downloadID string, files []TransferFile, bytesPerSecond int64, onTick func(StreamUpdate) bool, onDone func(error)) {
+    ss.StartWith(ctx, downloadID, files, SessionOptions{BytesPerSecond: bytesPerSecond}, onTick, onDone)
+}
+
+// StartWith is Start for a session that shares bandwidth as described by opts.
+// It reports whether a new session was started; onTick and onDone are only used
+// by a new session.
+func (ss *StreamService) StartWith(ctx context.Context, downloadID string, files []TransferFile, opts SessionOptions, onTick func(StreamUpdate) bool, onDone func(error)) bool {
     ss.mu.Lock()
     if s, ok := ss.sessions[downloadID]; ok {
-        // resume existing
-        s.paused = false
         ss.mu.Unlock()
-        return
+        s.resume()
+        ss.rebalance()
+        return false
     }
     cctx, cancel := context.WithCancel(ctx)
+    limit := limitFor(opts.BytesPerSecond)
     s := &session{
-        id:         downloadID,
-        total:      totalSize,
-        downloaded: startingDownloaded,
-        speed:      speed,
-        paused:     false,
-        stopped:    false,
-        ticker:     time.NewTicker(1 * time.Second),
-        cancel:     cancel,
+        id:      downloadID,
+        files:   append([]TransferFile(nil), files...),
+        limiter: rate.NewLimiter(limit, burstFor(limit, ss.bufferSize)),
+        cancel:  cancel,
+        userID:   opts.UserID,
+        weight:   normalWeight(opts.Weight),
+        maxRate:  opts.BytesPerSecond,
+        userRate: opts.UserBytesPerSecond,
+
+        rateChanged: make(chan struct{}),
+    }
+    for _, f := range s.files {
+        s.total += f.Size
+        s.downloaded += minInt64(f.Downloaded, f.Size)
     }
     ss.sessions[downloadID] = s
     ss.mu.Unlock()
+    ss.rebalance()
 
     go func() {
-        defer func() {
-            s.ticker.Stop()
-            ss.mu.Lock()
-            delete(ss.sessions, downloadID)
-            ss.mu.Unlock()
-            if onDone != nil {
-                onDone()
-            }
-        }()
-        for {
-            select {
-            case <-cctx.Done():
-                return
-            case <-s.ticker.C:
-                if s.stopped || s.paused {
-                    continue
-                }
-                // advance progress
-                s.downloaded += s.speed
-                if s.downloaded > s.total {
-                    s.downloaded = s.total
-                }
-                if onTick != nil {
-                    if stop := onTick(StreamUpdate{DownloadID: s.id, DownloadedSize: s.downloaded, TotalSize: s.total, Speed: s.speed}); stop {
-                        return
-                    }
-                }
-                if s.downloaded >= s.total {
-                    return
-                }
-            }
+        err := ss.run(cctx, s, onTick)
+        cancel()
+        ss.mu.Lock()
+        delete(ss.sessions, downloadID)
+        ss.mu.Unlock()
+        ss.rebalance()
+        if onDone != nil {
+            onDone(err)
         }
     }()
+    return true
 }
 
-func (ss *StreamService) Pause(downloadID string) {
+// Active reports whether a session exists for the download.
+func (ss *StreamService) Active(downloadID string) bool {
     ss.mu.Lock()
-    if s, ok := ss.sessions[downloadID]; ok {
-        s.paused = true
-    }
-    ss.mu.Unlock()
+    defer ss.mu.Unlock()
+    _, ok := ss.sessions[downloadID]
+    return ok
 }
 
-func (ss *StreamService) SetSpeed(downloadID string, bytesPerSecond int64) {
+// ActiveIDs returns the downloads that have a session in this process, paused or not.
+func (ss *StreamService) ActiveIDs() []string {
     ss.mu.Lock()
     defer ss.mu.Unlock()
-    if s, ok := ss.sessions[downloadID]; ok {
-        if bytesPerSecond > 0 {
-            s.speed = bytesPerSecond
-        }
+    ids := make([]string, 0, len(ss.sessions))
+    for id := range ss.sessions {
+        ids = append(ids, id)
     }
+    return ids
 }
 
-func (ss *StreamService) Resume(downloadID string) {
+// Pause suspends a session and hands its bandwidth to the others.
+func (ss *StreamService) Pause(downloadID string) {
+    if s := ss.get(downloadID); s != nil {
+        s.pause()
+        ss.rebalance()
+    }
+}
+
+// SetSpeed changes the bytes-per-second limit of a running session. The session
+// may get less when the node or user budget is contended. Non-positive values are ignored.
+func (ss *StreamService) SetSpeed(downloadID string, bytesPerSecond int64) {
+    if bytesPerSecond <= 0 {
+        return
+    }
     ss.mu.Lock()
-    if s, ok := ss.sessions[downloadID]; ok {
-        s.paused = false
+    s, ok := ss.sessions[downloadID]
+    if ok {
+        s.maxRate = bytesPerSecond
     }
     ss.mu.Unlock()
+    if ok {
+        ss.rebalance()
+    }
+}
+
+func (ss *StreamService) Resume(downloadID string) {
+    if s := ss.get(downloadID); s != nil {
+        s.resume()
+        ss.rebalance()
+    }
 }
 
 func (ss *StreamService) Stop(downloadID string) {
-    ss.mu.Lock()
-    if s, ok := ss.sessions[downloadID]; ok {
+    if s := ss.get(downloadID); s != nil {
+        s.mu.Lock()
         s.stopped = true
+        s.mu.Unlock()
         s.cancel()
     }
-    ss.mu.Unlock()
 }
 
+func (ss *StreamService) get(downloadID string) *session {
+    ss.mu.Lock()
+    defer ss.mu.Unlock()
+    return ss.sessions[downloadID]
+}
+
+func limitFor(bytesPerSecond int64) rate.Limit {
+    if bytesPerSecond <= 0 {
+        return rate.Inf
+    }
+    return rate.Limit(bytesPerSecond)
+}
+
+// run copies every file of the session in order and returns the terminal error, if any.
+func (ss *StreamService) run(ctx context.Context, s *session, onTick func(StreamUpdate) bool) error {
+    p := &progress{s: s, onTick: onTick, interval: ss.progressInterval, last: time.Now()}
+    buf := make([]byte, ss.bufferSize)
+    for i := range s.files {
+        f := &s.files[i]
+        if f.Size > 0 && f.Downloaded >= f.Size {
+            continue
+        }
+        if err := ss.copyFile(ctx, s, f, buf, p); err != nil {
+            return s.terminalError(&TransferError{FileID: f.ID, Err: err})
+        }
+        if p.emit(f, true) {
+            return ErrStreamStopped
+        }
+    }
+    return nil
+}
+
+func (ss *StreamService) copyFile(ctx context.Context, s *session, f *TransferFile, buf []byte, p *progress) error {
+    w, err := ss.sink.Open(s.id, *f)
+    if err != nil {
+        return err
+    }
+    defer w.Close()
+
+    var base int64 // position of the current segment in the file's transfer stream
+    for _, seg := range f.segments() {
+        segEnd := base + seg.Size
+        if f.Downloaded >= segEnd {
+            base = segEnd
+            continue
+        }
+        if err := ss.copySegment(ctx, s, f, seg, base, w, buf, p); err != nil {
+            return err
+        }
+        base = segEnd
+    }
+    return nil
+}
+
+// copySegment copies the rest of one segment. Segments with a digest are hashed as
+// they are written; a mismatch discards the segment and fetches it again, so only
+// the bad chunk is re-downloaded.
+func (ss *StreamService) copySegment(ctx context.Context, s *session, f *TransferFile, seg TransferSegment, base int64, w SinkFile, buf []byte, p *progress) error {
+    if seg.SHA256 != "" && f.Downloaded > base {
+        // Bytes written before a restart cannot be hashed; fetch the whole segment again.
+        s.rewind(f, base)
+    }
+    for attempt := 0; ; attempt++ {
+        var h hash.Hash
+        if seg.SHA256 != "" {
+            h = sha256.New()
+        }
+        for f.Downloaded < base+seg.Size {
+            if err := s.waitIfPaused(ctx); err != nil {
+                return err
+            }
+            var chunkErr error
+            for try := 0; try <= ss.chunkRetries; try++ {
+                if try > 0 {
+                    if err := sleepCtx(ctx, time.Duration(200*(1<<(try-1)))*time.Millisecond); err != nil {
+                        return err
+                    }
+                }
+                chunkErr = ss.copyChunk(ctx, s, f, seg, base, w, buf, p, h)
+                if chunkErr == nil || !retriableChunkError(ctx, chunkErr) {
+                    break
+                }
+            }
+            if chunkErr != nil {
+                return chunkErr
+            }
+        }
+        if h == nil || hex.EncodeToString(h.Sum(nil)) == seg.SHA256 {
+            return nil
+        }
+        s.rewind(f, base)
+        if attempt >= ss.chunkRetries {
+            return derr.ChunkCorruptedError{ObjectKey: seg.ObjectKey, Offset: seg.Offset, Size: seg.Size}
+        }
+    }
+}
+
+// copyChunk transfers one ranged read of seg starting at f.Downloaded. Progress made
+// before a failure is kept, so a retry only re-fetches the remainder.
+func (ss *StreamService) copyChunk(ctx context.Context, s *session, f *TransferFile, seg TransferSegment, base int64, w SinkFile, buf []byte, p *progress, h hash.Hash) error {
+    within := f.Downloaded - base
+    length := minInt64(ss.chunkSize, seg.Size-within)
+    start := f.Downloaded
+    end := start + length
+    rc, err := ss.storage.GetObjectRange(ctx, seg.ObjectKey, seg.SourceOffset+within, length)
+    if err != nil {
+        return fmt.Errorf("read %s: %w", seg.ObjectKey, err)
+    }
+    defer rc.Close()
+
+    for f.Downloaded < end {
+        if err := s.waitIfPaused(ctx); err != nil {
+            return err
+        }
+        // Writes are no larger than the limiter's burst, so each wait is short.
+        want := minInt64(int64(minInt(len(buf), s.limiter.Burst())), end-f.Downloaded)
+        n, readErr := io.ReadFull(rc, buf[:want])
+        if n > 0 {
+            if err := s.throttle(ctx, n); err != nil {
+                return err
+            }
+            if _, err := w.WriteAt(buf[:n], seg.Offset+within+(f.Downloaded-start)); err != nil {
+                return fmt.Errorf("write %s: %w", f.Path, err)
+            }
+            if h != nil {
+                h.Write(buf[:n])
+            }
+            f.Downloaded += int64(n)
+            s.addDownloaded(int64(n))
+            if p.due() && p.emit(f, false) {
+                return ErrStreamStopped
+            }
+        }
+        if readErr != nil {
+            if errors.Is(readErr, io.EOF) || errors.Is(readErr, io.ErrUnexpectedEOF) {
+                if f.Downloaded < end {
+                    return fmt.Errorf("read %s: %w", seg.ObjectKey, io.ErrUnexpectedEOF)
+                }
+                return nil
+            }
+            return fmt.Errorf("read %s: %w", seg.ObjectKey, readErr)
+        }
+    }
+    return nil
+}
+
+func retriableChunkError(ctx context.Context, err error) bool {
+    if ctx.Err() != nil || errors.Is(err, ErrStreamStopped) {
+        return false
+    }
+    if errors.Is(err, s3.ErrNotFound) || errors.Is(err, s3.ErrInvalidRange) {
+        return false
+    }
+    return true
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) error {
+    t := time.NewTimer(d)
+    defer t.Stop()
+    select {
+    case <-ctx.Done():
+        return ctx.Err()
+    case <-t.C:
+        return nil
+    }
+}
+
+func minInt(a, b int) int {
+    if a < b {
+        return a
+    }
+    return b
+}
+
+func maxInt(a, b int) int {
+    if a > b {
+        return a
+    }
+    return b
+}
+
+func minInt64(a, b int64) int64 {
+    if a < b {
+        return a
+    }
+    return b
+}
+
+// progress throttles onTick callbacks and measures throughput between them.
+type progress struct {
+    s         *session
+    onTick    func(StreamUpdate) bool
+    interval  time.Duration
+    last      time.Time
+    lastBytes int64
+}
+
+func (p *progress) due() bool { return time.Since(p.last) >= p.interval }
+
+// emit reports the current state and returns true if the callback asked to stop.
+func (p *progress) emit(f *TransferFile, fileCompleted bool) bool {
+    now := time.Now()
+    downloaded := p.s.downloadedSize()
+    var speed int64
+    if elapsed := now.Sub(p.last).Seconds(); elapsed > 0 {
+        speed = int64(float64(downloaded-p.lastBytes) / elapsed)
+    }
+    p.last = now
+    p.lastBytes = downloaded
+    if p.onTick == nil {
+        return false
+    }
+    return p.onTick(StreamUpdate{
+        DownloadID:     p.s.id,
+        FileID:         f.ID,
+        FileDownloaded: f.Downloaded,
+        FileCompleted:  fileCompleted,
+        DownloadedSize: downloaded,
+        TotalSize:      p.s.total,
+        Speed:          speed,
+    })
+}
+
+// setLimit applies a new rate to the session. The burst, and with it the largest
+// single write, is about a tenth of a second of transfer at that rate, capped at
+// maxBurst. Waits reserved at the old rate are cut short so the new rate applies
+// at once.
+func (s *session) setLimit(limit rate.Limit, maxBurst int) {
+    if limit == s.limiter.Limit() {
+        return
+    }
+    s.limiter.SetLimit(limit)
+    s.limiter.SetBurst(burstFor(limit, maxBurst))
+    s.mu.Lock()
+    close(s.rateChanged)
+    s.rateChanged = make(chan struct{})
+    s.mu.Unlock()
+}
+
+func burstFor(limit rate.Limit, maxBurst int) int {
+    if limit == rate.Inf {
+        return maxBurst
+    }
+    return minInt(maxBurst, maxInt(minBurst, int(float64(limit)/10)))
+}
+
+// throttle waits until n bytes may be sent, a burst at a time. A reservation made
+// at the old rate is cancelled when the limit changes and taken again at the new one.
+func (s *session) throttle(ctx context.Context, n int) error {
+    for n > 0 {
+        s.mu.Lock()
+        changed := s.rateChanged
+        s.mu.Unlock()
+        take := minInt(n, s.limiter.Burst())
+        r := s.limiter.ReserveN(time.Now(), take)
+        if !r.OK() {
+            continue // the burst shrank after it was read
+        }
+        if delay := r.Delay(); delay > 0 {
+            t := time.NewTimer(delay)
+            select {
+            case <-ctx.Done():
+                t.Stop()
+                r.Cancel()
+                return ctx.Err()
+            case <-changed:
+                t.Stop()
+                r.Cancel()
+                continue
+            case <-t.C:
+            }
+        }
+        n -= take
+    }
+    return nil
+}
+
+func (s *session) pause() {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if !s.paused {
+        s.paused = true
+        s.resumed = make(chan struct{})
+    }
+}
+
+func (s *session) resume() {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if s.paused {
+        s.paused = false
+        close(s.resumed)
+    }
+}
+
+func (s *session) isPaused() bool {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return s.paused
+}
+
+// waitIfPaused blocks while the session is paused.
+func (s *session) waitIfPaused(ctx context.Context) error {
+    for {
+        s.mu.Lock()
+        if !s.paused {
+            s.mu.Unlock()
+            return nil
+        }
+        ch := s.resumed
+        s.mu.Unlock()
+        select {
+        case <-ctx.Done():
+            return ctx.Err()
+        case <-ch:
+        }
+    }
+}
+
+// rewind discards file progress back to pos so those bytes are transferred again.
+func (s *session) rewind(f *TransferFile, pos int64) {
+    s.addDownloaded(pos - f.Downloaded)
+    f.Downloaded = pos
+}
+
+func (s *session) addDownloaded(n int64) {
+    s.mu.Lock()
+    s.downloaded += n
+    s.mu.Unlock()
+}
+
+func (s *session) downloadedSize() int64 {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return s.downloaded
+}
+
+// terminalError maps cancellation caused by Stop to ErrStreamStopped.
+func (s *session) terminalError(err error) error {
+    s.mu.Lock()
+    stopped := s.stopped
+    s.mu.Unlock()
+    if stopped || errors.Is(err, ErrStreamStopped) {
+        return ErrStreamStopped
+    }
+    return err
+}
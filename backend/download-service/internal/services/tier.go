@@ -0,0 +1,71 @@
+package services
+
+import (
+	"context"
+
+	"download-service/internal/clients/tier"
+	"download-service/pkg/logger"
+)
+
+// TierLimits are what a subscription tier entitles a user to.
+type TierLimits struct {
+	MaxBytesPerSecond int64 // bandwidth ceiling across the user's downloads; 0 means none
+	MaxActive         int   // downloads transferring at once; 0 uses the queue default
+	Priority          int   // priority new downloads start with
+}
+
+// TierOptions configures subscription tiers. A request's tier comes from its
+// token (see tier.NewContext), then from Provider, and is Default otherwise.
+type TierOptions struct {
+	Default  string
+	Limits   map[string]TierLimits
+	Provider tier.Interface
+}
+
+// ConfigureTiers replaces the tier configuration. Without it every user gets the
+// service-wide limits.
+func (s *DownloadService) ConfigureTiers(opts TierOptions) {
+	s.tiers = opts
+}
+
+// resolveTier returns the tier of the user making the request. Provider errors
+// fall back to the default tier so an outage never blocks downloads.
+func (s *DownloadService) resolveTier(ctx context.Context, userID string) string {
+	if t, ok := tier.FromContext(ctx); ok {
+		return t
+	}
+	if s.tiers.Provider != nil {
+		t, err := s.tiers.Provider.UserTier(ctx, userID)
+		if err != nil {
+			logger.Error(s.logger, "resolve user tier failed", "error", err, "userID", userID)
+		}
+		if t != "" {
+			return t
+		}
+	}
+	return s.tiers.Default
+}
+
+// tierLimits returns the limits of the named tier; unknown tiers get the default's.
+func (s *DownloadService) tierLimits(name string) TierLimits {
+	if l, ok := s.tiers.Limits[name]; ok {
+		return l
+	}
+	return s.tiers.Limits[s.tiers.Default]
+}
+
+// maxActiveFor is the concurrency limit of a tier; 0 means unlimited.
+func (s *DownloadService) maxActiveFor(tierName string) int {
+	if n := s.tierLimits(tierName).MaxActive; n > 0 {
+		return n
+	}
+	return s.maxActive
+}
+
+// clampSpeed lowers a requested speed to the tier's ceiling.
+func (s *DownloadService) clampSpeed(tierName string, bytesPerSecond int64) int64 {
+	if max := s.tierLimits(tierName).MaxBytesPerSecond; max > 0 && bytesPerSecond > max {
+		return max
+	}
+	return bytesPerSecond
+}
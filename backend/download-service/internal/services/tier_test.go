@@ -0,0 +1,79 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"download-service/internal/clients/tier"
+	"download-service/internal/models"
+	"github.com/stretchr/testify/require"
+)
+
+type stubTiers struct {
+	tiers map[string]string
+	err   error
+}
+
+func (p stubTiers) UserTier(ctx context.Context, userID string) (string, error) {
+	return p.tiers[userID], p.err
+}
+
+var testTiers = map[string]TierLimits{
+	"free":    {MaxBytesPerSecond: 4096, MaxActive: 1, Priority: 0},
+	"premium": {MaxActive: 3, Priority: 50},
+}
+
+func TestTiers_Resolve(t *testing.T) {
+	svc, _ := newTestDownloadService(newMemDownloadRepo(), mockLibrary{owned: true})
+	svc.ConfigureTiers(TierOptions{Default: "free", Limits: testTiers, Provider: stubTiers{tiers: map[string]string{"u1": "premium"}}})
+	ctx := context.Background()
+
+	require.Equal(t, "premium", svc.resolveTier(ctx, "u1"))
+	require.Equal(t, "free", svc.resolveTier(ctx, "u2"), "users without a subscription get the default")
+	require.Equal(t, "plus", svc.resolveTier(tier.NewContext(ctx, "plus"), "u1"), "the token claim wins")
+	require.Equal(t, testTiers["free"], svc.tierLimits("plus"), "unknown tiers get the default's limits")
+
+	svc.ConfigureTiers(TierOptions{Default: "free", Limits: testTiers, Provider: stubTiers{err: errors.New("down")}})
+	require.Equal(t, "free", svc.resolveTier(ctx, "u1"))
+}
+
+func TestTiers_LimitsApply(t *testing.T) {
+	repo := newMemDownloadRepo()
+	svc, storage := newTestDownloadService(repo, mockLibrary{owned: true})
+	svc.defaultSpeed = 16 * 1024
+	svc.ConfigureTiers(TierOptions{Default: "free", Limits: testTiers})
+	games := []string{"e3000000-0000-0000-0000-000000000001", "e3000000-0000-0000-0000-000000000002"}
+	for _, g := range games {
+		seedGame(storage, g)
+	}
+	ctx := context.Background()
+
+	// Free: one download at a time, capped at the tier's ceiling.
+	freeUser := "e4000000-0000-0000-0000-000000000001"
+	first, err := svc.StartDownload(ctx, freeUser, games[0])
+	require.NoError(t, err)
+	require.Equal(t, "free", first.Tier)
+	require.Equal(t, models.StatusDownloading, first.Status)
+	require.Equal(t, int64(4096), svc.stream.AllocatedSpeed(first.ID))
+	second, err := svc.StartDownload(ctx, freeUser, games[1])
+	require.NoError(t, err)
+	require.Equal(t, models.StatusPending, second.Status)
+
+	require.NoError(t, svc.SetDownloadSpeed(ctx, freeUser, first.ID, 1<<20))
+	require.Equal(t, int64(4096), svc.stream.AllocatedSpeed(first.ID), "requested speed is clamped to the ceiling")
+
+	// Premium: more slots, a higher queue priority and no ceiling.
+	premiumUser := "e4000000-0000-0000-0000-000000000002"
+	pctx := tier.NewContext(ctx, "premium")
+	for _, g := range games {
+		d, err := svc.StartDownload(pctx, premiumUser, g)
+		require.NoError(t, err)
+		require.Equal(t, models.StatusDownloading, d.Status)
+		require.Equal(t, 50, d.Priority)
+		require.Equal(t, svc.defaultSpeed, svc.stream.AllocatedSpeed(d.ID))
+	}
+	for _, id := range svc.stream.ActiveIDs() {
+		svc.stream.Stop(id)
+	}
+}
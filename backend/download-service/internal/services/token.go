@@ -0,0 +1,244 @@
+package services
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	derr "download-service/internal/errors"
+	"download-service/internal/models"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// DefaultTokenTTL is how long a download token is valid unless asked otherwise.
+	DefaultTokenTTL = 5 * time.Minute
+	// MaxTokenTTL bounds the lifetime a client may ask for.
+	MaxTokenTTL = time.Hour
+)
+
+// downloadTokenAudience keeps download tokens from passing as API tokens and back.
+const downloadTokenAudience = "download-edge"
+
+// TokenOptions configures the signing of download tokens. A PrivateKey signs
+// EdDSA tokens, which edges can check with the public key alone; otherwise Secret
+// signs HS256 tokens. Without either, tokens are not issued.
+type TokenOptions struct {
+	Secret     []byte
+	PrivateKey ed25519.PrivateKey
+	TTL        time.Duration // default lifetime; DefaultTokenTTL when zero
+	BaseURL    string        // public URL the edge routes are served under; empty yields relative URLs
+}
+
+// ByteRange is an inclusive span of byte offsets.
+type ByteRange struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+}
+
+// TokenScope narrows what a download token grants.
+type TokenScope struct {
+	FileID     string        // a single file of the download; empty for all of them
+	ClientCIDR string        // addresses the token may be used from; an address or a CIDR
+	Range      *ByteRange    // bytes of the file that may be fetched; requires FileID
+	TTL        time.Duration // lifetime; the configured default when zero
+}
+
+// DownloadToken is an issued token and the edge URL it unlocks.
+type DownloadToken struct {
+	Token     string
+	URL       string // set when the token is bound to a file
+	ExpiresAt time.Time
+}
+
+// DownloadGrant is what a verified token allows the edge to serve.
+type DownloadGrant struct {
+	Download *models.Download
+	File     *models.DownloadFile
+	Range    *ByteRange // nil grants the whole file
+}
+
+type downloadClaims struct {
+	jwt.RegisteredClaims
+	DownloadID string     `json:"did"`
+	GameID     string     `json:"gid"`
+	FileID     string     `json:"fid,omitempty"`
+	ClientCIDR string     `json:"cidr,omitempty"`
+	Range      *ByteRange `json:"rng,omitempty"`
+}
+
+// ConfigureTokens enables download tokens.
+func (s *DownloadService) ConfigureTokens(opts TokenOptions) {
+	if opts.TTL <= 0 {
+		opts.TTL = DefaultTokenTTL
+	}
+	opts.BaseURL = strings.TrimSuffix(opts.BaseURL, "/")
+	s.tokens = opts
+}
+
+// TokensEnabled reports whether download tokens are issued.
+func (s *DownloadService) TokensEnabled() bool {
+	return len(s.tokens.PrivateKey) > 0 || len(s.tokens.Secret) > 0
+}
+
+func (s *DownloadService) tokenMethod() jwt.SigningMethod {
+	if len(s.tokens.PrivateKey) > 0 {
+		return jwt.SigningMethodEdDSA
+	}
+	return jwt.SigningMethodHS256
+}
+
+// EdgePath returns the edge route serving a file of a download.
+func EdgePath(downloadID, fileID string) string {
+	return "/edge/downloads/" + url.PathEscape(downloadID) + "/files/" + url.PathEscape(fileID) + "/content"
+}
+
+// IssueDownloadToken signs a token for a download the user owns. clientIP is the
+// address of the requesting client; it is bound to the token unless the scope
+// names other clients.
+func (s *DownloadService) IssueDownloadToken(ctx context.Context, userID, downloadID, clientIP string, scope TokenScope) (*DownloadToken, error) {
+	if !s.TokensEnabled() {
+		return nil, derr.ValidationError{Msg: "download tokens are not enabled"}
+	}
+	ttl := scope.TTL
+	if ttl == 0 {
+		ttl = s.tokens.TTL
+	}
+	if ttl < 0 || ttl > MaxTokenTTL {
+		return nil, derr.ValidationError{Msg: fmt.Sprintf("token lifetime must be at most %s", MaxTokenTTL)}
+	}
+	cidr := scope.ClientCIDR
+	if cidr == "" {
+		cidr = clientIP
+	}
+	if _, err := parseClientCIDR(cidr); err != nil {
+		return nil, derr.ValidationError{Msg: err.Error()}
+	}
+
+	d, err := s.GetDownload(ctx, userID, downloadID)
+	if err != nil {
+		return nil, err
+	}
+	if d.Status == models.StatusCancelled {
+		return nil, derr.ValidationError{Msg: "download was cancelled"}
+	}
+	if err := s.requireOwnership(ctx, userID, d.GameID); err != nil {
+		return nil, err
+	}
+	if scope.Range != nil && scope.FileID == "" {
+		return nil, derr.ValidationError{Msg: "a byte range needs a file"}
+	}
+	if scope.FileID != "" {
+		_, f, err := s.GetDownloadFile(ctx, userID, downloadID, scope.FileID)
+		if err != nil {
+			return nil, err
+		}
+		if r := scope.Range; r != nil && (r.Start < 0 || r.End < r.Start || r.End >= f.FileSize) {
+			return nil, derr.ValidationError{Msg: fmt.Sprintf("range %d-%d is outside the file's %d bytes", r.Start, r.End, f.FileSize)}
+		}
+	}
+
+	now := time.Now()
+	expires := now.Add(ttl)
+	claims := downloadClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   userID,
+			Audience:  jwt.ClaimStrings{downloadTokenAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expires),
+		},
+		DownloadID: d.ID,
+		GameID:     d.GameID,
+		FileID:     scope.FileID,
+		ClientCIDR: cidr,
+		Range:      scope.Range,
+	}
+	var key any = s.tokens.Secret
+	if len(s.tokens.PrivateKey) > 0 {
+		key = s.tokens.PrivateKey
+	}
+	signed, err := jwt.NewWithClaims(s.tokenMethod(), claims).SignedString(key)
+	if err != nil {
+		return nil, err
+	}
+	tok := &DownloadToken{Token: signed, ExpiresAt: claims.ExpiresAt.Time}
+	if scope.FileID != "" {
+		tok.URL = s.tokens.BaseURL + EdgePath(d.ID, scope.FileID) + "?token=" + url.QueryEscape(signed)
+	}
+	return tok, nil
+}
+
+// VerifyDownloadToken checks a token presented to the edge for a file of a
+// download. Besides the signature, expiry and client address, it checks that the
+// user still owns the download and the game, so tokens die with a refund; tokens
+// issued before an entitlement revocation are refused outright.
+func (s *DownloadService) VerifyDownloadToken(ctx context.Context, token, downloadID, fileID, clientIP string) (*DownloadGrant, error) {
+	if !s.TokensEnabled() {
+		return nil, derr.InvalidTokenError{Reason: "download tokens are not enabled"}
+	}
+	var claims downloadClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(t *jwt.Token) (any, error) {
+		if len(s.tokens.PrivateKey) > 0 {
+			return s.tokens.PrivateKey.Public(), nil
+		}
+		return s.tokens.Secret, nil
+	}, jwt.WithValidMethods([]string{s.tokenMethod().Alg()}), jwt.WithAudience(downloadTokenAudience), jwt.WithExpirationRequired())
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, derr.InvalidTokenError{Reason: "expired"}
+		}
+		return nil, derr.InvalidTokenError{Reason: "malformed or bad signature"}
+	}
+	if claims.DownloadID != downloadID || (claims.FileID != "" && claims.FileID != fileID) {
+		return nil, derr.InvalidTokenError{Reason: "not issued for this file"}
+	}
+	if claims.ClientCIDR != "" {
+		network, err := parseClientCIDR(claims.ClientCIDR)
+		if ip := net.ParseIP(clientIP); err != nil || ip == nil || !network.Contains(ip) {
+			return nil, derr.AccessDeniedError{Reason: "token is bound to another client"}
+		}
+	}
+
+	d, f, err := s.GetDownloadFile(ctx, claims.Subject, downloadID, fileID)
+	if err != nil {
+		return nil, err
+	}
+	if d.GameID != claims.GameID {
+		return nil, derr.InvalidTokenError{Reason: "not issued for this game"}
+	}
+	if d.Status == models.StatusCancelled {
+		return nil, derr.AccessDeniedError{Reason: "download was cancelled"}
+	}
+	if at, revoked := s.revokedAt(ctx, d.UserID, d.GameID); revoked && !claims.IssuedAt.After(at) {
+		return nil, derr.InvalidTokenError{Reason: "revoked"}
+	}
+	if err := s.requireOwnership(ctx, d.UserID, d.GameID); err != nil {
+		return nil, err
+	}
+	return &DownloadGrant{Download: d, File: f, Range: claims.Range}, nil
+}
+
+// parseClientCIDR accepts a CIDR or a single address.
+func parseClientCIDR(s string) (*net.IPNet, error) {
+	if s == "" {
+		return nil, errors.New("client address is required")
+	}
+	if ip := net.ParseIP(s); ip != nil {
+		bits := 128
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 32
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	_, network, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid client address %q", s)
+	}
+	return network, nil
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	derr "download-service/internal/errors"
+	"download-service/internal/models"
+	"github.com/stretchr/testify/require"
+)
+
+// newTokenTestService starts a download and returns it with its single file.
+func newTokenTestService(t *testing.T, opts TokenOptions) (*DownloadService, *models.Download, models.DownloadFile) {
+	t.Helper()
+	svc, _, gameID := newScheduleTestService(t)
+	svc.ConfigureTokens(opts)
+	d, err := svc.StartDownload(context.Background(), "e8000000-0000-0000-0000-000000000001", gameID)
+	require.NoError(t, err)
+	files, err := svc.fileRepo.ListByDownload(context.Background(), d.ID)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	return svc, d, files[0]
+}
+
+func TestDownloadToken_IssueAndVerify(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	for name, opts := range map[string]TokenOptions{
+		"HS256": {Secret: []byte("0123456789abcdef0123456789abcdef"), BaseURL: "https://dl.example.com/"},
+		"EdDSA": {PrivateKey: priv, BaseURL: "https://dl.example.com/"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			svc, d, f := newTokenTestService(t, opts)
+			ctx := context.Background()
+
+			tok, err := svc.IssueDownloadToken(ctx, d.UserID, d.ID, "203.0.113.7", TokenScope{FileID: f.ID})
+			require.NoError(t, err)
+			require.Equal(t, "https://dl.example.com"+EdgePath(d.ID, f.ID)+"?token="+tok.Token, tok.URL)
+			require.WithinDuration(t, time.Now().Add(DefaultTokenTTL), tok.ExpiresAt, 2*time.Second)
+
+			grant, err := svc.VerifyDownloadToken(ctx, tok.Token, d.ID, f.ID, "203.0.113.7")
+			require.NoError(t, err)
+			require.Equal(t, f.ID, grant.File.ID)
+			require.Nil(t, grant.Range)
+
+			// Bound to the client, the file and the signing key.
+			_, err = svc.VerifyDownloadToken(ctx, tok.Token, d.ID, f.ID, "203.0.113.8")
+			require.True(t, errors.As(err, &derr.AccessDeniedError{}))
+			_, err = svc.VerifyDownloadToken(ctx, tok.Token, d.ID, "e8000000-0000-0000-0000-0000000000f0", "203.0.113.7")
+			require.True(t, errors.As(err, &derr.InvalidTokenError{}))
+			_, err = svc.VerifyDownloadToken(ctx, tok.Token[:len(tok.Token)-2]+"xx", d.ID, f.ID, "203.0.113.7")
+			require.True(t, errors.As(err, &derr.InvalidTokenError{}))
+		})
+	}
+}
+
+func TestDownloadToken_ScopeAndRevocation(t *testing.T) {
+	svc, d, f := newTokenTestService(t, TokenOptions{Secret: []byte("0123456789abcdef0123456789abcdef")})
+	ctx := context.Background()
+
+	// A token for a subnet and a byte range.
+	tok, err := svc.IssueDownloadToken(ctx, d.UserID, d.ID, "203.0.113.7", TokenScope{
+		FileID:     f.ID,
+		ClientCIDR: "198.51.100.0/24",
+		Range:      &ByteRange{Start: 0, End: 1023},
+		TTL:        time.Minute,
+	})
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(tok.URL, EdgePath(d.ID, f.ID)), "relative without a base URL")
+	grant, err := svc.VerifyDownloadToken(ctx, tok.Token, d.ID, f.ID, "198.51.100.42")
+	require.NoError(t, err)
+	require.Equal(t, &ByteRange{Start: 0, End: 1023}, grant.Range)
+
+	// Invalid scopes are refused.
+	for _, scope := range []TokenScope{
+		{Range: &ByteRange{Start: 0, End: 1}},
+		{FileID: f.ID, Range: &ByteRange{Start: 10, End: 5}},
+		{FileID: f.ID, Range: &ByteRange{Start: 0, End: f.FileSize}},
+		{ClientCIDR: "not-an-address"},
+		{TTL: 2 * MaxTokenTTL},
+	} {
+		_, err := svc.IssueDownloadToken(ctx, d.UserID, d.ID, "203.0.113.7", scope)
+		require.True(t, errors.As(err, &derr.ValidationError{}), "%+v", scope)
+	}
+	_, err = svc.IssueDownloadToken(ctx, "e8000000-0000-0000-0000-000000000002", d.ID, "203.0.113.7", TokenScope{})
+	require.True(t, errors.As(err, &derr.AccessDeniedError{}))
+
+	// Tokens stop working once the game is no longer owned and the cached
+	// ownership answer has expired.
+	svc.ConfigureEntitlements(EntitlementOptions{CacheTTL: time.Nanosecond})
+	svc.library = mockLibrary{owned: false}
+	_, err = svc.VerifyDownloadToken(ctx, tok.Token, d.ID, f.ID, "198.51.100.42")
+	require.True(t, errors.As(err, &derr.AccessDeniedError{}))
+}
+
+func TestDownloadToken_Expired(t *testing.T) {
+	svc, d, f := newTokenTestService(t, TokenOptions{Secret: []byte("0123456789abcdef0123456789abcdef")})
+	ctx := context.Background()
+
+	tok, err := svc.IssueDownloadToken(ctx, d.UserID, d.ID, "203.0.113.7", TokenScope{TTL: time.Second})
+	require.NoError(t, err)
+	require.Empty(t, tok.URL, "a download-wide token has no single URL")
+	time.Sleep(2100 * time.Millisecond)
+
+	_, err = svc.VerifyDownloadToken(ctx, tok.Token, d.ID, f.ID, "203.0.113.7")
+	var invalid derr.InvalidTokenError
+	require.True(t, errors.As(err, &invalid))
+	require.Equal(t, "expired", invalid.Reason)
+}
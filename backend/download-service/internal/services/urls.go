@@ -0,0 +1,75 @@
+package services
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"download-service/internal/clients/s3"
+)
+
+// URLSigner turns a storage object into a URL clients can fetch it from, e.g. a
+// presigned bucket URL or a signed CDN URL.
+type URLSigner interface {
+	SignURL(ctx context.Context, objectKey string, lifetime time.Duration, region string) (string, error)
+}
+
+// SizeTTL is the lifetime of URLs for games of up to MaxSize bytes.
+type SizeTTL struct {
+	MaxSize int64 // 0 means any size
+	TTL     time.Duration
+}
+
+// URLOptions configures the download URLs of FileService. Zero values keep the
+// storage presigner and presignedURLLifetime.
+type URLOptions struct {
+	Signer URLSigner
+	TTL    time.Duration // lifetime when no SizeTTLs entry matches
+	// SizeTTLs gives larger games longer-lived URLs, so a slow client can finish.
+	// The first entry, by MaxSize, the game fits in applies.
+	SizeTTLs []SizeTTL
+}
+
+// ConfigureURLs replaces how download URLs are signed and how long they live.
+func (s *FileService) ConfigureURLs(opts URLOptions) {
+	if opts.Signer == nil {
+		opts.Signer = storageSigner{storage: s.storage}
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = presignedURLLifetime
+	}
+	ttls := append([]SizeTTL(nil), opts.SizeTTLs...)
+	sort.SliceStable(ttls, func(i, j int) bool {
+		// Any size sorts last.
+		if (ttls[i].MaxSize == 0) != (ttls[j].MaxSize == 0) {
+			return ttls[j].MaxSize == 0
+		}
+		return ttls[i].MaxSize < ttls[j].MaxSize
+	})
+	opts.SizeTTLs = ttls
+	s.urls = opts
+}
+
+// urlTTL returns the lifetime of URLs for a game of size bytes; 0 when unknown.
+func (s *FileService) urlTTL(size int64) time.Duration {
+	if size > 0 {
+		for _, st := range s.urls.SizeTTLs {
+			if st.MaxSize == 0 || size <= st.MaxSize {
+				return st.TTL
+			}
+		}
+	}
+	return s.urls.TTL
+}
+
+// storageSigner hands out presigned URLs of the storage itself.
+type storageSigner struct {
+	storage s3.Interface
+}
+
+func (p storageSigner) SignURL(ctx context.Context, objectKey string, lifetime time.Duration, region string) (string, error) {
+	if rp, ok := p.storage.(s3.RegionalPresigner); ok {
+		return rp.GetPresignedURLIn(ctx, objectKey, lifetime, region)
+	}
+	return p.storage.GetPresignedURL(ctx, objectKey, lifetime)
+}
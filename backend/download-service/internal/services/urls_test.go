@@ -0,0 +1,56 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"download-service/internal/clients/s3"
+	"download-service/internal/models"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingSigner returns URLs naming the lifetime they were signed for.
+type recordingSigner struct{}
+
+func (recordingSigner) SignURL(ctx context.Context, objectKey string, lifetime time.Duration, region string) (string, error) {
+	return "https://cdn.example.com/" + objectKey + "?ttl=" + lifetime.String() + "&region=" + region, nil
+}
+
+func TestFileService_URLLifetimeBySize(t *testing.T) {
+	fileSvc := NewFileService(s3.NewMockClient())
+	fileSvc.ConfigureURLs(URLOptions{
+		Signer: recordingSigner{},
+		TTL:    10 * time.Minute,
+		SizeTTLs: []SizeTTL{
+			{MaxSize: 0, TTL: 4 * time.Hour},
+			{MaxSize: 10 << 30, TTL: time.Hour},
+			{MaxSize: 1 << 30, TTL: 15 * time.Minute},
+		},
+	})
+	ctx := context.Background()
+	seedGame(fileSvc.storage.(*s3.MockClient), "g1")
+
+	for size, want := range map[int64]string{
+		0:         "ttl=10m0s", // unknown size
+		512 << 20: "ttl=15m0s",
+		1 << 30:   "ttl=15m0s",
+		5 << 30:   "ttl=1h0m0s",
+		50 << 30:  "ttl=4h0m0s",
+	} {
+		urls, err := fileSvc.GetDownloadURLs(ctx, &models.Download{GameID: "g1", TotalSize: size}, "eu-central-1")
+		require.NoError(t, err)
+		url := urls[0].URL
+		require.True(t, strings.HasPrefix(url, "https://cdn.example.com/games/g1/"), url)
+		require.Contains(t, url, want, "size %d", size)
+		require.Contains(t, url, "region=eu-central-1")
+	}
+
+	// Without a signer the storage presigns.
+	fileSvc.ConfigureURLs(URLOptions{})
+	urls, err := fileSvc.GetDownloadURLs(ctx, &models.Download{GameID: "g1", TotalSize: 5 << 30}, "")
+	require.NoError(t, err)
+	require.Contains(t, urls[0].URL, "mock://")
+	require.Contains(t, urls[0].URL, "expires_in=900")
+}
@@ -0,0 +1,412 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"sync"
+
+	"download-service/internal/clients/s3"
+	derr "download-service/internal/errors"
+	"download-service/internal/models"
+	"download-service/pkg/logger"
+)
+
+// Reasons reported for chunks that fail verification.
+const (
+	ChunkMismatch  = "mismatch"
+	ChunkMissing   = "missing"
+	ChunkTruncated = "truncated"
+)
+
+// ChunkFailure identifies a chunk whose stored bytes do not match the manifest.
+type ChunkFailure struct {
+	Index  int
+	Offset int64
+	Size   int64
+	Reason string
+}
+
+// FileVerification is the integrity result for one file.
+type FileVerification struct {
+	FileID         string
+	Path           string
+	Status         models.DownloadStatus // StatusVerified or StatusCorrupted
+	ExpectedSHA256 string
+	ActualSHA256   string // empty when only some ranges of the file were checked
+	FailedChunks   []ChunkFailure
+	Repairing      bool // the failed chunks are being fetched again
+}
+
+// VerificationReport is the integrity result for every file of a download.
+type VerificationReport struct {
+	DownloadID string
+	Verified   bool
+	Files      []FileVerification
+}
+
+// verifyRange is one hashed range of a file and where its bytes are stored.
+type verifyRange struct {
+	objectKey    string
+	sourceOffset int64 // offset within the stored object
+	offset       int64 // offset within the file
+	size         int64
+	sha256       string // empty when only the whole-file digest is known
+}
+
+// rangeOpener returns the bytes of one range to hash.
+type rangeOpener func(r verifyRange) (io.ReadCloser, error)
+
+// VerifyManifestFile streams a file of the build through SHA-256, checking every
+// chunk digest and the whole-file digest recorded in the manifest. Missing or
+// short objects are reported as failed chunks; other storage errors are returned.
+func (s *FileService) VerifyManifestFile(ctx context.Context, gameID string, m *Manifest, f ManifestFile) (FileVerification, error) {
+	var ranges []verifyRange
+	switch {
+	case m.Chunked:
+		var offset int64
+		for _, c := range f.Chunks {
+			ranges = append(ranges, verifyRange{objectKey: ChunkObjectKey(c.SHA256), offset: offset, size: c.Size, sha256: c.SHA256})
+			offset += c.Size
+		}
+	case len(f.Chunks) > 0:
+		for _, c := range f.Chunks {
+			ranges = append(ranges, verifyRange{objectKey: f.objectKey(gameID), sourceOffset: c.Offset, offset: c.Offset, size: c.Size, sha256: c.SHA256})
+		}
+	case f.Size > 0:
+		ranges = []verifyRange{{objectKey: f.objectKey(gameID), size: f.Size}}
+	}
+	return verifyRanges(f.Path, f.SHA256, ranges, true, func(r verifyRange) (io.ReadCloser, error) {
+		return s.storage.GetObjectRange(ctx, r.objectKey, r.sourceOffset, r.size)
+	})
+}
+
+// verifyRanges hashes each range in order, checking chunk digests and, when the
+// ranges make up the whole file, the whole-file digest.
+func verifyRanges(filePath, expected string, ranges []verifyRange, whole bool, open rangeOpener) (FileVerification, error) {
+	res := FileVerification{Path: filePath, ExpectedSHA256: expected}
+	wholeHash := sha256.New()
+	for i, r := range ranges {
+		var chunk hash.Hash
+		if r.sha256 != "" {
+			chunk = sha256.New()
+		}
+		reason, err := hashRange(r, open, wholeHash, chunk)
+		if err != nil {
+			return res, err
+		}
+		if reason == "" && chunk != nil && hex.EncodeToString(chunk.Sum(nil)) != r.sha256 {
+			reason = ChunkMismatch
+		}
+		if reason != "" {
+			res.FailedChunks = append(res.FailedChunks, ChunkFailure{Index: i, Offset: r.offset, Size: r.size, Reason: reason})
+		}
+	}
+
+	res.Status = models.StatusVerified
+	if whole {
+		res.ActualSHA256 = hex.EncodeToString(wholeHash.Sum(nil))
+		if res.ActualSHA256 != expected {
+			res.Status = models.StatusCorrupted
+		}
+	}
+	if len(res.FailedChunks) > 0 {
+		res.Status = models.StatusCorrupted
+	}
+	return res, nil
+}
+
+// hashRange feeds the bytes of r into the hashers and returns a failure reason if
+// they are missing or shorter than expected. Short ranges are padded with zeros so
+// the whole-file digest still covers the expected length.
+func hashRange(r verifyRange, open rangeOpener, whole, chunk hash.Hash) (string, error) {
+	w := io.Writer(whole)
+	if chunk != nil {
+		w = io.MultiWriter(whole, chunk)
+	}
+	rc, err := open(r)
+	if err != nil {
+		if errors.Is(err, s3.ErrNotFound) || errors.Is(err, s3.ErrInvalidRange) || errors.Is(err, fs.ErrNotExist) {
+			_, _ = io.CopyN(w, zeroReader{}, r.size)
+			return ChunkMissing, nil
+		}
+		return "", fmt.Errorf("read %s: %w", r.objectKey, err)
+	}
+	defer rc.Close()
+
+	n, err := io.Copy(w, io.LimitReader(rc, r.size))
+	if err != nil {
+		return "", fmt.Errorf("read %s: %w", r.objectKey, err)
+	}
+	if n < r.size {
+		_, _ = io.CopyN(w, zeroReader{}, r.size-n)
+		return ChunkTruncated, nil
+	}
+	return "", nil
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+// VerifyDownload checks every file of a finished download against the digests in
+// its build manifest and records each file as verified or corrupted. When the
+// transfer engine stages files it can read back, the staged bytes are hashed and
+// the failed chunks of a completed download are fetched again in the background;
+// otherwise the stored build is checked. Files of legacy single-archive builds
+// carry no digest and are checked by size only.
+func (s *DownloadService) VerifyDownload(ctx context.Context, userID, downloadID string) (*VerificationReport, error) {
+	d, err := s.GetDownload(ctx, userID, downloadID)
+	if err != nil {
+		return nil, err
+	}
+	if d.Status != models.StatusCompleted && d.Status != models.StatusFailed {
+		return nil, derr.ValidationError{Msg: fmt.Sprintf("cannot verify a download that is %s", d.Status)}
+	}
+	files, err := s.fileRepo.ListByDownload(ctx, downloadID)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &downloadVerifier{d: d, files: s.files, byPath: map[string]ManifestFile{}}
+	v.staged, _ = s.stream.sink.(StagedSink)
+	for _, f := range files {
+		if f.Checksum != "" {
+			if v.manifest, err = s.files.LoadManifestVersion(ctx, d.GameID, d.Version); err != nil {
+				logger.Error(s.logger, "load manifest for verification failed", "error", err, "downloadID", downloadID)
+				return nil, err
+			}
+			break
+		}
+	}
+	if v.manifest != nil {
+		for _, mf := range v.manifest.Files {
+			v.byPath[mf.Path] = mf
+		}
+		if v.staged != nil {
+			// The staged ranges are the segments the download was planned with.
+			plan, err := s.planFor(ctx, d, files)
+			if err != nil {
+				return nil, err
+			}
+			if plan != nil {
+				v.segments = plan.segmentsByPath()
+			}
+		}
+	}
+
+	report := &VerificationReport{DownloadID: downloadID, Verified: true}
+	var repair []TransferFile
+	for _, f := range files {
+		res, bad, err := v.verify(ctx, f)
+		if err != nil {
+			return nil, err
+		}
+		res.FileID = f.ID
+		if err := s.fileRepo.UpdateStatus(ctx, f.ID, res.Status); err != nil {
+			return nil, err
+		}
+		if res.Status != models.StatusVerified {
+			report.Verified = false
+		}
+		if len(bad) > 0 && d.Status == models.StatusCompleted {
+			res.Repairing = true
+			repair = append(repair, repairFile(f, bad))
+		}
+		report.Files = append(report.Files, res)
+	}
+	if len(repair) > 0 && !s.repair(ctx, d, repair) {
+		for i := range report.Files {
+			report.Files[i].Repairing = false
+		}
+		repair = nil
+	}
+	logger.Info(s.logger, "download verified", "downloadID", downloadID, "verified", report.Verified, "files", len(files), "repairing", len(repair))
+	return report, nil
+}
+
+// downloadVerifier checks the files of one download.
+type downloadVerifier struct {
+	d        *models.Download
+	files    *FileService
+	manifest *Manifest
+	byPath   map[string]ManifestFile
+	staged   StagedSink               // nil when transferred bytes cannot be read back
+	segments map[string][]FileSegment // planned segments by path, for staged files
+}
+
+// verify checks one file and returns the segments whose staged bytes are bad.
+func (v *downloadVerifier) verify(ctx context.Context, f models.DownloadFile) (FileVerification, []TransferSegment, error) {
+	if f.Checksum == "" {
+		res := FileVerification{Path: f.FilePath, Status: models.StatusVerified}
+		var err error
+		if v.staged != nil {
+			err = v.verifyStagedSize(f)
+		} else {
+			err = v.files.VerifyFile(ctx, f.ObjectKey, f.FileSize)
+		}
+		if err != nil {
+			if !errors.As(err, &derr.FileCorruptedError{}) {
+				return res, nil, err
+			}
+			res.Status = models.StatusCorrupted
+		}
+		return res, nil, nil
+	}
+	mf, ok := v.byPath[f.FilePath]
+	if !ok || mf.SHA256 != f.Checksum {
+		// The manifest no longer describes the file that was downloaded.
+		return FileVerification{Path: f.FilePath, Status: models.StatusCorrupted, ExpectedSHA256: f.Checksum}, nil, nil
+	}
+	if v.staged == nil {
+		res, err := v.files.VerifyManifestFile(ctx, v.d.GameID, v.manifest, mf)
+		return res, nil, err
+	}
+	return v.verifyStaged(mf)
+}
+
+// verifyStaged hashes the ranges of a file this download wrote. An update stages
+// only the chunks it fetched, so the whole-file digest is checked only when the
+// staged ranges make up the entire file.
+func (v *downloadVerifier) verifyStaged(mf ManifestFile) (FileVerification, []TransferSegment, error) {
+	segs := v.segments[mf.Path]
+	ranges := make([]verifyRange, 0, len(segs))
+	var covered int64
+	for _, seg := range segs {
+		ranges = append(ranges, verifyRange{objectKey: seg.ObjectKey, sourceOffset: seg.SourceOffset, offset: seg.Offset, size: seg.Size, sha256: seg.SHA256})
+		covered += seg.Size
+	}
+
+	sf, openErr := v.staged.OpenStaged(v.d.ID, mf.Path)
+	if openErr == nil {
+		defer sf.Close()
+	}
+	res, err := verifyRanges(mf.Path, mf.SHA256, ranges, covered == mf.Size, func(r verifyRange) (io.ReadCloser, error) {
+		if openErr != nil {
+			return nil, openErr
+		}
+		return io.NopCloser(io.NewSectionReader(sf, r.offset, r.size)), nil
+	})
+	if err != nil {
+		return res, nil, err
+	}
+
+	var bad []TransferSegment
+	for _, fc := range res.FailedChunks {
+		seg := segs[fc.Index]
+		if seg.SHA256 != "" {
+			bad = append(bad, TransferSegment{ObjectKey: seg.ObjectKey, SourceOffset: seg.SourceOffset, Offset: seg.Offset, Size: seg.Size, SHA256: seg.SHA256})
+		}
+	}
+	return res, bad, nil
+}
+
+// verifyStagedSize checks that a staged file without a digest has its full size.
+func (v *downloadVerifier) verifyStagedSize(f models.DownloadFile) error {
+	sf, err := v.staged.OpenStaged(v.d.ID, f.FilePath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return derr.FileCorruptedError{Path: f.FilePath}
+		}
+		return err
+	}
+	defer sf.Close()
+	n, err := io.Copy(io.Discard, io.NewSectionReader(sf, 0, f.FileSize))
+	if err != nil {
+		return fmt.Errorf("read staged %s: %w", f.FilePath, err)
+	}
+	if n != f.FileSize {
+		return derr.FileCorruptedError{Path: f.FilePath}
+	}
+	return nil
+}
+
+// repairFile is a transfer of only the given segments of f.
+func repairFile(f models.DownloadFile, segs []TransferSegment) TransferFile {
+	tf := TransferFile{ID: f.ID, ObjectKey: f.ObjectKey, Path: f.FilePath, Segments: segs}
+	for _, seg := range segs {
+		tf.Size += seg.Size
+	}
+	return tf
+}
+
+// repair fetches the failed chunks of a completed download again and writes them
+// over the staged bytes. Each chunk is checked as it is written; the files are
+// recorded as verified once every chunk has been repaired. The repair holds the
+// download's lease like any transfer, and reports whether it was started.
+func (s *DownloadService) repair(ctx context.Context, d *models.Download, files []TransferFile) bool {
+	downloadID := d.ID
+	if s.stream.Active(downloadID) {
+		return false
+	}
+	acquired, err := s.acquireLease(ctx, downloadID)
+	if err != nil || !acquired {
+		logger.Info(s.logger, "download repair not started", "error", err, "downloadID", downloadID, "acquired", acquired)
+		return false
+	}
+	s.repairs.add(downloadID)
+	started := s.stream.StartWith(context.Background(), downloadID, files, s.sessionOptions(d), nil, func(err error) {
+		s.repairs.remove(downloadID)
+		if rerr := s.releaseLease(context.Background(), downloadID); rerr != nil {
+			logger.Error(s.logger, "release download lease failed", "error", rerr, "downloadID", downloadID)
+		}
+		if err != nil {
+			if errors.Is(err, ErrStreamStopped) {
+				logger.Error(s.logger, "download repair stopped, files remain corrupted", "downloadID", downloadID, "files", len(files))
+			} else {
+				logger.Error(s.logger, "download repair failed", "error", err, "downloadID", downloadID)
+			}
+			return
+		}
+		for _, f := range files {
+			if err := s.fileRepo.UpdateStatus(context.Background(), f.ID, models.StatusVerified); err != nil {
+				logger.Error(s.logger, "update repaired file status failed", "error", err, "downloadID", downloadID, "fileID", f.ID)
+			}
+		}
+		logger.Info(s.logger, "download repaired", "downloadID", downloadID, "files", len(files))
+	})
+	if !started {
+		// Another session took the download between the check and the start.
+		s.repairs.remove(downloadID)
+	}
+	return started
+}
+
+// repairSet holds the IDs of the local sessions that are repairs. Their download
+// is completed, so the heartbeat must not stop them to match the persisted status.
+type repairSet struct {
+	mu  sync.Mutex
+	ids map[string]struct{}
+}
+
+func (r *repairSet) add(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.ids == nil {
+		r.ids = make(map[string]struct{})
+	}
+	r.ids[id] = struct{}{}
+}
+
+func (r *repairSet) remove(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.ids, id)
+}
+
+func (r *repairSet) has(id string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.ids[id]
+	return ok
+}
@@ -0,0 +1,294 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"download-service/internal/clients/s3"
+	derr "download-service/internal/errors"
+	"download-service/internal/models"
+	"download-service/pkg/logger"
+	"github.com/stretchr/testify/require"
+)
+
+// putChunkedWholeFile stores content as one object and publishes a manifest listing
+// its chunks of chunkSize bytes.
+func putChunkedWholeFile(t testing.TB, storage *s3.MockClient, gameID, filePath string, content []byte, chunkSize int) *Manifest {
+	f := ManifestFile{Path: filePath, Size: int64(len(content)), SHA256: sha256Hex(content)}
+	for off := 0; off < len(content); off += chunkSize {
+		end := off + chunkSize
+		if end > len(content) {
+			end = len(content)
+		}
+		f.Chunks = append(f.Chunks, ManifestChunk{Offset: int64(off), Size: int64(end - off), SHA256: sha256Hex(content[off:end])})
+	}
+	m := &Manifest{GameID: gameID, Version: "1", Files: []ManifestFile{f}}
+	storage.PutObject(f.objectKey(gameID), f.Size, content)
+	data, err := json.Marshal(m)
+	require.NoError(t, err)
+	storage.PutObject(manifestKeyForGame(gameID), int64(len(data)), data)
+	return m
+}
+
+func TestFileService_VerifyManifestFileDetectsBadChunk(t *testing.T) {
+	storage := s3.NewMockClient()
+	svc := NewFileService(storage)
+	gameID := "a1000000-0000-0000-0000-000000000001"
+	content := patterned(1000, 5)
+	m := putChunkedWholeFile(t, storage, gameID, "game.bin", content, 300)
+
+	res, err := svc.VerifyManifestFile(context.Background(), gameID, m, m.Files[0])
+	require.NoError(t, err)
+	require.Equal(t, models.StatusVerified, res.Status)
+	require.Equal(t, res.ExpectedSHA256, res.ActualSHA256)
+
+	// Same size, one flipped byte in the second chunk.
+	corrupt := append([]byte(nil), content...)
+	corrupt[450] ^= 0xff
+	storage.PutObject(m.Files[0].objectKey(gameID), int64(len(corrupt)), corrupt)
+
+	res, err = svc.VerifyManifestFile(context.Background(), gameID, m, m.Files[0])
+	require.NoError(t, err)
+	require.Equal(t, models.StatusCorrupted, res.Status)
+	require.Equal(t, []ChunkFailure{{Index: 1, Offset: 300, Size: 300, Reason: ChunkMismatch}}, res.FailedChunks)
+	require.NotEqual(t, res.ExpectedSHA256, res.ActualSHA256)
+}
+
+func TestFileService_VerifyManifestFileMissingChunk(t *testing.T) {
+	storage := s3.NewMockClient()
+	svc := NewFileService(storage)
+	gameID := "a1000000-0000-0000-0000-000000000002"
+	a, b := patterned(64, 1), patterned(32, 2)
+	m := putChunkedVersion(t, storage, gameID, "1", true, chunkedFile{"game.bin", [][]byte{a, b}})
+	require.NoError(t, storage.CleanupPrefix(context.Background(), ChunkObjectKey(sha256Hex(b))))
+
+	res, err := svc.VerifyManifestFile(context.Background(), gameID, m, m.Files[0])
+	require.NoError(t, err)
+	require.Equal(t, models.StatusCorrupted, res.Status)
+	require.Equal(t, []ChunkFailure{{Index: 1, Offset: 64, Size: 32, Reason: ChunkMissing}}, res.FailedChunks)
+}
+
+// corruptingStorage flips a byte in the first read of each listed range.
+type corruptingStorage struct {
+	*s3.MockClient
+	mu       sync.Mutex
+	corrupt  map[int64]int // source offset -> reads left to corrupt
+	requests []int64
+}
+
+func (c *corruptingStorage) GetObjectRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	rc, err := c.MockClient.GetObjectRange(ctx, key, offset, length)
+	if err != nil {
+		return nil, err
+	}
+	data, _ := io.ReadAll(rc)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.requests = append(c.requests, offset)
+	if c.corrupt[offset] > 0 && len(data) > 0 {
+		c.corrupt[offset]--
+		data[0] ^= 0xff
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func TestStreamService_RefetchesCorruptedChunk(t *testing.T) {
+	mock := s3.NewMockClient()
+	storage := &corruptingStorage{MockClient: mock, corrupt: map[int64]int{512: 1}}
+	sink := newMemSink()
+	ss := newTestStream(storage, sink)
+	content := patterned(1024, 9)
+	mock.PutObject("obj", int64(len(content)), content)
+	file := TransferFile{ID: "f", ObjectKey: "obj", Path: "obj", Size: 1024, Segments: []TransferSegment{
+		{ObjectKey: "obj", Offset: 0, Size: 512, SHA256: sha256Hex(content[:512])},
+		{ObjectKey: "obj", SourceOffset: 512, Offset: 512, Size: 512, SHA256: sha256Hex(content[512:])},
+	}}
+
+	done := make(chan error, 1)
+	ss.Start(context.Background(), "dl-verify", []TransferFile{file}, 0, nil, func(err error) { done <- err })
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("transfer did not finish")
+	}
+	require.Equal(t, content, sink.get("dl-verify/obj"))
+	require.Equal(t, []int64{0, 512, 512}, storage.requests)
+}
+
+func TestStreamService_PersistentCorruptionFails(t *testing.T) {
+	mock := s3.NewMockClient()
+	storage := &corruptingStorage{MockClient: mock, corrupt: map[int64]int{0: 100}}
+	ss := newTestStream(storage, newMemSink())
+	content := patterned(256, 3)
+	mock.PutObject("obj", int64(len(content)), content)
+	file := TransferFile{ID: "f", ObjectKey: "obj", Path: "obj", Size: 256, Segments: []TransferSegment{
+		{ObjectKey: "obj", Size: 256, SHA256: sha256Hex(content)},
+	}}
+
+	done := make(chan error, 1)
+	ss.Start(context.Background(), "dl-corrupt", []TransferFile{file}, 0, nil, func(err error) { done <- err })
+	select {
+	case err := <-done:
+		require.True(t, errors.As(err, &derr.ChunkCorruptedError{}))
+		var te *TransferError
+		require.True(t, errors.As(err, &te))
+		require.Equal(t, "f", te.FileID)
+	case <-time.After(5 * time.Second):
+		t.Fatal("transfer did not finish")
+	}
+}
+
+func TestDownloadService_VerifyDownload(t *testing.T) {
+	repo := newMemDownloadRepo()
+	fileRepo := newMemDownloadFileRepo()
+	storage := s3.NewMockClient()
+	svc := NewDownloadService(nil, nil, repo, fileRepo, newMemDownloadEventRepo(), NewStreamService(storage, nil), NewFileService(storage), mockLibrary{owned: true}, logger.New())
+	svc.defaultSpeed = 0
+
+	userID := "a1000000-0000-0000-0000-000000000003"
+	gameID := "a1000000-0000-0000-0000-000000000004"
+	content := patterned(4096, 7)
+	m := putChunkedWholeFile(t, storage, gameID, "bin/game.bin", content, 1024)
+
+	d, err := svc.StartDownload(context.Background(), userID, gameID)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		got, _ := repo.GetByID(context.Background(), d.ID)
+		return got != nil && got.Status == models.StatusCompleted
+	}, 5*time.Second, 10*time.Millisecond)
+
+	report, err := svc.VerifyDownload(context.Background(), userID, d.ID)
+	require.NoError(t, err)
+	require.True(t, report.Verified)
+	files, _ := fileRepo.ListByDownload(context.Background(), d.ID)
+	require.Equal(t, models.StatusVerified, files[0].Status)
+
+	corrupt := append([]byte(nil), content...)
+	corrupt[3000] ^= 0x01
+	storage.PutObject(m.Files[0].objectKey(gameID), int64(len(corrupt)), corrupt)
+
+	report, err = svc.VerifyDownload(context.Background(), userID, d.ID)
+	require.NoError(t, err)
+	require.False(t, report.Verified)
+	require.Len(t, report.Files, 1)
+	require.Equal(t, files[0].ID, report.Files[0].FileID)
+	require.Equal(t, []ChunkFailure{{Index: 2, Offset: 2048, Size: 1024, Reason: ChunkMismatch}}, report.Files[0].FailedChunks)
+	files, _ = fileRepo.ListByDownload(context.Background(), d.ID)
+	require.Equal(t, models.StatusCorrupted, files[0].Status)
+
+	_, err = svc.VerifyDownload(context.Background(), "a1000000-0000-0000-0000-000000000005", d.ID)
+	require.True(t, errors.As(err, &derr.AccessDeniedError{}))
+}
+
+func TestDownloadService_VerifyDownloadRepairsStagedChunks(t *testing.T) {
+	repo := newMemDownloadRepo()
+	fileRepo := newMemDownloadFileRepo()
+	mock := s3.NewMockClient()
+	storage := &corruptingStorage{MockClient: mock}
+	root := t.TempDir()
+	svc := NewDownloadService(nil, nil, repo, fileRepo, newMemDownloadEventRepo(), NewStreamService(storage, DirSink{Root: root}), NewFileService(storage), mockLibrary{owned: true}, logger.New())
+	svc.defaultSpeed = 0
+
+	userID := "a1000000-0000-0000-0000-000000000006"
+	gameID := "a1000000-0000-0000-0000-000000000007"
+	content := patterned(4096, 4)
+	putChunkedWholeFile(t, mock, gameID, "bin/game.bin", content, 1024)
+
+	d, err := svc.StartDownload(context.Background(), userID, gameID)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		got, _ := repo.GetByID(context.Background(), d.ID)
+		return got != nil && got.Status == models.StatusCompleted
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// The stored build is intact; only the staged copy is damaged.
+	staged := filepath.Join(root, d.ID, "bin", "game.bin")
+	corrupt := append([]byte(nil), content...)
+	corrupt[3000] ^= 0x01
+	require.NoError(t, os.WriteFile(staged, corrupt, 0o644))
+	storage.mu.Lock()
+	storage.requests = nil
+	storage.mu.Unlock()
+
+	report, err := svc.VerifyDownload(context.Background(), userID, d.ID)
+	require.NoError(t, err)
+	require.False(t, report.Verified)
+	require.Equal(t, []ChunkFailure{{Index: 2, Offset: 2048, Size: 1024, Reason: ChunkMismatch}}, report.Files[0].FailedChunks)
+	require.True(t, report.Files[0].Repairing)
+
+	require.Eventually(t, func() bool {
+		files, _ := fileRepo.ListByDownload(context.Background(), d.ID)
+		return files[0].Status == models.StatusVerified
+	}, 5*time.Second, 10*time.Millisecond)
+	got, err := os.ReadFile(staged)
+	require.NoError(t, err)
+	require.Equal(t, content, got)
+	storage.mu.Lock()
+	// Manifests are read at offset 0; of the build only the bad chunk is fetched again.
+	require.Contains(t, storage.requests, int64(2048))
+	require.NotContains(t, storage.requests, int64(1024))
+	require.NotContains(t, storage.requests, int64(3072))
+	storage.mu.Unlock()
+
+	report, err = svc.VerifyDownload(context.Background(), userID, d.ID)
+	require.NoError(t, err)
+	require.True(t, report.Verified)
+	require.Equal(t, report.Files[0].ExpectedSHA256, report.Files[0].ActualSHA256)
+}
+
+func TestDownloadService_HeartbeatKeepsRepairRunning(t *testing.T) {
+	repo := newMemDownloadRepo()
+	fileRepo := newMemDownloadFileRepo()
+	storage := s3.NewMockClient()
+	root := t.TempDir()
+	svc := NewDownloadService(nil, nil, repo, fileRepo, newMemDownloadEventRepo(), NewStreamService(storage, DirSink{Root: root}), NewFileService(storage), mockLibrary{owned: true}, logger.New())
+	svc.defaultSpeed = 0
+
+	userID := "a1000000-0000-0000-0000-000000000008"
+	gameID := "a1000000-0000-0000-0000-000000000009"
+	content := patterned(4096, 5)
+	putChunkedWholeFile(t, storage, gameID, "bin/game.bin", content, 1024)
+
+	d, err := svc.StartDownload(context.Background(), userID, gameID)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		got, _ := repo.GetByID(context.Background(), d.ID)
+		return got != nil && got.Status == models.StatusCompleted && !svc.stream.Active(d.ID)
+	}, 5*time.Second, 10*time.Millisecond)
+
+	staged := filepath.Join(root, d.ID, "bin", "game.bin")
+	corrupt := append([]byte(nil), content...)
+	corrupt[3000] ^= 0x01
+	require.NoError(t, os.WriteFile(staged, corrupt, 0o644))
+
+	// Throttle the repair so it is still running when the heartbeat comes.
+	svc.defaultSpeed = 1
+	report, err := svc.VerifyDownload(context.Background(), userID, d.ID)
+	require.NoError(t, err)
+	require.True(t, report.Files[0].Repairing)
+	require.True(t, svc.stream.Active(d.ID))
+	got, _ := repo.GetByID(context.Background(), d.ID)
+	require.Equal(t, svc.instanceID, got.LeaseOwner)
+
+	svc.heartbeat(context.Background())
+	require.True(t, svc.stream.Active(d.ID), "a repair of a completed download survives the status reconciliation")
+
+	// A stopped repair leaves the file corrupted and gives the lease back.
+	svc.stream.Stop(d.ID)
+	require.Eventually(t, func() bool { return !svc.stream.Active(d.ID) }, 5*time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool {
+		got, _ := repo.GetByID(context.Background(), d.ID)
+		return got.LeaseOwner == ""
+	}, 5*time.Second, 10*time.Millisecond)
+	files, _ := fileRepo.ListByDownload(context.Background(), d.ID)
+	require.Equal(t, models.StatusCorrupted, files[0].Status)
+}
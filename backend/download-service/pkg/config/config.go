@@ -1,6 +1,8 @@
 package config
 
 import (
+    "crypto/ed25519"
+    "encoding/base64"
     "fmt"
     "log"
     "os"
@@ -23,19 +25,73 @@ type Config struct {
     LibraryCBCooldownMs    int
     LibraryInternalHeader  string
     LibraryInternalToken   string
+    LibraryCacheEnabled    bool
+    LibraryCacheOwnedSec   int // how long "owned" answers are cached
+    LibraryCacheDeniedSec  int // how long "not owned" answers are cached
+    LibraryCacheStaleSec   int // how long past its lifetime "owned" is served while the circuit is open
+    InternalWebhookToken   string // expected in LibraryInternalHeader on /internal routes
+    EntitlementCacheTTLSec int    // how long an ownership re-check is trusted
     // Auth & Rate limiting
     AuthJwtEnabled bool
     AuthJwtSecret  string
     AuthJwtIssuer  string
     AuthJwtAudience string
+    AuthJwksURL            string // public keys of the token issuer; enables RS256/ES256 tokens
+    AuthJwksFile           string // local alternative to AuthJwksURL, e.g. for tests
+    AuthJwksRefreshSec     int
+    AuthJwtAlgorithms      string // comma-separated accepted algorithms; empty accepts those of the configured keys
+    AuthDevTrustUserHeader bool   // trust X-User-Id when no secret or JWKS is set; never in production
+    AuthJwtRolesClaim      string // token claim listing the user's roles
+    AuthAdminRoles         string // comma-separated roles granted the admin API
+    AuthPublisherRoles     string // comma-separated roles granted the build publishing API
+    AuthJwtGamesClaim      string // token claim listing the games a publisher may publish builds of
     RateLimitRPS   int
     RateLimitBurst int
+    RateLimitBackend string // "memory" (per replica) or "redis" (shared)
+    RateLimitClasses string // "name:rps:burst,..." quotas of route classes
     // S3 Storage
     S3Endpoint        string
     S3Region          string
     S3AccessKeyID     string
     S3SecretAccessKey string
     S3Bucket          string
+    StorageOrigins            string // "name:region:bucket:weight[:endpoint],..." replicas of the bucket; empty uses S3_BUCKET alone
+    StorageOriginCBThreshold  int    // consecutive failures that take an origin out of rotation
+    StorageOriginCBCooldownMs int
+    // Storage backend
+    StorageBackend       string // "s3" or "fs" (local filesystem)
+    StorageFSRoot        string // directory holding the objects of the fs backend
+    StorageFSSigningKey  string // signs object URLs of the fs backend; at least 32 bytes
+    StoragePublicBaseURL string // public URL of this service for fs object URLs; empty yields relative URLs
+    // Download URLs
+    DownloadURLSigner  string // "storage" (presigned bucket URLs) or "cdn"
+    DownloadURLTTLSec  int    // lifetime of download URLs
+    DownloadURLTTLs    string // "maxBytes:seconds,...,*:seconds" lifetimes by game size; overrides DownloadURLTTLSec
+    CDNBaseURL         string
+    CDNSigningKey      string // shared with the CDN's token authentication; at least 32 bytes
+    CDNPathPrefix      string // path the CDN maps to the bucket
+    CDNSignDirectory   bool   // sign the build directory, so one token covers its files
+    // Build publishing
+    PublishUploadStaleSec int // unfinished build uploads older than this are aborted
+    // Transfer engine
+    DownloadStagingDir  string
+    InstanceID          string // lease owner name of this replica
+    DownloadLeaseTTLSec int
+    MaxActiveDownloads  int    // concurrent transfers per user; 0 disables the queue
+    NodeBandwidthBps    int64  // egress budget of this replica; 0 means unlimited
+    UserBandwidthBps    int64  // egress budget of one user on this replica; 0 means unlimited
+    OffPeakHours        string // "from-to" UTC hours off-peak scheduled downloads run in; empty keeps 2-8
+    // Download tokens
+    DownloadTokenSecret     string // signs HS256 download tokens; at least 32 bytes
+    DownloadTokenEd25519Key string // base64 Ed25519 seed or private key; signs EdDSA tokens instead of the secret
+    DownloadTokenTTLSec     int
+    DownloadEdgeBaseURL     string // public URL of the edge routes; empty yields relative URLs
+    // Subscription tiers
+    AuthJwtTierClaim  string
+    DefaultTier       string
+    DownloadTiers     string // "name:maxBytesPerSecond:maxActive:priority,..."; empty disables tiers
+    TierServiceURL    string // asked for the tier when the token carries none; empty disables it
+    TierInternalToken string
     // Logging
     LogLevel  string
     LogFormat string
@@ -58,6 +114,14 @@ func getint(key string, def int) int {
     return def
 }
 
+// defaultInstanceID identifies the replica by host name (the pod name on Kubernetes).
+func defaultInstanceID() string {
+    if h, err := os.Hostname(); err == nil && h != "" {
+        return h
+    }
+    return fmt.Sprintf("pid-%d", os.Getpid())
+}
+
 func Load() Config {
     cfg := Config{
         Env:         getenv("APP_ENV", "development"),
@@ -73,18 +137,72 @@ func Load() Config {
         LibraryCBCooldownMs:   getint("LIBRARY_CB_COOLDOWN_MS", 10000),
         LibraryInternalHeader: getenv("LIBRARY_INTERNAL_HEADER", "X-Internal-Token"),
         LibraryInternalToken:  getenv("LIBRARY_INTERNAL_TOKEN", ""),
+        LibraryCacheEnabled:   getenv("LIBRARY_CACHE_ENABLED", "true") == "true",
+        LibraryCacheOwnedSec:  getint("LIBRARY_CACHE_OWNED_SECONDS", 300),
+        LibraryCacheDeniedSec: getint("LIBRARY_CACHE_NOT_OWNED_SECONDS", 30),
+        LibraryCacheStaleSec:  getint("LIBRARY_CACHE_STALE_GRACE_SECONDS", 1800),
+        InternalWebhookToken:   getenv("INTERNAL_WEBHOOK_TOKEN", ""),
+        EntitlementCacheTTLSec: getint("ENTITLEMENT_CACHE_SECONDS", 30),
         AuthJwtEnabled: getenv("AUTH_JWT_ENABLED", "true") == "true",
         AuthJwtSecret:  getenv("AUTH_JWT_SECRET", ""),
         AuthJwtIssuer:  getenv("AUTH_JWT_ISSUER", ""),
         AuthJwtAudience: getenv("AUTH_JWT_AUDIENCE", ""),
+        AuthJwksURL:            getenv("AUTH_JWKS_URL", ""),
+        AuthJwksFile:           getenv("AUTH_JWKS_FILE", ""),
+        AuthJwksRefreshSec:     getint("AUTH_JWKS_REFRESH_SECONDS", 600),
+        AuthJwtAlgorithms:      getenv("AUTH_JWT_ALGORITHMS", ""),
+        AuthDevTrustUserHeader: getenv("AUTH_DEV_TRUST_USER_HEADER", "false") == "true",
+        AuthJwtRolesClaim:      getenv("AUTH_JWT_ROLES_CLAIM", "roles"),
+        AuthAdminRoles:         getenv("AUTH_ADMIN_ROLES", "admin,support"),
+        AuthPublisherRoles:     getenv("AUTH_PUBLISHER_ROLES", "publisher"),
+        AuthJwtGamesClaim:      getenv("AUTH_JWT_GAMES_CLAIM", "publisher_games"),
         RateLimitRPS:   getint("RATE_LIMIT_RPS", 5),
         RateLimitBurst: getint("RATE_LIMIT_BURST", 10),
+        RateLimitBackend: getenv("RATE_LIMIT_BACKEND", "memory"),
+        RateLimitClasses: getenv("RATE_LIMIT_CLASSES", "start:1:5,content:50:100,stream:1:5"),
         // S3
         S3Endpoint:        getenv("S3_ENDPOINT", ""),
         S3Region:          getenv("S3_REGION", "us-east-1"),
         S3AccessKeyID:     getenv("S3_ACCESS_KEY_ID", ""),
         S3SecretAccessKey: getenv("S3_SECRET_ACCESS_KEY", ""),
         S3Bucket:          getenv("S3_BUCKET", ""),
+        StorageOrigins:            getenv("STORAGE_ORIGINS", ""),
+        StorageOriginCBThreshold:  getint("STORAGE_ORIGIN_CB_THRESHOLD", 5),
+        StorageOriginCBCooldownMs: getint("STORAGE_ORIGIN_CB_COOLDOWN_MS", 10000),
+        // Storage backend
+        StorageBackend:       getenv("STORAGE_BACKEND", "s3"),
+        StorageFSRoot:        getenv("STORAGE_FS_ROOT", ""),
+        StorageFSSigningKey:  getenv("STORAGE_FS_SIGNING_KEY", ""),
+        StoragePublicBaseURL: getenv("STORAGE_PUBLIC_BASE_URL", ""),
+        // Download URLs
+        DownloadURLSigner: getenv("DOWNLOAD_URL_SIGNER", "storage"),
+        DownloadURLTTLSec: getint("DOWNLOAD_URL_TTL_SECONDS", 900),
+        DownloadURLTTLs:   getenv("DOWNLOAD_URL_TTLS", ""),
+        CDNBaseURL:        getenv("CDN_BASE_URL", ""),
+        CDNSigningKey:     getenv("CDN_SIGNING_KEY", ""),
+        CDNPathPrefix:     getenv("CDN_PATH_PREFIX", ""),
+        CDNSignDirectory:  getenv("CDN_SIGN_DIRECTORY", "false") == "true",
+        // Build publishing
+        PublishUploadStaleSec: getint("PUBLISH_UPLOAD_STALE_SECONDS", 86400),
+        // Transfer engine
+        DownloadStagingDir:  getenv("DOWNLOAD_STAGING_DIR", ""),
+        InstanceID:          getenv("INSTANCE_ID", defaultInstanceID()),
+        DownloadLeaseTTLSec: getint("DOWNLOAD_LEASE_TTL_SECONDS", 30),
+        MaxActiveDownloads:  getint("MAX_ACTIVE_DOWNLOADS_PER_USER", 3),
+        NodeBandwidthBps:    int64(getint("NODE_BANDWIDTH_BYTES_PER_SECOND", 0)),
+        UserBandwidthBps:    int64(getint("USER_BANDWIDTH_BYTES_PER_SECOND", 0)),
+        OffPeakHours:        getenv("OFF_PEAK_HOURS", "2-8"),
+        // Download tokens
+        DownloadTokenSecret:     getenv("DOWNLOAD_TOKEN_SECRET", ""),
+        DownloadTokenEd25519Key: getenv("DOWNLOAD_TOKEN_ED25519_KEY", ""),
+        DownloadTokenTTLSec:     getint("DOWNLOAD_TOKEN_TTL_SECONDS", 300),
+        DownloadEdgeBaseURL:     getenv("DOWNLOAD_EDGE_BASE_URL", ""),
+        // Subscription tiers
+        AuthJwtTierClaim:  getenv("AUTH_JWT_TIER_CLAIM", "tier"),
+        DefaultTier:       getenv("DEFAULT_TIER", "free"),
+        DownloadTiers:     getenv("DOWNLOAD_TIERS", ""),
+        TierServiceURL:    getenv("TIER_SERVICE_URL", ""),
+        TierInternalToken: getenv("TIER_INTERNAL_TOKEN", ""),
         // Logging
         LogLevel:  getenv("LOG_LEVEL", "info"),
         LogFormat: getenv("LOG_FORMAT", "json"),
@@ -117,14 +235,55 @@ func (c *Config) Validate() error {
         if c.DatabaseURL == "" {
             errors = append(errors, "DATABASE_URL is required in production")
         }
-        if c.AuthJwtEnabled && c.AuthJwtSecret == "" {
-            errors = append(errors, "AUTH_JWT_SECRET is required when JWT auth is enabled in production")
+        if c.AuthJwtEnabled && c.AuthJwtSecret == "" && c.AuthJwksURL == "" && c.AuthJwksFile == "" {
+            errors = append(errors, "AUTH_JWT_SECRET or AUTH_JWKS_URL is required when JWT auth is enabled in production")
+        }
+        if c.AuthDevTrustUserHeader {
+            errors = append(errors, "AUTH_DEV_TRUST_USER_HEADER must not be enabled in production")
         }
-        if c.S3Endpoint == "" || c.S3AccessKeyID == "" || c.S3SecretAccessKey == "" || c.S3Bucket == "" {
-            errors = append(errors, "S3 configuration (endpoint, access key, secret key, bucket) is required in production")
+        if c.StorageBackend != "fs" && (c.S3AccessKeyID == "" || c.S3SecretAccessKey == "" || (c.StorageOrigins == "" && (c.S3Endpoint == "" || c.S3Bucket == ""))) {
+            errors = append(errors, "S3 configuration (access key, secret key, and endpoint and bucket or STORAGE_ORIGINS) is required in production")
         }
     }
     
+    // Validate storage backend
+    if c.StorageBackend != "" && !contains([]string{"s3", "fs"}, c.StorageBackend) {
+        errors = append(errors, fmt.Sprintf("invalid STORAGE_BACKEND: %s, must be s3 or fs", c.StorageBackend))
+    }
+    if _, err := ParseOrigins(c.StorageOrigins); err != nil {
+        errors = append(errors, err.Error())
+    }
+    if c.StorageOriginCBThreshold < 0 || c.StorageOriginCBCooldownMs < 0 {
+        errors = append(errors, "STORAGE_ORIGIN_CB_THRESHOLD and STORAGE_ORIGIN_CB_COOLDOWN_MS must be non-negative")
+    }
+    if c.StorageBackend == "fs" {
+        if c.StorageFSRoot == "" {
+            errors = append(errors, "STORAGE_FS_ROOT is required with the fs storage backend")
+        }
+        if len(c.StorageFSSigningKey) < 32 {
+            errors = append(errors, "STORAGE_FS_SIGNING_KEY of at least 32 bytes is required with the fs storage backend")
+        }
+    }
+    
+    // Validate download URLs
+    if c.DownloadURLSigner != "" && !contains([]string{"storage", "cdn"}, c.DownloadURLSigner) {
+        errors = append(errors, fmt.Sprintf("invalid DOWNLOAD_URL_SIGNER: %s, must be storage or cdn", c.DownloadURLSigner))
+    }
+    if c.DownloadURLSigner == "cdn" {
+        if c.CDNBaseURL == "" {
+            errors = append(errors, "CDN_BASE_URL is required with the cdn URL signer")
+        }
+        if len(c.CDNSigningKey) < 32 {
+            errors = append(errors, "CDN_SIGNING_KEY of at least 32 bytes is required with the cdn URL signer")
+        }
+    }
+    if c.DownloadURLTTLSec < 0 || c.DownloadURLTTLSec > 7*24*3600 {
+        errors = append(errors, "DOWNLOAD_URL_TTL_SECONDS must be between 0 and 604800 (0 uses the default)")
+    }
+    if _, err := ParseURLTTLs(c.DownloadURLTTLs); err != nil {
+        errors = append(errors, err.Error())
+    }
+    
     // Validate log level
     validLogLevels := []string{"debug", "info", "warn", "error", "fatal", "panic"}
     if !contains(validLogLevels, strings.ToLower(c.LogLevel)) {
@@ -137,6 +296,16 @@ func (c *Config) Validate() error {
         errors = append(errors, fmt.Sprintf("invalid LOG_FORMAT: %s, must be one of %v", c.LogFormat, validLogFormats))
     }
     
+    // Validate token verification
+    if c.AuthJwksURL != "" && c.AuthJwksFile != "" {
+        errors = append(errors, "set only one of AUTH_JWKS_URL and AUTH_JWKS_FILE")
+    }
+    for _, alg := range c.JwtAlgorithms() {
+        if !contains(supportedJwtAlgorithms, alg) {
+            errors = append(errors, fmt.Sprintf("unsupported AUTH_JWT_ALGORITHMS entry %s, must be one of %v", alg, supportedJwtAlgorithms))
+        }
+    }
+
     // Validate rate limiting
     if c.RateLimitRPS < 0 {
         errors = append(errors, "RATE_LIMIT_RPS must be non-negative")
@@ -144,6 +313,59 @@ func (c *Config) Validate() error {
     if c.RateLimitBurst < 0 {
         errors = append(errors, "RATE_LIMIT_BURST must be non-negative")
     }
+    if c.RateLimitBackend != "" && !contains([]string{"memory", "redis"}, c.RateLimitBackend) {
+        errors = append(errors, fmt.Sprintf("invalid RATE_LIMIT_BACKEND: %s, must be memory or redis", c.RateLimitBackend))
+    }
+    if _, err := ParseRateClasses(c.RateLimitClasses); err != nil {
+        errors = append(errors, err.Error())
+    }
+
+    // Validate download leases
+    if c.DownloadLeaseTTLSec != 0 && c.DownloadLeaseTTLSec < 3 {
+        errors = append(errors, "DOWNLOAD_LEASE_TTL_SECONDS must be at least 3 (0 uses the default)")
+    }
+    if c.MaxActiveDownloads < 0 {
+        errors = append(errors, "MAX_ACTIVE_DOWNLOADS_PER_USER must be non-negative")
+    }
+    if c.NodeBandwidthBps < 0 || c.UserBandwidthBps < 0 {
+        errors = append(errors, "NODE_BANDWIDTH_BYTES_PER_SECOND and USER_BANDWIDTH_BYTES_PER_SECOND must be non-negative")
+    }
+
+    if c.OffPeakHours != "" {
+        if _, _, err := ParseHours(c.OffPeakHours); err != nil {
+            errors = append(errors, err.Error())
+        }
+    }
+
+    if c.LibraryCacheOwnedSec < 0 || c.LibraryCacheDeniedSec < 0 || c.LibraryCacheStaleSec < 0 {
+        errors = append(errors, "LIBRARY_CACHE_*_SECONDS must be non-negative (0 uses the default)")
+    } else if c.LibraryCacheOwnedSec > 0 && c.LibraryCacheDeniedSec > c.LibraryCacheOwnedSec {
+        errors = append(errors, "LIBRARY_CACHE_NOT_OWNED_SECONDS must not exceed LIBRARY_CACHE_OWNED_SECONDS")
+    }
+    if c.EntitlementCacheTTLSec < 0 || c.EntitlementCacheTTLSec > 300 {
+        errors = append(errors, "ENTITLEMENT_CACHE_SECONDS must be between 0 and 300 (0 uses the default)")
+    }
+    if c.PublishUploadStaleSec < 0 {
+        errors = append(errors, "PUBLISH_UPLOAD_STALE_SECONDS must be non-negative (0 uses the default)")
+    }
+
+    // Validate download tokens
+    if c.DownloadTokenSecret != "" && len(c.DownloadTokenSecret) < 32 {
+        errors = append(errors, "DOWNLOAD_TOKEN_SECRET must be at least 32 bytes")
+    }
+    if _, err := ParseEd25519Key(c.DownloadTokenEd25519Key); err != nil {
+        errors = append(errors, err.Error())
+    }
+    if c.DownloadTokenTTLSec < 0 || c.DownloadTokenTTLSec > 3600 {
+        errors = append(errors, "DOWNLOAD_TOKEN_TTL_SECONDS must be between 0 and 3600 (0 uses the default)")
+    }
+
+    // Validate subscription tiers
+    if tiers, err := ParseTiers(c.DownloadTiers); err != nil {
+        errors = append(errors, err.Error())
+    } else if len(tiers) > 0 && !hasTier(tiers, c.DefaultTier) {
+        errors = append(errors, fmt.Sprintf("DEFAULT_TIER %q is not defined in DOWNLOAD_TIERS", c.DefaultTier))
+    }
     
     if len(errors) > 0 {
         return fmt.Errorf("configuration errors: %s", strings.Join(errors, "; "))
@@ -152,6 +374,201 @@ func (c *Config) Validate() error {
     return nil
 }
 
+var supportedJwtAlgorithms = []string{"HS256", "HS384", "HS512", "RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+// JwtAlgorithms returns the entries of AUTH_JWT_ALGORITHMS.
+func (c *Config) JwtAlgorithms() []string { return splitList(c.AuthJwtAlgorithms) }
+
+// AdminRoles returns the entries of AUTH_ADMIN_ROLES.
+func (c *Config) AdminRoles() []string { return splitList(c.AuthAdminRoles) }
+
+// PublisherRoles returns the entries of AUTH_PUBLISHER_ROLES.
+func (c *Config) PublisherRoles() []string { return splitList(c.AuthPublisherRoles) }
+
+func splitList(spec string) []string {
+    var out []string
+    for _, v := range strings.Split(spec, ",") {
+        if v = strings.TrimSpace(v); v != "" {
+            out = append(out, v)
+        }
+    }
+    return out
+}
+
+// ParseEd25519Key decodes DOWNLOAD_TOKEN_ED25519_KEY, a base64 32-byte seed or
+// 64-byte private key. An empty spec yields a nil key.
+func ParseEd25519Key(spec string) (ed25519.PrivateKey, error) {
+    if spec == "" {
+        return nil, nil
+    }
+    raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(spec))
+    if err != nil {
+        return nil, fmt.Errorf("invalid DOWNLOAD_TOKEN_ED25519_KEY: not base64")
+    }
+    switch len(raw) {
+    case ed25519.SeedSize:
+        return ed25519.NewKeyFromSeed(raw), nil
+    case ed25519.PrivateKeySize:
+        return ed25519.PrivateKey(raw), nil
+    }
+    return nil, fmt.Errorf("invalid DOWNLOAD_TOKEN_ED25519_KEY: want a %d-byte seed or %d-byte key, got %d bytes", ed25519.SeedSize, ed25519.PrivateKeySize, len(raw))
+}
+
+// Tier is what a subscription tier entitles its users to.
+type Tier struct {
+    Name              string
+    MaxBytesPerSecond int64 // 0 means no ceiling
+    MaxActive         int   // 0 uses MAX_ACTIVE_DOWNLOADS_PER_USER
+    Priority          int   // 0-100, given to new downloads
+}
+
+// ParseTiers parses DOWNLOAD_TIERS, e.g. "free:5242880:2:0,premium:0:5:50".
+func ParseTiers(spec string) ([]Tier, error) {
+    var tiers []Tier
+    for _, entry := range strings.Split(spec, ",") {
+        entry = strings.TrimSpace(entry)
+        if entry == "" {
+            continue
+        }
+        parts := strings.Split(entry, ":")
+        if len(parts) != 4 || parts[0] == "" {
+            return nil, fmt.Errorf("invalid DOWNLOAD_TIERS entry %q, want name:maxBytesPerSecond:maxActive:priority", entry)
+        }
+        bps, err1 := strconv.ParseInt(parts[1], 10, 64)
+        active, err2 := strconv.Atoi(parts[2])
+        priority, err3 := strconv.Atoi(parts[3])
+        if err1 != nil || err2 != nil || err3 != nil || bps < 0 || active < 0 || priority < 0 || priority > 100 {
+            return nil, fmt.Errorf("invalid DOWNLOAD_TIERS entry %q: limits must be non-negative and priority at most 100", entry)
+        }
+        tiers = append(tiers, Tier{Name: parts[0], MaxBytesPerSecond: bps, MaxActive: active, Priority: priority})
+    }
+    return tiers, nil
+}
+
+func hasTier(tiers []Tier, name string) bool {
+    for _, t := range tiers {
+        if t.Name == name {
+            return true
+        }
+    }
+    return false
+}
+
+// StorageOrigin is one bucket replica of the S3 storage backend.
+type StorageOrigin struct {
+    Name     string
+    Region   string
+    Bucket   string
+    Weight   int
+    Endpoint string // empty uses S3_ENDPOINT
+}
+
+// ParseOrigins parses STORAGE_ORIGINS, e.g.
+// "eu:eu-central-1:games-eu:3,us:us-east-1:games-us:1:https://minio.us.internal:9000".
+// The endpoint is last so it may contain colons.
+func ParseOrigins(spec string) ([]StorageOrigin, error) {
+    var origins []StorageOrigin
+    seen := make(map[string]bool)
+    for _, entry := range strings.Split(spec, ",") {
+        entry = strings.TrimSpace(entry)
+        if entry == "" {
+            continue
+        }
+        parts := strings.SplitN(entry, ":", 5)
+        if len(parts) < 4 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+            return nil, fmt.Errorf("invalid STORAGE_ORIGINS entry %q, want name:region:bucket:weight[:endpoint]", entry)
+        }
+        weight, err := strconv.Atoi(parts[3])
+        if err != nil || weight < 1 {
+            return nil, fmt.Errorf("invalid STORAGE_ORIGINS entry %q: weight must be a positive integer", entry)
+        }
+        if seen[parts[0]] {
+            return nil, fmt.Errorf("duplicate STORAGE_ORIGINS name %q", parts[0])
+        }
+        seen[parts[0]] = true
+        o := StorageOrigin{Name: parts[0], Region: parts[1], Bucket: parts[2], Weight: weight}
+        if len(parts) == 5 {
+            o.Endpoint = parts[4]
+        }
+        origins = append(origins, o)
+    }
+    return origins, nil
+}
+
+// URLTTL is the lifetime of download URLs for games of up to MaxSize bytes.
+type URLTTL struct {
+    MaxSize int64 // 0 means any size
+    Seconds int
+}
+
+// ParseURLTTLs parses DOWNLOAD_URL_TTLS, e.g. "1073741824:900,10737418240:3600,*:14400".
+func ParseURLTTLs(spec string) ([]URLTTL, error) {
+    var ttls []URLTTL
+    for _, entry := range strings.Split(spec, ",") {
+        entry = strings.TrimSpace(entry)
+        if entry == "" {
+            continue
+        }
+        size, secs, ok := strings.Cut(entry, ":")
+        if !ok {
+            return nil, fmt.Errorf("invalid DOWNLOAD_URL_TTLS entry %q, want maxBytes:seconds or *:seconds", entry)
+        }
+        var t URLTTL
+        var err error
+        if size != "*" {
+            if t.MaxSize, err = strconv.ParseInt(size, 10, 64); err != nil || t.MaxSize <= 0 {
+                return nil, fmt.Errorf("invalid DOWNLOAD_URL_TTLS entry %q: size must be positive or *", entry)
+            }
+        }
+        if t.Seconds, err = strconv.Atoi(secs); err != nil || t.Seconds <= 0 || t.Seconds > 7*24*3600 {
+            return nil, fmt.Errorf("invalid DOWNLOAD_URL_TTLS entry %q: seconds must be between 1 and 604800", entry)
+        }
+        ttls = append(ttls, t)
+    }
+    return ttls, nil
+}
+
+// RateClass is the quota of a class of routes.
+type RateClass struct {
+    Name  string
+    RPS   float64
+    Burst int
+}
+
+// ParseRateClasses parses RATE_LIMIT_CLASSES, e.g. "start:1:5,content:50:100".
+func ParseRateClasses(spec string) ([]RateClass, error) {
+    var classes []RateClass
+    for _, entry := range strings.Split(spec, ",") {
+        entry = strings.TrimSpace(entry)
+        if entry == "" {
+            continue
+        }
+        parts := strings.Split(entry, ":")
+        if len(parts) != 3 || parts[0] == "" {
+            return nil, fmt.Errorf("invalid RATE_LIMIT_CLASSES entry %q, want name:rps:burst", entry)
+        }
+        rps, err1 := strconv.ParseFloat(parts[1], 64)
+        burst, err2 := strconv.Atoi(parts[2])
+        if err1 != nil || err2 != nil || rps <= 0 || burst <= 0 {
+            return nil, fmt.Errorf("invalid RATE_LIMIT_CLASSES entry %q: rps and burst must be positive", entry)
+        }
+        classes = append(classes, RateClass{Name: parts[0], RPS: rps, Burst: burst})
+    }
+    return classes, nil
+}
+
+// ParseHours parses OFF_PEAK_HOURS, e.g. "22-6"; the span wraps past midnight
+// when from is after to.
+func ParseHours(spec string) (from, to int, err error) {
+    f, t, ok := strings.Cut(spec, "-")
+    from, err1 := strconv.Atoi(strings.TrimSpace(f))
+    to, err2 := strconv.Atoi(strings.TrimSpace(t))
+    if !ok || err1 != nil || err2 != nil || from < 0 || from > 23 || to < 0 || to > 24 || from == to {
+        return 0, 0, fmt.Errorf("invalid OFF_PEAK_HOURS %q, want from-to hours such as 2-8", spec)
+    }
+    return from, to, nil
+}
+
 // contains checks if a slice contains a string
 func contains(slice []string, item string) bool {
     for _, s := range slice {
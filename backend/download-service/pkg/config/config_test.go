@@ -1,6 +1,8 @@
 package config
 
 import (
+	"crypto/ed25519"
+	"encoding/base64"
 	"os"
 	"testing"
 )
@@ -91,6 +93,102 @@ func TestConfig_Validate(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "production with JWKS and no secret",
+			config: Config{
+				Env:               "production",
+				Port:              8080,
+				DatabaseURL:       "postgres://localhost/test",
+				AuthJwtEnabled:    true,
+				AuthJwksURL:       "https://auth.example.com/.well-known/jwks.json",
+				AuthJwtAlgorithms: "RS256,ES256",
+				S3Endpoint:        "https://s3.amazonaws.com",
+				S3AccessKeyID:     "key",
+				S3SecretAccessKey: "secret",
+				S3Bucket:          "bucket",
+				LogLevel:          "info",
+				LogFormat:         "json",
+			},
+			wantErr: false,
+		},
+		{
+			name: "production trusting the user header",
+			config: Config{
+				Env:                    "production",
+				Port:                   8080,
+				DatabaseURL:            "postgres://localhost/test",
+				AuthJwtEnabled:         true,
+				AuthJwtSecret:          "secret",
+				AuthDevTrustUserHeader: true,
+				S3Endpoint:             "https://s3.amazonaws.com",
+				S3AccessKeyID:          "key",
+				S3SecretAccessKey:      "secret",
+				S3Bucket:               "bucket",
+				LogLevel:               "info",
+				LogFormat:              "json",
+			},
+			wantErr: true,
+		},
+		{
+			name: "unsupported JWT algorithm",
+			config: Config{
+				Env:               "development",
+				Port:              8080,
+				AuthJwtAlgorithms: "none",
+				LogLevel:          "info",
+				LogFormat:         "json",
+			},
+			wantErr: true,
+		},
+		{
+			name: "production on filesystem storage",
+			config: Config{
+				Env:                 "production",
+				Port:                8080,
+				DatabaseURL:         "postgres://localhost/test",
+				AuthJwtEnabled:      false,
+				StorageBackend:      "fs",
+				StorageFSRoot:       "/var/lib/downloads",
+				StorageFSSigningKey: "0123456789abcdef0123456789abcdef",
+				LogLevel:            "info",
+				LogFormat:           "json",
+			},
+			wantErr: false,
+		},
+		{
+			name: "filesystem storage without signing key",
+			config: Config{
+				Env:            "development",
+				Port:           8080,
+				StorageBackend: "fs",
+				StorageFSRoot:  "/var/lib/downloads",
+				LogLevel:       "info",
+				LogFormat:      "json",
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown storage backend",
+			config: Config{
+				Env:            "development",
+				Port:           8080,
+				StorageBackend: "gcs",
+				LogLevel:       "info",
+				LogFormat:      "json",
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative publish upload stale age",
+			config: Config{
+				Env:                   "development",
+				Port:                  8080,
+				PublishUploadStaleSec: -1,
+				LogLevel:              "info",
+				LogFormat:             "json",
+			},
+			wantErr: true,
+		},
 		{
 			name: "production missing S3 config",
 			config: Config{
@@ -199,4 +297,150 @@ func TestGetint(t *testing.T) {
 	if result != 789 {
 		t.Errorf("Expected 789 (default), got %d", result)
 	}
-}
\ No newline at end of file
+}
+
+func TestParseTiers(t *testing.T) {
+	tiers, err := ParseTiers("free:5242880:2:0, premium:0:5:50")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []Tier{
+		{Name: "free", MaxBytesPerSecond: 5242880, MaxActive: 2, Priority: 0},
+		{Name: "premium", MaxBytesPerSecond: 0, MaxActive: 5, Priority: 50},
+	}
+	if len(tiers) != len(want) {
+		t.Fatalf("Expected %d tiers, got %d", len(want), len(tiers))
+	}
+	for i := range want {
+		if tiers[i] != want[i] {
+			t.Errorf("tier %d: expected %+v, got %+v", i, want[i], tiers[i])
+		}
+	}
+
+	if tiers, err := ParseTiers(""); err != nil || len(tiers) != 0 {
+		t.Errorf("Expected no tiers for an empty spec, got %v, %v", tiers, err)
+	}
+	for _, bad := range []string{"free", "free:1:2", "free:-1:2:0", "free:1:2:101", ":1:2:3"} {
+		if _, err := ParseTiers(bad); err == nil {
+			t.Errorf("Expected error for %q", bad)
+		}
+	}
+
+	c := Config{Env: "development", Port: 8080, LogLevel: "info", LogFormat: "json", DownloadTiers: "premium:0:5:50", DefaultTier: "free"}
+	if err := c.Validate(); err == nil {
+		t.Error("Expected error for a default tier missing from DOWNLOAD_TIERS")
+	}
+	c.DefaultTier = "premium"
+	if err := c.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestParseHours(t *testing.T) {
+	from, to, err := ParseHours("22-6")
+	if err != nil || from != 22 || to != 6 {
+		t.Errorf("Expected 22-6, got %d-%d, %v", from, to, err)
+	}
+	for _, bad := range []string{"", "22", "3-3", "24-2", "1-25", "a-b"} {
+		if _, _, err := ParseHours(bad); err == nil {
+			t.Errorf("Expected error for %q", bad)
+		}
+	}
+}
+
+func TestParseOrigins(t *testing.T) {
+	origins, err := ParseOrigins("eu:eu-central-1:games-eu:3, us:us-east-1:games-us:1:https://minio.us.internal:9000")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []StorageOrigin{
+		{Name: "eu", Region: "eu-central-1", Bucket: "games-eu", Weight: 3},
+		{Name: "us", Region: "us-east-1", Bucket: "games-us", Weight: 1, Endpoint: "https://minio.us.internal:9000"},
+	}
+	if len(origins) != len(want) {
+		t.Fatalf("Expected %d origins, got %d", len(want), len(origins))
+	}
+	for i := range want {
+		if origins[i] != want[i] {
+			t.Errorf("origin %d: expected %+v, got %+v", i, want[i], origins[i])
+		}
+	}
+
+	for _, bad := range []string{"eu", "eu:eu-central-1:games-eu", "eu:eu-central-1:games-eu:0", ":r:b:1", "eu:r:b:1,eu:r2:b2:1"} {
+		if _, err := ParseOrigins(bad); err == nil {
+			t.Errorf("Expected error for %q", bad)
+		}
+	}
+}
+
+func TestParseURLTTLs(t *testing.T) {
+	ttls, err := ParseURLTTLs("1073741824:900, *:14400")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []URLTTL{{MaxSize: 1073741824, Seconds: 900}, {MaxSize: 0, Seconds: 14400}}
+	if len(ttls) != len(want) || ttls[0] != want[0] || ttls[1] != want[1] {
+		t.Errorf("Expected %+v, got %+v", want, ttls)
+	}
+
+	for _, bad := range []string{"900", "0:900", "-1:900", "1024:0", "*:999999999", "x:60"} {
+		if _, err := ParseURLTTLs(bad); err == nil {
+			t.Errorf("Expected error for %q", bad)
+		}
+	}
+
+	c := Config{Env: "development", Port: 8080, LogLevel: "info", LogFormat: "json", DownloadURLSigner: "cdn", CDNBaseURL: "https://cdn.example.com"}
+	if err := c.Validate(); err == nil {
+		t.Error("Expected error for the cdn signer without a signing key")
+	}
+	c.CDNSigningKey = "0123456789abcdef0123456789abcdef"
+	if err := c.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestParseRateClasses(t *testing.T) {
+	classes, err := ParseRateClasses("start:1:5, content:0.5:100")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []RateClass{{Name: "start", RPS: 1, Burst: 5}, {Name: "content", RPS: 0.5, Burst: 100}}
+	if len(classes) != len(want) || classes[0] != want[0] || classes[1] != want[1] {
+		t.Errorf("Expected %+v, got %+v", want, classes)
+	}
+	for _, bad := range []string{"start", "start:1", "start:0:5", "start:1:0", ":1:5"} {
+		if _, err := ParseRateClasses(bad); err == nil {
+			t.Errorf("Expected error for %q", bad)
+		}
+	}
+
+	c := Config{Env: "development", Port: 8080, LogLevel: "info", LogFormat: "json", RateLimitBackend: "memcached"}
+	if err := c.Validate(); err == nil {
+		t.Error("Expected error for an unknown RATE_LIMIT_BACKEND")
+	}
+}
+
+func TestParseEd25519Key(t *testing.T) {
+	seed := make([]byte, ed25519.SeedSize)
+	key, err := ParseEd25519Key(base64.StdEncoding.EncodeToString(seed))
+	if err != nil || !key.Equal(ed25519.NewKeyFromSeed(seed)) {
+		t.Fatalf("Expected the key of the seed, got %v", err)
+	}
+	full, err := ParseEd25519Key(base64.StdEncoding.EncodeToString(key))
+	if err != nil || !full.Equal(key) {
+		t.Errorf("Expected the 64-byte key back, got %v", err)
+	}
+	if key, err := ParseEd25519Key(""); err != nil || key != nil {
+		t.Errorf("Expected no key for an empty spec, got %v, %v", key, err)
+	}
+	for _, bad := range []string{"not base64!", base64.StdEncoding.EncodeToString([]byte("short"))} {
+		if _, err := ParseEd25519Key(bad); err == nil {
+			t.Errorf("Expected error for %q", bad)
+		}
+	}
+
+	c := Config{Env: "development", Port: 8080, LogLevel: "info", LogFormat: "json", DownloadTokenSecret: "too-short"}
+	if err := c.Validate(); err == nil {
+		t.Error("Expected error for a short DOWNLOAD_TOKEN_SECRET")
+	}
+}